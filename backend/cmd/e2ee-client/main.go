@@ -0,0 +1,107 @@
+// e2ee-client 端到端加密分享的命令行参考客户端
+//
+//	e2ee-client -server http://localhost:12345 -text "hello"
+//	e2ee-client -server http://localhost:12345 -file ./report.pdf
+//	e2ee-client -server http://localhost:12345 -fetch CODE -key KEY -out ./report.pdf
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/e2ee"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:12345", "服务端地址")
+	token := flag.String("token", "", "可选的登录令牌")
+	text := flag.String("text", "", "要加密分享的文本")
+	file := flag.String("file", "", "要加密分享的文件")
+	fetch := flag.String("fetch", "", "要下载解密的分享码")
+	key := flag.String("key", "", "分享链接 #k= 后的密钥")
+	out := flag.String("out", "", "解密后的输出文件，默认输出到标准输出")
+	expireValue := flag.Int("expire-value", 1, "过期数值")
+	expireStyle := flag.String("expire-style", "day", "过期方式")
+	flag.Parse()
+
+	client := e2ee.NewClient(*server)
+	client.Token = *token
+	ctx := context.Background()
+	opts := e2ee.ShareOptions{ExpireValue: *expireValue, ExpireStyle: *expireStyle}
+
+	var err error
+	switch {
+	case *text != "":
+		err = shareText(ctx, client, *text, opts)
+	case *file != "":
+		err = shareFile(ctx, client, *file, opts)
+	case *fetch != "":
+		err = fetchShare(ctx, client, *fetch, *key, *out)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func shareText(ctx context.Context, client *e2ee.Client, text string, opts e2ee.ShareOptions) error {
+	result, err := client.ShareText(ctx, text, opts)
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+func shareFile(ctx context.Context, client *e2ee.Client, path string, opts e2ee.ShareOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	result, err := client.UploadFile(ctx, filepath.Base(path), f, info.Size(), e2ee.DefaultChunkSize, opts)
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+func fetchShare(ctx context.Context, client *e2ee.Client, code, encodedKey, out string) error {
+	key, err := e2ee.DecodeKey(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	name, data, err := client.Fetch(ctx, code, key)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if name != "" {
+		fmt.Fprintf(os.Stderr, "原始文件名: %s\n", name)
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+func printResult(result *e2ee.Result) {
+	fmt.Printf("分享码: %s\n", result.Code)
+	fmt.Printf("密钥:   %s\n", e2ee.EncodeKey(result.Key))
+	fmt.Printf("链接:   %s\n", result.Link)
+}
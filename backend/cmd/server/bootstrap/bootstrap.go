@@ -4,16 +4,28 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/spf13/viper"
 	"github.com/zy84338719/fileCodeBox/backend/gen/http/router"
+	chunkService "github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	userService "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
 	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
 	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
 	previewPkg "github.com/zy84338719/fileCodeBox/backend/internal/preview"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/redis"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -31,14 +43,17 @@ func CORS() app.HandlerFunc {
 
 		// 设置 CORS 头
 		c.Header("Access-Control-Allow-Origin", origin)
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, HEAD, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, "+
+			"Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type, "+
+			"Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Checksum-Algorithm, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Share-Code, "+
+			"RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Max-Age", "86400") // 24小时
 
-		// 处理预检请求
-		if string(c.Method()) == "OPTIONS" {
+		// 处理预检请求；普通 OPTIONS 请求（如 tus 能力发现）交给路由处理
+		if string(c.Method()) == "OPTIONS" && len(c.GetHeader("Access-Control-Request-Method")) > 0 {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -62,12 +77,66 @@ func InitConfig(configPath string) (*Config, error) {
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.port", 12345)
 	v.SetDefault("server.mode", "debug")
+	v.SetDefault("server.trusted_proxies", []string{})
 	v.SetDefault("database.driver", "sqlite")
 	v.SetDefault("database.db_name", "./data/filecodebox.db")
 	// 用户配置默认值
 	v.SetDefault("user.allow_user_registration", true)
 	v.SetDefault("user.require_email_verify", false)
 	v.SetDefault("user.jwt_secret", "FileCodeBox2025JWT")
+	v.SetDefault("user.session_expiry_hours", 168)
+	v.SetDefault("user.max_sessions_per_user", 5)
+	v.SetDefault("user.access_token_minutes", 15)
+	v.SetDefault("user.user_upload_size", 52428800)
+	v.SetDefault("user.user_storage_quota", 1073741824)
+	v.SetDefault("user.two_factor.issuer", "FileCodeBox")
+	v.SetDefault("user.two_factor.required_roles", []string{})
+	v.SetDefault("upload.upload_size", 10485760)
+	v.SetDefault("upload.max_versions", 5)
+	v.SetDefault("upload.max_sessions_per_user", 10)
+	v.SetDefault("upload.max_sessions_per_ip", 5)
+	v.SetDefault("upload.session_ttl_hours", 24)
+	v.SetDefault("upload.session_gc_minutes", 30)
+	v.SetDefault("upload.anonymous.allow_file", true)
+	v.SetDefault("upload.anonymous.window_seconds", 600)
+	v.SetDefault("upload.anonymous.max_uploads", 10)
+	v.SetDefault("upload.anonymous.max_bytes", 104857600)
+	v.SetDefault("download.guard.enabled", true)
+	v.SetDefault("download.guard.window_seconds", 600)
+	v.SetDefault("download.guard.max_failures", 10)
+	v.SetDefault("download.guard.prefix_length", 3)
+	v.SetDefault("download.guard.max_prefix_failures", 5)
+	v.SetDefault("download.guard.max_global_prefix_failures", 50)
+	v.SetDefault("download.guard.block_seconds", 60)
+	v.SetDefault("download.guard.max_block_seconds", 86400)
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.policies.upload.requests_per_second", 10)
+	v.SetDefault("rate_limit.policies.upload.burst", 50)
+	v.SetDefault("rate_limit.policies.download.requests_per_second", 10)
+	v.SetDefault("rate_limit.policies.download.burst", 40)
+	v.SetDefault("rate_limit.policies.login.requests_per_second", 0.2)
+	v.SetDefault("rate_limit.policies.login.burst", 5)
+	v.SetDefault("rate_limit.policies.admin.requests_per_second", 20)
+	v.SetDefault("rate_limit.policies.admin.burst", 40)
+	v.SetDefault("rate_limit.policies.admin.key", "user")
+	v.SetDefault("mail.driver", "log")
+	v.SetDefault("mail.port", 587)
+	v.SetDefault("mail.dir", "./data/mail")
+	v.SetDefault("mail.base_url", "http://localhost:12345")
+	v.SetDefault("mail.verify_token_ttl_minutes", 1440)
+	v.SetDefault("mail.reset_token_ttl_minutes", 30)
+	v.SetDefault("oidc.disable_password_login", false)
+	v.SetDefault("oidc.skip_two_factor", false)
+	v.SetDefault("user.auth_providers", []string{"local"})
+	v.SetDefault("user.invite_quota", 0)
+	v.SetDefault("user.invitation_expire_hours", 168)
+	v.SetDefault("user.deletion_grace_days", 7)
+	v.SetDefault("user.deletion_purge_minutes", 60)
+	v.SetDefault("ldap.user_filter", "(objectClass=person)")
+	v.SetDefault("ldap.username_attribute", "uid")
+	v.SetDefault("ldap.email_attribute", "mail")
+	v.SetDefault("ldap.display_name_attribute", "cn")
+	v.SetDefault("ldap.timeout_seconds", 10)
 
 	if err := v.ReadInConfig(); err != nil {
 		log.Printf("Warning: Failed to read config file: %v, using defaults", err)
@@ -111,12 +180,27 @@ func InitDatabase(config *conf.DatabaseConfig) (*gorm.DB, error) {
 		&model.TransferLog{},
 		&model.AdminOperationLog{},
 		&model.UserAPIKey{},
+		&model.UserToken{},
+		&model.UserRecoveryCode{},
+		&model.UserSession{},
+		&model.UserIdentity{},
+		&model.Invitation{},
 		&model.FilePreview{}, // 添加预览表
+		&model.FileVersion{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// 旧版本的 API Key 没有权限范围，补齐普通用户的范围（不含 admin:*），避免升级后被全部拒绝
+	granted, err := dao.NewUserAPIKeyRepository().GrantLegacyScopes(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate api key scopes: %w", err)
+	}
+	if granted > 0 {
+		log.Printf("Granted legacy scopes to %d API keys without scopes", granted)
+	}
+
 	log.Println("Database initialized successfully")
 	return database, nil
 }
@@ -150,8 +234,11 @@ func CreateDefaultAdmin(database *gorm.DB) error {
 }
 
 var (
-	database *gorm.DB
-	config   *Config
+	database    *gorm.DB
+	config      *Config
+	stopJanitor context.CancelFunc
+	stopSync    context.CancelFunc
+	stopPurge   context.CancelFunc
 )
 
 // Bootstrap 应用程序启动入口
@@ -179,12 +266,27 @@ func Bootstrap() (*server.Hertz, error) {
 		return nil, fmt.Errorf("failed to init logger: %w", err)
 	}
 
+	// 2.5 加载 JWT 签名密钥，生产环境拒绝使用默认密钥启动
+	if err := initJWTKeys(&config.User, config.App.Production); err != nil {
+		return nil, fmt.Errorf("failed to init jwt keys: %w", err)
+	}
+
 	// 3. 初始化数据库
 	database, err = InitDatabase(&config.Database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init database: %w", err)
 	}
 
+	// 3.5 连接 Redis（可选），不可用时计数器等功能回退到内存实现
+	if config.Redis.Host != "" {
+		if err := redis.Init(&config.Redis); err != nil {
+			logger.Warn("Redis unavailable, falling back to in-memory counters", zap.Error(err))
+		}
+	}
+
+	// 3.6 认证中间件校验访问令牌时回调会话服务，确认会话未被撤销
+	auth.SetSessionChecker(session.GetService().Check)
+
 	// 4. 创建默认管理员
 	if err := CreateDefaultAdmin(database); err != nil {
 		logger.Error("Failed to create default admin", zap.Error(err))
@@ -195,6 +297,15 @@ func Bootstrap() (*server.Hertz, error) {
 		logger.Error("Failed to init preview service", zap.Error(err))
 	}
 
+	// 4.6 启动闲置上传会话回收任务
+	startUploadJanitor(&config.Upload)
+
+	// 4.7 启动 LDAP 账号状态同步任务
+	startDirectorySync(config)
+
+	// 4.8 启动待删除账号清除任务
+	startAccountPurger(&config.User)
+
 	// 5. 创建 HTTP 服务器
 	port := config.Server.Port
 	if port == 0 {
@@ -202,8 +313,17 @@ func Bootstrap() (*server.Hertz, error) {
 	}
 	h := server.New(
 		server.WithHostPorts(fmt.Sprintf("%s:%d", config.Server.Host, port)),
+		// 流式读取请求体：tus PATCH 请求体可能远大于默认的 4MB 上限
+		server.WithStreamBody(true),
 	)
 
+	// 按受信任代理解析客户端地址，限流、封禁和 API Key 白名单都基于该地址
+	clientIP, err := httpmw.NewClientIPFunc(config.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+	h.SetClientIPFunc(clientIP)
+
 	// 添加 CORS 中间件
 	h.Use(CORS())
 
@@ -221,12 +341,26 @@ func Bootstrap() (*server.Hertz, error) {
 func Cleanup() {
 	logger.Info("Cleaning up resources...")
 
+	if stopJanitor != nil {
+		stopJanitor()
+	}
+	if stopSync != nil {
+		stopSync()
+	}
+	if stopPurge != nil {
+		stopPurge()
+	}
+
 	if database != nil {
 		if err := db.Close(); err != nil {
 			logger.Error("Failed to close database", zap.Error(err))
 		}
 	}
 
+	if err := redis.Close(); err != nil {
+		logger.Error("Failed to close redis", zap.Error(err))
+	}
+
 	logger.Sync()
 }
 
@@ -235,6 +369,125 @@ func customizedRegister(r *server.Hertz) {
 	// 这里可以添加自定义路由，现在为空，所有的路由都通过 GeneratedRegister 注册
 }
 
+// defaultJWTSecrets 代码和示例配置中出现过的默认密钥，生产环境不允许使用
+var defaultJWTSecrets = map[string]bool{
+	"FileCodeBox2025SecretKey":                            true,
+	"FileCodeBox2025JWT":                                  true,
+	"CHANGE_THIS_TO_A_SECURE_RANDOM_STRING_IN_PRODUCTION": true,
+}
+
+// minJWTSecretLength 生产环境 HS256 密钥的最小长度
+const minJWTSecretLength = 32
+
+// weakJWTSecret 密钥为空、过短或是公开的默认值
+func weakJWTSecret(secret string) bool {
+	return len(secret) < minJWTSecretLength || defaultJWTSecrets[secret]
+}
+
+// initJWTKeys 加载 jwt_secret 和签名密钥集合
+// jwt_secret 除了在未配置 jwt_keys 时签发访问令牌，还用于邮件链接等内部签名，因此始终需要配置
+func initJWTKeys(cfg *conf.UserConfig, production bool) error {
+	checkSecret := func(name, secret string) error {
+		if !weakJWTSecret(secret) {
+			return nil
+		}
+		if production {
+			return fmt.Errorf("%s 为空、是默认值或少于 %d 个字符，生产环境必须配置随机密钥", name, minJWTSecretLength)
+		}
+		logger.Warn("JWT secret is empty, a default value or too short; do not use it in production", zap.String("key", name))
+		return nil
+	}
+
+	if err := checkSecret("user.jwt_secret", cfg.JWTSecret); err != nil {
+		return err
+	}
+	if cfg.JWTSecret != "" {
+		auth.SetJWTSecret(cfg.JWTSecret)
+	}
+
+	specs := make([]auth.KeySpec, 0, len(cfg.JWTKeys))
+	for _, k := range cfg.JWTKeys {
+		spec := auth.KeySpec{ID: k.ID, Algorithm: k.Algorithm, Secret: k.Secret}
+		if k.Algorithm == "" || strings.EqualFold(k.Algorithm, "HS256") {
+			if err := checkSecret("user.jwt_keys["+k.ID+"].secret", k.Secret); err != nil {
+				return err
+			}
+		}
+		if k.PrivateKeyFile != "" {
+			data, err := os.ReadFile(k.PrivateKeyFile)
+			if err != nil {
+				return fmt.Errorf("读取 JWT 私钥 %s 失败: %w", k.ID, err)
+			}
+			spec.PrivateKeyPEM = data
+		}
+		if k.PublicKeyFile != "" {
+			data, err := os.ReadFile(k.PublicKeyFile)
+			if err != nil {
+				return fmt.Errorf("读取 JWT 公钥 %s 失败: %w", k.ID, err)
+			}
+			spec.PublicKeyPEM = data
+		}
+		specs = append(specs, spec)
+	}
+	return auth.SetKeys(cfg.JWTCurrentKey, specs)
+}
+
+// startUploadJanitor 启动后台任务，定期回收闲置的分片上传会话
+func startUploadJanitor(cfg *conf.UploadConfig) {
+	ttl := time.Duration(cfg.SessionTTLHours) * time.Hour
+	interval := time.Duration(cfg.SessionGCMinutes) * time.Minute
+	if ttl <= 0 || interval <= 0 {
+		logger.Info("Upload session janitor disabled")
+		return
+	}
+
+	// 存储根目录与分片上传处理器保持一致
+	store := storage.NewStorageService(&storage.StorageConfig{
+		Type:     storage.StorageTypeLocal,
+		DataPath: "./data",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopJanitor = cancel
+	chunkService.NewJanitor(chunkService.NewService(), store, ttl, interval).Start(ctx)
+}
+
+// startDirectorySync 启用 LDAP 认证时启动后台任务，定期把目录中禁用或删除的账号同步为本地停用
+func startDirectorySync(cfg *conf.AppConfiguration) {
+	interval := time.Duration(cfg.LDAP.SyncIntervalMinutes) * time.Minute
+	if !slices.Contains(cfg.User.AuthProviders, userService.ProviderLDAP) || interval <= 0 {
+		return
+	}
+
+	job, err := userService.NewDirectorySync(interval)
+	if err != nil {
+		logger.Error("Failed to start LDAP directory sync", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopSync = cancel
+	job.Start(ctx)
+}
+
+// startAccountPurger 启动后台任务，定期清除宽限期已结束的待删除账号
+func startAccountPurger(cfg *conf.UserConfig) {
+	interval := time.Duration(cfg.DeletionPurgeMinutes) * time.Minute
+	if interval <= 0 {
+		logger.Info("Account purger disabled")
+		return
+	}
+
+	// 存储根目录与分享处理器保持一致
+	store := storage.NewStorageService(&storage.StorageConfig{
+		Type:     storage.StorageTypeLocal,
+		DataPath: "./data/uploads",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopPurge = cancel
+	userService.NewAccountPurger(store, interval).Start(ctx)
+}
+
 // initPreviewService 初始化预览服务
 func initPreviewService() error {
 	previewConfig := &previewPkg.Config{
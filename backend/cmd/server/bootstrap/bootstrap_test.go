@@ -0,0 +1,87 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+)
+
+const strongSecret = "k3Jq8vZ2pW7xR4tY9mN6bC1dF5gH0sLa"
+
+func setupJWTTest(t *testing.T) {
+	t.Helper()
+	if err := logger.Init(&logger.Config{Level: "error"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = auth.SetKeys("", nil) })
+}
+
+func TestInitJWTKeysRejectsWeakSecretsInProduction(t *testing.T) {
+	setupJWTTest(t)
+
+	cases := map[string]conf.UserConfig{
+		"jwt_secret 为空":   {},
+		"jwt_secret 为默认值": {JWTSecret: "FileCodeBox2025SecretKey"},
+		"jwt_secret 为示例值": {JWTSecret: "CHANGE_THIS_TO_A_SECURE_RANDOM_STRING_IN_PRODUCTION"},
+		"jwt_secret 过短":   {JWTSecret: strings.Repeat("x", minJWTSecretLength-1)},
+		"jwt_keys 密钥过短":   {JWTSecret: strongSecret, JWTKeys: []conf.JWTKeyConfig{{ID: "k1", Secret: "short"}}},
+		"jwt_keys 密钥为默认值": {JWTSecret: strongSecret, JWTKeys: []conf.JWTKeyConfig{{ID: "k1", Algorithm: "hs256", Secret: "FileCodeBox2025JWT"}}},
+	}
+	for name, cfg := range cases {
+		cfg := cfg
+		if err := initJWTKeys(&cfg, true); err == nil {
+			t.Errorf("%s: 生产环境没有拒绝", name)
+		}
+		// 非生产环境只记录警告
+		if err := initJWTKeys(&cfg, false); err != nil {
+			t.Errorf("%s: 非生产环境返回 %v", name, err)
+		}
+	}
+}
+
+func TestInitJWTKeysAcceptsStrongKeysInProduction(t *testing.T) {
+	setupJWTTest(t)
+
+	// 非对称密钥不受 jwt_secret 长度限制
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "ed25519.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &conf.UserConfig{
+		JWTSecret:     strongSecret,
+		JWTCurrentKey: "ed",
+		JWTKeys: []conf.JWTKeyConfig{
+			{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: keyFile},
+			{ID: "old", Secret: strongSecret + "-old"},
+		},
+	}
+	if err := initJWTKeys(cfg, true); err != nil {
+		t.Fatalf("initJWTKeys: %v", err)
+	}
+	if jwks := auth.PublicJWKs(); len(jwks) != 1 || jwks[0]["kid"] != "ed" {
+		t.Fatalf("加载后的公钥: %v", jwks)
+	}
+
+	cfg.JWTKeys[0].PrivateKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+	if err := initJWTKeys(cfg, true); err == nil {
+		t.Fatal("私钥文件不存在时没有返回错误")
+	}
+}
@@ -4,17 +4,32 @@ package admin
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	admin "github.com/zy84338719/fileCodeBox/backend/gen/http/model/admin"
 	adminsvc "github.com/zy84338719/fileCodeBox/backend/internal/app/admin"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/sso"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	userservice "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
 )
 
 var adminService *adminsvc.Service
 
 func init() {
 	adminService = adminsvc.NewService()
+	// 与分享处理器使用同一存储根目录，立即删除用户时删除其分享文件
+	adminService.SetStorage(storage.NewStorageService(&storage.StorageConfig{
+		Type:     storage.StorageTypeLocal,
+		DataPath: "./data/uploads",
+	}))
 }
 
 // AdminLogin .
@@ -41,7 +56,32 @@ func AdminLogin(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 生成 token
-	token, err := adminService.GenerateTokenForAdmin(ctx, req.Username, req.Password)
+	tokens, err := adminService.GenerateTokenForAdmin(ctx, req.Username, req.Password, sessionClient(c))
+	var challenge *twofactor.ChallengeError
+	if errors.As(err, &challenge) {
+		message := "请输入两步验证码"
+		if !challenge.Enrolled {
+			message = "管理员账号要求开启两步验证，请先绑定验证器"
+		}
+		c.JSON(consts.StatusOK, map[string]interface{}{
+			"code":    200,
+			"message": message,
+			"data": map[string]interface{}{
+				"two_factor_required": true,
+				"two_factor_enrolled": challenge.Enrolled,
+				"pre_auth_token":      challenge.PreAuthToken,
+				"expires_in":          challenge.ExpiresIn,
+			},
+		})
+		return
+	}
+	if errors.Is(err, sso.ErrPasswordLoginDisabled) {
+		c.JSON(consts.StatusForbidden, &admin.AdminLoginResp{
+			Code:    403,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusUnauthorized, &admin.AdminLoginResp{
 			Code:    401,
@@ -51,17 +91,332 @@ func AdminLogin(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 返回成功响应
-	resp := &admin.AdminLoginResp{
-		Code:    200,
-		Message: "登录成功",
-		Data: &admin.AdminLoginData{
-			Token:     token,
-			TokenType: "Bearer",
-			ExpiresIn: 24 * 60 * 60, // 24小时
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "登录成功",
+		"data":    loginData(tokens),
+	})
+}
+
+// loginData 登录成功时返回的令牌信息
+func loginData(tokens *session.Tokens) map[string]interface{} {
+	return map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    tokens.ExpiresIn,
+		"refresh_token": tokens.RefreshToken,
+	}
+}
+
+// sessionClient 从请求中提取登录会话记录的客户端信息
+func sessionClient(c *app.RequestContext) session.Client {
+	return session.Client{IP: c.ClientIP(), UserAgent: string(c.UserAgent())}
+}
+
+// AdminLoginTwoFactor 管理员登录第二步：提交预认证令牌和验证码（或恢复码）换取 token
+// @router /admin/login/2fa [POST]
+func AdminLoginTwoFactor(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || req.PreAuthToken == "" || strings.TrimSpace(req.Code) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入验证码",
+		})
+		return
+	}
+
+	tokens, recoveryCodes, err := adminService.CompleteTwoFactorLogin(ctx, req.PreAuthToken, req.Code, sessionClient(c))
+	if err != nil {
+		status := consts.StatusBadRequest
+		if errors.Is(err, twofactor.ErrTooManyAttempts) {
+			status = consts.StatusTooManyRequests
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	data := loginData(tokens)
+	if recoveryCodes != nil {
+		// 登录时完成绑定，恢复码只展示这一次
+		data["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "登录成功",
+		"data":    data,
+	})
+}
+
+// AdminResetUserTwoFactor 重置用户的两步验证，用户丢失验证器和恢复码时使用
+// @router /admin/users/:id/2fa [DELETE]
+func AdminResetUserTwoFactor(ctx context.Context, c *app.RequestContext) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	actor, _ := actorID.(uint)
+	if err := adminService.ResetUserTwoFactor(ctx, uint(userID), actor, c.GetString("username"), c.ClientIP()); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "重置两步验证失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已重置两步验证，用户下次登录时需要重新绑定",
+	})
+}
+
+// AdminDeleteUser 删除用户，默认进入宽限期，immediate=true 时立即清除；transfer_to 指定接收其分享的用户
+// @router /admin/users/:id [DELETE]
+func AdminDeleteUser(ctx context.Context, c *app.RequestContext) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "无效的用户ID",
+		})
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	actor, _ := actorID.(uint)
+	if actor == uint(userID) {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "不能删除当前登录的管理员账号",
+		})
+		return
+	}
+
+	req := userservice.DeletionReq{
+		ActorID:   &actor,
+		ActorName: c.GetString("username"),
+		IP:        c.ClientIP(),
+	}
+	if v := c.Query("transfer_to"); v != "" {
+		target, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || target == 0 {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": "无效的接收用户ID",
+			})
+			return
+		}
+		to := uint(target)
+		req.TransferTo = &to
+	}
+	immediate := c.Query("immediate") == "true"
+
+	user, result, err := adminService.DeleteUser(ctx, uint(userID), req, immediate)
+	if err != nil {
+		status := consts.StatusBadRequest
+		if user != nil {
+			// 已进入待删除状态，清除失败的账号会由后台任务重试
+			status = consts.StatusInternalServerError
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": "删除用户失败: " + err.Error(),
+		})
+		return
+	}
+
+	if immediate {
+		c.JSON(consts.StatusOK, map[string]interface{}{
+			"code":    200,
+			"message": "用户已删除",
+			"data":    result,
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "用户已停用，将在宽限期结束后删除",
+		"data": map[string]interface{}{
+			"status":                user.Status,
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+			"transfer_to":           user.DeletionTransferTo,
 		},
+	})
+}
+
+// AdminRestoreUser 在宽限期内撤销用户的删除申请
+// @router /admin/users/:id/restore [POST]
+func AdminRestoreUser(ctx context.Context, c *app.RequestContext) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "无效的用户ID",
+		})
+		return
 	}
 
-	c.JSON(consts.StatusOK, resp)
+	actorID, _ := c.Get("user_id")
+	actor, _ := actorID.(uint)
+	user, err := adminService.RestoreUser(ctx, uint(userID), userservice.DeletionReq{
+		ActorID:   &actor,
+		ActorName: c.GetString("username"),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "撤销删除失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已撤销删除，API Key 需要重新创建",
+		"data":    user.ToResp(),
+	})
+}
+
+// AdminListInvitations 分页列出邀请码，created_by 按创建者过滤
+// @router /admin/invitations [GET]
+func AdminListInvitations(ctx context.Context, c *app.RequestContext) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	query := model.InvitationQuery{Page: page, PageSize: pageSize}
+	if raw := c.Query("created_by"); raw != "" {
+		createdBy, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": "无效的创建者ID",
+			})
+			return
+		}
+		id := uint(createdBy)
+		query.CreatedBy = &id
+	}
+
+	invitations, total, err := adminService.ListInvitations(ctx, query)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "获取邀请码失败: " + err.Error(),
+		})
+		return
+	}
+	items := make([]*model.InvitationResp, len(invitations))
+	for i, invitation := range invitations {
+		items[i] = invitation.ToResp()
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data": map[string]interface{}{
+			"invitations": items,
+			"total":       total,
+		},
+	})
+}
+
+// AdminCreateInvitation 创建邀请码，可指定使用次数、有效期、预设角色和配额；明文邀请码和注册链接只返回这一次
+// @router /admin/invitations [POST]
+func AdminCreateInvitation(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Note            string `json:"note"`
+		MaxUses         int    `json:"max_uses"`
+		ExpiresInHours  *int   `json:"expires_in_hours"`
+		ExpiresAt       string `json:"expires_at"`
+		Role            string `json:"role"`
+		MaxUploadSize   int64  `json:"max_upload_size"`
+		MaxStorageQuota int64  `json:"max_storage_quota"`
+	}
+	if err := c.Bind(&req); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": "expires_at 必须是 RFC3339 格式的时间",
+			})
+			return
+		}
+		expiresAt = &t
+	}
+
+	actorID, _ := c.Get("user_id")
+	actor, _ := actorID.(uint)
+	result, err := adminService.CreateInvitation(ctx, &userservice.CreateInvitationReq{
+		CreatorID:       actor,
+		CreatorName:     c.GetString("username"),
+		IP:              c.ClientIP(),
+		Note:            req.Note,
+		MaxUses:         req.MaxUses,
+		ExpiresInHours:  req.ExpiresInHours,
+		ExpiresAt:       expiresAt,
+		Role:            req.Role,
+		MaxUploadSize:   req.MaxUploadSize,
+		MaxStorageQuota: req.MaxStorageQuota,
+	})
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "创建邀请码失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "邀请码已创建，请妥善保存，关闭后无法再次查看",
+		"data": map[string]interface{}{
+			"invitation": result.Invitation.ToResp(),
+			"code":       result.Code,
+			"link":       result.Link,
+		},
+	})
+}
+
+// AdminRevokeInvitation 撤销邀请码，已注册的用户不受影响
+// @router /admin/invitations/:id [DELETE]
+func AdminRevokeInvitation(ctx context.Context, c *app.RequestContext) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "无效的邀请码ID",
+		})
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	actor, _ := actorID.(uint)
+	if err := adminService.RevokeInvitation(ctx, uint(id), actor, c.GetString("username"), c.ClientIP()); err != nil {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "邀请码已撤销",
+	})
 }
 
 // AdminStats .
@@ -139,9 +494,32 @@ func AdminUpdateUserStatus(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	resp := new(admin.AdminUpdateUserStatusResp)
+	// 前端以 1/0 表示启用/禁用
+	status := "active"
+	if req.Status == 0 {
+		status = "inactive"
+	}
+	actorID, _ := c.Get("user_id")
+	if actor, _ := actorID.(uint); actor == uint(req.Id) && status != "active" {
+		c.JSON(consts.StatusBadRequest, &admin.AdminUpdateUserStatusResp{
+			Code:    400,
+			Message: "不能禁用当前登录的管理员账号",
+		})
+		return
+	}
 
-	c.JSON(consts.StatusOK, resp)
+	if err := adminService.UpdateUserStatus(ctx, uint(req.Id), status); err != nil {
+		c.JSON(consts.StatusBadRequest, &admin.AdminUpdateUserStatusResp{
+			Code:    400,
+			Message: "更新用户状态失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, &admin.AdminUpdateUserStatusResp{
+		Code:    200,
+		Message: "用户状态已更新",
+	})
 }
 
 // AdminGetConfig .
@@ -3,13 +3,20 @@
 package chunk
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
@@ -17,9 +24,15 @@ import (
 	"github.com/google/uuid"
 	chunkmodel "github.com/zy84338719/fileCodeBox/backend/gen/http/model/chunk"
 	chunkService "github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/quota"
 	shareService "github.com/zy84338719/fileCodeBox/backend/internal/app/share"
+	userService "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
 	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/utils"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	"go.uber.org/zap"
 )
 
 var chunkSvc *chunkService.Service
@@ -32,6 +45,13 @@ const (
 	defaultBaseURL     = "http://localhost:12345"
 )
 
+// chunkExtParams IDL 之外的分片上传扩展参数
+type chunkExtParams struct {
+	E2EE          bool   `json:"e2ee" form:"e2ee"`
+	E2EEMeta      string `json:"e2ee_meta" form:"e2ee_meta"`
+	AvailableFrom string `json:"available_from" form:"available_from"` // 完成上传时指定的生效时间
+}
+
 func getChunkService() *chunkService.Service {
 	if chunkSvc == nil {
 		chunkSvc = chunkService.NewService()
@@ -53,6 +73,8 @@ func getStorageService() storage.StorageInterface {
 func getShareService() *shareService.Service {
 	if shareSvc == nil {
 		shareSvc = shareService.NewService(defaultBaseURL, getStorageService())
+		// 分片上传、秒传完成后同样计入用户上传数和存储用量
+		shareSvc.SetUserService(userService.NewService())
 	}
 	return shareSvc
 }
@@ -71,6 +93,16 @@ func ChunkUploadInit(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	// IDL 之外的扩展参数（端到端加密）
+	var ext chunkExtParams
+	if err = c.Bind(&ext); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 参数验证
 	if req.FileName == "" {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -93,43 +125,82 @@ func ChunkUploadInit(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	// 分片按 index*chunk_size 写入目标文件，分片数量必须与文件大小一致
+	if expected := (req.FileSize + int64(req.ChunkSize) - 1) / int64(req.ChunkSize); int64(req.TotalChunks) != expected {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": fmt.Sprintf("分片数量应为 %d", expected),
+		})
+		return
+	}
 
-	// 生成上传ID
-	uploadID := req.FileHash
-	if uploadID == "" {
-		uploadID = uuid.New().String()
-	}
-
-	// 检查快速上传：如果文件已存在，直接返回分享代码
-	if req.FileHash != "" {
-		shareCode, err := getChunkService().CheckQuickUpload(ctx, req.FileHash, req.FileSize)
-		if err == nil && shareCode != "" {
-			resp := &chunkmodel.ChunkUploadInitResp{
-				Code:    200,
-				Message: "文件已存在，快速上传成功",
-				Data: &chunkmodel.ChunkUploadInitData{
-					UploadId:      uploadID,
-					ChunkSize:     fmt.Sprintf("%d", req.ChunkSize),
-					TotalChunks:   fmt.Sprintf("%d", req.TotalChunks),
-					IsQuickUpload: true,
-					ShareCode:     shareCode,
-				},
-			}
-			c.JSON(consts.StatusOK, resp)
+	// E2EE 上传：校验加密元数据；密文哈希不可用于去重
+	var e2eeMeta string
+	if ext.E2EE {
+		e2eeMeta, err = shareService.ValidateE2EEMeta(ext.E2EEMeta)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+		req.FileHash = ""
+	}
+
+	// 声明的文件哈希用于合并后的完整性校验，必须是 SHA-256
+	req.FileHash = strings.ToLower(strings.TrimSpace(req.FileHash))
+	if req.FileHash != "" && !isSHA256Hex(req.FileHash) {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "file_hash 必须是 SHA-256 十六进制字符串",
+		})
+		return
+	}
+
+	// 按声明的文件大小检查限制并预留配额，会话创建后由未完成会话计入用量
+	userID := contextUserID(c)
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: userID, Size: req.FileSize})
+	if err != nil {
+		writeQuotaError(c, err)
+		return
+	}
+	defer reservation.Release()
+
+	// 匿名上传在创建会话时计入按 IP 统计的次数和字节数，会话创建失败时退回；有效期在完成上传时校验
+	var anonUpload *quota.AnonymousUpload
+	if userID == nil {
+		if anonUpload, err = quota.GetService().ReserveAnonymousUpload(ctx, c.ClientIP(), req.FileSize, true); err != nil {
+			writeQuotaError(c, err)
 			return
 		}
 	}
+	defer anonUpload.Release()
 
-	// 初始化上传
+	// 秒传需要先通过 /chunk/upload/quick/ 完成持有证明，这里始终走普通分片上传
+	// 初始化上传：上传ID由服务端生成，会话绑定到当前用户或签发的上传令牌
 	initReq := &chunkService.InitiateUploadReq{
-		UploadID:    uploadID,
 		FileName:    req.FileName,
 		TotalChunks: int(req.TotalChunks),
 		FileSize:    req.FileSize,
 		ChunkSize:   int(req.ChunkSize),
+		FileHash:    req.FileHash,
+		E2EE:        ext.E2EE,
+		E2EEMeta:    e2eeMeta,
+
+		UserID:       userID,
+		OwnerIP:      c.ClientIP(),
+		RequireToken: true,
 	}
 
 	result, err := getChunkService().InitiateUpload(ctx, initReq)
+	if err == chunkService.ErrTooManySessions {
+		c.JSON(consts.StatusTooManyRequests, map[string]interface{}{
+			"code":    429,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -138,18 +209,31 @@ func ChunkUploadInit(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	resp := &chunkmodel.ChunkUploadInitResp{
-		Code:    200,
-		Message: "初始化成功",
-		Data: &chunkmodel.ChunkUploadInitData{
-			UploadId:      result.UploadID,
-			ChunkSize:     fmt.Sprintf("%d", result.ChunkSize),
-			TotalChunks:   fmt.Sprintf("%d", result.TotalChunks),
-			IsQuickUpload: false,
-		},
+	reservation.Commit()
+
+	// 预分配目标文件，分片到达后直接写入对应偏移
+	if err := getStorageService().InitChunks(ctx, result.UploadID, req.FileSize); err != nil {
+		_ = getChunkService().DeleteUpload(ctx, result.UploadID)
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "初始化上传失败: " + err.Error(),
+		})
+		return
 	}
+	anonUpload.Commit()
 
-	c.JSON(consts.StatusOK, resp)
+	// upload_token 只在此处返回一次，匿名上传的后续请求需通过 X-Upload-Token 头携带
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "初始化成功",
+		"data": map[string]interface{}{
+			"upload_id":       result.UploadID,
+			"chunk_size":      fmt.Sprintf("%d", result.ChunkSize),
+			"total_chunks":    fmt.Sprintf("%d", result.TotalChunks),
+			"is_quick_upload": false,
+			"upload_token":    result.UploadToken,
+		},
+	})
 }
 
 // ChunkUpload .
@@ -178,6 +262,33 @@ func ChunkUpload(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	// 持有共享锁直到分片写入并记录完成，合并时独占持有，分片不会写进已校验或已移走的数据文件
+	lock := chunkService.UploadLock(uploadID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	// 校验上传会话归属，状态在持锁后读取
+	info, status, err := authorizeUpload(ctx, c, uploadID)
+	if err != nil {
+		// 不存在的上传不保留锁
+		if status == consts.StatusNotFound {
+			chunkService.ReleaseUploadLock(uploadID)
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 已完成的会话不再接受分片，避免在已移走的数据文件位置重新写入
+	if info.Status == "completed" {
+		c.JSON(consts.StatusConflict, map[string]interface{}{
+			"code":    409,
+			"message": "上传已完成",
+		})
+		return
+	}
+
 	// 获取上传的文件
 	file, err := c.FormFile("chunk")
 	if err != nil {
@@ -210,12 +321,43 @@ func ChunkUpload(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 计算分片哈希
-	hash := md5.Sum(data)
+	// 计算分片哈希，并与客户端声明的哈希比对
+	hash := sha256.Sum256(data)
 	chunkHash := hex.EncodeToString(hash[:])
+	err = getChunkService().VerifyChunkHash(ctx, uploadID, chunkIndex, c.DefaultPostForm("chunk_hash", ""), chunkHash)
+	if err != nil {
+		var mismatch *chunkService.ChunkHashMismatchError
+		if errors.As(err, &mismatch) {
+			c.JSON(consts.StatusUnprocessableEntity, map[string]interface{}{
+				"code":    422,
+				"message": "分片校验失败，请重新上传该分片",
+				"data": map[string]interface{}{
+					"retryable":   true,
+					"chunk_index": mismatch.ChunkIndex,
+					"expected":    mismatch.Expected,
+					"actual":      mismatch.Actual,
+					"retry_count": mismatch.RetryCount,
+				},
+			})
+			return
+		}
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 
-	// 保存分片到存储
-	err = getStorageService().SaveChunk(ctx, uploadID, chunkIndex, data)
+	// 分片直接写入目标文件的对应偏移
+	offset, err := chunkService.ChunkOffset(info, chunkIndex, int64(len(data)))
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = getStorageService().SaveChunk(ctx, uploadID, chunkIndex, offset, data)
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -230,6 +372,8 @@ func ChunkUpload(ctx context.Context, c *app.RequestContext) {
 		ChunkIndex: chunkIndex,
 		ChunkHash:  chunkHash,
 		ChunkSize:  int(file.Size),
+		Nonce:      c.DefaultPostForm("nonce", ""),
+		AuthTag:    c.DefaultPostForm("tag", ""),
 	}
 
 	result, err := getChunkService().UploadChunk(ctx, uploadReq)
@@ -268,12 +412,12 @@ func ChunkUploadStatus(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 获取上传信息
-	info, err := getChunkService().GetUploadInfo(ctx, uploadID)
+	// 获取上传信息并校验会话归属
+	info, code, err := authorizeUpload(ctx, c, uploadID)
 	if err != nil {
-		c.JSON(consts.StatusNotFound, map[string]interface{}{
-			"code":    404,
-			"message": "上传记录不存在",
+		c.JSON(code, map[string]interface{}{
+			"code":    code,
+			"message": err.Error(),
 		})
 		return
 	}
@@ -350,12 +494,46 @@ func ChunkUploadComplete(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 获取上传信息
-	info, err := getChunkService().GetUploadInfo(ctx, uploadID)
+	// IDL 之外的扩展参数（定时生效）
+	var ext chunkExtParams
+	if err = c.Bind(&ext); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	availableFrom, err := utils.ParseAvailableFrom(ext.AvailableFrom)
 	if err != nil {
-		c.JSON(consts.StatusNotFound, map[string]interface{}{
-			"code":    404,
-			"message": "上传记录不存在",
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 独占上传锁：等待正在写入的分片结束，合并和校验期间不再接受新分片
+	lock := chunkService.UploadLock(uploadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 获取上传信息并校验会话归属，状态在持锁后读取
+	info, status, err := authorizeUpload(ctx, c, uploadID)
+	if err != nil {
+		if status == consts.StatusNotFound {
+			chunkService.ReleaseUploadLock(uploadID)
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 重复提交完成请求不会再次创建分享
+	if info.Status == "completed" {
+		c.JSON(consts.StatusConflict, map[string]interface{}{
+			"code":    409,
+			"message": "上传已完成",
 		})
 		return
 	}
@@ -378,66 +556,204 @@ func ChunkUploadComplete(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 合并分片
-	now := time.Now()
-	fileExt := filepath.Ext(info.FileName)
-	uuidFileName := uuid.New().String() + fileExt
+	shareResult, err := finishUpload(ctx, c, info, shareOptions{
+		ExpireValue:   int(req.ExpireValue),
+		ExpireStyle:   req.ExpireStyle,
+		RequireAuth:   req.RequireAuth,
+		AvailableFrom: availableFrom,
+	})
+	if errors.Is(err, chunkService.ErrFileIntegrity) {
+		c.JSON(consts.StatusUnprocessableEntity, map[string]interface{}{
+			"code":    422,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		writeQuotaError(c, err)
+		return
+	}
+	// 上传已完成，之后的分片会被拒绝，不再需要锁
+	chunkService.ReleaseUploadLock(uploadID)
 
-	relativePath := filepath.Join(
-		"uploads",
-		now.Format("2006"),
-		now.Format("01"),
-		now.Format("02"),
-		uuidFileName,
-	)
+	// 生成分享URL
+	fullShareURL := fmt.Sprintf("%s/share/%s", defaultBaseURL, shareResult.Code)
 
-	err = getStorageService().MergeChunks(ctx, uploadID, info.TotalChunks, relativePath)
-	if err != nil {
-		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
-			"code":    500,
-			"message": "合并分片失败: " + err.Error(),
+	resp := &chunkmodel.ChunkUploadCompleteResp{
+		Code:    200,
+		Message: "上传完成",
+		Data: &chunkmodel.ChunkUploadCompleteData{
+			ShareCode: shareResult.Code,
+			ShareUrl:  fullShareURL,
+			FileName:  info.FileName,
+			FileSize:  info.FileSize,
+		},
+	}
+
+	c.JSON(consts.StatusOK, resp)
+}
+
+// quickUploadConfirmParams 秒传确认参数
+type quickUploadConfirmParams struct {
+	Proof         string `json:"proof" form:"proof"` // 以 nonce 为密钥、挑战区间内容的 HMAC-SHA256（十六进制）
+	FileName      string `json:"file_name" form:"file_name"`
+	ExpireValue   int    `json:"expire_value" form:"expire_value"`
+	ExpireStyle   string `json:"expire_style" form:"expire_style"`
+	RequireAuth   bool   `json:"require_auth" form:"require_auth"`
+	AvailableFrom string `json:"available_from" form:"available_from"`
+}
+
+// ChunkQuickUploadCheck 秒传预检：存在相同文件时返回持有证明挑战
+// @router /chunk/upload/quick/ [POST]
+func ChunkQuickUploadCheck(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		FileHash string `json:"file_hash" form:"file_hash"`
+		FileSize int64  `json:"file_size" form:"file_size"`
+	}
+	if err := c.Bind(&req); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// 计算过期时间
-	expireTime := utils.CalculateExpireTime(int(req.ExpireValue), req.ExpireStyle)
-	expireCount := utils.CalculateExpireCount(req.ExpireStyle, int(req.ExpireValue))
-
-	// 获取用户ID（如果有）
-	var userID *uint
-	if uid, exists := c.Get("user_id"); exists {
-		if uidUint, ok := uid.(uint); ok {
-			userID = &uidUint
+	challenge, err := getChunkService().CheckQuickUpload(ctx, req.FileHash, req.FileSize)
+	if err != nil {
+		switch err {
+		case chunkService.ErrQuickUploadUnavailable:
+			c.JSON(consts.StatusOK, map[string]interface{}{
+				"code":    200,
+				"message": err.Error(),
+				"data": map[string]interface{}{
+					"is_quick_upload": false,
+				},
+			})
+		case chunkService.ErrTooManyChallenges:
+			c.JSON(consts.StatusTooManyRequests, map[string]interface{}{
+				"code":    429,
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": err.Error(),
+			})
 		}
+		return
 	}
 
-	// 获取客户端 IP
-	ownerIP := c.ClientIP()
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "文件已存在，请提交持有证明",
+		"data": map[string]interface{}{
+			"is_quick_upload": true,
+			"challenge_id":    challenge.ID,
+			"nonce":           challenge.Nonce,
+			"offset":          challenge.Offset,
+			"length":          challenge.Length,
+			"expires_at":      challenge.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
 
-	// 确定上传类型
+// ChunkQuickUploadConfirm 提交持有证明，校验通过后直接引用已有文件创建分享
+// @router /chunk/upload/quick/:challenge_id [POST]
+func ChunkQuickUploadConfirm(ctx context.Context, c *app.RequestContext) {
+	var params quickUploadConfirmParams
+	if err := c.Bind(&params); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	availableFrom, err := utils.ParseAvailableFrom(params.AvailableFrom)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	challenge, err := getChunkService().TakeQuickUploadChallenge(ctx, c.Param("challenge_id"))
+	if err != nil {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 读取挑战区间并校验
+	source := challenge.Source
+	storedPath := filepath.Join("uploads", source.GetFilePath())
+	data, err := readStoredRange(ctx, storedPath, challenge.Offset, challenge.Length)
+	if err != nil {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": "文件不存在，无法秒传",
+		})
+		return
+	}
+	if !challenge.Verify(data, params.Proof) {
+		c.JSON(consts.StatusForbidden, map[string]interface{}{
+			"code":    403,
+			"message": "持有证明校验失败",
+		})
+		return
+	}
+
+	userID := contextUserID(c)
 	uploadType := "anonymous"
 	if userID != nil {
 		uploadType = "authenticated"
 	}
 
-	// 创建分享记录
-	shareReq := &shareService.ShareFileReq{
-		FilePath:     relativePath,
-		Size:         info.FileSize,
-		Text:         info.FileName,
-		ExpiredAt:    expireTime,
-		ExpiredCount: expireCount,
-		RequireAuth:  req.RequireAuth,
-		UserID:       userID,
-		UploadType:   uploadType,
-		OwnerIP:      ownerIP,
-		FileHash:     uploadID,
-		IsChunked:    true,
-		UploadID:     uploadID,
+	// 秒传同样计入存储用量
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: userID, Size: source.Size})
+	if err != nil {
+		writeQuotaError(c, err)
+		return
 	}
+	defer reservation.Release()
 
-	shareResult, err := getShareService().ShareFile(ctx, shareReq)
+	expireTime := utils.CalculateExpireTimeFrom(availableFrom, params.ExpireValue, params.ExpireStyle)
+	var anonUpload *quota.AnonymousUpload
+	if userID == nil {
+		if err = quota.CheckAnonymousExpiry(expireTime, availableFrom); err == nil {
+			anonUpload, err = quota.GetService().ReserveAnonymousUpload(ctx, c.ClientIP(), source.Size, true)
+		}
+		if err != nil {
+			writeQuotaError(c, err)
+			return
+		}
+	}
+	defer anonUpload.Release()
+
+	fileName := utils.SanitizeFileName(params.FileName)
+	if fileName == "" {
+		fileName = source.FileName()
+	}
+	prefix, suffix := utils.SplitFileName(fileName)
+
+	shareResult, err := getShareService().ShareFile(ctx, &shareService.ShareFileReq{
+		FilePath:      source.GetFilePath(),
+		Size:          source.Size,
+		Prefix:        prefix,
+		Suffix:        suffix,
+		MimeType:      source.MimeType,
+		ExpiredAt:     expireTime,
+		AvailableFrom: availableFrom,
+		ExpiredCount:  utils.CalculateExpireCount(params.ExpireStyle, params.ExpireValue),
+		RequireAuth:   params.RequireAuth,
+		UserID:        userID,
+		UploadType:    uploadType,
+		OwnerIP:       c.ClientIP(),
+		FileHash:      challenge.FileHash,
+		HashVerified:  true,
+	})
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -445,29 +761,19 @@ func ChunkUploadComplete(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	reservation.Commit()
+	anonUpload.Commit()
 
-	// 更新上传状态为完成
-	err = getChunkService().CompleteUpload(ctx, uploadID)
-	if err != nil {
-		// 记录错误但不影响返回结果
-		fmt.Printf("更新上传状态失败: %v\n", err)
-	}
-
-	// 生成分享URL
-	fullShareURL := fmt.Sprintf("%s/share/%s", defaultBaseURL, shareResult.Code)
-
-	resp := &chunkmodel.ChunkUploadCompleteResp{
-		Code:    200,
-		Message: "上传完成",
-		Data: &chunkmodel.ChunkUploadCompleteData{
-			ShareCode: shareResult.Code,
-			ShareUrl:  fullShareURL,
-			FileName:  info.FileName,
-			FileSize:  info.FileSize,
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "秒传成功",
+		"data": map[string]interface{}{
+			"share_code": shareResult.Code,
+			"share_url":  fmt.Sprintf("%s/share/%s", defaultBaseURL, shareResult.Code),
+			"file_name":  fileName,
+			"file_size":  shareResult.Size,
 		},
-	}
-
-	c.JSON(consts.StatusOK, resp)
+	})
 }
 
 // ChunkUploadCancel .
@@ -483,6 +789,15 @@ func ChunkUploadCancel(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	// 校验上传会话归属
+	if _, status, err := authorizeUpload(ctx, c, uploadID); err != nil {
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 删除分片存储
 	err := getStorageService().CleanChunks(ctx, uploadID)
 	if err != nil {
@@ -506,3 +821,776 @@ func ChunkUploadCancel(ctx context.Context, c *app.RequestContext) {
 
 	c.JSON(consts.StatusOK, resp)
 }
+
+// tus 1.0 可续传上传协议，复用分片上传的存储与记录
+// 参考 https://tus.io/protocols/resumable-upload
+const (
+	tusVersion            = "1.0.0"
+	tusExtensions         = "creation,creation-with-upload,termination,checksum"
+	tusChecksumAlgorithms = "sha1,sha256,md5"
+	tusContentType        = "application/offset+octet-stream"
+	// statusChecksumMismatch tus checksum 扩展定义的校验失败状态码
+	statusChecksumMismatch = 460
+	// defaultTusChunkSize 未配置 upload.chunk_size 时 PATCH 请求体的切分大小
+	defaultTusChunkSize = 2 * 1024 * 1024
+)
+
+// TusOptions tus 能力发现
+// @router /tus/ [OPTIONS]
+func TusOptions(ctx context.Context, c *app.RequestContext) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	c.SetStatusCode(consts.StatusNoContent)
+}
+
+// TusCreate 创建上传（creation / creation-with-upload）
+// @router /tus/ [POST]
+func TusCreate(ctx context.Context, c *app.RequestContext) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(string(c.GetHeader("Upload-Length")), 10, 64)
+	if err != nil || length <= 0 {
+		writeTusError(c, consts.StatusBadRequest, "Upload-Length 必须为大于0的整数")
+		return
+	}
+
+	rawMeta := string(c.GetHeader("Upload-Metadata"))
+	meta, err := parseTusMetadata(rawMeta)
+	if err != nil {
+		writeTusError(c, consts.StatusBadRequest, err.Error())
+		return
+	}
+	opts, err := tusShareOptions(meta)
+	if err != nil {
+		writeTusError(c, consts.StatusBadRequest, err.Error())
+		return
+	}
+
+	fileName := meta["filename"]
+	if fileName == "" {
+		fileName = meta["name"]
+	}
+	if fileName == "" {
+		fileName = "upload"
+	}
+
+	userID := contextUserID(c)
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: userID, Size: length})
+	if err != nil {
+		writeTusError(c, quotaErrorStatus(err), err.Error())
+		return
+	}
+	defer reservation.Release()
+
+	// 匿名上传：分享设置在创建时已知，提前校验有效期，避免传完才被拒绝；会话创建失败时退回计数
+	var anonUpload *quota.AnonymousUpload
+	if userID == nil {
+		expireAt := utils.CalculateExpireTimeFrom(opts.AvailableFrom, opts.ExpireValue, opts.ExpireStyle)
+		if err = quota.CheckAnonymousExpiry(expireAt, opts.AvailableFrom); err == nil {
+			anonUpload, err = quota.GetService().ReserveAnonymousUpload(ctx, c.ClientIP(), length, true)
+		}
+		if err != nil {
+			writeTusError(c, quotaErrorStatus(err), err.Error())
+			return
+		}
+	}
+	defer anonUpload.Release()
+
+	// 登录用户的 tus 会话绑定到用户；匿名会话以服务端生成的 upload_id 作为凭证
+	result, err := getChunkService().InitiateUpload(ctx, &chunkService.InitiateUploadReq{
+		FileName:   fileName,
+		FileSize:   length,
+		ChunkSize:  tusChunkSize(),
+		UploadMeta: rawMeta,
+		UserID:     userID,
+		OwnerIP:    c.ClientIP(),
+	})
+	if err == chunkService.ErrTooManySessions {
+		writeTusError(c, consts.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		writeTusError(c, consts.StatusInternalServerError, "初始化上传失败: "+err.Error())
+		return
+	}
+	reservation.Commit()
+
+	uploadID := result.UploadID
+	if err := getStorageService().InitChunks(ctx, uploadID, length); err != nil {
+		_ = getChunkService().DeleteUpload(ctx, uploadID)
+		writeTusError(c, consts.StatusInternalServerError, "初始化上传失败: "+err.Error())
+		return
+	}
+	anonUpload.Commit()
+	c.Header("Location", "/tus/"+uploadID)
+
+	// creation-with-upload：创建请求同时携带了第一段数据
+	offset := int64(0)
+	if string(c.ContentType()) == tusContentType {
+		lock := chunkService.UploadLock(uploadID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		info, err := getChunkService().GetUploadInfo(ctx, uploadID)
+		if err != nil {
+			writeTusError(c, consts.StatusInternalServerError, err.Error())
+			return
+		}
+		var status int
+		if offset, status, err = writeTusBody(ctx, c, info, 0); err != nil {
+			writeTusError(c, status, err.Error())
+			return
+		}
+		if offset == length && !finishTusUpload(ctx, c, uploadID) {
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.SetStatusCode(consts.StatusCreated)
+}
+
+// TusHead 查询上传偏移量，用于断点续传
+// @router /tus/:upload_id [HEAD]
+func TusHead(ctx context.Context, c *app.RequestContext) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+
+	uploadID := c.Param("upload_id")
+	info, status, err := authorizeUpload(ctx, c, uploadID)
+	if err != nil {
+		c.SetStatusCode(status)
+		return
+	}
+	offset, err := getChunkService().GetUploadOffset(ctx, uploadID)
+	if err != nil {
+		c.SetStatusCode(consts.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(info.FileSize, 10))
+	if info.UploadMeta != "" {
+		c.Header("Upload-Metadata", info.UploadMeta)
+	}
+	if code, err := getChunkService().GetShareCodeByUploadID(ctx, uploadID); err == nil {
+		setTusShareHeaders(c, code)
+	}
+	c.SetStatusCode(consts.StatusOK)
+}
+
+// TusPatch 从指定偏移量继续写入数据，写满后创建分享
+// @router /tus/:upload_id [PATCH]
+func TusPatch(ctx context.Context, c *app.RequestContext) {
+	if !checkTusResumable(c) {
+		return
+	}
+	if string(c.ContentType()) != tusContentType {
+		writeTusError(c, consts.StatusUnsupportedMediaType, "Content-Type 必须为 "+tusContentType)
+		return
+	}
+
+	uploadID := c.Param("upload_id")
+	lock := chunkService.UploadLock(uploadID)
+	if !lock.TryLock() {
+		writeTusError(c, consts.StatusLocked, "该上传正在写入中")
+		return
+	}
+	defer lock.Unlock()
+
+	info, status, err := authorizeUpload(ctx, c, uploadID)
+	if err != nil {
+		// 不存在的上传不保留写锁
+		if status == consts.StatusNotFound {
+			chunkService.ReleaseUploadLock(uploadID)
+		}
+		writeTusError(c, status, err.Error())
+		return
+	}
+	// 已完成的上传数据文件已移走，不能再写入
+	if info.Status == "completed" {
+		chunkService.ReleaseUploadLock(uploadID)
+		writeTusError(c, consts.StatusConflict, "上传已完成")
+		return
+	}
+
+	offset, err := getChunkService().GetUploadOffset(ctx, uploadID)
+	if err != nil {
+		writeTusError(c, consts.StatusInternalServerError, err.Error())
+		return
+	}
+	reqOffset, err := strconv.ParseInt(string(c.GetHeader("Upload-Offset")), 10, 64)
+	if err != nil || reqOffset < 0 {
+		writeTusError(c, consts.StatusBadRequest, "Upload-Offset 格式错误")
+		return
+	}
+	if reqOffset != offset {
+		c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+		writeTusError(c, consts.StatusConflict, "Upload-Offset 与服务端不一致")
+		return
+	}
+
+	newOffset, status, err := writeTusBody(ctx, c, info, offset)
+	if err != nil {
+		writeTusError(c, status, err.Error())
+		return
+	}
+	if newOffset == info.FileSize && !finishTusUpload(ctx, c, uploadID) {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.SetStatusCode(consts.StatusNoContent)
+}
+
+// TusDelete 终止上传并清理已写入的数据（termination）
+// @router /tus/:upload_id [DELETE]
+func TusDelete(ctx context.Context, c *app.RequestContext) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	uploadID := c.Param("upload_id")
+	lock := chunkService.UploadLock(uploadID)
+	if !lock.TryLock() {
+		writeTusError(c, consts.StatusLocked, "该上传正在写入中")
+		return
+	}
+	defer lock.Unlock()
+
+	if _, status, err := authorizeUpload(ctx, c, uploadID); err != nil {
+		if status == consts.StatusNotFound {
+			chunkService.ReleaseUploadLock(uploadID)
+		}
+		writeTusError(c, status, err.Error())
+		return
+	}
+	if err := getStorageService().CleanChunks(ctx, uploadID); err != nil {
+		fmt.Printf("清理分片文件失败: %v\n", err)
+	}
+	if err := getChunkService().DeleteUpload(ctx, uploadID); err != nil {
+		writeTusError(c, consts.StatusInternalServerError, "取消上传失败: "+err.Error())
+		return
+	}
+	c.SetStatusCode(consts.StatusNoContent)
+}
+
+// sniffStoredFile 读取已保存文件的头部嗅探 MIME 类型
+func sniffStoredFile(ctx context.Context, path, fileName string) string {
+	reader, _, err := getStorageService().GetFileReader(ctx, path)
+	if err != nil {
+		return utils.DetectMimeType(fileName, nil)
+	}
+	defer reader.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(reader, head)
+	return utils.DetectMimeType(fileName, head[:n])
+}
+
+// hashStoredFile 计算已保存文件的 SHA-256
+func hashStoredFile(ctx context.Context, path string) (string, error) {
+	reader, _, err := getStorageService().GetFileReader(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verifyMergedFile 校验合并后文件的大小，以及声明了哈希时的 SHA-256（actual 为合并文件的实际哈希）
+func verifyMergedFile(ctx context.Context, info *model.UploadChunk, mergedPath, actual string) error {
+	size, err := getStorageService().GetFileSize(ctx, mergedPath)
+	if err != nil {
+		return fmt.Errorf("读取合并文件失败: %w", err)
+	}
+	if size != info.FileSize {
+		return fmt.Errorf("%w: 文件大小应为 %d 字节，实际为 %d 字节", chunkService.ErrFileIntegrity, info.FileSize, size)
+	}
+	if info.FileHash != "" && actual != info.FileHash {
+		return fmt.Errorf("%w: SHA-256 应为 %s，实际为 %s", chunkService.ErrFileIntegrity, info.FileHash, actual)
+	}
+	return nil
+}
+
+// isSHA256Hex 判断是否为小写十六进制的 SHA-256
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// readStoredRange 读取已保存文件中 [offset, offset+length) 区间的内容
+func readStoredRange(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	reader, size, err := getStorageService().GetFileReader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if offset+length > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if seeker, ok := reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// shareOptions 上传完成后创建分享的设置
+type shareOptions struct {
+	ExpireValue   int
+	ExpireStyle   string
+	RequireAuth   bool
+	AvailableFrom *time.Time
+}
+
+// finishUpload 合并全部分片并创建分享记录，分片上传与 tus 上传共用
+func finishUpload(ctx context.Context, c *app.RequestContext, info *model.UploadChunk, opts shareOptions) (*shareService.ShareResp, error) {
+	uploadID := info.UploadID
+	userID := contextUserID(c)
+
+	// 复查配额：初始化后限制可能被调整；本会话已计入的用量不重复统计
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: userID, Size: info.FileSize, UploadID: uploadID})
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+
+	// 匿名分享的有效期上限
+	expireTime := utils.CalculateExpireTimeFrom(opts.AvailableFrom, opts.ExpireValue, opts.ExpireStyle)
+	if userID == nil {
+		if err := quota.CheckAnonymousExpiry(expireTime, opts.AvailableFrom); err != nil {
+			return nil, err
+		}
+	}
+
+	// E2EE 上传：收集各分片的 nonce/tag，供下载方流式解密
+	var e2eeChunks string
+	if info.E2EE {
+		chunks, err := getChunkService().GetCompletedChunks(ctx, uploadID)
+		if err != nil {
+			return nil, fmt.Errorf("读取分片信息失败: %w", err)
+		}
+		items := make([]shareService.E2EEChunk, 0, len(chunks))
+		for _, ch := range chunks {
+			items = append(items, shareService.E2EEChunk{
+				Index: ch.ChunkIndex,
+				Size:  int64(ch.ChunkSize),
+				Nonce: ch.Nonce,
+				Tag:   ch.AuthTag,
+			})
+		}
+		if e2eeChunks, err = shareService.EncodeE2EEChunks(items); err != nil {
+			return nil, fmt.Errorf("序列化分片信息失败: %w", err)
+		}
+	}
+
+	// 分片已写入预分配的文件，这里只需落盘并移动到最终位置
+	// E2EE 上传不保留扩展名，避免泄露明文信息
+	now := time.Now()
+	fileName := utils.SanitizeFileName(info.FileName)
+	fileExt := filepath.Ext(fileName)
+	if info.E2EE {
+		fileExt = ".bin"
+	}
+	uuidFileName := uuid.New().String() + fileExt
+
+	relativePath := filepath.Join(
+		"uploads",
+		now.Format("2006"),
+		now.Format("01"),
+		now.Format("02"),
+		uuidFileName,
+	)
+
+	// 分享记录中的路径相对于 ./data/uploads（与普通上传一致），而分片存储根目录是 ./data
+	mergedPath := filepath.Join("uploads", relativePath)
+	if err := getStorageService().FinalizeChunks(ctx, uploadID, mergedPath); err != nil {
+		return nil, fmt.Errorf("合并分片失败: %w", err)
+	}
+
+	// 客户端声明了 SHA-256 时同步校验；否则在创建分享后异步计算，避免大文件完成请求长时间阻塞
+	var fileHash string
+	if info.FileHash != "" {
+		var err error
+		if fileHash, err = hashStoredFile(ctx, mergedPath); err != nil {
+			return nil, fmt.Errorf("计算文件哈希失败: %w", err)
+		}
+	}
+
+	// 校验合并结果与声明的大小、哈希一致，不一致时拒绝创建分享
+	if err := verifyMergedFile(ctx, info, mergedPath, fileHash); err != nil {
+		_ = getStorageService().DeleteFile(ctx, mergedPath)
+		_ = getChunkService().MarkUploadFailed(ctx, uploadID, err.Error())
+		return nil, err
+	}
+
+	// 根据合并后的文件头嗅探 MIME 类型
+	mimeType := "application/octet-stream"
+	if !info.E2EE {
+		mimeType = sniffStoredFile(ctx, mergedPath, fileName)
+	}
+
+	// 计算过期时间
+	expireCount := utils.CalculateExpireCount(opts.ExpireStyle, opts.ExpireValue)
+
+	// 确定上传类型
+	uploadType := "anonymous"
+	if userID != nil {
+		uploadType = "authenticated"
+	}
+
+	// 创建分享记录
+	// E2EE 分享不记录文件哈希和文件名，避免密文参与去重
+	if info.E2EE {
+		fileName = ""
+	}
+	prefix, suffix := utils.SplitFileName(fileName)
+	shareResult, err := getShareService().ShareFile(ctx, &shareService.ShareFileReq{
+		FilePath:      relativePath,
+		Size:          info.FileSize,
+		Prefix:        prefix,
+		Suffix:        suffix,
+		MimeType:      mimeType,
+		ExpiredAt:     expireTime,
+		AvailableFrom: opts.AvailableFrom,
+		ExpiredCount:  expireCount,
+		RequireAuth:   opts.RequireAuth,
+		UserID:        userID,
+		UploadType:    uploadType,
+		OwnerIP:       c.ClientIP(),
+		FileHash:      fileHash,
+		HashVerified:  fileHash != "",
+		IsChunked:     true,
+		UploadID:      uploadID,
+		E2EE:          info.E2EE,
+		E2EEMeta:      info.E2EEMeta,
+		E2EEChunks:    e2eeChunks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建分享记录失败: %w", err)
+	}
+
+	// 更新上传状态为完成
+	if err := getChunkService().CompleteUpload(ctx, uploadID); err != nil {
+		// 记录错误但不影响返回结果
+		fmt.Printf("更新上传状态失败: %v\n", err)
+	}
+	reservation.Commit()
+
+	// 补记文件哈希，使该文件可用于秒传；E2EE 密文不参与
+	if fileHash == "" && !info.E2EE {
+		go recordFileHash(shareResult.Code, mergedPath)
+	}
+	return shareResult, nil
+}
+
+// recordFileHash 后台计算已保存文件的 SHA-256 并写入分享记录
+func recordFileHash(code, path string) {
+	ctx := context.Background()
+	fileHash, err := hashStoredFile(ctx, path)
+	if err != nil {
+		logger.Warn("计算文件哈希失败", zap.String("code", code), zap.Error(err))
+		return
+	}
+	if err := getShareService().RecordFileHash(ctx, code, fileHash); err != nil {
+		logger.Warn("记录文件哈希失败", zap.String("code", code), zap.Error(err))
+	}
+}
+
+// quotaErrorStatus 错误对应的 HTTP 状态码：超出单次大小 413，超出存储配额 507，
+// 匿名上传过于频繁 429，禁止匿名上传文件 403，匿名有效期超限 400，其余为 500
+func quotaErrorStatus(err error) int {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		if exceeded.Reason == quota.ReasonStorageQuota {
+			return consts.StatusInsufficientStorage
+		}
+		return consts.StatusRequestEntityTooLarge
+	}
+
+	var limited *quota.AnonymousLimitError
+	if errors.As(err, &limited) {
+		switch limited.Reason {
+		case quota.ReasonAnonymousFileDisabled:
+			return consts.StatusForbidden
+		case quota.ReasonAnonymousExpiry:
+			return consts.StatusBadRequest
+		default:
+			return consts.StatusTooManyRequests
+		}
+	}
+	return consts.StatusInternalServerError
+}
+
+// writeQuotaError 写出错误响应，配额或匿名上传限制超限时附带限制信息
+func writeQuotaError(c *app.RequestContext, err error) {
+	status := quotaErrorStatus(err)
+	resp := map[string]interface{}{
+		"code":    status,
+		"message": err.Error(),
+	}
+
+	var exceeded *quota.ExceededError
+	var limited *quota.AnonymousLimitError
+	switch {
+	case errors.As(err, &exceeded):
+		resp["data"] = map[string]interface{}{
+			"reason":    exceeded.Reason,
+			"limit":     exceeded.Limit,
+			"used":      exceeded.Used,
+			"requested": exceeded.Requested,
+		}
+	case errors.As(err, &limited):
+		if status == consts.StatusTooManyRequests {
+			c.Header("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())+1))
+		}
+		resp["data"] = map[string]interface{}{
+			"reason":      limited.Reason,
+			"limit":       limited.Limit,
+			"retry_after": int(limited.RetryAfter.Seconds()),
+		}
+	}
+	c.JSON(status, resp)
+}
+
+// contextUserID 获取认证中间件写入的用户ID，匿名请求返回 nil
+func contextUserID(c *app.RequestContext) *uint {
+	if uid, exists := c.Get("user_id"); exists {
+		if uidUint, ok := uid.(uint); ok {
+			return &uidUint
+		}
+	}
+	return nil
+}
+
+// authorizeUpload 校验当前请求是否为上传会话的创建者，失败时返回对应的 HTTP 状态码
+// 匿名会话的上传令牌可通过 X-Upload-Token 头、upload_token 查询参数或表单字段携带
+func authorizeUpload(ctx context.Context, c *app.RequestContext, uploadID string) (*model.UploadChunk, int, error) {
+	token := string(c.GetHeader("X-Upload-Token"))
+	if token == "" {
+		token = c.Query("upload_token")
+	}
+	if token == "" {
+		token = c.PostForm("upload_token")
+	}
+
+	info, err := getChunkService().AuthorizeUpload(ctx, uploadID, contextUserID(c), token)
+	switch err {
+	case nil:
+		return info, consts.StatusOK, nil
+	case chunkService.ErrUploadNotFound:
+		return nil, consts.StatusNotFound, err
+	case chunkService.ErrUploadForbidden:
+		return nil, consts.StatusForbidden, err
+	default:
+		return nil, consts.StatusInternalServerError, err
+	}
+}
+
+// checkTusResumable 校验客户端使用的 tus 协议版本
+func checkTusResumable(c *app.RequestContext) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if string(c.GetHeader("Tus-Resumable")) != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		writeTusError(c, consts.StatusPreconditionFailed, "不支持的 tus 协议版本")
+		return false
+	}
+	return true
+}
+
+func writeTusError(c *app.RequestContext, status int, message string) {
+	c.JSON(status, map[string]interface{}{
+		"code":    status,
+		"message": message,
+	})
+}
+
+func tusChunkSize() int {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Upload.ChunkSize > 0 {
+		return int(cfg.Upload.ChunkSize)
+	}
+	return defaultTusChunkSize
+}
+
+// parseTusMetadata 解析 Upload-Metadata：逗号分隔的 "key base64(value)" 列表
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Upload-Metadata 格式错误")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata 中 %s 的值不是合法的 base64", key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// tusShareOptions 从 Upload-Metadata 读取分享设置（expire_value/expire_style/require_auth/available_from）
+func tusShareOptions(meta map[string]string) (shareOptions, error) {
+	opts := shareOptions{
+		ExpireValue: 1,
+		ExpireStyle: meta["expire_style"],
+		RequireAuth: meta["require_auth"] == "true",
+	}
+	if v := meta["expire_value"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("expire_value 必须是数字")
+		}
+		opts.ExpireValue = n
+	}
+	availableFrom, err := utils.ParseAvailableFrom(meta["available_from"])
+	if err != nil {
+		return opts, err
+	}
+	opts.AvailableFrom = availableFrom
+	return opts, nil
+}
+
+// newTusChecksum 根据 Upload-Checksum 的算法名创建哈希
+func newTusChecksum(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
+
+// writeTusBody 将 PATCH 请求体按 tusChunkSize 切分为分片写入存储，返回写入后的偏移量
+// 未携带 Upload-Checksum 时每个分片写入后立即记录，连接中断也能保留已写入的数据；
+// 携带校验时全部数据校验通过后才记录，校验失败的数据会被丢弃
+func writeTusBody(ctx context.Context, c *app.RequestContext, info *model.UploadChunk, offset int64) (int64, int, error) {
+	var checksum hash.Hash
+	var expected []byte
+	if header := string(c.GetHeader("Upload-Checksum")); header != "" {
+		algorithm, encoded, _ := strings.Cut(header, " ")
+		if checksum = newTusChecksum(algorithm); checksum == nil {
+			return offset, consts.StatusBadRequest, errors.New("不支持的校验算法: " + algorithm)
+		}
+		var err error
+		if expected, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return offset, consts.StatusBadRequest, errors.New("Upload-Checksum 格式错误")
+		}
+	}
+
+	var body io.Reader
+	if c.Request.IsBodyStream() {
+		body = c.Request.BodyStream()
+	} else {
+		body = bytes.NewReader(c.Request.Body())
+	}
+
+	type pendingChunk struct {
+		index int
+		size  int
+		hash  string
+	}
+	var pending []pendingChunk
+
+	remaining := info.FileSize - offset
+	reader := io.LimitReader(body, remaining+1)
+	buf := make([]byte, tusChunkSize())
+	index := info.TotalChunks
+	var written int64
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if n > 0 {
+			if written+int64(n) > remaining {
+				return offset + written, consts.StatusRequestEntityTooLarge, errors.New("写入的数据超过 Upload-Length")
+			}
+			data := buf[:n]
+			if err := getStorageService().SaveChunk(ctx, info.UploadID, index, offset+written, data); err != nil {
+				return offset + written, consts.StatusInternalServerError, fmt.Errorf("保存分片失败: %w", err)
+			}
+			sum := sha256.Sum256(data)
+			chunk := pendingChunk{index: index, size: n, hash: hex.EncodeToString(sum[:])}
+			if checksum != nil {
+				checksum.Write(data)
+				pending = append(pending, chunk)
+			} else if err := getChunkService().AppendChunk(ctx, info.UploadID, chunk.index, chunk.size, chunk.hash); err != nil {
+				return offset + written, consts.StatusInternalServerError, fmt.Errorf("记录分片信息失败: %w", err)
+			}
+			index++
+			written += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return offset + written, consts.StatusBadRequest, fmt.Errorf("读取请求体失败: %w", readErr)
+		}
+	}
+
+	if checksum != nil {
+		if !bytes.Equal(checksum.Sum(nil), expected) {
+			return offset, statusChecksumMismatch, errors.New("Checksum Mismatch")
+		}
+		for _, chunk := range pending {
+			if err := getChunkService().AppendChunk(ctx, info.UploadID, chunk.index, chunk.size, chunk.hash); err != nil {
+				return offset, consts.StatusInternalServerError, fmt.Errorf("记录分片信息失败: %w", err)
+			}
+		}
+	}
+	return offset + written, 0, nil
+}
+
+// finishTusUpload 数据写满后合并分片并创建分享，失败时已写出错误响应
+func finishTusUpload(ctx context.Context, c *app.RequestContext, uploadID string) bool {
+	// 重新读取控制记录，获取写入过程中更新的分片总数
+	info, err := getChunkService().GetUploadInfo(ctx, uploadID)
+	if err != nil {
+		writeTusError(c, consts.StatusInternalServerError, err.Error())
+		return false
+	}
+	meta, _ := parseTusMetadata(info.UploadMeta)
+	opts, _ := tusShareOptions(meta)
+
+	shareResult, err := finishUpload(ctx, c, info, opts)
+	if err != nil {
+		writeTusError(c, quotaErrorStatus(err), err.Error())
+		return false
+	}
+	setTusShareHeaders(c, shareResult.Code)
+	// 上传已完成，之后的 PATCH 会被拒绝，不再需要写锁
+	chunkService.ReleaseUploadLock(uploadID)
+	return true
+}
+
+// setTusShareHeaders 通过响应头返回上传完成后生成的分享码
+func setTusShareHeaders(c *app.RequestContext, code string) {
+	c.Header("Upload-Share-Code", code)
+	c.Header("Upload-Share-Url", fmt.Sprintf("%s/share/%s", defaultBaseURL, code))
+}
@@ -0,0 +1,115 @@
+package chunk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	chunkService "github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+)
+
+// lockWait 判断请求是否在等待上传锁的时长
+const lockWait = 200 * time.Millisecond
+
+type upload struct {
+	base  string
+	id    string
+	token string
+}
+
+func initUpload(t *testing.T, base string) *upload {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{
+		"file_name": "a.bin", "file_size": 8, "chunk_size": 4, "total_chunks": 2,
+	})
+	resp, err := http.Post(base+"/chunk/upload/init/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("初始化上传失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Data struct {
+			UploadID    string `json:"upload_id"`
+			UploadToken string `json:"upload_token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.Data.UploadID == "" {
+		t.Fatalf("初始化上传: status=%d err=%v", resp.StatusCode, err)
+	}
+	return &upload{base: base, id: out.Data.UploadID, token: out.Data.UploadToken}
+}
+
+func (u *upload) chunk(index int, data []byte) int {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("chunk", fmt.Sprintf("chunk_%d", index))
+	_, _ = part.Write(data)
+	_ = writer.WriteField("upload_token", u.token)
+	_ = writer.Close()
+
+	resp, err := http.Post(fmt.Sprintf("%s/chunk/upload/chunk/%s/%d", u.base, u.id, index), writer.FormDataContentType(), body)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (u *upload) complete() int {
+	body, _ := json.Marshal(map[string]interface{}{"expire_value": 1, "expire_style": "day"})
+	resp, err := http.Post(u.base+"/chunk/upload/complete/"+u.id+"?upload_token="+u.token, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// waitLocked 确认请求在锁释放前一直等待，释放后返回其状态码
+func waitLocked(t *testing.T, unlock func(), request func() int) int {
+	t.Helper()
+	done := make(chan int, 1)
+	go func() { done <- request() }()
+
+	select {
+	case status := <-done:
+		unlock()
+		t.Fatalf("请求未等待上传锁，返回 %d", status)
+	case <-time.After(lockWait):
+	}
+	unlock()
+	return <-done
+}
+
+func TestChunkUploadHoldsUploadLock(t *testing.T) {
+	testenv.Setup(t)
+	u := initUpload(t, testenv.StartServer(t))
+
+	if status := u.chunk(0, []byte("abcd")); status != http.StatusOK {
+		t.Fatalf("上传分片 0 返回 %d", status)
+	}
+
+	// 合并期间（独占锁）到达的分片需要等待，不会写进正在校验的数据文件
+	lock := chunkService.UploadLock(u.id)
+	lock.Lock()
+	if status := waitLocked(t, lock.Unlock, func() int { return u.chunk(1, []byte("efgh")) }); status != http.StatusOK {
+		t.Fatalf("上传分片 1 返回 %d", status)
+	}
+
+	// 分片写入期间（共享锁）完成请求需要等待
+	lock = chunkService.UploadLock(u.id)
+	lock.RLock()
+	if status := waitLocked(t, lock.RUnlock, u.complete); status != http.StatusOK {
+		t.Fatalf("完成上传返回 %d", status)
+	}
+
+	// 完成后到达的分片被拒绝
+	if status := u.chunk(1, []byte("efgh")); status != http.StatusConflict {
+		t.Fatalf("完成后上传分片返回 %d", status)
+	}
+}
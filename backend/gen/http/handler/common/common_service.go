@@ -8,6 +8,7 @@ import (
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	common "github.com/zy84338719/fileCodeBox/backend/gen/http/model/common"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
 )
 
 // Health .
@@ -57,3 +58,13 @@ func Ping(ctx context.Context, c *app.RequestContext) {
 
 	c.JSON(consts.StatusOK, resp)
 }
+
+// JWKS 以 JWK Set 格式公开访问令牌的验证公钥，其他服务可据此验证本服务签发的令牌
+// 只包含 EdDSA/RS256 密钥，HS256 共享密钥不会公开
+// @router /.well-known/jwks.json [GET]
+func JWKS(ctx context.Context, c *app.RequestContext) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"keys": auth.PublicJWKs(),
+	})
+}
@@ -4,13 +4,21 @@ package maintenance
 
 import (
 	"context"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	adminsvc "github.com/zy84338719/fileCodeBox/backend/internal/app/admin"
+	chunksvc "github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/guard"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
 )
 
-var adminService *adminsvc.Service
+var (
+	adminService *adminsvc.Service
+	storageSvc   storage.StorageInterface
+)
 
 func init() {
 	adminService = adminsvc.NewService()
@@ -39,7 +47,15 @@ func CleanExpiredFiles(ctx context.Context, c *app.RequestContext) {
 // CleanTempFiles 清理临时文件
 // @router /admin/maintenance/clean-temp [POST]
 func CleanTempFiles(ctx context.Context, c *app.RequestContext) {
-	count, err := adminService.CleanupIncompleteUploads(ctx, 24)
+	ttlHours := 24
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Upload.SessionTTLHours > 0 {
+		ttlHours = cfg.Upload.SessionTTLHours
+	}
+
+	// 与后台回收任务共用同一套逻辑：删除分片存储、删除会话记录并写入操作日志
+	actor := c.GetString("username")
+	janitor := chunksvc.NewJanitor(chunksvc.NewService(), getStorageService(), time.Duration(ttlHours)*time.Hour, 0)
+	result, err := janitor.RunOnce(ctx, actor)
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -51,7 +67,9 @@ func CleanTempFiles(ctx context.Context, c *app.RequestContext) {
 		"code":    200,
 		"message": "清理完成",
 		"data": map[string]interface{}{
-			"deleted_count": count,
+			"deleted_count": result.Sessions,
+			"freed_space":   result.FreedBytes,
+			"failed_count":  result.Failed,
 		},
 	})
 }
@@ -80,6 +98,49 @@ func GetSystemInfo(ctx context.Context, c *app.RequestContext) {
 	})
 }
 
+// ListLookupBlocks 列出分享码查找防护生效中的封禁
+// @router /admin/maintenance/blocks [GET]
+func ListLookupBlocks(ctx context.Context, c *app.RequestContext) {
+	blocks, err := guard.GetService().ListBlocks(ctx)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "获取封禁列表失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": blocks,
+	})
+}
+
+// ClearLookupBlock 解除一条封禁，scope 为 ip 或 prefix
+// @router /admin/maintenance/blocks [DELETE]
+func ClearLookupBlock(ctx context.Context, c *app.RequestContext) {
+	scope := c.Query("scope")
+	subject := c.Query("subject")
+	if subject == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请提供要解除封禁的对象",
+		})
+		return
+	}
+
+	if err := guard.GetService().Unblock(ctx, scope, subject, c.GetString("username")); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "解除封禁失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已解除封禁",
+	})
+}
+
 // GetStorageStatus 获取存储状态
 // @router /admin/maintenance/monitor/storage [GET]
 func GetStorageStatus(ctx context.Context, c *app.RequestContext) {
@@ -94,3 +155,14 @@ func GetStorageStatus(ctx context.Context, c *app.RequestContext) {
 		"data": status,
 	})
 }
+
+func getStorageService() storage.StorageInterface {
+	if storageSvc == nil {
+		// 存储根目录与分片上传处理器保持一致
+		storageSvc = storage.NewStorageService(&storage.StorageConfig{
+			Type:     storage.StorageTypeLocal,
+			DataPath: "./data",
+		})
+	}
+	return storageSvc
+}
@@ -4,18 +4,29 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	shareService "github.com/zy84338719/fileCodeBox/backend/internal/app/share"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
 	previewService "github.com/zy84338719/fileCodeBox/backend/internal/preview"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
 	dao_preview "github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao_preview"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+)
+
+var (
+	shareSvc     *shareService.Service
+	shareSvcOnce sync.Once
 )
 
 // GetPreview 获取文件预览信息
 // @router /preview/:code [GET]
 func GetPreview(ctx context.Context, c *app.RequestContext) {
+	start := time.Now()
 	code := c.Param("code")
 	if code == "" {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -36,6 +47,28 @@ func GetPreview(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	// 未到生效时间的分享不对外暴露内容
+	if !fileCode.IsAvailable() {
+		c.JSON(consts.StatusForbidden, map[string]interface{}{
+			"code":    403,
+			"message": "分享尚未生效",
+			"data": map[string]interface{}{
+				"not_yet_available": true,
+				"available_from":    fileCode.AvailableFrom.Format(time.RFC3339),
+			},
+		})
+		return
+	}
+
+	// E2EE 分享只有密文，服务端无法也不应生成预览
+	if fileCode.E2EE {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": "端到端加密分享不支持预览",
+		})
+		return
+	}
+
 	// 获取预览信息
 	previewRepo := dao_preview.NewFilePreviewRepository()
 	preview, err := previewRepo.GetByFileCodeID(ctx, fileCode.ID)
@@ -51,6 +84,8 @@ func GetPreview(ctx context.Context, c *app.RequestContext) {
 		}
 	}
 
+	recordPreviewView(ctx, c, fileCode, start)
+
 	c.JSON(consts.StatusOK, map[string]interface{}{
 		"code":    200,
 		"message": "获取成功",
@@ -58,6 +93,38 @@ func GetPreview(ctx context.Context, c *app.RequestContext) {
 	})
 }
 
+// getShareService 预览只用分享服务写访问日志，不需要存储驱动
+func getShareService() *shareService.Service {
+	shareSvcOnce.Do(func() {
+		shareSvc = shareService.NewService("", nil)
+	})
+	return shareSvc
+}
+
+// recordPreviewView 记录一次预览查看，失败不影响请求
+func recordPreviewView(ctx context.Context, c *app.RequestContext, fileCode *model.FileCode, start time.Time) {
+	ev := &shareService.AccessEvent{
+		Operation: model.TransferOpPreview,
+		FileCode:  fileCode,
+		IP:        c.ClientIP(),
+		UserAgent: string(c.UserAgent()),
+		Duration:  time.Since(start),
+		Success:   true,
+	}
+	if uid, exists := c.Get("user_id"); exists {
+		if uidUint, ok := uid.(uint); ok {
+			ev.UserID = &uidUint
+		}
+	}
+	if username, exists := c.Get("username"); exists {
+		ev.Username, _ = username.(string)
+	}
+
+	if err := getShareService().RecordAccess(ctx, ev); err != nil {
+		logger.Warn("记录预览日志失败", zap.String("code", fileCode.Code), zap.Error(err))
+	}
+}
+
 // generatePreview 生成预览
 func generatePreview(ctx context.Context, fileCode *model.FileCode) (*model.FilePreview, error) {
 	// 判断文件类型
@@ -72,14 +139,9 @@ func generatePreview(ctx context.Context, fileCode *model.FileCode) (*model.File
 				}
 			}
 		}
-		// 如果还是没有，从Text字段（原始文件名）提取
-		if ext == "" && fileCode.Text != "" {
-			for i := len(fileCode.Text) - 1; i >= 0; i-- {
-				if fileCode.Text[i] == '.' {
-					ext = fileCode.Text[i:]
-					break
-				}
-			}
+		// 如果还是没有，从原始文件名提取（兼容旧数据保存在 Text 中的文件名）
+		if ext == "" {
+			ext = filepath.Ext(fileCode.FileName())
 		}
 	}
 
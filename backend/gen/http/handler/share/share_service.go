@@ -4,8 +4,11 @@ package share
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html"
+	"io"
+	"mime/multipart"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -15,9 +18,15 @@ import (
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	"github.com/google/uuid"
 	sharemodel "github.com/zy84338719/fileCodeBox/backend/gen/http/model/share"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/guard"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/quota"
 	shareService "github.com/zy84338719/fileCodeBox/backend/internal/app/share"
+	userService "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
 	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/utils"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	"go.uber.org/zap"
 )
 
 var shareSvc *shareService.Service
@@ -25,9 +34,8 @@ var storageSvc storage.StorageInterface
 
 // 配置常量（应从配置读取，这里使用默认值）
 const (
-	defaultMaxUploadSize = 10485760 // 10MB
-	defaultStoragePath   = "./data/uploads"
-	defaultBaseURL       = "http://localhost:12345"
+	defaultStoragePath = "./data/uploads"
+	defaultBaseURL     = "http://localhost:12345"
 )
 
 func getStorageService() storage.StorageInterface {
@@ -41,9 +49,18 @@ func getStorageService() storage.StorageInterface {
 	return storageSvc
 }
 
+// shareExtParams IDL 之外的分享扩展参数
+type shareExtParams struct {
+	E2EE          bool   `json:"e2ee" form:"e2ee"`
+	E2EEMeta      string `json:"e2ee_meta" form:"e2ee_meta"`
+	AvailableFrom string `json:"available_from" form:"available_from"` // RFC 3339 或 Unix 时间戳
+	Password      string `json:"password" form:"password"`             // 访问密码，为空表示不设置
+}
+
 func getShareService() *shareService.Service {
 	if shareSvc == nil {
 		shareSvc = shareService.NewService(defaultBaseURL, getStorageService())
+		shareSvc.SetUserService(userService.NewService())
 	}
 	return shareSvc
 }
@@ -62,6 +79,33 @@ func ShareText(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	// IDL 之外的扩展参数（端到端加密）
+	var ext shareExtParams
+	if err = c.Bind(&ext); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	availableFrom, err := utils.ParseAvailableFrom(ext.AvailableFrom)
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err = shareService.ValidatePassword(ext.Password); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 空文本验证：拒绝空文本或只包含空白字符的文本
 	if strings.TrimSpace(req.Text) == "" {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -72,7 +116,11 @@ func ShareText(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// XSS 防护：对文本内容进行 HTML 转义
-	safeText := html.EscapeString(req.Text)
+	// E2EE 文本是客户端密文，服务端必须原样保存，不做任何转换
+	safeText := req.Text
+	if !ext.E2EE {
+		safeText = html.EscapeString(req.Text)
+	}
 
 	// 获取用户ID（如果有）
 	var userID *uint
@@ -85,15 +133,32 @@ func ShareText(ctx context.Context, c *app.RequestContext) {
 	// 获取客户端 IP
 	ownerIP := c.ClientIP()
 
+	// 匿名分享：校验有效期上限和按 IP 统计的上传频率，创建失败时退回计数
+	var anonUpload *quota.AnonymousUpload
+	if userID == nil {
+		expireAt := utils.CalculateExpireTimeFrom(availableFrom, int(req.ExpireValue), req.ExpireStyle)
+		if err = quota.CheckAnonymousExpiry(expireAt, availableFrom); err == nil {
+			anonUpload, err = quota.GetService().ReserveAnonymousUpload(ctx, ownerIP, int64(len(req.Text)), false)
+		}
+		if err != nil {
+			writeQuotaError(c, err)
+			return
+		}
+	}
+	defer anonUpload.Release()
+
 	// 调用 service（使用转义后的安全文本）
-	result, err := getShareService().ShareTextWithAuth(
-		ctx,
-		safeText,
-		int(req.ExpireValue),
-		req.ExpireStyle,
-		userID,
-		ownerIP,
-	)
+	result, err := getShareService().ShareTextWithAuth(ctx, &shareService.ShareTextWithAuthReq{
+		Text:          safeText,
+		ExpireValue:   int(req.ExpireValue),
+		ExpireStyle:   req.ExpireStyle,
+		AvailableFrom: availableFrom,
+		Password:      ext.Password,
+		UserID:        userID,
+		OwnerIP:       ownerIP,
+		E2EE:          ext.E2EE,
+		E2EEMeta:      ext.E2EEMeta,
+	})
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -101,6 +166,7 @@ func ShareText(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	anonUpload.Commit()
 
 	resp := &sharemodel.ShareTextResp{
 		Code:    200,
@@ -122,70 +188,106 @@ func ShareFile(ctx context.Context, c *app.RequestContext) {
 	expireStyle := c.DefaultPostForm("expire_style", "day")
 	requireAuth := c.DefaultPostForm("require_auth", "false") == "true"
 	password := c.DefaultPostForm("password", "")
+	isE2EE := c.DefaultPostForm("e2ee", "false") == "true"
 
 	expireValue, err := strconv.Atoi(expireValueStr)
 	if err != nil {
 		expireValue = 1
 	}
 
-	// 2. 获取上传文件
-	file, err := c.FormFile("file")
+	availableFrom, err := utils.ParseAvailableFrom(c.DefaultPostForm("available_from", ""))
 	if err != nil {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
 			"code":    400,
-			"message": "请上传文件",
+			"message": err.Error(),
 		})
 		return
 	}
-
-	// 3. 检查文件大小
-	if file.Size > defaultMaxUploadSize {
+	if err = shareService.ValidatePassword(password); err != nil {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
 			"code":    400,
-			"message": fmt.Sprintf("文件大小超过限制（最大 %d MB）", defaultMaxUploadSize/1024/1024),
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// 4. 生成唯一文件名
-	originalFilename := file.Filename
-	fileExt := filepath.Ext(originalFilename)
-	uuidFileName := uuid.New().String() + fileExt
-
-	// 5. 生成存储路径（按日期分目录）
-	now := time.Now()
-	relativePath := filepath.Join(
-		"uploads",
-		now.Format("2006"),
-		now.Format("01"),
-		now.Format("02"),
-	)
-	savePath := filepath.Join(relativePath, uuidFileName)
+	// E2EE 分享：校验客户端提供的加密元数据
+	var e2eeMeta string
+	if isE2EE {
+		e2eeMeta, err = shareService.ValidateE2EEMeta(c.DefaultPostForm("e2ee_meta", ""))
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 
-	// 6. 保存文件到存储
-	storageSvc := getStorageService()
-	result, err := storageSvc.SaveFile(ctx, file, savePath)
+	// 2. 获取上传文件
+	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
-			"code":    500,
-			"message": fmt.Sprintf("文件保存失败: %v", err),
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请上传文件",
 		})
 		return
 	}
 
-	// 7. 计算过期时间
-	expireTime := utils.CalculateExpireTime(expireValue, expireStyle)
-	expireCount := utils.CalculateExpireCount(expireStyle, expireValue)
-
-	// 8. 获取用户ID（如果有）
+	// 3. 获取用户ID（如果有），检查单次大小和存储配额并预留用量
 	var userID *uint
 	if uid, exists := c.Get("user_id"); exists {
 		if uidUint, ok := uid.(uint); ok {
 			userID = &uidUint
 		}
 	}
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: userID, Size: file.Size})
+	if err != nil {
+		writeQuotaError(c, err)
+		return
+	}
+	defer reservation.Release()
+
+	// 匿名上传：校验是否允许上传文件、有效期上限和按 IP 统计的上传频率，上传失败时退回计数
+	expireTime := utils.CalculateExpireTimeFrom(availableFrom, expireValue, expireStyle)
+	var anonUpload *quota.AnonymousUpload
+	if userID == nil {
+		if err = quota.CheckAnonymousExpiry(expireTime, availableFrom); err == nil {
+			anonUpload, err = quota.GetService().ReserveAnonymousUpload(ctx, c.ClientIP(), file.Size, true)
+		}
+		if err != nil {
+			writeQuotaError(c, err)
+			return
+		}
+	}
+	defer anonUpload.Release()
+
+	// 4. 解析原始文件名和 MIME 类型
+	// E2EE 分享不保留原始文件名和扩展名，避免向服务端泄露明文信息
+	originalFilename := utils.SanitizeFileName(file.Filename)
+	fileExt := filepath.Ext(originalFilename)
+	mimeType := sniffUploadedFile(file, originalFilename)
+	if isE2EE {
+		originalFilename = ""
+		fileExt = ".bin"
+		mimeType = "application/octet-stream"
+	}
+	prefix, suffix := utils.SplitFileName(originalFilename)
 
-	// 9. 获取客户端 IP
+	// 5-6. 按日期分目录保存文件到存储
+	result, err := saveUploadedFile(ctx, file, fileExt)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": fmt.Sprintf("文件保存失败: %v", err),
+		})
+		return
+	}
+
+	// 7. 计算过期次数（过期时间已在上传前计算）
+	expireCount := utils.CalculateExpireCount(expireStyle, expireValue)
+
+	// 8-9. 获取客户端 IP
 	ownerIP := c.ClientIP()
 
 	// 10. 确定上传类型
@@ -195,17 +297,29 @@ func ShareFile(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 11. 构建分享请求
+	// E2EE 文件的摘要是密文的摘要，不能用于去重和秒传
+	fileHash, hashVerified := result.FileHash, true
+	if isE2EE {
+		fileHash, hashVerified = "", false
+	}
 	shareReq := &shareService.ShareFileReq{
-		FilePath:     result.FilePath,
-		Size:         result.FileSize,
-		Text:         originalFilename, // 存储原始文件名
-		ExpiredAt:    expireTime,
-		ExpiredCount: expireCount,
-		RequireAuth:  requireAuth,
-		UserID:       userID,
-		UploadType:   uploadType,
-		OwnerIP:      ownerIP,
-		FileHash:     result.FileHash,
+		FilePath:      result.FilePath,
+		Size:          result.FileSize,
+		Prefix:        prefix,
+		Suffix:        suffix,
+		MimeType:      mimeType,
+		ExpiredAt:     expireTime,
+		AvailableFrom: availableFrom,
+		ExpiredCount:  expireCount,
+		RequireAuth:   requireAuth,
+		Password:      password,
+		UserID:        userID,
+		UploadType:    uploadType,
+		OwnerIP:       ownerIP,
+		FileHash:      fileHash,
+		HashVerified:  hashVerified,
+		E2EE:          isE2EE,
+		E2EEMeta:      e2eeMeta,
 	}
 
 	// 12. 调用 service 创建分享记录
@@ -217,6 +331,8 @@ func ShareFile(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	reservation.Commit()
+	anonUpload.Commit()
 
 	// 13. 构建响应
 	fullShareURL := fmt.Sprintf("%s/share/%s", defaultBaseURL, shareResult.Code)
@@ -230,9 +346,6 @@ func ShareFile(ctx context.Context, c *app.RequestContext) {
 		},
 	}
 
-	// 保存 password 用于验证（如果需要）
-	_ = password // TODO: 实现密码验证逻辑
-
 	c.JSON(consts.StatusOK, resp)
 }
 
@@ -283,8 +396,12 @@ func GetUserShares(ctx context.Context, c *app.RequestContext) {
 	for i, f := range files {
 		items[i] = map[string]interface{}{
 			"code":           f.Code,
-			"filename":       f.UUIDFileName,
+			"filename":       f.FileName(),
+			"prefix":         f.Prefix,
+			"suffix":         f.Suffix,
+			"mime_type":      f.MimeType,
 			"file_size":      f.Size,
+			"available_from": f.AvailableFrom,
 			"content_type":   f.UploadType,
 			"download_count": f.UsedCount,
 			"created_at":     f.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -370,9 +487,246 @@ func DeleteShare(ctx context.Context, c *app.RequestContext) {
 	})
 }
 
+// UploadShareVersion 为已有分享上传新版本（仅所有者）
+// @router /share/:code/versions [POST]
+func UploadShareVersion(ctx context.Context, c *app.RequestContext) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+			"code":    401,
+			"message": "请先登录",
+		})
+		return
+	}
+
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "用户ID格式错误",
+		})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请上传文件",
+		})
+		return
+	}
+	// 新版本计入存储用量，同样需要检查配额
+	reservation, err := quota.GetService().Reserve(ctx, &quota.ReserveReq{UserID: &userID, Size: file.Size})
+	if err != nil {
+		writeQuotaError(c, err)
+		return
+	}
+	defer reservation.Release()
+
+	fileName := utils.SanitizeFileName(file.Filename)
+	result, err := saveUploadedFile(ctx, file, filepath.Ext(fileName))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": fmt.Sprintf("文件保存失败: %v", err),
+		})
+		return
+	}
+
+	shareResult, err := getShareService().AddVersion(ctx, &shareService.NewVersionReq{
+		Code:     c.Param("code"),
+		UserID:   userID,
+		FilePath: result.FilePath,
+		Size:     result.FileSize,
+		FileName: fileName,
+		MimeType: sniffUploadedFile(file, fileName),
+		FileHash: result.FileHash,
+	})
+	if err != nil {
+		// 更新失败时清理刚保存的文件
+		_ = getStorageService().DeleteFile(ctx, result.FilePath)
+
+		errMsg := err.Error()
+		switch {
+		case errors.Is(err, shareService.ErrVersionConflict):
+			c.JSON(consts.StatusConflict, map[string]interface{}{
+				"code":    409,
+				"message": errMsg,
+			})
+		case errMsg == "分享不存在":
+			c.JSON(consts.StatusNotFound, map[string]interface{}{
+				"code":    404,
+				"message": errMsg,
+			})
+		case errMsg == "无权限更新此分享":
+			c.JSON(consts.StatusForbidden, map[string]interface{}{
+				"code":    403,
+				"message": errMsg,
+			})
+		case errMsg == "文本分享不支持版本更新", errMsg == "端到端加密分享不支持版本更新":
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": errMsg,
+			})
+		default:
+			c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+				"code":    500,
+				"message": fmt.Sprintf("更新版本失败: %s", errMsg),
+			})
+		}
+		return
+	}
+
+	reservation.Commit()
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "新版本上传成功",
+		"data": map[string]interface{}{
+			"code":    shareResult.Code,
+			"version": shareResult.Version,
+			"size":    shareResult.Size,
+		},
+	})
+}
+
+// ListShareVersions 获取分享的版本历史（仅所有者）
+// @router /share/:code/versions [GET]
+func ListShareVersions(ctx context.Context, c *app.RequestContext) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+			"code":    401,
+			"message": "请先登录",
+		})
+		return
+	}
+
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "用户ID格式错误",
+		})
+		return
+	}
+
+	fileCode, versions, err := getShareService().ListVersions(ctx, c.Param("code"), userID)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "分享不存在" {
+			c.JSON(consts.StatusNotFound, map[string]interface{}{
+				"code":    404,
+				"message": errMsg,
+			})
+			return
+		}
+		if errMsg == "无权限查看此分享" {
+			c.JSON(consts.StatusForbidden, map[string]interface{}{
+				"code":    403,
+				"message": errMsg,
+			})
+			return
+		}
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": errMsg,
+		})
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(versions)+1)
+	items = append(items, map[string]interface{}{
+		"version":    fileCode.Version,
+		"file_name":  fileCode.FileName(),
+		"mime_type":  fileCode.MimeType,
+		"size":       fileCode.Size,
+		"created_at": fileCode.UpdatedAt.Format("2006-01-02 15:04:05"),
+		"current":    true,
+	})
+	for _, v := range versions {
+		items = append(items, map[string]interface{}{
+			"version":    v.Version,
+			"file_name":  v.FileName,
+			"mime_type":  v.MimeType,
+			"size":       v.Size,
+			"created_at": v.CreatedAt.Format("2006-01-02 15:04:05"),
+			"current":    false,
+		})
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "获取成功",
+		"data": map[string]interface{}{
+			"code":     fileCode.Code,
+			"current":  fileCode.Version,
+			"versions": items,
+		},
+	})
+}
+
+// ShareStats 分享访问统计（仅所有者）
+// @router /share/:code/stats [GET]
+func ShareStats(ctx context.Context, c *app.RequestContext) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+			"code":    401,
+			"message": "请先登录",
+		})
+		return
+	}
+
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "用户ID格式错误",
+		})
+		return
+	}
+
+	code := c.Param("code")
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+	stats, err := getShareService().GetShareStats(ctx, code, userID, days)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "分享不存在" {
+			c.JSON(consts.StatusNotFound, map[string]interface{}{
+				"code":    404,
+				"message": errMsg,
+			})
+			return
+		}
+		if errMsg == "无权限查看此分享的统计" {
+			c.JSON(consts.StatusForbidden, map[string]interface{}{
+				"code":    403,
+				"message": errMsg,
+			})
+			return
+		}
+
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": errMsg,
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "获取成功",
+		"data":    stats,
+	})
+}
+
 // GetShare .
 // @router /share/select/ [GET]
 func GetShare(ctx context.Context, c *app.RequestContext) {
+	start := time.Now()
 	code := c.Query("code")
 	password := c.Query("password")
 
@@ -383,10 +737,22 @@ func GetShare(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	if writeLookupBlocked(c, guard.GetService().Check(ctx, c.ClientIP(), code)) {
+		return
+	}
+	if password != "" && writeLookupBlocked(c, guard.GetService().CheckPasswordAttempt(ctx, c.ClientIP(), code)) {
+		return
+	}
 
 	// 获取分享内容
 	fileCode, err := getShareService().GetFileByCode(ctx, code)
 	if err != nil {
+		if writeNotYetAvailable(c, err) {
+			return
+		}
+		if writeLookupBlocked(c, guard.GetService().RecordFailure(ctx, c.ClientIP(), code)) {
+			return
+		}
 		c.JSON(consts.StatusNotFound, map[string]interface{}{
 			"code":    404,
 			"message": "分享不存在或已过期",
@@ -394,43 +760,71 @@ func GetShare(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 检查是否需要密码
-	if fileCode.RequireAuth && password == "" {
-		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
-			"code":    401,
-			"message": "需要密码",
+	// 校验访问密码，密码错误与分享码不存在一样计入失败次数
+	if writePasswordError(ctx, c, code, shareService.CheckPassword(fileCode, password)) {
+		return
+	}
+
+	// E2EE 分享：返回不透明的加密元数据，而不是文件名/文本
+	if fileCode.E2EE {
+		meta, chunks := shareService.DecodeE2EEInfo(fileCode.E2EEMeta, fileCode.E2EEChunks)
+		c.JSON(consts.StatusOK, map[string]interface{}{
+			"code":    200,
+			"message": "获取成功",
 			"data": map[string]interface{}{
-				"has_password": true,
+				"code":         fileCode.Code,
+				"e2ee":         true,
+				"e2ee_meta":    meta,
+				"e2ee_chunks":  chunks,
+				"file_size":    fmt.Sprintf("%d", fileCode.Size),
+				"url":          fmt.Sprintf("/share/download?code=%s", fileCode.Code),
+				"has_password": fileCode.HasPassword(),
 			},
 		})
 		return
 	}
 
-	// TODO: 验证密码
+	// 文本分享在此处直接返回内容，视为一次文本读取
+	if fileCode.IsText() {
+		recordAccess(newAccessEvent(c, fileCode, model.TransferOpText), int64(len(fileCode.Text)), start, true)
 
-	// 构建响应
-	resp := &sharemodel.GetShareResp{
-		Code:    200,
-		Message: "获取成功",
-		Data: &sharemodel.ShareDetail{
-			Code:        fileCode.Code,
-			Text:        fileCode.Text,
-			FileName:    fileCode.UUIDFileName,
-			FileSize:    fmt.Sprintf("%d", fileCode.Size),
-			Url:         fmt.Sprintf("/download/%s", fileCode.Code),
-			HasPassword: fileCode.RequireAuth,
-			// ExpireTime:  fileCode.ExpiredAt.Format("2006-01-02 15:04:05"),
-		},
+		c.JSON(consts.StatusOK, &sharemodel.GetShareResp{
+			Code:    200,
+			Message: "获取成功",
+			Data: &sharemodel.ShareDetail{
+				Code:        fileCode.Code,
+				Text:        fileCode.Text,
+				HasPassword: fileCode.HasPassword(),
+			},
+		})
+		return
 	}
 
-	c.JSON(consts.StatusOK, resp)
+	// 文件分享：返回原始文件名和 MIME 类型（IDL 的 ShareDetail 没有这些字段，直接返回 map）
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "获取成功",
+		"data": map[string]interface{}{
+			"code":         fileCode.Code,
+			"file_name":    fileCode.FileName(),
+			"prefix":       fileCode.Prefix,
+			"suffix":       fileCode.Suffix,
+			"mime_type":    fileCode.MimeType,
+			"file_size":    fmt.Sprintf("%d", fileCode.Size),
+			"url":          fmt.Sprintf("/share/download?code=%s", fileCode.Code),
+			"has_password": fileCode.HasPassword(),
+			"version":      fileCode.Version,
+		},
+	})
 }
 
 // DownloadFile 下载分享文件
 // @router /share/download [GET]
 func DownloadFile(ctx context.Context, c *app.RequestContext) {
+	start := time.Now()
 	code := c.Query("code")
 	password := c.Query("password")
+	rangeHeader := string(c.GetHeader("Range"))
 
 	if code == "" {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -439,18 +833,23 @@ func DownloadFile(ctx context.Context, c *app.RequestContext) {
 		})
 		return
 	}
+	if writeLookupBlocked(c, guard.GetService().Check(ctx, c.ClientIP(), code)) {
+		return
+	}
+	if password != "" && writeLookupBlocked(c, guard.GetService().CheckPasswordAttempt(ctx, c.ClientIP(), code)) {
+		return
+	}
 
 	// 获取分享内容并增加使用次数
 	fileCode, err := getShareService().GetFileWithUsage(ctx, code, password)
 	if err != nil {
-		if err.Error() == "需要密码" {
-			c.JSON(consts.StatusUnauthorized, map[string]interface{}{
-				"code":    401,
-				"message": "需要密码",
-				"data": map[string]interface{}{
-					"has_password": true,
-				},
-			})
+		if writeNotYetAvailable(c, err) {
+			return
+		}
+		if writePasswordError(ctx, c, code, err) {
+			return
+		}
+		if writeLookupBlocked(c, guard.GetService().RecordFailure(ctx, c.ClientIP(), code)) {
 			return
 		}
 		c.JSON(consts.StatusNotFound, map[string]interface{}{
@@ -460,17 +859,29 @@ func DownloadFile(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// 更新下载次数
-	if err := getShareService().UpdateFileUsage(ctx, code); err != nil {
-		// 记录错误但不阻止下载
-		fmt.Printf("更新下载次数失败: %v\n", err)
+	// 更新下载次数（断点续传的后续请求不重复计数）
+	if !isResumeRange(rangeHeader) {
+		if err := getShareService().UpdateFileUsage(ctx, code); err != nil {
+			// 记录错误但不阻止下载
+			fmt.Printf("更新下载次数失败: %v\n", err)
+		}
+	}
+
+	// E2EE 文本分享：原样返回密文
+	if fileCode.E2EE && fileCode.GetFilePath() == "" {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", `attachment; filename="ciphertext.bin"`)
+		c.SetBodyString(fileCode.Text)
+		recordAccess(newAccessEvent(c, fileCode, model.TransferOpText), int64(len(fileCode.Text)), start, true)
+		return
 	}
 
 	// 如果是文本分享，直接返回文本
-	if fileCode.Text != "" {
+	if fileCode.IsText() {
 		c.Header("Content-Type", "text/plain; charset=utf-8")
 		c.Header("Content-Disposition", `inline; filename="text.txt"`)
 		c.SetBodyString(fileCode.Text)
+		recordAccess(newAccessEvent(c, fileCode, model.TransferOpText), int64(len(fileCode.Text)), start, true)
 		return
 	}
 
@@ -484,27 +895,295 @@ func DownloadFile(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	fileName := fileCode.FileName()
+	mimeType := fileCode.MimeType
+
+	// 指定 ?version= 时下载历史版本，默认下载最新版本
+	if versionStr := c.Query("version"); versionStr != "" {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": "版本号格式错误",
+			})
+			return
+		}
+		history, err := getShareService().GetVersion(ctx, fileCode, version)
+		if err != nil {
+			c.JSON(consts.StatusNotFound, map[string]interface{}{
+				"code":    404,
+				"message": err.Error(),
+			})
+			return
+		}
+		if history != nil {
+			filePath = history.GetFilePath()
+			fileName = history.FileName
+			mimeType = history.MimeType
+		}
+	}
+
+	ev := newAccessEvent(c, fileCode, model.TransferOpDownload)
+
 	// 获取文件读取器
 	reader, fileSize, err := getStorageService().GetFileReader(ctx, filePath)
 	if err != nil {
+		recordAccess(ev, 0, start, false)
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
 			"message": fmt.Sprintf("获取文件失败: %v", err),
 		})
 		return
 	}
-	defer reader.Close()
+	// reader 由 SetBodyStream 在响应写完后关闭，这里不能提前 Close
+
+	// 断点续传：仅支持单个区间，且存储后端需支持随机读取
+	var body io.Reader = reader
+	contentLength := fileSize
+	statusCode := consts.StatusOK
+	byteRange, err := utils.ParseRange(rangeHeader, fileSize)
+	if err != nil {
+		reader.Close()
+		ev.Operation = model.TransferOpRange
+		recordAccess(ev, 0, start, false)
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
+		c.JSON(consts.StatusRequestedRangeNotSatisfiable, map[string]interface{}{
+			"code":    416,
+			"message": err.Error(),
+		})
+		return
+	}
+	if seeker, ok := reader.(io.Seeker); ok && byteRange != nil {
+		if _, err := seeker.Seek(byteRange.Start, io.SeekStart); err == nil {
+			body = io.LimitReader(reader, byteRange.Length)
+			contentLength = byteRange.Length
+			statusCode = consts.StatusPartialContent
+			ev.Operation = model.TransferOpRange
+			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", byteRange.Start, byteRange.Start+byteRange.Length-1, fileSize))
+		}
+	}
 
 	// 设置文件下载头
-	fileName := fileCode.UUIDFileName
-	if fileName == "" {
-		// 向后兼容：如果UUIDFileName为空，则使用Prefix + Suffix
-		fileName = fileCode.Prefix + fileCode.Suffix
+	// 仅白名单内的 MIME 类型允许通过 ?inline=1 在浏览器中直接展示
+	if fileCode.E2EE {
+		fileName = "ciphertext.bin"
+		mimeType = "application/octet-stream"
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if c.Query("inline") == "1" && utils.IsInlineSafeMime(mimeType) {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Disposition", utils.ContentDisposition(disposition, fileName))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", fmt.Sprintf("%d", contentLength))
+	c.Header("Accept-Ranges", "bytes")
+	c.SetStatusCode(statusCode)
+
+	// 流式传输文件内容，传输结束时记录访问日志
+	c.SetBodyStream(&accessLogReader{
+		Reader:   body,
+		closer:   reader,
+		ev:       ev,
+		start:    start,
+		expected: contentLength,
+	}, int(contentLength))
+}
+
+// writeLookupBlocked 分享码查找被暴力破解防护拒绝时返回 429，返回值表示是否已写出响应
+func writeLookupBlocked(c *app.RequestContext, err error) bool {
+	var blocked *guard.BlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	retryAfter := blocked.RetryAfterSeconds()
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(consts.StatusTooManyRequests, map[string]interface{}{
+		"code":    429,
+		"message": blocked.Error(),
+		"data": map[string]interface{}{
+			"retry_after": retryAfter,
+		},
+	})
+	return true
+}
+
+// writePasswordError 分享需要密码或密码错误时写入 401 并返回 true
+// 密码错误计入暴力破解统计，达到阈值时返回 429
+func writePasswordError(ctx context.Context, c *app.RequestContext, code string, err error) bool {
+	switch {
+	case errors.Is(err, shareService.ErrPasswordRequired):
+	case errors.Is(err, shareService.ErrWrongPassword):
+		if writeLookupBlocked(c, guard.GetService().RecordFailure(ctx, c.ClientIP(), code)) {
+			return true
+		}
+	default:
+		return false
+	}
+	c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+		"code":    401,
+		"message": err.Error(),
+		"data": map[string]interface{}{
+			"has_password": true,
+		},
+	})
+	return true
+}
+
+// writeNotYetAvailable 分享尚未生效时返回生效时间，返回值表示是否已写出响应
+func writeNotYetAvailable(c *app.RequestContext, err error) bool {
+	var notYet *shareService.NotYetAvailableError
+	if !errors.As(err, &notYet) {
+		return false
+	}
+	c.JSON(consts.StatusForbidden, map[string]interface{}{
+		"code":    403,
+		"message": "分享尚未生效",
+		"data": map[string]interface{}{
+			"not_yet_available": true,
+			"available_from":    notYet.AvailableFrom.Format(time.RFC3339),
+		},
+	})
+	return true
+}
+
+// writeQuotaError 写出配额或匿名上传限制校验失败的响应：
+// 超出单次大小 413，超出存储配额 507，匿名上传过于频繁 429，禁止匿名上传文件 403，匿名有效期超限 400
+func writeQuotaError(c *app.RequestContext, err error) {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		status := consts.StatusRequestEntityTooLarge
+		if exceeded.Reason == quota.ReasonStorageQuota {
+			status = consts.StatusInsufficientStorage
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": exceeded.Error(),
+			"data": map[string]interface{}{
+				"reason":    exceeded.Reason,
+				"limit":     exceeded.Limit,
+				"used":      exceeded.Used,
+				"requested": exceeded.Requested,
+			},
+		})
+		return
+	}
+
+	var limited *quota.AnonymousLimitError
+	if errors.As(err, &limited) {
+		status := consts.StatusTooManyRequests
+		switch limited.Reason {
+		case quota.ReasonAnonymousFileDisabled:
+			status = consts.StatusForbidden
+		case quota.ReasonAnonymousExpiry:
+			status = consts.StatusBadRequest
+		default:
+			c.Header("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())+1))
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": limited.Error(),
+			"data": map[string]interface{}{
+				"reason":      limited.Reason,
+				"limit":       limited.Limit,
+				"retry_after": int(limited.RetryAfter.Seconds()),
+			},
+		})
+		return
+	}
+
+	c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+		"code":    500,
+		"message": "检查配额失败: " + err.Error(),
+	})
+}
+
+// newAccessEvent 根据请求上下文构造访问事件
+func newAccessEvent(c *app.RequestContext, fileCode *model.FileCode, operation string) *shareService.AccessEvent {
+	ev := &shareService.AccessEvent{
+		Operation: operation,
+		FileCode:  fileCode,
+		IP:        c.ClientIP(),
+		UserAgent: string(c.UserAgent()),
+	}
+	if uid, exists := c.Get("user_id"); exists {
+		if uidUint, ok := uid.(uint); ok {
+			ev.UserID = &uidUint
+		}
+	}
+	if username, exists := c.Get("username"); exists {
+		ev.Username, _ = username.(string)
+	}
+	return ev
+}
+
+// recordAccess 写入访问日志，失败不影响请求
+func recordAccess(ev *shareService.AccessEvent, bytesSent int64, start time.Time, success bool) {
+	ev.BytesSent = bytesSent
+	ev.Duration = time.Since(start)
+	ev.Success = success
+	if err := getShareService().RecordAccess(context.Background(), ev); err != nil {
+		logger.Warn("记录访问日志失败", zap.String("code", ev.FileCode.Code), zap.Error(err))
+	}
+}
+
+// isResumeRange 判断是否为断点续传的后续请求（不从第 0 字节开始）
+func isResumeRange(rangeHeader string) bool {
+	return rangeHeader != "" && !strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// accessLogReader 统计实际发送的字节数，并在响应写完（Close）时记录访问日志
+type accessLogReader struct {
+	io.Reader
+	closer   io.Closer
+	ev       *shareService.AccessEvent
+	start    time.Time
+	expected int64
+	sent     int64
+	closed   bool
+}
+
+func (r *accessLogReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.sent += int64(n)
+	return n, err
+}
+
+func (r *accessLogReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	err := r.closer.Close()
+	recordAccess(r.ev, r.sent, r.start, r.sent == r.expected)
+	return err
+}
+
+// saveUploadedFile 按日期分目录保存上传文件，文件名使用 UUID
+func saveUploadedFile(ctx context.Context, file *multipart.FileHeader, fileExt string) (*storage.FileOperationResult, error) {
+	now := time.Now()
+	relativePath := filepath.Join(
+		"uploads",
+		now.Format("2006"),
+		now.Format("01"),
+		now.Format("02"),
+	)
+	savePath := filepath.Join(relativePath, uuid.New().String()+fileExt)
+	return getStorageService().SaveFile(ctx, file, savePath)
+}
+
+// sniffUploadedFile 读取上传文件头部嗅探 MIME 类型
+func sniffUploadedFile(file *multipart.FileHeader, fileName string) string {
+	src, err := file.Open()
+	if err != nil {
+		return utils.DetectMimeType(fileName, nil)
 	}
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
-	c.Header("Content-Length", fmt.Sprintf("%d", fileSize))
+	defer src.Close()
 
-	// 流式传输文件内容
-	c.SetBodyStream(reader, int(fileSize))
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	return utils.DetectMimeType(fileName, head[:n])
 }
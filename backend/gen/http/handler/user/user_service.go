@@ -4,28 +4,57 @@ package user
 
 import (
 	"context"
+	"errors"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	usermodel "github.com/zy84338719/fileCodeBox/backend/gen/http/model/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/quota"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/sso"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
 	userservice "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
 	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 )
 
 var userService = userservice.NewService()
 
+// registerExtParams IDL 之外的注册扩展参数
+type registerExtParams struct {
+	InviteCode string `json:"invite_code" form:"invite_code"`
+}
+
 // Register .
 // @router /user/register [POST]
 func Register(ctx context.Context, c *app.RequestContext) {
-	// 检查是否允许用户注册
+	// 关闭开放注册时只能凭邀请码注册
 	cfg := conf.GetGlobalConfig()
-	if cfg != nil && !cfg.User.AllowUserRegistration {
+	var ext registerExtParams
+	if err := c.Bind(&ext); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	ext.InviteCode = strings.TrimSpace(ext.InviteCode)
+	if cfg != nil && !cfg.User.AllowUserRegistration && ext.InviteCode == "" {
 		c.JSON(consts.StatusForbidden, map[string]interface{}{
 			"code":    403,
-			"message": "用户注册已关闭",
+			"message": "用户注册已关闭，请使用邀请码注册",
+		})
+		return
+	}
+	if sso.PasswordLoginDisabled() {
+		c.JSON(consts.StatusForbidden, map[string]interface{}{
+			"code":    403,
+			"message": "已关闭本地注册，请使用单点登录",
 		})
 		return
 	}
@@ -43,11 +72,19 @@ func Register(ctx context.Context, c *app.RequestContext) {
 
 	// 调用 service
 	result, err := userService.Create(ctx, &userservice.CreateUserReq{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: req.Password,
-		Nickname: req.Nickname,
+		Username:   req.Username,
+		Email:      req.Email,
+		Password:   req.Password,
+		Nickname:   req.Nickname,
+		InviteCode: ext.InviteCode,
 	})
+	if errors.Is(err, userservice.ErrInvitationInvalid) {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
 			"code":    500,
@@ -56,9 +93,17 @@ func Register(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	message := "注册成功"
+	if cfg != nil && cfg.User.RequireEmailVerify {
+		// 邮件发送失败不影响注册，用户可以稍后重新发送
+		if err := userService.SendVerificationEmail(ctx, result.ID); err == nil {
+			message = "注册成功，请查收验证邮件"
+		}
+	}
+
 	resp := &usermodel.RegisterResp{
 		Code:    200,
-		Message: "注册成功",
+		Message: message,
 		Data: &usermodel.UserData{
 			Id:        uint32(result.ID),
 			Username:  result.Username,
@@ -88,7 +133,29 @@ func Login(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 调用 service 进行登录验证
-	userInfo, token, err := userService.Login(ctx, req.Username, req.Password)
+	userInfo, tokens, err := userService.Login(ctx, req.Username, req.Password, sessionClient(c))
+	if errors.Is(err, userservice.ErrEmailNotVerified) {
+		c.JSON(consts.StatusForbidden, map[string]interface{}{
+			"code":    403,
+			"message": err.Error(),
+			"data": map[string]interface{}{
+				"email_verification_required": true,
+			},
+		})
+		return
+	}
+	var challenge *twofactor.ChallengeError
+	if errors.As(err, &challenge) {
+		writeTwoFactorChallenge(c, challenge)
+		return
+	}
+	if errors.Is(err, sso.ErrPasswordLoginDisabled) {
+		c.JSON(consts.StatusForbidden, map[string]interface{}{
+			"code":    403,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
 			"code":    401,
@@ -97,24 +164,11 @@ func Login(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	resp := &usermodel.LoginResp{
-		Code:    200,
-		Message: "登录成功",
-		Data: &usermodel.LoginData{
-			Token: token,
-			User: &usermodel.UserData{
-				Id:        uint32(userInfo.ID),
-				Username:  userInfo.Username,
-				Email:     userInfo.Email,
-				Nickname:  userInfo.Nickname,
-				Avatar:    userInfo.Avatar,
-				Status:    int32(1),
-				CreatedAt: userInfo.CreatedAt.Format("2006-01-02 15:04:05"),
-			},
-		},
-	}
-
-	c.JSON(consts.StatusOK, resp)
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "登录成功",
+		"data":    loginData(userInfo, tokens),
+	})
 }
 
 // UserInfo .
@@ -204,34 +258,86 @@ func ChangePassword(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// TODO: 实现密码修改
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入旧密码和新密码",
+		})
+		return
+	}
 
-	resp := &usermodel.ChangePasswordResp{
-		Code:    200,
-		Message: "密码修改成功",
+	// 修改成功后该用户的全部会话都会被注销，包括当前会话
+	if err := userService.ChangePassword(ctx, userID, req.OldPassword, req.NewPassword); err != nil {
+		status := consts.StatusInternalServerError
+		if errors.Is(err, userservice.ErrOldPasswordMismatch) || errors.Is(err, userservice.ErrPasswordTooShort) {
+			status = consts.StatusBadRequest
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
 	}
 
-	c.JSON(consts.StatusOK, resp)
+	c.JSON(consts.StatusOK, &usermodel.ChangePasswordResp{
+		Code:    200,
+		Message: "密码修改成功，请重新登录",
+	})
 }
 
 // UserStats .
 // @router /user/stats [GET]
 func UserStats(ctx context.Context, c *app.RequestContext) {
-	// TODO: 从上下文获取用户ID（需要认证中间件）
-	// userID := middleware.GetUserID(c)
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+			"code":    401,
+			"message": "用户未登录",
+		})
+		return
+	}
 
-	resp := &usermodel.UserStatsResp{
-		Code:    200,
-		Message: "获取成功",
-		Data: &usermodel.UserStats{
-			TotalUploads: 0,
-			TotalSize:    0,
-			QuotaUsed:    0,
-			QuotaLimit:   0,
-		},
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "用户ID类型错误",
+		})
+		return
 	}
 
-	c.JSON(consts.StatusOK, resp)
+	stats, err := userService.GetStats(ctx, userID)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 配额上限：用户单独设置 > 角色默认 > 全局配置，0 表示不限制
+	var quotaLimit int64
+	if limits, err := quota.GetService().Resolve(ctx, &userID); err == nil {
+		quotaLimit = limits.StorageQuota
+	}
+
+	// total_downloads 不在 IDL 中，这里直接返回 map
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "获取成功",
+		"data": map[string]interface{}{
+			"total_uploads":   stats.TotalUploads,
+			"total_downloads": stats.TotalDownloads,
+			"total_size":      stats.TotalStorage,
+			"pending_size":    stats.PendingStorage,
+			"quota_used":      stats.TotalStorage + stats.PendingStorage,
+			"quota_limit":     quotaLimit,
+		},
+	})
 }
 
 // UserFiles .
@@ -286,13 +392,11 @@ func UserFiles(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	resp := &usermodel.UserFilesResp{
-		Code:    200,
-		Message: "获取成功",
-		Data:    fileList,
-	}
-
-	c.JSON(consts.StatusOK, resp)
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "获取成功",
+		"data":    fileList,
+	})
 }
 
 // ==================== API Key 管理接口 ====================
@@ -331,15 +435,7 @@ func ListAPIKeys(ctx context.Context, c *app.RequestContext) {
 	// 转换为响应格式
 	respKeys := make([]map[string]interface{}, len(keys))
 	for i, key := range keys {
-		respKeys[i] = map[string]interface{}{
-			"id":           key.ID,
-			"name":         key.Name,
-			"prefix":       key.Prefix,
-			"last_used_at": formatTime(key.LastUsedAt),
-			"expires_at":   formatTime(key.ExpiresAt),
-			"created_at":   formatTime(key.CreatedAt),
-			"revoked":      key.Revoked,
-		}
+		respKeys[i] = apiKeyData(key)
 	}
 
 	c.JSON(consts.StatusOK, map[string]interface{}{
@@ -373,9 +469,12 @@ func CreateAPIKey(ctx context.Context, c *app.RequestContext) {
 
 	// 解析请求体
 	var req struct {
-		Name          string `json:"name"`
-		ExpiresAt     string `json:"expires_at"`
-		ExpiresInDays *int64 `json:"expires_in_days"`
+		Name               string   `json:"name"`
+		ExpiresAt          string   `json:"expires_at"`
+		ExpiresInDays      *int64   `json:"expires_in_days"`
+		Scopes             []string `json:"scopes"`
+		AllowedIPs         []string `json:"allowed_ips"`
+		RateLimitPerMinute int      `json:"rate_limit_per_minute"`
 	}
 	if err := c.Bind(&req); err != nil {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -407,9 +506,12 @@ func CreateAPIKey(ctx context.Context, c *app.RequestContext) {
 
 	// 调用 service 创建 API Key
 	result, err := userService.CreateAPIKey(ctx, uint(userID), &userservice.CreateAPIKeyReq{
-		Name:          req.Name,
-		ExpiresAt:     expiresAt,
-		ExpiresInDays: expiresInDays,
+		Name:               req.Name,
+		ExpiresAt:          expiresAt,
+		ExpiresInDays:      expiresInDays,
+		Scopes:             req.Scopes,
+		AllowedIPs:         req.AllowedIPs,
+		RateLimitPerMinute: req.RateLimitPerMinute,
 	})
 	if err != nil {
 		c.JSON(consts.StatusBadRequest, map[string]interface{}{
@@ -424,20 +526,37 @@ func CreateAPIKey(ctx context.Context, c *app.RequestContext) {
 		"code":    200,
 		"message": "API Key 生成成功",
 		"data": map[string]interface{}{
-			"key": result.Key,
-			"api_key": map[string]interface{}{
-				"id":           result.APIKey.ID,
-				"name":         result.APIKey.Name,
-				"prefix":       result.APIKey.Prefix,
-				"last_used_at": formatTime(result.APIKey.LastUsedAt),
-				"expires_at":   formatTime(result.APIKey.ExpiresAt),
-				"created_at":   formatTime(result.APIKey.CreatedAt),
-				"revoked":      result.APIKey.Revoked,
-			},
+			"key":     result.Key,
+			"api_key": apiKeyData(result.APIKey),
 		},
 	})
 }
 
+// apiKeyData 密钥信息的响应格式
+func apiKeyData(key *userservice.APIKeyData) map[string]interface{} {
+	scopes, allowedIPs := key.Scopes, key.AllowedIPs
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if allowedIPs == nil {
+		allowedIPs = []string{}
+	}
+	return map[string]interface{}{
+		"id":                    key.ID,
+		"name":                  key.Name,
+		"prefix":                key.Prefix,
+		"scopes":                scopes,
+		"allowed_ips":           allowedIPs,
+		"rate_limit_per_minute": key.RateLimitPerMinute,
+		"usage_count":           key.UsageCount,
+		"last_used_at":          formatTime(key.LastUsedAt),
+		"last_used_ip":          key.LastUsedIP,
+		"expires_at":            formatTime(key.ExpiresAt),
+		"created_at":            formatTime(key.CreatedAt),
+		"revoked":               key.Revoked,
+	}
+}
+
 // DeleteAPIKey 撤销指定的 API Key
 // @router /user/api-keys/:id [DELETE]
 func DeleteAPIKey(ctx context.Context, c *app.RequestContext) {
@@ -494,6 +613,850 @@ func DeleteAPIKey(ctx context.Context, c *app.RequestContext) {
 	})
 }
 
+// SendVerificationEmail 发送邮箱验证邮件，已登录时发送到当前用户邮箱，否则按请求中的邮箱重新发送
+// @router /user/email/verify/send [POST]
+func SendVerificationEmail(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	_ = c.Bind(&req)
+
+	var err error
+	if userIDVal, exists := c.Get("user_id"); exists {
+		userID, _ := userIDVal.(uint)
+		err = userService.SendVerificationEmail(ctx, userID)
+	} else {
+		if strings.TrimSpace(req.Email) == "" {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": "邮箱不能为空",
+			})
+			return
+		}
+		err = userService.ResendVerificationEmail(ctx, req.Email)
+	}
+	if err != nil {
+		c.JSON(emailErrorStatus(err), map[string]interface{}{
+			"code":    emailErrorStatus(err),
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "如果该邮箱已注册且尚未验证，验证邮件已发送",
+	})
+}
+
+// VerifyEmail 使用邮件中的令牌完成邮箱验证
+// @router /user/email/verify [POST]
+func VerifyEmail(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "缺少验证令牌",
+		})
+		return
+	}
+
+	if err := userService.VerifyEmail(ctx, req.Token); err != nil {
+		c.JSON(emailErrorStatus(err), map[string]interface{}{
+			"code":    emailErrorStatus(err),
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "邮箱验证成功",
+	})
+}
+
+// ForgotPassword 发送重置密码邮件，无论邮箱是否注册都返回相同结果
+// @router /user/password/forgot [POST]
+func ForgotPassword(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "邮箱不能为空",
+		})
+		return
+	}
+
+	if err := userService.RequestPasswordReset(ctx, req.Email); err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "如果该邮箱已注册，重置密码邮件已发送",
+	})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码
+// @router /user/password/reset [POST]
+func ResetPassword(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "缺少重置令牌",
+		})
+		return
+	}
+
+	if err := userService.ResetPassword(ctx, req.Token, req.NewPassword); err != nil {
+		c.JSON(emailErrorStatus(err), map[string]interface{}{
+			"code":    emailErrorStatus(err),
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "密码已重置，请使用新密码登录",
+	})
+}
+
+// LoginTwoFactor 登录第二步：提交预认证令牌和验证码（或恢复码）换取登录令牌
+// @router /user/login/2fa [POST]
+func LoginTwoFactor(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || req.PreAuthToken == "" || strings.TrimSpace(req.Code) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入验证码",
+		})
+		return
+	}
+
+	userInfo, tokens, recoveryCodes, err := userService.CompleteTwoFactorLogin(ctx, req.PreAuthToken, req.Code, sessionClient(c))
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	data := loginData(userInfo, tokens)
+	// 单点登录完成两步验证后，前端按角色决定是否进入管理后台
+	data["role"] = userInfo.Role
+	if recoveryCodes != nil {
+		// 登录时完成绑定，恢复码只展示这一次
+		data["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "登录成功",
+		"data":    data,
+	})
+}
+
+// LoginTwoFactorSetup 角色要求两步验证但尚未绑定时，凭预认证令牌获取绑定二维码
+// @router /user/login/2fa/setup [POST]
+func LoginTwoFactorSetup(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+	}
+	if err := c.Bind(&req); err != nil || req.PreAuthToken == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "缺少预认证令牌",
+		})
+		return
+	}
+
+	result, err := twofactor.GetService().SetupForLogin(ctx, req.PreAuthToken)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "请使用验证器应用扫描二维码",
+		"data":    result,
+	})
+}
+
+// TwoFactorStatus 查询当前用户的两步验证状态
+// @router /user/2fa [GET]
+func TwoFactorStatus(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := twofactor.GetService().GetStatus(ctx, userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": status,
+	})
+}
+
+// TwoFactorSetup 生成两步验证密钥和绑定二维码
+// @router /user/2fa/setup [POST]
+func TwoFactorSetup(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	result, err := twofactor.GetService().Setup(ctx, userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "请使用验证器应用扫描二维码",
+		"data":    result,
+	})
+}
+
+// TwoFactorEnable 提交验证码确认绑定，返回恢复码
+// @router /user/2fa/enable [POST]
+func TwoFactorEnable(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入验证码",
+		})
+		return
+	}
+
+	codes, err := twofactor.GetService().Enable(ctx, userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "两步验证已开启，请妥善保存恢复码",
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// TwoFactorDisable 关闭两步验证，需要当前密码和验证码（或恢复码）
+// @router /user/2fa/disable [POST]
+func TwoFactorDisable(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || req.Password == "" || strings.TrimSpace(req.Code) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入密码和验证码",
+		})
+		return
+	}
+
+	if err := twofactor.GetService().Disable(ctx, userID, req.Password, req.Code, c.ClientIP()); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "两步验证已关闭",
+	})
+}
+
+// TwoFactorRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+// @router /user/2fa/recovery-codes [POST]
+func TwoFactorRecoveryCodes(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请输入验证码",
+		})
+		return
+	}
+
+	codes, err := twofactor.GetService().RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已生成新的恢复码，请妥善保存",
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+// @router /user/token/refresh [POST]
+func RefreshToken(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "缺少刷新令牌",
+		})
+		return
+	}
+
+	tokens, err := session.GetService().Refresh(ctx, req.RefreshToken, sessionClient(c))
+	if err != nil {
+		status := consts.StatusInternalServerError
+		if errors.Is(err, session.ErrInvalidRefreshToken) {
+			status = consts.StatusUnauthorized
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data": map[string]interface{}{
+			"token":         tokens.AccessToken,
+			"token_type":    "Bearer",
+			"expires_in":    tokens.ExpiresIn,
+			"refresh_token": tokens.RefreshToken,
+		},
+	})
+}
+
+// Logout 退出登录，注销当前会话
+// @router /user/logout [POST]
+func Logout(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := session.GetService().Revoke(ctx, userID, c.GetString("session_id"), session.ReasonLogout); err != nil && !errors.Is(err, session.ErrSessionNotFound) {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "退出登录失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已退出登录",
+	})
+}
+
+// ListSessions 列出当前用户已登录的会话
+// @router /user/sessions [GET]
+func ListSessions(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	sessions, err := session.GetService().List(ctx, userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "获取会话列表失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data":    sessions,
+	})
+}
+
+// RevokeSession 注销指定会话，该会话的访问令牌和刷新令牌立即失效
+// @router /user/sessions/:id [DELETE]
+func RevokeSession(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	err := session.GetService().Revoke(ctx, userID, c.Param("id"), session.ReasonRevoked)
+	if errors.Is(err, session.ErrSessionNotFound) {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "注销会话失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "会话已注销",
+	})
+}
+
+// RevokeAllSessions 注销当前用户的全部会话，keep_current=true 时保留当前会话
+// @router /user/sessions [DELETE]
+func RevokeAllSessions(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	keep := ""
+	if c.Query("keep_current") == "true" {
+		keep = c.GetString("session_id")
+	}
+	count, err := session.GetService().RevokeAll(ctx, userID, keep, session.ReasonRevoked)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "注销会话失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "已注销 " + strconv.Itoa(count) + " 个会话",
+		"data": map[string]interface{}{
+			"revoked": count,
+		},
+	})
+}
+
+// DeleteAccount 申请删除当前账号：账号立即停用并注销全部会话和 API Key，宽限期结束后删除分享和个人数据
+// 宽限期内可以联系管理员撤销
+// @router /user/account [DELETE]
+func DeleteAccount(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	if err := userService.VerifyDeletion(ctx, userID, req.Password, strings.TrimSpace(req.Code)); err != nil {
+		if errors.Is(err, userservice.ErrInvalidCredentials) || errors.Is(err, userservice.ErrDeletionPassword) {
+			c.JSON(consts.StatusBadRequest, map[string]interface{}{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	user, err := userService.ScheduleDeletion(ctx, userID, userservice.DeletionReq{
+		ActorID:   &userID,
+		ActorName: c.GetString("username"),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		status := consts.StatusInternalServerError
+		if errors.Is(err, userservice.ErrDeletionPending) || errors.Is(err, userservice.ErrDeleteLastAdmin) {
+			status = consts.StatusBadRequest
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "账号已停用，将在宽限期结束后删除",
+		"data": map[string]interface{}{
+			"status":                user.Status,
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+		},
+	})
+}
+
+// ListInvitations 列出当前用户创建的邀请码和剩余邀请名额
+// @router /user/invitations [GET]
+func ListInvitations(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	invitations, total, err := userService.ListInvitations(ctx, model.InvitationQuery{
+		CreatedBy: &userID,
+		Page:      page,
+		PageSize:  pageSize,
+	})
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "获取邀请码失败: " + err.Error(),
+		})
+		return
+	}
+	quota, err := userService.GetInvitationQuota(ctx, userID)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "获取邀请名额失败: " + err.Error(),
+		})
+		return
+	}
+
+	items := make([]*model.InvitationResp, len(invitations))
+	for i, invitation := range invitations {
+		items[i] = invitation.ToResp()
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data": map[string]interface{}{
+			"invitations": items,
+			"total":       total,
+			"quota":       quota,
+		},
+	})
+}
+
+// CreateInvitation 创建单次使用的邀请码，受邀请名额限制；明文邀请码和注册链接只返回这一次
+// @router /user/invitations [POST]
+func CreateInvitation(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Note           string `json:"note"`
+		ExpiresInHours *int   `json:"expires_in_hours"`
+	}
+	if err := c.Bind(&req); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := userService.CreateInvitation(ctx, &userservice.CreateInvitationReq{
+		CreatorID:      userID,
+		CreatorName:    c.GetString("username"),
+		IP:             c.ClientIP(),
+		Note:           req.Note,
+		ExpiresInHours: req.ExpiresInHours,
+	})
+	if err != nil {
+		status := consts.StatusBadRequest
+		if errors.Is(err, userservice.ErrInvitationNotAllowed) || errors.Is(err, userservice.ErrInvitationQuota) {
+			status = consts.StatusForbidden
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "邀请码已创建，请妥善保存，关闭后无法再次查看",
+		"data": map[string]interface{}{
+			"invitation": result.Invitation.ToResp(),
+			"code":       result.Code,
+			"link":       result.Link,
+		},
+	})
+}
+
+// RevokeInvitation 撤销自己创建的邀请码
+// @router /user/invitations/:id [DELETE]
+func RevokeInvitation(ctx context.Context, c *app.RequestContext) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "无效的邀请码ID",
+		})
+		return
+	}
+	if err := userService.RevokeInvitation(ctx, uint(id), &userID, userID, c.GetString("username"), c.ClientIP()); err != nil {
+		c.JSON(consts.StatusNotFound, map[string]interface{}{
+			"code":    404,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "邀请码已撤销",
+	})
+}
+
+// OIDCProviders 列出可用的单点登录方式，以及是否允许密码登录
+// @router /user/oidc/providers [GET]
+func OIDCProviders(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data": map[string]interface{}{
+			"providers":              sso.GetService().Providers(),
+			"password_login_enabled": !sso.PasswordLoginDisabled(),
+		},
+	})
+}
+
+// OIDCLogin 跳转到身份提供方登录，状态保存在仅回调路径可见的 Cookie 中
+// @router /user/oidc/:provider/login [GET]
+func OIDCLogin(ctx context.Context, c *app.RequestContext) {
+	authURL, stateToken, err := sso.GetService().Begin(ctx, c.Param("provider"), c.Query("redirect"))
+	if err != nil {
+		redirectSSOError(c, err)
+		return
+	}
+	setSSOStateCookie(c, stateToken, int(sso.StateTTL.Seconds()))
+	c.Redirect(consts.StatusFound, []byte(authURL))
+}
+
+// OIDCCallback 身份提供方登录完成后的回调，成功后带着一次性交换码跳转回前端
+// @router /user/oidc/:provider/callback [GET]
+func OIDCCallback(ctx context.Context, c *app.RequestContext) {
+	setSSOStateCookie(c, "", -1)
+	if errCode := c.Query("error"); errCode != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = errCode
+		}
+		redirectSSOError(c, errors.New("身份提供方拒绝了登录: "+message))
+		return
+	}
+
+	code, redirect, err := sso.GetService().Callback(ctx, c.Param("provider"), c.Query("code"), c.Query("state"), string(c.Cookie(sso.StateCookie)))
+	if err != nil {
+		redirectSSOError(c, err)
+		return
+	}
+	query := url.Values{}
+	query.Set("code", code)
+	if redirect != "" {
+		query.Set("redirect", redirect)
+	}
+	c.Redirect(consts.StatusFound, []byte(sso.SiteURL()+"/#/user/oidc-callback?"+query.Encode()))
+}
+
+// OIDCExchange 使用回调得到的一次性交换码换取登录令牌，需要两步验证时与密码登录一样返回预认证令牌
+// @router /user/oidc/exchange [POST]
+func OIDCExchange(ctx context.Context, c *app.RequestContext) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		c.JSON(consts.StatusBadRequest, map[string]interface{}{
+			"code":    400,
+			"message": "缺少登录凭证",
+		})
+		return
+	}
+
+	user, err := sso.GetService().Exchange(ctx, req.Code)
+	var challenge *twofactor.ChallengeError
+	if errors.As(err, &challenge) {
+		writeTwoFactorChallenge(c, challenge)
+		return
+	}
+	if err != nil {
+		status := consts.StatusInternalServerError
+		if errors.Is(err, sso.ErrInvalidExchangeCode) || errors.Is(err, sso.ErrUserDisabled) {
+			status = consts.StatusUnauthorized
+		}
+		c.JSON(status, map[string]interface{}{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	tokens, err := session.GetService().Create(ctx, user, sessionClient(c))
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	data := loginData(user.ToResp(), tokens)
+	data["role"] = user.Role
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": "登录成功",
+		"data":    data,
+	})
+}
+
+// setSSOStateCookie 写入或清除单点登录状态 Cookie
+// 身份提供方回调是跨站跳转，SameSite 必须为 Lax 才能带上 Cookie
+func setSSOStateCookie(c *app.RequestContext, value string, maxAge int) {
+	secure := strings.HasPrefix(sso.SiteURL(), "https://")
+	c.SetCookie(sso.StateCookie, value, maxAge, "/user/oidc", "", protocol.CookieSameSiteLaxMode, secure, true)
+}
+
+// redirectSSOError 单点登录失败时带着错误信息跳转回前端登录页
+func redirectSSOError(c *app.RequestContext, err error) {
+	query := url.Values{}
+	query.Set("sso_error", err.Error())
+	c.Redirect(consts.StatusFound, []byte(sso.SiteURL()+"/#/user/login?"+query.Encode()))
+}
+
+// currentUserID 读取认证中间件写入的用户 ID，未登录时直接写入错误响应
+func currentUserID(c *app.RequestContext) (uint, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(consts.StatusUnauthorized, map[string]interface{}{
+			"code":    401,
+			"message": "用户未登录",
+		})
+		return 0, false
+	}
+	userID, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(consts.StatusInternalServerError, map[string]interface{}{
+			"code":    500,
+			"message": "用户ID类型错误",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+// loginData 登录成功时返回的令牌和用户信息
+func loginData(userInfo *model.UserResp, tokens *session.Tokens) map[string]interface{} {
+	return map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    tokens.ExpiresIn,
+		"refresh_token": tokens.RefreshToken,
+		"user": &usermodel.UserData{
+			Id:        uint32(userInfo.ID),
+			Username:  userInfo.Username,
+			Email:     userInfo.Email,
+			Nickname:  userInfo.Nickname,
+			Avatar:    userInfo.Avatar,
+			Status:    int32(1),
+			CreatedAt: userInfo.CreatedAt.Format("2006-01-02 15:04:05"),
+		},
+	}
+}
+
+// sessionClient 从请求中提取登录会话记录的客户端信息
+func sessionClient(c *app.RequestContext) session.Client {
+	return session.Client{IP: c.ClientIP(), UserAgent: string(c.UserAgent())}
+}
+
+// writeTwoFactorChallenge 密码校验通过后返回预认证令牌，客户端凭它提交验证码
+func writeTwoFactorChallenge(c *app.RequestContext, challenge *twofactor.ChallengeError) {
+	message := "请输入两步验证码"
+	if !challenge.Enrolled {
+		message = "当前账号要求开启两步验证，请先绑定验证器"
+	}
+	c.JSON(consts.StatusOK, map[string]interface{}{
+		"code":    200,
+		"message": message,
+		"data": map[string]interface{}{
+			"two_factor_required": true,
+			"two_factor_enrolled": challenge.Enrolled,
+			"pre_auth_token":      challenge.PreAuthToken,
+			"expires_in":          challenge.ExpiresIn,
+		},
+	})
+}
+
+// writeTwoFactorError 两步验证相关错误：验证码错误等返回 400，错误次数过多返回 429
+// 验证码错误不使用 401，避免前端清除登录状态
+func writeTwoFactorError(c *app.RequestContext, err error) {
+	status := consts.StatusInternalServerError
+	switch {
+	case errors.Is(err, twofactor.ErrTooManyAttempts):
+		status = consts.StatusTooManyRequests
+	case errors.Is(err, twofactor.ErrInvalidCode),
+		errors.Is(err, twofactor.ErrInvalidPreAuth),
+		errors.Is(err, twofactor.ErrPasswordMismatch),
+		errors.Is(err, twofactor.ErrAlreadyEnabled),
+		errors.Is(err, twofactor.ErrNotEnabled),
+		errors.Is(err, twofactor.ErrNotSetup),
+		errors.Is(err, twofactor.ErrRequiredByRole):
+		status = consts.StatusBadRequest
+	}
+	c.JSON(status, map[string]interface{}{
+		"code":    status,
+		"message": err.Error(),
+	})
+}
+
+// emailErrorStatus 邮件验证和重置密码相关错误对应的 HTTP 状态码
+func emailErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, userservice.ErrTooManyEmails):
+		return consts.StatusTooManyRequests
+	case errors.Is(err, userservice.ErrInvalidEmailToken),
+		errors.Is(err, userservice.ErrEmailAlreadyVerified),
+		errors.Is(err, userservice.ErrPasswordTooShort):
+		return consts.StatusBadRequest
+	default:
+		return consts.StatusInternalServerError
+	}
+}
+
 // formatTime 格式化时间指针为字符串
 func formatTime(t *time.Time) string {
 	if t == nil {
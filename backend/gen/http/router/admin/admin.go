@@ -24,12 +24,21 @@ func Register(r *server.Hertz) {
 		_admin.GET("/files", append(_adminlistfilesMw(), admin.AdminListFiles)...)
 		_files := _admin.Group("/files", _filesMw()...)
 		_files.DELETE("/:id", append(_admindeletefileMw(), admin.AdminDeleteFile)...)
+		_admin.GET("/invitations", append(_adminlistinvitationsMw(), admin.AdminListInvitations)...)
+		_admin.POST("/invitations", append(_admincreateinvitationMw(), admin.AdminCreateInvitation)...)
+		_invitations := _admin.Group("/invitations", _invitationsMw()...)
+		_invitations.DELETE("/:id", append(_adminrevokeinvitationMw(), admin.AdminRevokeInvitation)...)
 		_admin.POST("/login", append(_adminloginMw(), admin.AdminLogin)...)
+		_login := _admin.Group("/login", _loginMw()...)
+		_login.POST("/2fa", append(_adminlogintwofactorMw(), admin.AdminLoginTwoFactor)...)
 		_admin.GET("/stats", append(_adminstatsMw(), admin.AdminStats)...)
 		_admin.GET("/users", append(_adminlistusersMw(), admin.AdminListUsers)...)
 		_users := _admin.Group("/users", _usersMw()...)
+		_users.DELETE("/:id", append(_admindeleteuserMw(), admin.AdminDeleteUser)...)
 		{
 			_id := _users.Group("/:id", _idMw()...)
+			_id.DELETE("/2fa", append(_adminresetusertwofactorMw(), admin.AdminResetUserTwoFactor)...)
+			_id.POST("/restore", append(_adminrestoreuserMw(), admin.AdminRestoreUser)...)
 			_id.PUT("/status", append(_adminupdateuserstatusMw(), admin.AdminUpdateUserStatus)...)
 		}
 	}
@@ -4,7 +4,7 @@ package admin
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/middleware"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -14,7 +14,9 @@ func rootMw() []app.HandlerFunc {
 
 func _adminMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AdminMiddleware(),
+		// 登录接口不需要认证
+		httpmw.SkipPaths(httpmw.AdminAuth(), "/admin/login", "/admin/login/2fa"),
+		httpmw.RouteRateLimit("admin"),
 	}
 }
 
@@ -69,8 +71,10 @@ func _adminupdateuserstatusMw() []app.HandlerFunc {
 }
 
 func _adminloginMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	// 与用户登录共用限流策略，防止暴力破解管理员密码
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
 }
 
 func _maintenanceMw() []app.HandlerFunc {
@@ -107,3 +111,50 @@ func _getstoragestatusMw() []app.HandlerFunc {
 	// your code...
 	return nil
 }
+
+func _loginMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _adminlogintwofactorMw() []app.HandlerFunc {
+	// 凭预认证令牌提交验证码，与用户登录共用限流策略
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _adminresetusertwofactorMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _admindeleteuserMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _adminrestoreuserMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _adminlistinvitationsMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _admincreateinvitationMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _invitationsMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _adminrevokeinvitationMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
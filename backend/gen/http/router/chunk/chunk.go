@@ -40,10 +40,21 @@ func Register(r *server.Hertz) {
 				_init := _upload.Group("/init", _initMw()...)
 				_init.POST("/", append(_chunkuploadinitMw(), chunk.ChunkUploadInit)...)
 			}
+			{
+				_quick := _upload.Group("/quick", _quickMw()...)
+				_quick.POST("/", append(_chunkquickuploadcheckMw(), chunk.ChunkQuickUploadCheck)...)
+				_quick.POST("/:challenge_id", append(_chunkquickuploadconfirmMw(), chunk.ChunkQuickUploadConfirm)...)
+			}
 			{
 				_status := _upload.Group("/status", _statusMw()...)
 				_status.GET("/:upload_id", append(_chunkuploadstatusMw(), chunk.ChunkUploadStatus)...)
 			}
 		}
+		_tus := root.Group("/tus", _tusMw()...)
+		_tus.OPTIONS("/", append(_tusoptionsMw(), chunk.TusOptions)...)
+		_tus.POST("/", append(_tuscreateMw(), chunk.TusCreate)...)
+		_tus.HEAD("/:upload_id", append(_tusheadMw(), chunk.TusHead)...)
+		_tus.PATCH("/:upload_id", append(_tuspatchMw(), chunk.TusPatch)...)
+		_tus.DELETE("/:upload_id", append(_tusdeleteMw(), chunk.TusDelete)...)
 	}
 }
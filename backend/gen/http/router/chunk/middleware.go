@@ -4,6 +4,8 @@ package chunk
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -12,8 +14,9 @@ func rootMw() []app.HandlerFunc {
 }
 
 func _chunkMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("upload"),
+	}
 }
 
 func _uploadMw() []app.HandlerFunc {
@@ -27,8 +30,9 @@ func _cancelMw() []app.HandlerFunc {
 }
 
 func _chunkuploadcancelMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
 }
 
 func _chunk0Mw() []app.HandlerFunc {
@@ -42,8 +46,9 @@ func _upload_idMw() []app.HandlerFunc {
 }
 
 func _chunkuploadMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
 }
 
 func _completeMw() []app.HandlerFunc {
@@ -52,8 +57,9 @@ func _completeMw() []app.HandlerFunc {
 }
 
 func _chunkuploadcompleteMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
 }
 
 func _initMw() []app.HandlerFunc {
@@ -62,8 +68,9 @@ func _initMw() []app.HandlerFunc {
 }
 
 func _chunkuploadinitMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
 }
 
 func _statusMw() []app.HandlerFunc {
@@ -72,6 +79,58 @@ func _statusMw() []app.HandlerFunc {
 }
 
 func _chunkuploadstatusMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
+
+func _quickMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _chunkquickuploadcheckMw() []app.HandlerFunc {
 	// your code...
 	return nil
 }
+
+func _chunkquickuploadconfirmMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
+
+func _tusMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("upload"),
+	}
+}
+
+func _tusoptionsMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _tuscreateMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
+
+func _tusheadMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
+
+func _tuspatchMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
+
+func _tusdeleteMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+	}
+}
@@ -18,6 +18,10 @@ func Register(r *server.Hertz) {
 
 	root := r.Group("/", rootMw()...)
 	root.GET("/", append(_indexMw(), common.Index)...)
+	{
+		_well_known := root.Group("/.well-known", _well_knownMw()...)
+		_well_known.GET("/jwks.json", append(_jwksMw(), common.JWKS)...)
+	}
 	{
 		_api := root.Group("/api", _apiMw()...)
 		{
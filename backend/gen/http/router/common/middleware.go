@@ -35,3 +35,13 @@ func _pingMw() []app.HandlerFunc {
 	// your code...
 	return nil
 }
+
+func _well_knownMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _jwksMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
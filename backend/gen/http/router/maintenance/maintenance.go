@@ -19,6 +19,8 @@ func Register(r *server.Hertz) {
 			_maintenance.POST("/clean-temp", append(_cleanTempFilesMw(), maintenancehandler.CleanTempFiles)...)
 			_maintenance.GET("/logs", append(_getSystemLogsMw(), maintenancehandler.GetSystemLogs)...)
 			_maintenance.GET("/system-info", append(_getSystemInfoMw(), maintenancehandler.GetSystemInfo)...)
+			_maintenance.GET("/blocks", append(_listLookupBlocksMw(), maintenancehandler.ListLookupBlocks)...)
+			_maintenance.DELETE("/blocks", append(_clearLookupBlockMw(), maintenancehandler.ClearLookupBlock)...)
 			{
 				_monitor := _maintenance.Group("/monitor", _monitorMw()...)
 				_monitor.GET("/storage", append(_getStorageStatusMw(), maintenancehandler.GetStorageStatus)...)
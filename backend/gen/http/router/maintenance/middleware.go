@@ -4,7 +4,7 @@ package maintenance
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
-	adminsvc "github.com/zy84338719/fileCodeBox/backend/internal/pkg/middleware"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -13,7 +13,8 @@ func rootMw() []app.HandlerFunc {
 
 func _adminMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		adminsvc.AdminMiddleware(),
+		httpmw.AdminAuth(),
+		httpmw.RouteRateLimit("admin"),
 	}
 }
 
@@ -37,6 +38,14 @@ func _getSystemInfoMw() []app.HandlerFunc {
 	return nil
 }
 
+func _listLookupBlocksMw() []app.HandlerFunc {
+	return nil
+}
+
+func _clearLookupBlockMw() []app.HandlerFunc {
+	return nil
+}
+
 func _monitorMw() []app.HandlerFunc {
 	return nil
 }
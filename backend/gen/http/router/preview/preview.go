@@ -5,6 +5,8 @@ package preview
 import (
 	"github.com/cloudwego/hertz/pkg/app/server"
 	preview "github.com/zy84338719/fileCodeBox/backend/gen/http/handler/preview"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 /*
@@ -18,6 +20,6 @@ func Register(r *server.Hertz) {
 	root := r.Group("/")
 	{
 		_preview := root.Group("/preview")
-		_preview.GET("/:code", preview.GetPreview)
+		_preview.GET("/:code", httpmw.OptionalUserAuth(model.APIKeyScopeShareRead), preview.GetPreview)
 	}
 }
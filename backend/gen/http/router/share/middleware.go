@@ -4,7 +4,8 @@ package share
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/middleware"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -24,13 +25,15 @@ func _fileMw() []app.HandlerFunc {
 
 func _sharefileMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.OptionalAuthMiddleware(),
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+		httpmw.RouteRateLimit("upload"),
 	}
 }
 
 func _selectMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.OptionalAuthMiddleware(),
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareRead),
+		httpmw.RouteRateLimit("download"),
 	}
 }
 
@@ -46,23 +49,45 @@ func _textMw() []app.HandlerFunc {
 
 func _sharetextMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.OptionalAuthMiddleware(),
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareCreate),
+		httpmw.RouteRateLimit("upload"),
 	}
 }
 
 func _usersharesMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(model.APIKeyScopeShareRead),
 	}
 }
 
 func _deleteshareMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(model.APIKeyScopeShareDelete),
 	}
 }
 
 func _downloadfileMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.OptionalUserAuth(model.APIKeyScopeShareRead),
+		httpmw.RouteRateLimit("download"),
+	}
+}
+
+func _sharestatsMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(model.APIKeyScopeShareRead),
+	}
+}
+
+func _listshareversionsMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(model.APIKeyScopeShareRead),
+	}
+}
+
+func _uploadshareversionMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(model.APIKeyScopeShareCreate),
+		httpmw.RouteRateLimit("upload"),
+	}
 }
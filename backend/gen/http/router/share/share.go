@@ -19,7 +19,12 @@ func Register(r *server.Hertz) {
 	root := r.Group("/", rootMw()...)
 	{
 		_share := root.Group("/share", _shareMw()...)
+		_share.DELETE("/:code", append(_deleteshareMw(), share.DeleteShare)...)
 		_share.GET("/download", append(_downloadfileMw(), share.DownloadFile)...)
+		_share.GET("/user", append(_usersharesMw(), share.GetUserShares)...)
+		_share.GET("/:code/stats", append(_sharestatsMw(), share.ShareStats)...)
+		_share.GET("/:code/versions", append(_listshareversionsMw(), share.ListShareVersions)...)
+		_share.POST("/:code/versions", append(_uploadshareversionMw(), share.UploadShareVersion)...)
 		{
 			_file := _share.Group("/file", _fileMw()...)
 			_file.POST("/", append(_sharefileMw(), share.ShareFile)...)
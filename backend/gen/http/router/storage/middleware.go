@@ -4,6 +4,7 @@ package storage
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -12,8 +13,10 @@ func rootMw() []app.HandlerFunc {
 }
 
 func _adminMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.AdminAuth(),
+		httpmw.RouteRateLimit("admin"),
+	}
 }
 
 func _storageMw() []app.HandlerFunc {
@@ -4,7 +4,8 @@ package user
 
 import (
 	"github.com/cloudwego/hertz/pkg/app"
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/middleware"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
 )
 
 func rootMw() []app.HandlerFunc {
@@ -19,35 +20,39 @@ func _userMw() []app.HandlerFunc {
 
 func _changepasswordMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
+		httpmw.RouteRateLimit("login"),
 	}
 }
 
 func _userinfoMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
 	}
 }
 
 func _loginMw() []app.HandlerFunc {
-	// your code...
-	return nil
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
 }
 
 func _updateprofileMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
 	}
 }
 
 func _registerMw() []app.HandlerFunc {
 	// 注册不需要认证
-	return nil
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
 }
 
 func _userstatsMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(model.APIKeyScopeFilesList),
 	}
 }
 
@@ -58,24 +63,225 @@ func _api_keysMw() []app.HandlerFunc {
 
 func _listapikeysMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
 	}
 }
 
 func _deleteapikeyMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
 	}
 }
 
 func _createapikeyMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(),
 	}
 }
 
 func _userfilesMw() []app.HandlerFunc {
 	return []app.HandlerFunc{
-		middleware.AuthMiddleware(),
+		httpmw.UserAuth(model.APIKeyScopeFilesList),
+	}
+}
+
+func _emailMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _verifyMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _verifyemailMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _sendverificationemailMw() []app.HandlerFunc {
+	// 已登录时发送到当前用户邮箱，未登录时按请求中的邮箱发送
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+		httpmw.OptionalUserAuth(),
+	}
+}
+
+func _passwordMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _forgotpasswordMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _resetpasswordMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _login0Mw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _2faMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _logintwofactorMw() []app.HandlerFunc {
+	// 凭预认证令牌提交验证码，与密码登录共用限流策略
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _logintwofactorsetupMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _2fa0Mw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _twofactorstatusMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _twofactorsetupMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _twofactorenableMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _twofactordisableMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _twofactorrecoverycodesMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _logoutMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _sessionsMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _listsessionsMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _revokeallsessionsMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _revokesessionMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _tokenMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _refreshtokenMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _oidcMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _oidcprovidersMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _providerMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _oidcloginMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _oidccallbackMw() []app.HandlerFunc {
+	// 回调先校验签名的状态 Cookie，再请求身份提供方
+	return nil
+}
+
+func _oidcexchangeMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.RouteRateLimit("login"),
+	}
+}
+
+func _deleteaccountMw() []app.HandlerFunc {
+	// 只接受登录令牌，API Key 不能删除账号
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _listinvitationsMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _createinvitationMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
+	}
+}
+
+func _invitationsMw() []app.HandlerFunc {
+	// your code...
+	return nil
+}
+
+func _revokeinvitationMw() []app.HandlerFunc {
+	return []app.HandlerFunc{
+		httpmw.UserAuth(),
 	}
 }
@@ -19,16 +19,51 @@ func Register(r *server.Hertz) {
 	root := r.Group("/", rootMw()...)
 	{
 		_user := root.Group("/user", _userMw()...)
+		_user.DELETE("/account", append(_deleteaccountMw(), user.DeleteAccount)...)
 		_user.GET("/api-keys", append(_listapikeysMw(), user.ListAPIKeys)...)
 		_api_keys := _user.Group("/api-keys", _api_keysMw()...)
 		_api_keys.DELETE("/:id", append(_deleteapikeyMw(), user.DeleteAPIKey)...)
 		_user.POST("/api-keys", append(_createapikeyMw(), user.CreateAPIKey)...)
 		_user.POST("/change-password", append(_changepasswordMw(), user.ChangePassword)...)
+		_email := _user.Group("/email", _emailMw()...)
+		_email.POST("/verify", append(_verifyemailMw(), user.VerifyEmail)...)
+		_verify := _email.Group("/verify", _verifyMw()...)
+		_verify.POST("/send", append(_sendverificationemailMw(), user.SendVerificationEmail)...)
+		_user.GET("/2fa", append(_twofactorstatusMw(), user.TwoFactorStatus)...)
+		_2fa0 := _user.Group("/2fa", _2fa0Mw()...)
+		_2fa0.POST("/disable", append(_twofactordisableMw(), user.TwoFactorDisable)...)
+		_2fa0.POST("/enable", append(_twofactorenableMw(), user.TwoFactorEnable)...)
+		_2fa0.POST("/recovery-codes", append(_twofactorrecoverycodesMw(), user.TwoFactorRecoveryCodes)...)
+		_2fa0.POST("/setup", append(_twofactorsetupMw(), user.TwoFactorSetup)...)
 		_user.GET("/files", append(_userfilesMw(), user.UserFiles)...)
 		_user.GET("/info", append(_userinfoMw(), user.UserInfo)...)
+		_user.GET("/invitations", append(_listinvitationsMw(), user.ListInvitations)...)
+		_user.POST("/invitations", append(_createinvitationMw(), user.CreateInvitation)...)
+		_invitations := _user.Group("/invitations", _invitationsMw()...)
+		_invitations.DELETE("/:id", append(_revokeinvitationMw(), user.RevokeInvitation)...)
 		_user.POST("/login", append(_loginMw(), user.Login)...)
+		_login := _user.Group("/login", _login0Mw()...)
+		_login.POST("/2fa", append(_logintwofactorMw(), user.LoginTwoFactor)...)
+		_2fa := _login.Group("/2fa", _2faMw()...)
+		_2fa.POST("/setup", append(_logintwofactorsetupMw(), user.LoginTwoFactorSetup)...)
+		_user.POST("/logout", append(_logoutMw(), user.Logout)...)
+		_oidc := _user.Group("/oidc", _oidcMw()...)
+		_oidc.POST("/exchange", append(_oidcexchangeMw(), user.OIDCExchange)...)
+		_oidc.GET("/providers", append(_oidcprovidersMw(), user.OIDCProviders)...)
+		_provider := _oidc.Group("/:provider", _providerMw()...)
+		_provider.GET("/callback", append(_oidccallbackMw(), user.OIDCCallback)...)
+		_provider.GET("/login", append(_oidcloginMw(), user.OIDCLogin)...)
+		_password := _user.Group("/password", _passwordMw()...)
+		_password.POST("/forgot", append(_forgotpasswordMw(), user.ForgotPassword)...)
+		_password.POST("/reset", append(_resetpasswordMw(), user.ResetPassword)...)
 		_user.PUT("/profile", append(_updateprofileMw(), user.UpdateProfile)...)
 		_user.POST("/register", append(_registerMw(), user.Register)...)
+		_user.GET("/sessions", append(_listsessionsMw(), user.ListSessions)...)
+		_user.DELETE("/sessions", append(_revokeallsessionsMw(), user.RevokeAllSessions)...)
+		_sessions := _user.Group("/sessions", _sessionsMw()...)
+		_sessions.DELETE("/:id", append(_revokesessionMw(), user.RevokeSession)...)
 		_user.GET("/stats", append(_userstatsMw(), user.UserStats)...)
+		_token := _user.Group("/token", _tokenMw()...)
+		_token.POST("/refresh", append(_refreshtokenMw(), user.RefreshToken)...)
 	}
 }
@@ -6,10 +6,14 @@ import (
 	"runtime"
 	"time"
 
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	chunkservice "github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/sso"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	userservice "github.com/zy84338719/fileCodeBox/backend/internal/app/user"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
 )
 
 type AdminStats struct {
@@ -47,6 +51,7 @@ type Service struct {
 	transferLogRepo    *dao.TransferLogRepository
 	adminOperationRepo *dao.AdminOperationLogRepository
 	chunkRepo          *dao.ChunkRepository
+	storage            storage.StorageInterface
 	config             *SystemConfig
 }
 
@@ -61,6 +66,11 @@ func NewService() *Service {
 	}
 }
 
+// SetStorage 设置分享文件所在的存储，立即删除用户时通过它删除文件
+func (s *Service) SetStorage(store storage.StorageInterface) {
+	s.storage = store
+}
+
 // SetConfig 设置配置
 func (s *Service) SetConfig(config *SystemConfig) {
 	s.config = config
@@ -122,16 +132,42 @@ func (s *Service) GetUsers(ctx context.Context, page, pageSize int) ([]*model.Us
 	return resps, total, nil
 }
 
-// DeleteUser 删除用户
-func (s *Service) DeleteUser(ctx context.Context, userID uint) error {
-	// 1. 删除用户的所有文件
-	// files, _ := s.fileCodeRepo.GetByUserID(ctx, userID)
-	// for _, file := range files {
-	// 	s.DeleteFile(ctx, file.ID)
-	// }
+// DeleteUser 删除用户：账号标记为待删除并注销会话和 API Key，宽限期结束后由清除任务删除分享文件和用户数据
+// req.TransferTo 不为空时分享转移给该用户；immediate 为 true 时跳过宽限期立即清除
+func (s *Service) DeleteUser(ctx context.Context, userID uint, req userservice.DeletionReq, immediate bool) (*model.User, *userservice.PurgeResult, error) {
+	if immediate && s.storage == nil {
+		return nil, nil, errors.New("存储未配置，无法立即删除")
+	}
+	user, err := userservice.NewService().ScheduleDeletion(ctx, userID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !immediate {
+		return user, nil, nil
+	}
+	result, err := userservice.NewAccountPurger(s.storage, 0).Purge(ctx, userID, req.ActorName)
+	return user, result, err
+}
+
+// RestoreUser 在宽限期内撤销用户的删除申请
+func (s *Service) RestoreUser(ctx context.Context, userID uint, req userservice.DeletionReq) (*model.User, error) {
+	return userservice.NewService().CancelDeletion(ctx, userID, req)
+}
+
+// CreateInvitation 创建邀请码，管理员可以指定使用次数、角色和配额
+func (s *Service) CreateInvitation(ctx context.Context, req *userservice.CreateInvitationReq) (*userservice.CreateInvitationResp, error) {
+	req.ByAdmin = true
+	return userservice.NewService().CreateInvitation(ctx, req)
+}
+
+// ListInvitations 分页列出邀请码
+func (s *Service) ListInvitations(ctx context.Context, query model.InvitationQuery) ([]*model.Invitation, int64, error) {
+	return userservice.NewService().ListInvitations(ctx, query)
+}
 
-	// 2. 删除用户记录
-	return s.userRepo.Delete(ctx, userID)
+// RevokeInvitation 撤销任意用户创建的邀请码
+func (s *Service) RevokeInvitation(ctx context.Context, id, actorID uint, actorName, ip string) error {
+	return userservice.NewService().RevokeInvitation(ctx, id, nil, actorID, actorName, ip)
 }
 
 // GetFiles 获取文件列表
@@ -199,6 +235,9 @@ func (s *Service) CleanupIncompleteUploads(ctx context.Context, olderThanHours i
 	if err != nil {
 		return 0, err
 	}
+	for _, uploadID := range uploadIDs {
+		chunkservice.ReleaseUploadLock(uploadID)
+	}
 
 	// TODO: 记录管理员操作日志
 	// s.logAdminOperation(ctx, "maintenance.clean_incomplete_uploads", fmt.Sprintf("Cleaned up %d incomplete uploads", deletedCount), true)
@@ -261,37 +300,79 @@ func (s *Service) UpdateUserStatus(ctx context.Context, userID uint, status stri
 		return err
 	}
 
+	if user.Status == model.UserStatusPendingDeletion {
+		return errors.New("账号正在等待删除，请先撤销删除")
+	}
+
 	user.Status = status
-	return s.userRepo.Update(ctx, user)
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	// 禁用账号时立即注销其全部会话
+	if status != "active" {
+		_, err = session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonUserDisabled)
+	}
+	return err
 }
 
 // GenerateTokenForAdmin 生成管理员登录 token
-func (s *Service) GenerateTokenForAdmin(ctx context.Context, username, password string) (string, error) {
-	// 查找用户
-	user, err := s.userRepo.GetByUsername(ctx, username)
+func (s *Service) GenerateTokenForAdmin(ctx context.Context, username, password string, client session.Client) (*session.Tokens, error) {
+	if sso.PasswordLoginDisabled() {
+		return nil, sso.ErrPasswordLoginDisabled
+	}
+
+	// 与普通用户登录使用同一组认证方式（本地密码、LDAP 等）
+	user, err := userservice.NewService().Authenticate(ctx, username, password, false)
 	if err != nil {
-		return "", errors.New("用户名或密码错误")
+		return nil, err
 	}
 
 	// 检查是否为管理员
 	if user.Role != "admin" {
-		return "", errors.New("权限不足")
-	}
-
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("用户名或密码错误")
+		return nil, errors.New("权限不足")
 	}
 
 	// 检查用户状态
 	if user.Status != "active" {
-		return "", errors.New("用户已被禁用")
+		return nil, errors.New("用户已被禁用")
+	}
+
+	// 已开启或被要求开启两步验证时，先返回预认证令牌
+	if err := twofactor.GetService().Challenge(user); err != nil {
+		return nil, err
 	}
 
-	// 生成 token (24小时过期)
-	token, err := auth.GenerateToken(user.ID, user.Username, "admin")
+	return s.issueAdminToken(ctx, user, client)
+}
+
+// CompleteTwoFactorLogin 管理员登录第二步：提交预认证令牌和验证码（或恢复码）换取 token
+// 尚未绑定时本次提交同时完成绑定，并返回新生成的恢复码
+func (s *Service) CompleteTwoFactorLogin(ctx context.Context, preAuthToken, code string, client session.Client) (*session.Tokens, []string, error) {
+	user, recoveryCodes, err := twofactor.GetService().CompleteLogin(ctx, preAuthToken, code)
 	if err != nil {
-		return "", errors.New("生成 token 失败")
+		return nil, nil, err
+	}
+	if user.Role != "admin" {
+		return nil, nil, errors.New("权限不足")
+	}
+
+	tokens, err := s.issueAdminToken(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, recoveryCodes, nil
+}
+
+// ResetUserTwoFactor 为用户重置两步验证，写入后台操作日志
+func (s *Service) ResetUserTwoFactor(ctx context.Context, userID, actorID uint, actorName, ip string) error {
+	return twofactor.GetService().Reset(ctx, userID, actorID, actorName, ip)
+}
+
+// issueAdminToken 创建管理员登录会话并记录登录时间
+func (s *Service) issueAdminToken(ctx context.Context, user *model.User, client session.Client) (*session.Tokens, error) {
+	tokens, err := session.GetService().Create(ctx, user, client)
+	if err != nil {
+		return nil, err
 	}
 
 	// 更新最后登录时间
@@ -299,7 +380,7 @@ func (s *Service) GenerateTokenForAdmin(ctx context.Context, username, password
 	user.LastLoginAt = &now
 	_ = s.userRepo.Update(ctx, user)
 
-	return token, nil
+	return tokens, nil
 }
 
 // ==================== 维护工具 API ====================
@@ -347,6 +428,9 @@ func (s *Service) CleanTempFiles(ctx context.Context) (int64, int64, error) {
 	if err != nil {
 		return 0, 0, err
 	}
+	for _, uploadID := range uploadIDs {
+		chunkservice.ReleaseUploadLock(uploadID)
+	}
 
 	return int64(deletedCount), 0, nil
 }
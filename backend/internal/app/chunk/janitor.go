@@ -0,0 +1,113 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	"go.uber.org/zap"
+)
+
+// janitorBatchSize 每轮回收最多处理的会话数，剩余的留给下一轮
+const janitorBatchSize = 500
+
+// GCResult 一次回收的结果
+type GCResult struct {
+	Sessions   int   `json:"sessions"`    // 回收的上传会话数
+	FreedBytes int64 `json:"freed_bytes"` // 已写入分片的总大小
+	Failed     int   `json:"failed"`      // 删除存储失败、留待下次重试的会话数
+}
+
+// Janitor 定期回收闲置的分片上传会话：通过存储驱动删除已写入的分片，再删除会话记录
+type Janitor struct {
+	service  *Service
+	storage  storage.StorageInterface
+	logRepo  *dao.AdminOperationLogRepository
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// NewJanitor 创建回收任务，ttl 为会话最后一次活动后的保留时长
+func NewJanitor(service *Service, store storage.StorageInterface, ttl, interval time.Duration) *Janitor {
+	return &Janitor{
+		service:  service,
+		storage:  store,
+		logRepo:  dao.NewAdminOperationLogRepository(),
+		ttl:      ttl,
+		interval: interval,
+	}
+}
+
+// Start 在后台按间隔执行回收，ctx 取消后退出
+func (j *Janitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := j.RunOnce(ctx, "scheduler"); err != nil {
+					logger.Error("回收闲置上传会话失败", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce 执行一轮回收，并在有会话被回收或出错时写入后台操作日志
+func (j *Janitor) RunOnce(ctx context.Context, actor string) (*GCResult, error) {
+	start := time.Now()
+	result, err := j.collect(ctx, start.Add(-j.ttl))
+	if err == nil && result.Sessions == 0 && result.Failed == 0 {
+		return result, nil
+	}
+
+	entry := &model.AdminOperationLog{
+		Action:    "maintenance.gc_upload_sessions",
+		Target:    fmt.Sprintf("idle > %s", j.ttl),
+		Success:   err == nil && result.Failed == 0,
+		ActorName: actor,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	} else {
+		entry.Message = fmt.Sprintf("回收 %d 个上传会话，释放 %d 字节，%d 个失败", result.Sessions, result.FreedBytes, result.Failed)
+	}
+	if logErr := j.logRepo.Create(ctx, entry); logErr != nil {
+		logger.Warn("记录回收日志失败", zap.Error(logErr))
+	}
+	return result, err
+}
+
+func (j *Janitor) collect(ctx context.Context, idleBefore time.Time) (*GCResult, error) {
+	sessions, err := j.service.chunkRepo.GetIdleSessions(ctx, idleBefore, janitorBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{}
+	for _, session := range sessions {
+		size, _ := j.service.chunkRepo.SumCompletedChunkSize(ctx, session.UploadID)
+
+		// 先删除存储再删除记录，存储删除失败时保留记录以便下次重试
+		if err := j.storage.CleanChunks(ctx, session.UploadID); err != nil {
+			logger.Warn("删除上传分片失败", zap.String("upload_id", session.UploadID), zap.Error(err))
+			result.Failed++
+			continue
+		}
+		if err := j.service.DeleteUpload(ctx, session.UploadID); err != nil {
+			result.Failed++
+			continue
+		}
+		result.Sessions++
+		result.FreedBytes += size
+	}
+	return result, nil
+}
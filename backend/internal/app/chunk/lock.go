@@ -0,0 +1,18 @@
+package chunk
+
+import "sync"
+
+// uploadLocks 每个上传的读写锁：分片接口并行写入不同分片时共享持有，
+// tus 写入、合并完成和取消时独占持有
+var uploadLocks sync.Map // map[string]*sync.RWMutex
+
+// UploadLock 获取上传的读写锁，不存在时创建
+func UploadLock(uploadID string) *sync.RWMutex {
+	lock, _ := uploadLocks.LoadOrStore(uploadID, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// ReleaseUploadLock 上传完成、取消或被回收后删除写锁，之后的请求会拿到新的锁
+func ReleaseUploadLock(uploadID string) {
+	uploadLocks.Delete(uploadID)
+}
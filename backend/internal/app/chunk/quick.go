@@ -0,0 +1,193 @@
+package chunk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/redis"
+)
+
+const (
+	// quickChallengeTTL 秒传挑战的有效期
+	quickChallengeTTL = 2 * time.Minute
+	// quickChallengeMaxLength 挑战区间的最大长度
+	quickChallengeMaxLength = 64 * 1024
+	// maxPendingChallenges 未连接 Redis 时进程内同时存在的挑战数量上限，防止内存被耗尽
+	maxPendingChallenges = 10000
+)
+
+// quickChallengeKeyPrefix Redis 中秒传挑战的键前缀
+const quickChallengeKeyPrefix = "fcb:quick:"
+
+var (
+	ErrQuickUploadUnavailable = errors.New("文件不存在，无法秒传")
+	ErrChallengeNotFound      = errors.New("秒传挑战不存在或已过期")
+	ErrTooManyChallenges      = errors.New("秒传请求过多，请稍后再试")
+)
+
+// QuickUploadChallenge 秒传持有证明挑战
+// 客户端需要返回以 Nonce 为密钥、文件 [Offset, Offset+Length) 区间内容的 HMAC-SHA256，
+// Nonce 每次随机生成，即使区间覆盖整个文件，仅知道文件哈希也无法通过校验
+type QuickUploadChallenge struct {
+	ID        string    `json:"challenge_id"`
+	Nonce     string    `json:"nonce"`
+	FileHash  string    `json:"file_hash"`
+	FileSize  int64     `json:"file_size"`
+	Offset    int64     `json:"offset"`
+	Length    int64     `json:"length"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SourceID  uint      `json:"source_id"`
+
+	// Source 被复用的已有分享，新分享将引用它的存储文件；取出挑战时重新加载
+	Source *model.FileCode `json:"-"`
+}
+
+// Verify 校验客户端提交的持有证明，data 为服务端读取的对应区间内容
+func (ch *QuickUploadChallenge) Verify(data []byte, proof string) bool {
+	if int64(len(data)) != ch.Length {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ch.Proof(data)), []byte(strings.ToLower(proof))) == 1
+}
+
+// Proof 计算区间内容的持有证明：hex(HMAC-SHA256(key=Nonce, data))
+func (ch *QuickUploadChallenge) Proof(data []byte) string {
+	mac := hmac.New(sha256.New, []byte(ch.Nonce))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckQuickUpload 检查是否可以秒传：存在哈希和大小都匹配的已校验文件时签发持有证明挑战
+// 已连接 Redis 时挑战保存在 Redis 中，可以在任意实例上提交证明
+func (s *Service) CheckQuickUpload(ctx context.Context, fileHash string, fileSize int64) (*QuickUploadChallenge, error) {
+	fileHash = strings.ToLower(strings.TrimSpace(fileHash))
+	if len(fileHash) != sha256.Size*2 || fileSize <= 0 {
+		return nil, errors.New("文件哈希必须为 SHA-256 十六进制字符串，且文件大小大于0")
+	}
+
+	source, err := s.fileCodeRepo.GetByHashAndSize(ctx, fileHash, fileSize)
+	if err != nil {
+		return nil, ErrQuickUploadUnavailable
+	}
+
+	length := int64(quickChallengeMaxLength)
+	if fileSize < length {
+		length = fileSize
+	}
+	offset, err := randomInt64(fileSize - length + 1)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ch := &QuickUploadChallenge{
+		ID:        uuid.New().String(),
+		Nonce:     hex.EncodeToString(nonce),
+		FileHash:  fileHash,
+		FileSize:  fileSize,
+		Offset:    offset,
+		Length:    length,
+		ExpiresAt: time.Now().Add(quickChallengeTTL),
+		SourceID:  source.ID,
+		Source:    source,
+	}
+
+	if redis.GetClient() != nil {
+		data, err := json.Marshal(ch)
+		if err != nil {
+			return nil, err
+		}
+		if err := redis.Set(ctx, quickChallengeKeyPrefix+ch.ID, data, quickChallengeTTL); err != nil {
+			return nil, err
+		}
+		return ch, nil
+	}
+
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+	s.purgeExpiredChallenges()
+	if len(s.challenges) >= maxPendingChallenges {
+		return nil, ErrTooManyChallenges
+	}
+	s.challenges[ch.ID] = ch
+	return ch, nil
+}
+
+// TakeQuickUploadChallenge 取出挑战并重新加载被复用的分享，每个挑战只能使用一次（无论校验是否通过）
+func (s *Service) TakeQuickUploadChallenge(ctx context.Context, challengeID string) (*QuickUploadChallenge, error) {
+	ch, err := s.takeChallenge(ctx, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(ch.ExpiresAt) {
+		return nil, ErrChallengeNotFound
+	}
+
+	// 签发挑战后被复用的分享可能已被删除
+	source, err := s.fileCodeRepo.GetByID(ctx, ch.SourceID)
+	if err != nil || source.FileHash != ch.FileHash || source.Size != ch.FileSize {
+		return nil, ErrQuickUploadUnavailable
+	}
+	ch.Source = source
+	return ch, nil
+}
+
+// takeChallenge 从 Redis 或进程内存中原子地取出并删除挑战
+func (s *Service) takeChallenge(ctx context.Context, challengeID string) (*QuickUploadChallenge, error) {
+	if client := redis.GetClient(); client != nil {
+		data, err := client.GetDel(ctx, quickChallengeKeyPrefix+challengeID).Bytes()
+		if err != nil {
+			return nil, ErrChallengeNotFound
+		}
+		var ch QuickUploadChallenge
+		if err := json.Unmarshal(data, &ch); err != nil {
+			return nil, ErrChallengeNotFound
+		}
+		return &ch, nil
+	}
+
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+	ch, ok := s.challenges[challengeID]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+	delete(s.challenges, challengeID)
+	return ch, nil
+}
+
+// purgeExpiredChallenges 清理过期挑战，调用方需持有 challengeMu
+func (s *Service) purgeExpiredChallenges() {
+	now := time.Now()
+	for id, ch := range s.challenges {
+		if now.After(ch.ExpiresAt) {
+			delete(s.challenges, id)
+		}
+	}
+}
+
+// randomInt64 返回 [0, n) 范围内的安全随机数
+func randomInt64(n int64) (int64, error) {
+	if n <= 1 {
+		return 0, nil
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64(), nil
+}
@@ -0,0 +1,74 @@
+package chunk_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/chunk"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+func TestQuickUploadProof(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+
+	// 小于挑战区间上限的文件，挑战区间就是整个文件
+	content := []byte("small file content")
+	sum := sha256.Sum256(content)
+	fileHash := hex.EncodeToString(sum[:])
+	source := &model.FileCode{Code: "src", FilePath: "a/b.txt", Size: int64(len(content)), FileHash: fileHash, HashVerified: true}
+	if err := dao.NewFileCodeRepository().Create(ctx, source); err != nil {
+		t.Fatalf("创建分享失败: %v", err)
+	}
+
+	service := chunk.NewService()
+	ch, err := service.CheckQuickUpload(ctx, fileHash, source.Size)
+	if err != nil {
+		t.Fatalf("CheckQuickUpload: %v", err)
+	}
+	if ch.Offset != 0 || ch.Length != source.Size || ch.Nonce == "" {
+		t.Fatalf("挑战: %+v", ch)
+	}
+
+	// 只知道文件哈希的一方无法给出证明
+	if ch.Verify(content, fileHash) {
+		t.Fatal("文件哈希被当作持有证明接受")
+	}
+	if !ch.Verify(content, ch.Proof(content)) {
+		t.Fatal("正确的持有证明被拒绝")
+	}
+
+	// 每次挑战的 nonce 不同，证明不能复用
+	other, err := service.CheckQuickUpload(ctx, fileHash, source.Size)
+	if err != nil {
+		t.Fatalf("CheckQuickUpload: %v", err)
+	}
+	if other.Nonce == ch.Nonce || other.Verify(content, ch.Proof(content)) {
+		t.Fatal("不同挑战接受了相同的证明")
+	}
+
+	// 挑战只能取出一次，取出时重新加载被复用的分享
+	taken, err := service.TakeQuickUploadChallenge(ctx, ch.ID)
+	if err != nil {
+		t.Fatalf("TakeQuickUploadChallenge: %v", err)
+	}
+	if taken.Source == nil || taken.Source.ID != source.ID || taken.Nonce != ch.Nonce {
+		t.Fatalf("取出的挑战: %+v", taken)
+	}
+	if _, err := service.TakeQuickUploadChallenge(ctx, ch.ID); !errors.Is(err, chunk.ErrChallengeNotFound) {
+		t.Fatalf("重复取出挑战: %v", err)
+	}
+
+	// 签发挑战后被复用的分享已删除
+	if err := dao.NewFileCodeRepository().Delete(ctx, source.ID); err != nil {
+		t.Fatalf("删除分享失败: %v", err)
+	}
+	if _, err := service.TakeQuickUploadChallenge(ctx, other.ID); !errors.Is(err, chunk.ErrQuickUploadUnavailable) {
+		t.Fatalf("分享已删除: %v", err)
+	}
+}
@@ -4,17 +4,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 )
 
 type InitiateUploadReq struct {
-	UploadID    string
 	FileName    string
 	TotalChunks int
 	FileSize    int64
 	ChunkSize   int
+	FileHash    string // 客户端声明的整个文件 SHA-256，可为空
+	E2EE        bool   // 端到端加密上传
+	E2EEMeta    string // 端到端加密元数据（JSON）
+	UploadMeta  string // tus Upload-Metadata 原文
+
+	UserID       *uint  // 登录用户，会话绑定到该用户
+	OwnerIP      string // 发起上传的客户端 IP，用于匿名会话数限制
+	RequireToken bool   // 匿名会话是否签发上传令牌（tus 匿名上传以服务端生成的 upload_id 作为凭证）
 }
 
 type UploadChunkReq struct {
@@ -22,8 +32,25 @@ type UploadChunkReq struct {
 	ChunkIndex int
 	ChunkHash  string
 	ChunkSize  int
+	Nonce      string // E2EE 分片 nonce（base64）
+	AuthTag    string // E2EE 分片认证 tag（base64）
 }
 
+// ChunkHashMismatchError 分片内容与客户端声明的哈希不一致，客户端可以重新上传该分片
+type ChunkHashMismatchError struct {
+	ChunkIndex int
+	Expected   string
+	Actual     string
+	RetryCount int
+}
+
+func (e *ChunkHashMismatchError) Error() string {
+	return fmt.Sprintf("chunk %d hash mismatch: expected %s, got %s", e.ChunkIndex, e.Expected, e.Actual)
+}
+
+// ErrFileIntegrity 合并后的文件与声明的大小或哈希不一致
+var ErrFileIntegrity = errors.New("文件完整性校验失败")
+
 type ChunkResp struct {
 	ID          uint   `json:"id"`
 	UploadID    string `json:"upload_id"`
@@ -35,6 +62,7 @@ type ChunkResp struct {
 	FileName    string `json:"file_name"`
 	Completed   bool   `json:"completed"`
 	Status      string `json:"status"`
+	UploadToken string `json:"upload_token,omitempty"` // 仅初始化匿名会话时返回一次
 }
 
 type ProgressResp struct {
@@ -46,35 +74,57 @@ type ProgressResp struct {
 }
 
 type Service struct {
-	chunkRepo *dao.ChunkRepository
+	chunkRepo    *dao.ChunkRepository
+	fileCodeRepo *dao.FileCodeRepository
+
+	challengeMu sync.Mutex
+	challenges  map[string]*QuickUploadChallenge // 未使用的秒传挑战，按 ID 索引
 }
 
 func NewService() *Service {
 	return &Service{
-		chunkRepo: dao.NewChunkRepository(),
+		chunkRepo:    dao.NewChunkRepository(),
+		fileCodeRepo: dao.NewFileCodeRepository(),
+		challenges:   make(map[string]*QuickUploadChallenge),
 	}
 }
 
 // InitiateUpload 初始化分片上传
 func (s *Service) InitiateUpload(ctx context.Context, req *InitiateUploadReq) (*ChunkResp, error) {
-	// 检查是否已存在相同的上传ID
-	existing, err := s.chunkRepo.GetByUploadID(ctx, req.UploadID)
-	if err == nil && existing != nil {
-		return nil, errors.New("upload ID already exists")
+	// 限制同一用户 / IP 同时未完成的上传会话数
+	if err := s.checkSessionLimit(ctx, req.UserID, req.OwnerIP); err != nil {
+		return nil, err
+	}
+
+	// 上传ID由服务端生成，匿名会话另外签发上传令牌
+	var token, tokenHash string
+	if req.UserID == nil && req.RequireToken {
+		var err error
+		if token, tokenHash, err = newUploadToken(); err != nil {
+			return nil, err
+		}
 	}
 
 	// 创建控制记录（chunk_index = -1）
 	chunk := &model.UploadChunk{
-		UploadID:    req.UploadID,
+		UploadID:    uuid.New().String(),
 		ChunkIndex:  -1, // 控制记录标识
 		TotalChunks: req.TotalChunks,
 		FileSize:    req.FileSize,
 		ChunkSize:   req.ChunkSize,
 		FileName:    req.FileName,
+		FileHash:    req.FileHash,
 		Status:      "pending",
+		E2EE:        req.E2EE,
+		E2EEMeta:    req.E2EEMeta,
+		UploadMeta:  req.UploadMeta,
+
+		UserID:          req.UserID,
+		OwnerIP:         req.OwnerIP,
+		UploadTokenHash: tokenHash,
 	}
 
-	err = s.chunkRepo.Create(ctx, chunk)
+	err := s.chunkRepo.Create(ctx, chunk)
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +140,7 @@ func (s *Service) InitiateUpload(ctx context.Context, req *InitiateUploadReq) (*
 		FileName:    chunk.FileName,
 		Completed:   chunk.Completed,
 		Status:      chunk.Status,
+		UploadToken: token,
 	}, nil
 }
 
@@ -123,6 +174,11 @@ func (s *Service) UploadChunk(ctx context.Context, req *UploadChunkReq) (*ChunkR
 		}, nil // 分片已完成，直接返回
 	}
 
+	// E2EE 分片必须携带流式解密所需的 nonce/tag
+	if controlChunk.E2EE && (req.Nonce == "" || req.AuthTag == "") {
+		return nil, errors.New("E2EE chunk requires nonce and tag")
+	}
+
 	// 创建或更新分片记录
 	chunk := &model.UploadChunk{
 		UploadID:   req.UploadID,
@@ -131,6 +187,8 @@ func (s *Service) UploadChunk(ctx context.Context, req *UploadChunkReq) (*ChunkR
 		ChunkSize:  req.ChunkSize,
 		Status:     "completed",
 		Completed:  true,
+		Nonce:      req.Nonce,
+		AuthTag:    req.AuthTag,
 	}
 
 	if existingChunk != nil {
@@ -141,8 +199,8 @@ func (s *Service) UploadChunk(ctx context.Context, req *UploadChunkReq) (*ChunkR
 		}
 		chunk.Model.ID = existingChunk.Model.ID
 	} else {
-		// 创建新记录
-		err = s.chunkRepo.Create(ctx, chunk)
+		// 创建新记录；之前校验失败留下的记录会被更新，保留重试次数
+		err = s.chunkRepo.FirstOrCreateChunk(ctx, chunk)
 		if err != nil {
 			return nil, err
 		}
@@ -162,6 +220,51 @@ func (s *Service) UploadChunk(ctx context.Context, req *UploadChunkReq) (*ChunkR
 	}, nil
 }
 
+// ChunkOffset 计算分片在目标文件中的写入偏移
+// 分片直接写入预分配的文件，因此除最后一个分片外必须恰好为 ChunkSize，最后一个分片补齐剩余字节
+func ChunkOffset(info *model.UploadChunk, chunkIndex int, size int64) (int64, error) {
+	if chunkIndex < 0 || chunkIndex >= info.TotalChunks {
+		return 0, errors.New("invalid chunk index")
+	}
+	offset := int64(chunkIndex) * int64(info.ChunkSize)
+	expected := int64(info.ChunkSize)
+	if chunkIndex == info.TotalChunks-1 {
+		expected = info.FileSize - offset
+	}
+	if size != expected {
+		return 0, fmt.Errorf("分片 %d 大小应为 %d 字节，实际为 %d 字节", chunkIndex, expected, size)
+	}
+	return offset, nil
+}
+
+// VerifyChunkHash 校验分片内容哈希，expected 为空时不校验
+// 不一致时记录重试次数和错误信息，返回 *ChunkHashMismatchError
+func (s *Service) VerifyChunkHash(ctx context.Context, uploadID string, chunkIndex int, expected, actual string) error {
+	if expected == "" || strings.EqualFold(expected, actual) {
+		return nil
+	}
+
+	controlChunk, err := s.chunkRepo.GetByUploadID(ctx, uploadID)
+	if err != nil {
+		return fmt.Errorf("upload ID not found: %v", err)
+	}
+	if chunkIndex < 0 || chunkIndex >= controlChunk.TotalChunks {
+		return errors.New("invalid chunk index")
+	}
+
+	mismatch := &ChunkHashMismatchError{ChunkIndex: chunkIndex, Expected: expected, Actual: actual}
+	mismatch.RetryCount, err = s.chunkRepo.RecordChunkFailure(ctx, uploadID, chunkIndex, mismatch.Error())
+	if err != nil {
+		return err
+	}
+	return mismatch
+}
+
+// MarkUploadFailed 标记上传失败并记录原因
+func (s *Service) MarkUploadFailed(ctx context.Context, uploadID string, reason string) error {
+	return s.chunkRepo.MarkUploadFailed(ctx, uploadID, reason)
+}
+
 // CheckUploadProgress 检查上传进度
 func (s *Service) CheckUploadProgress(ctx context.Context, uploadID string) (*ProgressResp, error) {
 	controlChunk, err := s.chunkRepo.GetByUploadID(ctx, uploadID)
@@ -234,9 +337,13 @@ func (s *Service) GetUploadList(ctx context.Context, page, pageSize int) ([]*Chu
 	return resps, total, nil
 }
 
-// DeleteUpload 删除上传
+// DeleteUpload 删除上传并释放其写锁
 func (s *Service) DeleteUpload(ctx context.Context, uploadID string) error {
-	return s.chunkRepo.DeleteByUploadID(ctx, uploadID)
+	if err := s.chunkRepo.DeleteByUploadID(ctx, uploadID); err != nil {
+		return err
+	}
+	ReleaseUploadLock(uploadID)
+	return nil
 }
 
 // GetUploadedChunkIndexes 获取已上传分片的索引列表
@@ -244,30 +351,16 @@ func (s *Service) GetUploadedChunkIndexes(ctx context.Context, uploadID string)
 	return s.chunkRepo.GetUploadedChunkIndexes(ctx, uploadID)
 }
 
+// GetCompletedChunks 获取已完成的分片记录（按索引排序）
+func (s *Service) GetCompletedChunks(ctx context.Context, uploadID string) ([]*model.UploadChunk, error) {
+	return s.chunkRepo.GetCompletedChunks(ctx, uploadID)
+}
+
 // GetUploadInfo 获取上传信息（包括文件名、大小等）
 func (s *Service) GetUploadInfo(ctx context.Context, uploadID string) (*model.UploadChunk, error) {
 	return s.chunkRepo.GetByUploadID(ctx, uploadID)
 }
 
-// CheckQuickUpload 检查是否可以快速上传（通过文件哈希查找已存在的上传）
-// 如果找到相同的文件哈希和文件大小，返回对应的分享代码
-func (s *Service) CheckQuickUpload(ctx context.Context, fileHash string, fileSize int64) (string, error) {
-	// 查找相同哈希和文件大小的已完成上传
-	chunk, err := s.chunkRepo.GetByHash(ctx, fileHash, fileSize)
-	if err != nil {
-		return "", err
-	}
-
-	// 检查状态是否为已完成
-	if chunk.Status != "completed" {
-		return "", errors.New("upload not completed")
-	}
-
-	// TODO: 查找对应的分享代码
-	// 当前实现需要关联到 FileCode 表，暂时返回空字符串
-	return "", errors.New("share code not found")
-}
-
 // CompleteUploadWithShare 完成上传并生成分享代码
 func (s *Service) CompleteUploadWithShare(ctx context.Context, uploadID string, expireValue int, expireStyle string, requireAuth bool, shareService ShareServiceInterface) (string, string, error) {
 	// 检查所有分片是否已完成
@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+const (
+	// defaultMaxSessionsPerUser 未配置时每个登录用户同时未完成的上传会话数
+	defaultMaxSessionsPerUser = 10
+	// defaultMaxSessionsPerIP 未配置时每个 IP 同时未完成的匿名上传会话数
+	defaultMaxSessionsPerIP = 5
+	// sessionLimitWindow 超过该时间仍未完成的会话视为已放弃，不再计入并发限制
+	sessionLimitWindow = 24 * time.Hour
+	// uploadTokenBytes 上传令牌的随机字节数
+	uploadTokenBytes = 32
+)
+
+var (
+	ErrUploadNotFound  = errors.New("上传记录不存在")
+	ErrUploadForbidden = errors.New("无权限操作此上传")
+	ErrTooManySessions = errors.New("未完成的上传过多，请先完成或取消已有上传")
+)
+
+// AuthorizeUpload 校验调用方是否为上传会话的创建者，返回控制记录
+// 登录用户创建的会话要求同一用户；匿名会话要求携带初始化时签发的上传令牌
+func (s *Service) AuthorizeUpload(ctx context.Context, uploadID string, userID *uint, token string) (*model.UploadChunk, error) {
+	controlChunk, err := s.chunkRepo.GetByUploadID(ctx, uploadID)
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	switch {
+	case controlChunk.UserID != nil:
+		if userID == nil || *userID != *controlChunk.UserID {
+			return nil, ErrUploadForbidden
+		}
+	case controlChunk.UploadTokenHash != "":
+		if token == "" || subtle.ConstantTimeCompare([]byte(hashUploadToken(token)), []byte(controlChunk.UploadTokenHash)) != 1 {
+			return nil, ErrUploadForbidden
+		}
+	}
+	return controlChunk, nil
+}
+
+// checkSessionLimit 检查用户（或匿名 IP）未完成的上传会话数是否已达上限
+func (s *Service) checkSessionLimit(ctx context.Context, userID *uint, ownerIP string) error {
+	limit := defaultMaxSessionsPerIP
+	if userID != nil {
+		limit = defaultMaxSessionsPerUser
+	}
+	if cfg := conf.GetGlobalConfig(); cfg != nil {
+		if userID != nil && cfg.Upload.MaxSessionsPerUser > 0 {
+			limit = cfg.Upload.MaxSessionsPerUser
+		}
+		if userID == nil && cfg.Upload.MaxSessionsPerIP > 0 {
+			limit = cfg.Upload.MaxSessionsPerIP
+		}
+	}
+
+	count, err := s.chunkRepo.CountOpenSessions(ctx, userID, ownerIP, time.Now().Add(-sessionLimitWindow))
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return ErrTooManySessions
+	}
+	return nil
+}
+
+// newUploadToken 生成上传令牌，返回明文和用于保存的哈希
+func newUploadToken() (string, string, error) {
+	buf := make([]byte, uploadTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashUploadToken(token), nil
+}
+
+func hashUploadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package chunk
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// tus 上传复用分片上传的记录：控制记录的 FileSize 即 Upload-Length，
+// 每次 PATCH 写入的数据按顺序追加为新的分片，已完成分片的大小之和即 Upload-Offset
+
+// GetUploadOffset 获取已写入的字节数
+func (s *Service) GetUploadOffset(ctx context.Context, uploadID string) (int64, error) {
+	return s.chunkRepo.SumCompletedChunkSize(ctx, uploadID)
+}
+
+// AppendChunk 追加一个已保存到存储的分片，index 必须等于当前分片数
+func (s *Service) AppendChunk(ctx context.Context, uploadID string, index int, size int, chunkHash string) error {
+	if index < 0 {
+		return errors.New("invalid chunk index")
+	}
+
+	chunk := &model.UploadChunk{
+		UploadID:   uploadID,
+		ChunkIndex: index,
+		ChunkHash:  chunkHash,
+		ChunkSize:  size,
+		Status:     "completed",
+		Completed:  true,
+	}
+	if err := s.chunkRepo.FirstOrCreateChunk(ctx, chunk); err != nil {
+		return err
+	}
+	return s.chunkRepo.UpdateTotalChunks(ctx, uploadID, index+1)
+}
+
+// GetShareCodeByUploadID 获取已完成上传对应的分享码
+func (s *Service) GetShareCodeByUploadID(ctx context.Context, uploadID string) (string, error) {
+	fileCode, err := s.fileCodeRepo.GetByUploadID(ctx, uploadID)
+	if err != nil {
+		return "", err
+	}
+	return fileCode.Code, nil
+}
@@ -0,0 +1,307 @@
+// Package guard 防止暴力猜测分享码：按客户端 IP、“客户端 IP + 分享码前缀”以及不区分客户端的分享码前缀
+// 统计查找失败次数，超过阈值后封禁。状态保存在 counter.Store 中，已连接 Redis 时多实例共享
+package guard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/counter"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+)
+
+// 封禁的统计维度
+const (
+	ScopeIP     = "ip"     // 单个客户端 IP
+	ScopePrefix = "prefix" // 单个客户端 IP 猜测的分享码前缀，对象为 "前缀@IP"
+	// ScopeGlobalPrefix 所有客户端对同一分享码前缀的失败次数，防止攻击者轮换 IP 分散猜测。
+	// 阈值应明显高于单个 IP 的阈值，封禁时长固定为 block_seconds 不逐级延长，
+	// 避免攻击者借此长期锁定某个前缀
+	ScopeGlobalPrefix = "prefix_global"
+)
+
+// strikeWindow 封禁级别的保留时间，期间再次被封禁时封禁时长翻倍
+const strikeWindow = 24 * time.Hour
+
+const (
+	failKeyPrefix   = "guard:fail:"
+	blockKeyPrefix  = "guard:block:"
+	strikeKeyPrefix = "guard:strike:"
+)
+
+// BlockedError 客户端或分享码前缀处于封禁期
+type BlockedError struct {
+	Scope      string
+	Subject    string
+	RetryAfter time.Duration
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("尝试次数过多，请 %d 秒后再试", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds 剩余封禁时间，向上取整到秒
+func (e *BlockedError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// Block 一条生效中的封禁
+type Block struct {
+	Scope      string    `json:"scope"`
+	Subject    string    `json:"subject"`
+	Level      int64     `json:"level"`       // 第几次被封禁，封禁时长随级别翻倍
+	RetryAfter int64     `json:"retry_after"` // 剩余封禁秒数
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Service 分享码查找的暴力破解防护
+type Service struct {
+	logRepo *dao.AdminOperationLogRepository
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// GetService 获取全局防护服务
+func GetService() *Service {
+	defaultOnce.Do(func() {
+		defaultService = &Service{logRepo: dao.NewAdminOperationLogRepository()}
+	})
+	return defaultService
+}
+
+// Check 查找分享码前调用，客户端 IP 处于封禁期时返回 *BlockedError
+// 前缀封禁只在查找失败时由 RecordFailure 生效，不影响正确的分享码
+// 计数存储不可用时放行，避免 Redis 故障导致分享不可访问
+func (s *Service) Check(ctx context.Context, ip, code string) error {
+	if _, ok := policy(); !ok {
+		return nil
+	}
+	return blockedError(ctx, counter.Default(), subject{scope: ScopeIP, value: ip})
+}
+
+// CheckPasswordAttempt 提交分享密码前调用，该客户端猜测的前缀处于封禁期时返回 *BlockedError，
+// 避免封禁期间继续比对密码
+func (s *Service) CheckPasswordAttempt(ctx context.Context, ip, code string) error {
+	policy, ok := policy()
+	if !ok {
+		return nil
+	}
+	return prefixBlocked(ctx, counter.Default(), subjects(policy, ip, code))
+}
+
+// RecordFailure 记录一次失败的查找（分享码不存在或密码错误）
+// 该客户端猜测的前缀已被封禁，或本次失败达到阈值时返回 *BlockedError
+func (s *Service) RecordFailure(ctx context.Context, ip, code string) error {
+	policy, ok := policy()
+	if !ok {
+		return nil
+	}
+	store := counter.Default()
+	window := time.Duration(policy.WindowSeconds) * time.Second
+
+	list := subjects(policy, ip, code)
+	if err := prefixBlocked(ctx, store, list); err != nil {
+		return err
+	}
+
+	var blocked error
+	for _, subject := range list {
+		limit := policy.MaxFailures
+		switch subject.scope {
+		case ScopePrefix:
+			limit = policy.MaxPrefixFailures
+		case ScopeGlobalPrefix:
+			limit = policy.MaxGlobalPrefixFailures
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		failures, _, err := store.IncrBy(ctx, failKeyPrefix+subject.key(), 1, window)
+		if err != nil {
+			logger.Warn("记录查找失败次数失败", zap.Error(err))
+			return nil
+		}
+		if failures < int64(limit) {
+			continue
+		}
+
+		duration, err := s.block(ctx, store, policy, subject)
+		if err != nil {
+			logger.Warn("写入封禁状态失败", zap.Error(err))
+			return nil
+		}
+		if blocked == nil {
+			blocked = &BlockedError{Scope: subject.scope, Subject: subject.value, RetryAfter: duration}
+		}
+	}
+	return blocked
+}
+
+// blockedError 对象处于封禁期时返回 *BlockedError，读取失败时放行
+func blockedError(ctx context.Context, store counter.Store, subject subject) error {
+	level, ttl, err := store.Get(ctx, blockKeyPrefix+subject.key())
+	if err != nil {
+		logger.Warn("读取封禁状态失败", zap.Error(err))
+		return nil
+	}
+	if level > 0 {
+		return &BlockedError{Scope: subject.scope, Subject: subject.value, RetryAfter: ttl}
+	}
+	return nil
+}
+
+// prefixBlocked 统计对象中的前缀处于封禁期时返回 *BlockedError
+func prefixBlocked(ctx context.Context, store counter.Store, list []subject) error {
+	for _, subject := range list {
+		if subject.scope == ScopeIP {
+			continue
+		}
+		if err := blockedError(ctx, store, subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// block 封禁并清零失败计数，封禁时长为 block_seconds * 2^(级别-1)，不超过 max_block_seconds
+// 全局前缀固定为第 1 级
+func (s *Service) block(ctx context.Context, store counter.Store, policy conf.LookupGuardConfig, subject subject) (time.Duration, error) {
+	level := int64(1)
+	if subject.scope != ScopeGlobalPrefix {
+		var err error
+		level, _, err = store.IncrBy(ctx, strikeKeyPrefix+subject.key(), 1, strikeWindow)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	duration := time.Duration(policy.BlockSeconds) * time.Second
+	maxDuration := time.Duration(policy.MaxBlockSeconds) * time.Second
+	for i := int64(1); i < level && (maxDuration <= 0 || duration < maxDuration); i++ {
+		duration *= 2
+	}
+	if maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+
+	if err := store.Set(ctx, blockKeyPrefix+subject.key(), level, duration); err != nil {
+		return 0, err
+	}
+	_ = store.Reset(ctx, failKeyPrefix+subject.key())
+
+	logger.Warn("分享码查找失败次数过多，已封禁",
+		zap.String("scope", subject.scope),
+		zap.String("subject", subject.value),
+		zap.Int64("level", level),
+		zap.Duration("duration", duration),
+	)
+	return duration, nil
+}
+
+// ListBlocks 列出生效中的封禁，按剩余时间从长到短排序
+func (s *Service) ListBlocks(ctx context.Context) ([]Block, error) {
+	entries, err := counter.Default().List(ctx, blockKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	blocks := make([]Block, 0, len(entries))
+	for _, entry := range entries {
+		scope, value, ok := strings.Cut(strings.TrimPrefix(entry.Key, blockKeyPrefix), ":")
+		if !ok {
+			continue
+		}
+		blocks = append(blocks, Block{
+			Scope:      scope,
+			Subject:    value,
+			Level:      entry.Value,
+			RetryAfter: int64(math.Ceil(entry.TTL.Seconds())),
+			ExpiresAt:  now.Add(entry.TTL),
+		})
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].RetryAfter > blocks[j].RetryAfter })
+	return blocks, nil
+}
+
+// Unblock 解除封禁并清除失败计数和封禁级别，同时写入后台操作日志
+func (s *Service) Unblock(ctx context.Context, scope, value, actor string) error {
+	if scope != ScopeIP && scope != ScopePrefix && scope != ScopeGlobalPrefix {
+		return fmt.Errorf("未知的封禁类型: %s", scope)
+	}
+	subject := subject{scope: scope, value: value}
+
+	store := counter.Default()
+	var err error
+	for _, prefix := range []string{blockKeyPrefix, strikeKeyPrefix, failKeyPrefix} {
+		if resetErr := store.Reset(ctx, prefix+subject.key()); resetErr != nil && err == nil {
+			err = resetErr
+		}
+	}
+
+	entry := &model.AdminOperationLog{
+		Action:    "security.unblock",
+		Target:    subject.key(),
+		Success:   err == nil,
+		ActorName: actor,
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	}
+	if logErr := s.logRepo.Create(ctx, entry); logErr != nil {
+		logger.Warn("记录解除封禁日志失败", zap.Error(logErr))
+	}
+	return err
+}
+
+// subject 一个统计维度下的统计对象
+type subject struct {
+	scope string
+	value string
+}
+
+func (s subject) key() string {
+	return s.scope + ":" + s.value
+}
+
+// subjects 本次查找涉及的统计对象：客户端 IP、该 IP 猜测的分享码前缀，以及不区分客户端的前缀
+func subjects(policy conf.LookupGuardConfig, ip, code string) []subject {
+	list := []subject{{scope: ScopeIP, value: ip}}
+	if policy.PrefixLength > 0 && code != "" {
+		prefix := code
+		if len(prefix) > policy.PrefixLength {
+			prefix = prefix[:policy.PrefixLength]
+		}
+		list = append(list,
+			subject{scope: ScopePrefix, value: prefix + "@" + ip},
+			subject{scope: ScopeGlobalPrefix, value: prefix},
+		)
+	}
+	return list
+}
+
+// policy 读取当前配置，未启用时返回 false
+func policy() (conf.LookupGuardConfig, bool) {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil {
+		return conf.LookupGuardConfig{}, false
+	}
+	guard := cfg.Download.Guard
+	if !guard.Enabled || guard.WindowSeconds <= 0 || guard.BlockSeconds <= 0 {
+		return guard, false
+	}
+	return guard, true
+}
@@ -0,0 +1,197 @@
+package guard_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/guard"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/counter"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// 测试共用进程内的内存计数器，各用例使用不同的 IP 和分享码前缀互不干扰
+func setupGuard(t *testing.T, policy conf.LookupGuardConfig) {
+	t.Helper()
+	cfg := testenv.Setup(t)
+	policy.Enabled = true
+	policy.WindowSeconds = 600
+	policy.BlockSeconds = 60
+	policy.MaxBlockSeconds = 200
+	cfg.Download.Guard = policy
+}
+
+// expireBlock 删除封禁状态，模拟封禁期结束，失败次数和封禁级别保留
+func expireBlock(t *testing.T, scope, subject string) {
+	t.Helper()
+	if err := counter.Default().Reset(context.Background(), "guard:block:"+scope+":"+subject); err != nil {
+		t.Fatalf("清除封禁失败: %v", err)
+	}
+}
+
+func asBlocked(t *testing.T, err error) *guard.BlockedError {
+	t.Helper()
+	var blocked *guard.BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("期望 *BlockedError，得到 %v", err)
+	}
+	return blocked
+}
+
+func findBlock(t *testing.T, scope, subject string) *guard.Block {
+	t.Helper()
+	blocks, err := guard.GetService().ListBlocks(context.Background())
+	if err != nil {
+		t.Fatalf("ListBlocks: %v", err)
+	}
+	for i := range blocks {
+		if blocks[i].Scope == scope && blocks[i].Subject == subject {
+			return &blocks[i]
+		}
+	}
+	return nil
+}
+
+func TestProgressiveIPBlock(t *testing.T) {
+	setupGuard(t, conf.LookupGuardConfig{MaxFailures: 3})
+	ctx := context.Background()
+	svc := guard.GetService()
+	ip := "192.0.2.10"
+
+	for round, want := range []time.Duration{60 * time.Second, 120 * time.Second, 200 * time.Second} {
+		for i := 0; i < 2; i++ {
+			if err := svc.RecordFailure(ctx, ip, "missing"); err != nil {
+				t.Fatalf("第 %d 轮第 %d 次失败即被封禁: %v", round+1, i+1, err)
+			}
+		}
+		blocked := asBlocked(t, svc.RecordFailure(ctx, ip, "missing"))
+		if blocked.Scope != guard.ScopeIP || blocked.Subject != ip {
+			t.Fatalf("封禁对象为 %s/%s", blocked.Scope, blocked.Subject)
+		}
+		if blocked.RetryAfter != want {
+			t.Fatalf("第 %d 次封禁时长为 %v，期望 %v", round+1, blocked.RetryAfter, want)
+		}
+
+		asBlocked(t, svc.Check(ctx, ip, "anything"))
+		if block := findBlock(t, guard.ScopeIP, ip); block == nil || block.Level != int64(round+1) {
+			t.Fatalf("第 %d 次封禁的列表项为 %+v", round+1, block)
+		}
+		expireBlock(t, guard.ScopeIP, ip)
+	}
+
+	if err := svc.Check(ctx, "192.0.2.11", "anything"); err != nil {
+		t.Fatalf("其他 IP 被封禁: %v", err)
+	}
+}
+
+func TestPrefixBlockIsPerClient(t *testing.T) {
+	setupGuard(t, conf.LookupGuardConfig{PrefixLength: 3, MaxPrefixFailures: 2})
+	ctx := context.Background()
+	svc := guard.GetService()
+	ip := "192.0.2.20"
+
+	if err := svc.RecordFailure(ctx, ip, "pfa001"); err != nil {
+		t.Fatalf("首次失败即被封禁: %v", err)
+	}
+	blocked := asBlocked(t, svc.RecordFailure(ctx, ip, "pfa002"))
+	if blocked.Scope != guard.ScopePrefix || blocked.Subject != "pfa@"+ip {
+		t.Fatalf("封禁对象为 %s/%s", blocked.Scope, blocked.Subject)
+	}
+
+	// 前缀封禁不影响查找，只拒绝该客户端的密码尝试
+	if err := svc.Check(ctx, ip, "pfa003"); err != nil {
+		t.Fatalf("前缀封禁影响了查找: %v", err)
+	}
+	asBlocked(t, svc.CheckPasswordAttempt(ctx, ip, "pfa003"))
+	if err := svc.CheckPasswordAttempt(ctx, "192.0.2.21", "pfa003"); err != nil {
+		t.Fatalf("其他客户端被前缀封禁: %v", err)
+	}
+}
+
+func TestGlobalPrefixBlock(t *testing.T) {
+	setupGuard(t, conf.LookupGuardConfig{PrefixLength: 3, MaxPrefixFailures: 100, MaxGlobalPrefixFailures: 3})
+	ctx := context.Background()
+	svc := guard.GetService()
+
+	for round := 1; round <= 2; round++ {
+		// 攻击者每次换一个 IP，单个 IP 的计数达不到阈值
+		for i, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+			if err := svc.RecordFailure(ctx, ip, fmt.Sprintf("glb%03d", i)); err != nil {
+				t.Fatalf("第 %d 轮 %s 被提前封禁: %v", round, ip, err)
+			}
+		}
+		blocked := asBlocked(t, svc.RecordFailure(ctx, "198.51.100.3", "glb009"))
+		if blocked.Scope != guard.ScopeGlobalPrefix || blocked.Subject != "glb" {
+			t.Fatalf("封禁对象为 %s/%s", blocked.Scope, blocked.Subject)
+		}
+		// 全局前缀不逐级延长封禁时间
+		if blocked.RetryAfter != 60*time.Second {
+			t.Fatalf("第 %d 次全局封禁时长为 %v", round, blocked.RetryAfter)
+		}
+		if block := findBlock(t, guard.ScopeGlobalPrefix, "glb"); block == nil || block.Level != 1 {
+			t.Fatalf("全局封禁的列表项为 %+v", block)
+		}
+
+		asBlocked(t, svc.CheckPasswordAttempt(ctx, "198.51.100.99", "glb123"))
+		if err := svc.CheckPasswordAttempt(ctx, "198.51.100.99", "oth123"); err != nil {
+			t.Fatalf("其他前缀被封禁: %v", err)
+		}
+		expireBlock(t, guard.ScopeGlobalPrefix, "glb")
+	}
+}
+
+func TestUnblock(t *testing.T) {
+	setupGuard(t, conf.LookupGuardConfig{MaxFailures: 1})
+	ctx := context.Background()
+	svc := guard.GetService()
+	ip := "192.0.2.30"
+
+	asBlocked(t, svc.RecordFailure(ctx, ip, "missing"))
+	if findBlock(t, guard.ScopeIP, ip) == nil {
+		t.Fatal("封禁列表中没有该 IP")
+	}
+
+	if err := svc.Unblock(ctx, "unknown", ip, "admin"); err == nil {
+		t.Fatal("未知的封禁类型没有返回错误")
+	}
+	if err := svc.Unblock(ctx, guard.ScopeIP, ip, "admin"); err != nil {
+		t.Fatalf("Unblock: %v", err)
+	}
+	if findBlock(t, guard.ScopeIP, ip) != nil {
+		t.Fatal("解除后仍在封禁列表中")
+	}
+	if err := svc.Check(ctx, ip, "missing"); err != nil {
+		t.Fatalf("解除后仍被封禁: %v", err)
+	}
+
+	// 封禁级别一并清除，再次封禁从第 1 级开始
+	blocked := asBlocked(t, svc.RecordFailure(ctx, ip, "missing"))
+	if blocked.RetryAfter != 60*time.Second {
+		t.Fatalf("解除后再次封禁时长为 %v", blocked.RetryAfter)
+	}
+
+	var entry model.AdminOperationLog
+	if err := db.GetDB().Where("action = ? AND target = ?", "security.unblock", "ip:"+ip).First(&entry).Error; err != nil {
+		t.Fatalf("没有记录解除封禁日志: %v", err)
+	}
+	if !entry.Success || entry.ActorName != "admin" {
+		t.Fatalf("解除封禁日志为 %+v", entry)
+	}
+}
+
+func TestDisabledGuard(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.Download.Guard = conf.LookupGuardConfig{Enabled: false, MaxFailures: 1}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := guard.GetService().RecordFailure(ctx, "192.0.2.40", "missing"); err != nil {
+			t.Fatalf("未启用时仍被封禁: %v", err)
+		}
+	}
+}
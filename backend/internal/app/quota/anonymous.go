@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/counter"
+)
+
+// 匿名上传被拒绝的原因
+const (
+	ReasonAnonymousFileDisabled = "anonymous_file_disabled"
+	ReasonAnonymousUploads      = "anonymous_upload_count"
+	ReasonAnonymousBytes        = "anonymous_upload_bytes"
+	ReasonAnonymousExpiry       = "anonymous_expiry"
+)
+
+// AnonymousLimitError 匿名上传超出按 IP 统计的限制或策略
+type AnonymousLimitError struct {
+	Reason     string
+	Limit      int64         // 窗口内允许的次数 / 字节数，或允许的最长有效期（秒）
+	RetryAfter time.Duration // 距离窗口重置的时间，仅次数 / 字节数限制有效
+}
+
+func (e *AnonymousLimitError) Error() string {
+	switch e.Reason {
+	case ReasonAnonymousFileDisabled:
+		return "匿名用户不能上传文件，请登录后上传"
+	case ReasonAnonymousUploads:
+		return fmt.Sprintf("上传过于频繁，每个 IP 在统计窗口内最多上传 %d 次", e.Limit)
+	case ReasonAnonymousBytes:
+		return fmt.Sprintf("上传量过大，每个 IP 在统计窗口内最多上传 %d 字节", e.Limit)
+	default:
+		return fmt.Sprintf("匿名分享的有效期不能超过 %d 秒", e.Limit)
+	}
+}
+
+// ReserveAnonymousUpload 校验按 IP 统计的次数和字节数，并为本次匿名上传计数
+// isFile 为 false 表示文本分享，不受 allow_file 开关影响；超出限制时本次计数会被撤销
+// 上传成功后调用 Commit，失败时调用 Release 退回计数，只有失败的上传不占用额度
+func (s *Service) ReserveAnonymousUpload(ctx context.Context, ip string, size int64, isFile bool) (*AnonymousUpload, error) {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil {
+		return &AnonymousUpload{}, nil
+	}
+	policy := cfg.Upload.Anonymous
+	if isFile && !policy.AllowFile {
+		return nil, &AnonymousLimitError{Reason: ReasonAnonymousFileDisabled}
+	}
+	if policy.WindowSeconds <= 0 || (policy.MaxUploads <= 0 && policy.MaxBytes <= 0) {
+		return &AnonymousUpload{}, nil
+	}
+
+	store := counter.Default()
+	window := time.Duration(policy.WindowSeconds) * time.Second
+	countKey := "anon:uploads:" + ip
+	bytesKey := "anon:bytes:" + ip
+
+	count, retryAfter, err := store.IncrBy(ctx, countKey, 1, window)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaxUploads > 0 && count > int64(policy.MaxUploads) {
+		_ = store.DecrBy(ctx, countKey, 1)
+		return nil, &AnonymousLimitError{Reason: ReasonAnonymousUploads, Limit: int64(policy.MaxUploads), RetryAfter: retryAfter}
+	}
+
+	upload := &AnonymousUpload{store: store, countKey: countKey}
+	if policy.MaxBytes > 0 {
+		total, retryAfter, err := store.IncrBy(ctx, bytesKey, size, window)
+		if err != nil {
+			upload.Release()
+			return nil, err
+		}
+		if total > policy.MaxBytes {
+			_ = store.DecrBy(ctx, bytesKey, size)
+			upload.Release()
+			return nil, &AnonymousLimitError{Reason: ReasonAnonymousBytes, Limit: policy.MaxBytes, RetryAfter: retryAfter}
+		}
+		upload.bytesKey = bytesKey
+		upload.size = size
+	}
+	return upload, nil
+}
+
+// AnonymousUpload 一次匿名上传占用的次数和字节数，Commit / Release 只有第一次调用生效
+// 方法可以在 nil 上调用，登录用户的上传不需要判断
+type AnonymousUpload struct {
+	store    counter.Store
+	countKey string
+	bytesKey string
+	size     int64
+	once     sync.Once
+}
+
+// Commit 上传成功（分享已创建或分片会话已创建），保留计数
+func (u *AnonymousUpload) Commit() {
+	if u != nil {
+		u.once.Do(func() {})
+	}
+}
+
+// Release 上传失败，退回本次计入的次数和字节数
+func (u *AnonymousUpload) Release() {
+	if u == nil {
+		return
+	}
+	u.once.Do(func() {
+		if u.store == nil {
+			return
+		}
+		// 请求可能已被取消，退回计数不能依赖请求的 context；窗口已过期时没有可退回的计数
+		ctx := context.Background()
+		_ = u.store.DecrBy(ctx, u.countKey, 1)
+		if u.bytesKey != "" {
+			_ = u.store.DecrBy(ctx, u.bytesKey, u.size)
+		}
+	})
+}
+
+// CheckAnonymousExpiry 校验匿名分享的过期时间不超过 upload.max_save_seconds
+// expiredAt 为 nil 表示永久有效；availableFrom 不为空时从生效时间开始计算有效期
+func CheckAnonymousExpiry(expiredAt, availableFrom *time.Time) error {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil || cfg.Upload.MaxSaveSeconds <= 0 {
+		return nil
+	}
+
+	maxAge := time.Duration(cfg.Upload.MaxSaveSeconds) * time.Second
+	start := time.Now()
+	if availableFrom != nil && availableFrom.After(start) {
+		start = *availableFrom
+	}
+	if expiredAt == nil || expiredAt.Sub(start) > maxAge {
+		return &AnonymousLimitError{Reason: ReasonAnonymousExpiry, Limit: int64(cfg.Upload.MaxSaveSeconds)}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+)
+
+func setAnonymousPolicy(t *testing.T, policy conf.AnonymousUploadConfig) {
+	t.Helper()
+	previous := conf.GetGlobalConfig()
+	cfg := &conf.AppConfiguration{}
+	cfg.Upload.Anonymous = policy
+	conf.SetGlobalConfig(cfg)
+	t.Cleanup(func() { conf.SetGlobalConfig(previous) })
+}
+
+func limitReason(err error) string {
+	var limitErr *AnonymousLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Reason
+	}
+	return ""
+}
+
+func TestAnonymousUploadReleaseRefunds(t *testing.T) {
+	setAnonymousPolicy(t, conf.AnonymousUploadConfig{AllowFile: true, WindowSeconds: 60, MaxUploads: 2, MaxBytes: 100})
+	s := &Service{}
+	ctx := context.Background()
+	ip := "192.0.2.10"
+
+	// 失败的上传退回次数和字节数，不占用额度
+	for i := 0; i < 5; i++ {
+		upload, err := s.ReserveAnonymousUpload(ctx, ip, 60, true)
+		if err != nil {
+			t.Fatalf("第 %d 次失败的上传之后被拒绝: %v", i+1, err)
+		}
+		upload.Release()
+		upload.Commit() // 已退回后不再生效
+	}
+
+	first, err := s.ReserveAnonymousUpload(ctx, ip, 60, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Commit()
+	first.Release() // 已提交后不再退回
+
+	if _, err := s.ReserveAnonymousUpload(ctx, ip, 60, true); limitReason(err) != ReasonAnonymousBytes {
+		t.Fatalf("超出字节数: %v", err)
+	}
+	// 超出字节数被拒绝时次数同样撤销，较小的上传仍然可以通过
+	second, err := s.ReserveAnonymousUpload(ctx, ip, 40, false)
+	if err != nil {
+		t.Fatalf("剩余额度内的上传: %v", err)
+	}
+	second.Commit()
+
+	if _, err := s.ReserveAnonymousUpload(ctx, ip, 0, false); limitReason(err) != ReasonAnonymousUploads {
+		t.Fatalf("超出次数: %v", err)
+	}
+}
+
+func TestAnonymousUploadReleaseAfterWindow(t *testing.T) {
+	setAnonymousPolicy(t, conf.AnonymousUploadConfig{AllowFile: true, WindowSeconds: 1, MaxUploads: 1})
+	s := &Service{}
+	ctx := context.Background()
+	ip := "192.0.2.30"
+
+	upload, err := s.ReserveAnonymousUpload(ctx, ip, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 窗口过期后才失败的上传没有可退回的计数，不能多出一次额度
+	time.Sleep(1100 * time.Millisecond)
+	upload.Release()
+
+	next, err := s.ReserveAnonymousUpload(ctx, ip, 1, true)
+	if err != nil {
+		t.Fatalf("新窗口的第一次上传: %v", err)
+	}
+	next.Commit()
+	if _, err := s.ReserveAnonymousUpload(ctx, ip, 1, true); limitReason(err) != ReasonAnonymousUploads {
+		t.Fatalf("超出次数: %v", err)
+	}
+}
+
+func TestAnonymousUploadPolicy(t *testing.T) {
+	setAnonymousPolicy(t, conf.AnonymousUploadConfig{AllowFile: false})
+	s := &Service{}
+	ctx := context.Background()
+
+	if _, err := s.ReserveAnonymousUpload(ctx, "192.0.2.20", 1, true); limitReason(err) != ReasonAnonymousFileDisabled {
+		t.Fatalf("禁止匿名上传文件: %v", err)
+	}
+	// 未配置窗口时文本分享不受限制，返回的计数可以直接释放
+	upload, err := s.ReserveAnonymousUpload(ctx, "192.0.2.20", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.Release()
+
+	// 登录用户不计数，nil 上调用同样安全
+	var none *AnonymousUpload
+	none.Commit()
+	none.Release()
+}
@@ -0,0 +1,196 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+)
+
+// defaultUploadSize 未加载配置时的单次上传上限
+const defaultUploadSize = 10 * 1024 * 1024
+
+// 超限原因
+const (
+	ReasonUploadSize   = "upload_size"
+	ReasonStorageQuota = "storage_quota"
+)
+
+// Limits 解析后的有效限制，0 表示不限制
+type Limits struct {
+	UploadSize   int64 `json:"upload_size"`
+	StorageQuota int64 `json:"storage_quota"`
+}
+
+// ExceededError 上传超出单次大小或存储配额
+type ExceededError struct {
+	Reason    string // ReasonUploadSize 或 ReasonStorageQuota
+	Limit     int64  // 生效的限制
+	Used      int64  // 已用（含未完成的上传和预留），仅存储配额有效
+	Requested int64  // 本次上传大小
+}
+
+func (e *ExceededError) Error() string {
+	if e.Reason == ReasonUploadSize {
+		return fmt.Sprintf("文件大小超过限制（最大 %d 字节）", e.Limit)
+	}
+	return fmt.Sprintf("存储空间不足（已用 %d / %d 字节）", e.Used, e.Limit)
+}
+
+// ReserveReq 预留配额参数
+type ReserveReq struct {
+	UserID *uint // 匿名上传为 nil，只校验单次大小
+	Size   int64
+	// UploadID 已计入用量的分片上传会话，完成时复查配额需从未完成会话中排除，避免重复计算
+	UploadID string
+}
+
+// Service 解析用户的有效上传限制，并在上传过程中预留配额
+// 生效顺序：用户单独设置 > 角色默认 > 全局配置
+type Service struct {
+	userRepo  *dao.UserRepository
+	chunkRepo *dao.ChunkRepository
+
+	mu       sync.Mutex
+	reserved map[uint]int64 // 进行中上传预留的用量，按用户统计
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// GetService 获取全局配额服务，各处上传共享同一份预留状态
+func GetService() *Service {
+	defaultOnce.Do(func() {
+		defaultService = &Service{
+			userRepo:  dao.NewUserRepository(),
+			chunkRepo: dao.NewChunkRepository(),
+			reserved:  make(map[uint]int64),
+		}
+	})
+	return defaultService
+}
+
+// Resolve 解析用户的有效限制，userID 为 nil 时返回匿名上传限制
+func (s *Service) Resolve(ctx context.Context, userID *uint) (*Limits, error) {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil {
+		return &Limits{UploadSize: defaultUploadSize}, nil
+	}
+	if userID == nil {
+		return &Limits{UploadSize: effective(cfg.Upload.UploadSize)}, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, *userID)
+	if err != nil {
+		return nil, err
+	}
+	role := cfg.User.RoleLimits[user.Role]
+	return &Limits{
+		UploadSize:   effective(user.MaxUploadSize, role.UploadSize, cfg.User.UserUploadSize),
+		StorageQuota: effective(user.MaxStorageQuota, role.StorageQuota, cfg.User.UserStorageQuota),
+	}, nil
+}
+
+// Usage 用户当前已用空间：已保存的文件、未完成的分片上传以及进行中的预留
+func (s *Service) Usage(ctx context.Context, userID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usageLocked(ctx, userID, "")
+}
+
+// Reserve 校验单次大小和存储配额，并为本次上传预留用量
+// 上传成功、用量已写入用户统计（或已创建分片会话）后调用 Commit，失败时调用 Release
+func (s *Service) Reserve(ctx context.Context, req *ReserveReq) (*Reservation, error) {
+	limits, err := s.Resolve(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if limits.UploadSize > 0 && req.Size > limits.UploadSize {
+		return nil, &ExceededError{Reason: ReasonUploadSize, Limit: limits.UploadSize, Requested: req.Size}
+	}
+
+	r := &Reservation{service: s}
+	if req.UserID == nil || limits.StorageQuota == 0 {
+		return r, nil
+	}
+
+	// 校验与预留在同一把锁内完成，并发上传不会同时通过校验
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, err := s.usageLocked(ctx, *req.UserID, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if used+req.Size > limits.StorageQuota {
+		return nil, &ExceededError{Reason: ReasonStorageQuota, Limit: limits.StorageQuota, Used: used, Requested: req.Size}
+	}
+
+	s.reserved[*req.UserID] += req.Size
+	r.userID = *req.UserID
+	r.size = req.Size
+	return r, nil
+}
+
+func (s *Service) usageLocked(ctx context.Context, userID uint, excludeUploadID string) (int64, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := s.chunkRepo.SumOpenSessionSize(ctx, userID, excludeUploadID)
+	if err != nil {
+		return 0, err
+	}
+	return user.TotalStorage + pending + s.reserved[userID], nil
+}
+
+func (s *Service) release(userID uint, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reserved[userID] -= size; s.reserved[userID] <= 0 {
+		delete(s.reserved, userID)
+	}
+}
+
+// Reservation 一次上传预留的配额，Commit / Release 只有第一次调用生效
+type Reservation struct {
+	service *Service
+	userID  uint
+	size    int64
+	once    sync.Once
+}
+
+// Commit 用量已持久化（写入用户统计或分片会话），预留不再需要
+func (r *Reservation) Commit() {
+	r.finish()
+}
+
+// Release 上传失败，归还预留的用量
+func (r *Reservation) Release() {
+	r.finish()
+}
+
+func (r *Reservation) finish() {
+	r.once.Do(func() {
+		if r.size > 0 {
+			r.service.release(r.userID, r.size)
+		}
+	})
+}
+
+// effective 按顺序取第一个非 0 的限制，-1（或任意负数）表示不限制，返回 0
+func effective(values ...int64) int64 {
+	for _, v := range values {
+		if v < 0 {
+			return 0
+		}
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,380 @@
+// Package session 登录会话：每次登录创建一条服务端会话，签发短期访问令牌和可轮换的刷新令牌。
+// 访问令牌携带会话ID，认证中间件通过 auth.ValidateToken 回调 Check 确认会话未被撤销；
+// 刷新令牌每次使用后轮换，旧令牌再次出现视为泄露，整个会话立即撤销
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/redis"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("登录已失效，请重新登录")
+	ErrSessionNotFound     = errors.New("会话不存在")
+	ErrSessionRevoked      = errors.New("会话已失效")
+)
+
+// 会话撤销原因
+const (
+	ReasonLogout          = "logout"
+	ReasonRevoked         = "revoked"
+	ReasonEvicted         = "evicted"
+	ReasonRefreshReuse    = "refresh_reuse"
+	ReasonPasswordChanged = "password_changed"
+	ReasonPasswordReset   = "password_reset"
+	ReasonUserDisabled    = "user_disabled"
+	ReasonAccountDeleted  = "account_deleted"
+)
+
+const (
+	// cacheKeyPrefix Redis 中会话状态缓存键的前缀
+	cacheKeyPrefix = "fcb:session:"
+	// activeCacheTTL 有效会话状态的缓存时间，撤销时会立即覆盖缓存
+	activeCacheTTL = time.Minute
+	// staleRetention 已过期或已撤销的会话保留多久后清理
+	staleRetention = 7 * 24 * time.Hour
+	cacheRevoked   = "revoked"
+)
+
+// Client 发起登录或刷新的客户端信息
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Tokens 登录或刷新后签发的令牌
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int // 访问令牌有效期（秒）
+	SessionID    string
+}
+
+// Info 展示给用户的会话信息
+type Info struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Service 会话服务
+type Service struct {
+	repo     *dao.UserSessionRepository
+	userRepo *dao.UserRepository
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// GetService 获取全局会话服务
+func GetService() *Service {
+	defaultOnce.Do(func() {
+		defaultService = &Service{
+			repo:     dao.NewUserSessionRepository(),
+			userRepo: dao.NewUserRepository(),
+		}
+	})
+	return defaultService
+}
+
+// accessTTL 访问令牌有效期
+func accessTTL() time.Duration {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.User.AccessTokenMinutes > 0 {
+		return time.Duration(cfg.User.AccessTokenMinutes) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// sessionTTL 刷新令牌闲置有效期
+func sessionTTL() time.Duration {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.User.SessionExpiryHours > 0 {
+		return time.Duration(cfg.User.SessionExpiryHours) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// maxSessions 每个用户同时有效的会话数，0 表示不限制
+func maxSessions() int {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.User.MaxSessionsPerUser > 0 {
+		return cfg.User.MaxSessionsPerUser
+	}
+	return 0
+}
+
+// Create 为登录成功的用户创建会话，超出会话数上限时注销最早创建的会话
+func (s *Service) Create(ctx context.Context, user *model.User, client Client) (*Tokens, error) {
+	now := time.Now()
+	_ = s.repo.DeleteStale(ctx, now.Add(-staleRetention))
+
+	if limit := maxSessions(); limit > 0 {
+		active, err := s.repo.ListActive(ctx, user.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if excess := len(active) - limit + 1; excess > 0 {
+			evicted := make([]string, 0, excess)
+			for _, sess := range active[:excess] {
+				evicted = append(evicted, sess.SessionID)
+			}
+			if err := s.revoke(ctx, evicted, ReasonEvicted); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	sess := &model.UserSession{
+		UserID:      user.ID,
+		SessionID:   sessionID,
+		RefreshHash: hashSecret(secret),
+		UserAgent:   truncate(client.UserAgent, 255),
+		IP:          client.IP,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(sessionTTL()),
+	}
+	if err := s.repo.Create(ctx, sess); err != nil {
+		return nil, err
+	}
+	return s.issue(user, sessionID, secret)
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，同时轮换刷新令牌
+// 已轮换掉的旧令牌再次出现说明令牌可能已泄露，此时撤销整个会话
+func (s *Service) Refresh(ctx context.Context, refreshToken string, client Client) (*Tokens, error) {
+	sessionID, secret, ok := strings.Cut(strings.TrimSpace(refreshToken), ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	sess, err := s.repo.GetBySessionID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !sess.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	oldHash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(oldHash), []byte(sess.RefreshHash)) != 1 {
+		s.revokeReused(ctx, sess, client)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, sess.UserID)
+	if err != nil || user.Status != "active" {
+		_ = s.revoke(ctx, []string{sess.SessionID}, ReasonUserDisabled)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newSecret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.Rotate(ctx, sess.ID, oldHash, hashSecret(newSecret), now.Add(sessionTTL()), client.IP, truncate(client.UserAgent, 255))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// 并发请求已抢先轮换了同一个令牌
+		s.revokeReused(ctx, sess, client)
+		return nil, ErrInvalidRefreshToken
+	}
+	return s.issue(user, sess.SessionID, newSecret)
+}
+
+// Check 确认访问令牌所属的会话仍然有效，注册为 auth.SessionChecker
+// 已连接 Redis 时缓存会话状态，撤销会话时同步写入缓存；否则每次查询数据库
+func (s *Service) Check(ctx context.Context, claims *auth.Claims) error {
+	if claims.SessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	cached := redis.GetClient() != nil
+	if cached {
+		if state, err := redis.Get(ctx, cacheKeyPrefix+claims.SessionID); err == nil {
+			if state == strconv.FormatUint(uint64(claims.UserID), 10) {
+				return nil
+			}
+			return ErrSessionRevoked
+		}
+	}
+
+	sess, err := s.repo.GetBySessionID(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	active := sess.Active(time.Now()) && sess.UserID == claims.UserID
+	if cached {
+		if active {
+			_ = redis.Set(ctx, cacheKeyPrefix+sess.SessionID, strconv.FormatUint(uint64(sess.UserID), 10), activeCacheTTL)
+		} else {
+			_ = redis.Set(ctx, cacheKeyPrefix+sess.SessionID, cacheRevoked, accessTTL())
+		}
+	}
+	if !active {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// List 列出用户当前有效的会话，currentID 对应的会话标记为当前会话
+func (s *Service) List(ctx context.Context, userID uint, currentID string) ([]Info, error) {
+	sessions, err := s.repo.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]Info, 0, len(sessions))
+	for i := len(sessions) - 1; i >= 0; i-- {
+		sess := sessions[i]
+		infos = append(infos, Info{
+			ID:         sess.SessionID,
+			IP:         sess.IP,
+			UserAgent:  sess.UserAgent,
+			CreatedAt:  sess.CreatedAt,
+			LastUsedAt: sess.LastUsedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			Current:    sess.SessionID == currentID,
+		})
+	}
+	return infos, nil
+}
+
+// Revoke 撤销用户的一个会话
+func (s *Service) Revoke(ctx context.Context, userID uint, sessionID, reason string) error {
+	sess, err := s.repo.GetBySessionID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	if sess.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.revoke(ctx, []string{sess.SessionID}, reason)
+}
+
+// RevokeAll 撤销用户的全部会话，exceptID 不为空时保留该会话，返回撤销的数量
+func (s *Service) RevokeAll(ctx context.Context, userID uint, exceptID, reason string) (int, error) {
+	sessions, err := s.repo.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		if sess.SessionID != exceptID {
+			ids = append(ids, sess.SessionID)
+		}
+	}
+	if err := s.revoke(ctx, ids, reason); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// revoke 撤销会话并写入撤销状态缓存，使访问令牌立即失效
+func (s *Service) revoke(ctx context.Context, sessionIDs []string, reason string) error {
+	if err := s.repo.Revoke(ctx, sessionIDs, reason); err != nil {
+		return err
+	}
+	if redis.GetClient() != nil {
+		for _, id := range sessionIDs {
+			_ = redis.Set(ctx, cacheKeyPrefix+id, cacheRevoked, accessTTL())
+		}
+	}
+	return nil
+}
+
+// revokeReused 刷新令牌被重复使用时撤销会话并记录告警
+func (s *Service) revokeReused(ctx context.Context, sess *model.UserSession, client Client) {
+	logger.Warn("检测到刷新令牌重复使用，已撤销会话",
+		zap.Uint("user_id", sess.UserID),
+		zap.String("session_id", sess.SessionID),
+		zap.String("ip", client.IP),
+	)
+	if err := s.revoke(ctx, []string{sess.SessionID}, ReasonRefreshReuse); err != nil {
+		logger.Error("撤销会话失败", zap.Error(err))
+	}
+}
+
+// issue 签发访问令牌，刷新令牌格式为 "<会话ID>.<随机密钥>"
+func (s *Service) issue(user *model.User, sessionID, secret string) (*Tokens, error) {
+	ttl := accessTTL()
+	token, err := auth.GenerateToken(user.ID, user.Username, user.Role, sessionID, ttl)
+	if err != nil {
+		return nil, errors.New("生成令牌失败")
+	}
+	return &Tokens{
+		AccessToken:  token,
+		RefreshToken: sessionID + "." + secret,
+		ExpiresIn:    int(ttl.Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// newSessionID 生成 128 位随机会话ID（十六进制）
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// newSecret 生成 256 位随机刷新令牌密钥
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
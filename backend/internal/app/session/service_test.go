@@ -0,0 +1,219 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+var client = session.Client{IP: "192.0.2.1", UserAgent: "go-test"}
+
+func createUser(t *testing.T) *model.User {
+	t.Helper()
+	user := &model.User{Username: "alice", Email: "alice@example.com", Role: "user", Status: "active"}
+	if err := db.GetDB().Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+func loadSession(t *testing.T, sessionID string) *model.UserSession {
+	t.Helper()
+	var sess model.UserSession
+	if err := db.GetDB().Where("session_id = ?", sessionID).First(&sess).Error; err != nil {
+		t.Fatalf("读取会话失败: %v", err)
+	}
+	return &sess
+}
+
+// check 解析访问令牌并确认会话状态
+func check(t *testing.T, accessToken string) error {
+	t.Helper()
+	claims, err := auth.ParseToken(accessToken)
+	if err != nil {
+		t.Fatalf("解析访问令牌失败: %v", err)
+	}
+	return session.GetService().Check(context.Background(), claims)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := session.GetService()
+	user := createUser(t)
+
+	first, err := svc.Create(ctx, user, client)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	second, err := svc.Refresh(ctx, first.RefreshToken, session.Client{IP: "192.0.2.2", UserAgent: "rotated"})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("轮换后 session=%s refresh 相同=%v", second.SessionID, second.RefreshToken == first.RefreshToken)
+	}
+	if err := check(t, second.AccessToken); err != nil {
+		t.Fatalf("新访问令牌: %v", err)
+	}
+	if sess := loadSession(t, first.SessionID); sess.IP != "192.0.2.2" || sess.UserAgent != "rotated" {
+		t.Fatalf("刷新后未记录客户端信息: %+v", sess)
+	}
+
+	third, err := svc.Refresh(ctx, second.RefreshToken, client)
+	if err != nil || third.SessionID != first.SessionID {
+		t.Fatalf("再次刷新: %v", err)
+	}
+
+	for _, token := range []string{"", "no-dot", ".secret", first.SessionID + ".", "unknown.secret"} {
+		if _, err := svc.Refresh(ctx, token, client); !errors.Is(err, session.ErrInvalidRefreshToken) {
+			t.Errorf("刷新令牌 %q 返回 %v", token, err)
+		}
+	}
+	// 格式错误或会话不存在的令牌不会影响现有会话
+	if err := check(t, third.AccessToken); err != nil {
+		t.Fatalf("无效令牌影响了会话: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := session.GetService()
+	user := createUser(t)
+
+	first, err := svc.Create(ctx, user, client)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	second, err := svc.Refresh(ctx, first.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// 已轮换掉的令牌再次出现，整个会话被撤销
+	if _, err := svc.Refresh(ctx, first.RefreshToken, client); !errors.Is(err, session.ErrInvalidRefreshToken) {
+		t.Fatalf("重放刷新令牌返回 %v", err)
+	}
+	if sess := loadSession(t, first.SessionID); sess.RevokedAt == nil || sess.RevokeReason != session.ReasonRefreshReuse {
+		t.Fatalf("重放后会话状态: revoked_at=%v reason=%q", sess.RevokedAt, sess.RevokeReason)
+	}
+	if _, err := svc.Refresh(ctx, second.RefreshToken, client); !errors.Is(err, session.ErrInvalidRefreshToken) {
+		t.Fatalf("撤销后最新的刷新令牌返回 %v", err)
+	}
+	if err := check(t, second.AccessToken); !errors.Is(err, session.ErrSessionRevoked) {
+		t.Fatalf("撤销后访问令牌返回 %v", err)
+	}
+}
+
+func TestRefreshRevokesDisabledUser(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := session.GetService()
+	user := createUser(t)
+
+	tokens, err := svc.Create(ctx, user, client)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := db.GetDB().Model(user).Update("status", "disabled").Error; err != nil {
+		t.Fatalf("禁用用户失败: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, tokens.RefreshToken, client); !errors.Is(err, session.ErrInvalidRefreshToken) {
+		t.Fatalf("禁用用户刷新返回 %v", err)
+	}
+	if sess := loadSession(t, tokens.SessionID); sess.RevokeReason != session.ReasonUserDisabled {
+		t.Fatalf("撤销原因为 %q", sess.RevokeReason)
+	}
+}
+
+func TestCreateEvictsOldestSession(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.User.MaxSessionsPerUser = 2
+	ctx := context.Background()
+	svc := session.GetService()
+	user := createUser(t)
+
+	var created []*session.Tokens
+	for i := 0; i < 4; i++ {
+		tokens, err := svc.Create(ctx, user, client)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		created = append(created, tokens)
+	}
+
+	for i, tokens := range created[:2] {
+		if sess := loadSession(t, tokens.SessionID); sess.RevokeReason != session.ReasonEvicted {
+			t.Fatalf("第 %d 个会话的撤销原因为 %q", i+1, sess.RevokeReason)
+		}
+		if err := check(t, tokens.AccessToken); !errors.Is(err, session.ErrSessionRevoked) {
+			t.Fatalf("被注销的第 %d 个会话返回 %v", i+1, err)
+		}
+	}
+
+	infos, err := svc.List(ctx, user.ID, created[3].SessionID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	// 按创建时间倒序，最新的会话在前
+	if len(infos) != 2 || infos[0].ID != created[3].SessionID || infos[1].ID != created[2].SessionID {
+		t.Fatalf("剩余会话: %+v", infos)
+	}
+	if !infos[0].Current || infos[1].Current {
+		t.Fatalf("当前会话标记错误: %+v", infos)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := session.GetService()
+	user := createUser(t)
+
+	tokens, err := svc.Create(ctx, user, client)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	claims, err := auth.ParseToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.SessionID != tokens.SessionID {
+		t.Fatalf("访问令牌的 sid 为 %q", claims.SessionID)
+	}
+	if err := svc.Check(ctx, claims); err != nil {
+		t.Fatalf("有效会话返回 %v", err)
+	}
+
+	cases := map[string]*auth.Claims{
+		"没有 sid":   {UserID: user.ID},
+		"会话不存在":    {UserID: user.ID, SessionID: "missing"},
+		"会话属于其他用户": {UserID: user.ID + 1, SessionID: tokens.SessionID},
+	}
+	for name, c := range cases {
+		if err := svc.Check(ctx, c); !errors.Is(err, session.ErrSessionRevoked) {
+			t.Errorf("%s: 返回 %v", name, err)
+		}
+	}
+
+	// 其他用户不能撤销该会话
+	if err := svc.Revoke(ctx, user.ID+1, tokens.SessionID, session.ReasonRevoked); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("撤销其他用户的会话返回 %v", err)
+	}
+	if err := svc.Revoke(ctx, user.ID, tokens.SessionID, session.ReasonLogout); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := svc.Check(ctx, claims); !errors.Is(err, session.ErrSessionRevoked) {
+		t.Fatalf("撤销后返回 %v", err)
+	}
+	if _, err := svc.Refresh(ctx, tokens.RefreshToken, client); !errors.Is(err, session.ErrInvalidRefreshToken) {
+		t.Fatalf("撤销后刷新返回 %v", err)
+	}
+}
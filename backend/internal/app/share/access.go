@@ -0,0 +1,79 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// defaultStatsDays 访问统计默认的按天聚合窗口
+const defaultStatsDays = 30
+
+// AccessEvent 一次分享访问事件
+type AccessEvent struct {
+	Operation string // model.TransferOp*
+	FileCode  *model.FileCode
+	UserID    *uint
+	Username  string
+	IP        string
+	UserAgent string
+	BytesSent int64
+	Duration  time.Duration
+	Success   bool
+}
+
+// RecordAccess 写入一条分享访问日志
+func (s *Service) RecordAccess(ctx context.Context, ev *AccessEvent) error {
+	s.ensureRepository()
+	if ev == nil || ev.FileCode == nil {
+		return errors.New("访问事件缺少分享信息")
+	}
+
+	userAgent := ev.UserAgent
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	return s.transferLogRepo.Create(ctx, &model.TransferLog{
+		Operation:  ev.Operation,
+		FileCodeID: ev.FileCode.ID,
+		FileCode:   ev.FileCode.Code,
+		FileName:   ev.FileCode.FileName(),
+		FileSize:   ev.FileCode.Size,
+		UserID:     ev.UserID,
+		Username:   ev.Username,
+		IP:         ev.IP,
+		UserAgent:  userAgent,
+		BytesSent:  ev.BytesSent,
+		DurationMs: ev.Duration.Milliseconds(),
+		Success:    ev.Success,
+	})
+}
+
+// GetShareStats 获取分享的访问统计，仅分享所有者可查看
+func (s *Service) GetShareStats(ctx context.Context, code string, userID uint, days int) (*model.ShareAccessStats, error) {
+	s.ensureRepository()
+
+	fileCode, err := s.fileCodeRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, errors.New("分享不存在")
+	}
+	if fileCode.UserID == nil || *fileCode.UserID != userID {
+		return nil, errors.New("无权限查看此分享的统计")
+	}
+
+	if days <= 0 || days > 365 {
+		days = defaultStatsDays
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(days - 1))
+
+	stats, err := s.transferLogRepo.StatsByFileCodeID(ctx, fileCode.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	stats.Code = fileCode.Code
+	return stats, nil
+}
@@ -0,0 +1,79 @@
+package share
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// maxE2EEMetaSize E2EE 元数据的最大长度（字节）
+const maxE2EEMetaSize = 4096
+
+// E2EEMeta 客户端提交的端到端加密元数据
+// 服务端只做结构校验并原样保存，不会也无法解密其中的文件名
+type E2EEMeta struct {
+	Alg       string `json:"alg"`        // 加密算法，例如 AES-256-GCM
+	ChunkSize int64  `json:"chunk_size"` // 明文分片大小，0 表示整体加密
+	Name      string `json:"name"`       // 加密后的原始文件名（base64）
+	NameNonce string `json:"name_nonce"` // 文件名加密使用的 nonce（base64）
+}
+
+// E2EEChunk 单个加密分片的解密参数
+type E2EEChunk struct {
+	Index int    `json:"index"`
+	Size  int64  `json:"size"`  // 密文长度（不含 tag）
+	Nonce string `json:"nonce"` // base64
+	Tag   string `json:"tag"`   // base64
+}
+
+// ValidateE2EEMeta 校验 E2EE 元数据格式，返回规范化后的 JSON
+func ValidateE2EEMeta(raw string) (string, error) {
+	if raw == "" {
+		return "", errors.New("E2EE 分享必须提供 e2ee_meta")
+	}
+	if len(raw) > maxE2EEMetaSize {
+		return "", errors.New("e2ee_meta 过长")
+	}
+
+	var meta E2EEMeta
+	if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+		return "", errors.New("e2ee_meta 必须是合法的 JSON 对象")
+	}
+	if meta.Alg == "" {
+		return "", errors.New("e2ee_meta 缺少 alg")
+	}
+	if meta.ChunkSize < 0 {
+		return "", errors.New("e2ee_meta.chunk_size 不能为负数")
+	}
+
+	normalized, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// EncodeE2EEChunks 将分片解密参数按索引排序后序列化
+func EncodeE2EEChunks(chunks []E2EEChunk) (string, error) {
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeE2EEInfo 解析分享记录中保存的 E2EE 元数据和分片参数
+func DecodeE2EEInfo(metaRaw, chunksRaw string) (*E2EEMeta, []E2EEChunk) {
+	meta := &E2EEMeta{}
+	_ = json.Unmarshal([]byte(metaRaw), meta)
+
+	var chunks []E2EEChunk
+	if chunksRaw != "" {
+		_ = json.Unmarshal([]byte(chunksRaw), &chunks)
+	}
+	if chunks == nil {
+		chunks = []E2EEChunk{}
+	}
+	return meta, chunks
+}
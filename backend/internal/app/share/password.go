@@ -0,0 +1,58 @@
+package share
+
+import (
+	"errors"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength 分享密码的最大长度（bcrypt 只处理前 72 字节）
+const maxPasswordLength = 72
+
+// 分享密码校验结果
+var (
+	ErrPasswordRequired = errors.New("需要密码")
+	ErrWrongPassword    = errors.New("密码错误")
+)
+
+// ValidatePassword 上传前校验分享密码的长度
+func ValidatePassword(password string) error {
+	if len(password) > maxPasswordLength {
+		return errors.New("分享密码不能超过 72 个字节")
+	}
+	return nil
+}
+
+// hashPassword 生成分享密码的 bcrypt 摘要，密码为空时返回空字符串
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验访问分享时提交的密码
+// 设置了密码的分享按摘要比对；没有密码摘要但 RequireAuth 为 true 的旧分享保持原有行为，只要求提供密码
+func CheckPassword(fileCode *model.FileCode, password string) error {
+	if !fileCode.HasPassword() {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if fileCode.PasswordHash == "" {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(fileCode.PasswordHash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
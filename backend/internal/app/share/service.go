@@ -14,57 +14,98 @@ import (
 )
 
 type ShareTextReq struct {
-	Text         string
-	ExpiredAt    *time.Time
-	ExpiredCount int
-	RequireAuth  bool
-	UserID       *uint
-	UploadType   string
-	OwnerIP      string
+	Text          string
+	ExpiredAt     *time.Time
+	AvailableFrom *time.Time
+	ExpiredCount  int
+	RequireAuth   bool
+	Password      string // 分享密码明文，保存为 bcrypt 摘要
+	UserID        *uint
+	UploadType    string
+	OwnerIP       string
+	E2EE          bool
+	E2EEMeta      string
 }
 
 type ShareFileReq struct {
-	FilePath     string
-	Size         int64
-	Text         string
-	ExpiredAt    *time.Time
-	ExpiredCount int
-	RequireAuth  bool
-	UserID       *uint
-	UploadType   string
-	OwnerIP      string
-	FileHash     string
-	IsChunked    bool
-	UploadID     string
+	FilePath      string
+	Size          int64
+	Prefix        string // 原始文件名（不含扩展名）
+	Suffix        string // 原始扩展名（含点）
+	MimeType      string
+	Text          string
+	ExpiredAt     *time.Time
+	AvailableFrom *time.Time
+	ExpiredCount  int
+	RequireAuth   bool
+	Password      string // 分享密码明文，保存为 bcrypt 摘要
+	UserID        *uint
+	UploadType    string
+	OwnerIP       string
+	FileHash      string
+	HashVerified  bool // FileHash 由服务端计算，可用于秒传
+	IsChunked     bool
+	UploadID      string
+	E2EE          bool
+	E2EEMeta      string
+	E2EEChunks    string
+}
+
+// ShareTextWithAuthReq Handler 层文本分享参数
+type ShareTextWithAuthReq struct {
+	Text          string
+	ExpireValue   int
+	ExpireStyle   string
+	AvailableFrom *time.Time // 生效时间，过期时间从生效时刻开始计算
+	Password      string     // 分享密码，为空表示不设置
+	UserID        *uint
+	OwnerIP       string
+	E2EE          bool   // 端到端加密：Text 为客户端密文
+	E2EEMeta      string // 端到端加密元数据（JSON）
 }
 
 type ShareResp struct {
-	Code         string     `json:"code"`
-	Prefix       string     `json:"prefix"`
-	Suffix       string     `json:"suffix"`
-	UUIDFileName string     `json:"uuid_file_name"`
-	FilePath     string     `json:"file_path"`
-	Size         int64      `json:"size"`
-	Text         string     `json:"text"`
-	ExpiredAt    *time.Time `json:"expired_at"`
-	ExpiredCount int        `json:"expired_count"`
-	UsedCount    int        `json:"used_count"`
-	FileHash     string     `json:"file_hash"`
-	IsChunked    bool       `json:"is_chunked"`
-	UploadID     string     `json:"upload_id"`
-	UserID       *uint      `json:"user_id"`
-	UploadType   string     `json:"upload_type"`
-	RequireAuth  bool       `json:"require_auth"`
-	OwnerIP      string     `json:"owner_ip"`
-	ShareURL     string     `json:"share_url"`      // 相对分享链接
-	FullShareURL string     `json:"full_share_url"` // 完整分享链接
+	Code          string     `json:"code"`
+	Prefix        string     `json:"prefix"`
+	Suffix        string     `json:"suffix"`
+	UUIDFileName  string     `json:"uuid_file_name"`
+	FilePath      string     `json:"file_path"`
+	Size          int64      `json:"size"`
+	MimeType      string     `json:"mime_type"`
+	Text          string     `json:"text"`
+	ExpiredAt     *time.Time `json:"expired_at"`
+	AvailableFrom *time.Time `json:"available_from"`
+	ExpiredCount  int        `json:"expired_count"`
+	UsedCount     int        `json:"used_count"`
+	FileHash      string     `json:"file_hash"`
+	IsChunked     bool       `json:"is_chunked"`
+	UploadID      string     `json:"upload_id"`
+	UserID        *uint      `json:"user_id"`
+	UploadType    string     `json:"upload_type"`
+	RequireAuth   bool       `json:"require_auth"`
+	OwnerIP       string     `json:"owner_ip"`
+	E2EE          bool       `json:"e2ee"`
+	Version       int        `json:"version"`
+	ShareURL      string     `json:"share_url"`      // 相对分享链接
+	FullShareURL  string     `json:"full_share_url"` // 完整分享链接
+}
+
+// NotYetAvailableError 分享尚未到生效时间
+type NotYetAvailableError struct {
+	AvailableFrom time.Time
+}
+
+func (e *NotYetAvailableError) Error() string {
+	return "分享尚未生效"
 }
 
 type Service struct {
-	fileCodeRepo *dao.FileCodeRepository
-	userService  UserServiceInterface
-	storage      storage.StorageInterface
-	baseURL      string // 基础 URL，用于生成分享链接
+	fileCodeRepo    *dao.FileCodeRepository
+	transferLogRepo *dao.TransferLogRepository
+	fileVersionRepo *dao.FileVersionRepository
+	userService     UserServiceInterface
+	storage         storage.StorageInterface
+	baseURL         string // 基础 URL，用于生成分享链接
 }
 
 // UserServiceInterface 定义用户服务接口，避免循环依赖
@@ -87,6 +128,12 @@ func (s *Service) ensureRepository() {
 	if s.fileCodeRepo == nil {
 		s.fileCodeRepo = dao.NewFileCodeRepository()
 	}
+	if s.transferLogRepo == nil {
+		s.transferLogRepo = dao.NewTransferLogRepository()
+	}
+	if s.fileVersionRepo == nil {
+		s.fileVersionRepo = dao.NewFileVersionRepository()
+	}
 }
 
 func (s *Service) SetUserService(userService UserServiceInterface) {
@@ -110,17 +157,26 @@ func (s *Service) GenerateCode() string {
 func (s *Service) ShareText(ctx context.Context, req *ShareTextReq) (*ShareResp, error) {
 	s.ensureRepository()
 
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	code := s.GenerateCode()
 
 	fileCode := &model.FileCode{
-		Code:         code,
-		Text:         req.Text,
-		ExpiredAt:    req.ExpiredAt,
-		ExpiredCount: req.ExpiredCount,
-		RequireAuth:  req.RequireAuth,
-		UserID:       req.UserID,
-		UploadType:   req.UploadType,
-		OwnerIP:      req.OwnerIP,
+		Code:          code,
+		Text:          req.Text,
+		ExpiredAt:     req.ExpiredAt,
+		AvailableFrom: req.AvailableFrom,
+		ExpiredCount:  req.ExpiredCount,
+		RequireAuth:   req.RequireAuth,
+		PasswordHash:  passwordHash,
+		UserID:        req.UserID,
+		UploadType:    req.UploadType,
+		OwnerIP:       req.OwnerIP,
+		E2EE:          req.E2EE,
+		E2EEMeta:      req.E2EEMeta,
 	}
 
 	if err := s.fileCodeRepo.Create(ctx, fileCode); err != nil {
@@ -138,23 +194,34 @@ func (s *Service) ShareText(ctx context.Context, req *ShareTextReq) (*ShareResp,
 }
 
 // ShareTextWithAuth 带认证的文本分享（用于 Handler）
-func (s *Service) ShareTextWithAuth(ctx context.Context, text string, expireValue int, expireStyle string, userID *uint, ownerIP string) (*ShareResp, error) {
+func (s *Service) ShareTextWithAuth(ctx context.Context, params *ShareTextWithAuthReq) (*ShareResp, error) {
 	// 计算过期时间
-	expireTime := utils.CalculateExpireTime(expireValue, expireStyle)
-	expireCount := utils.CalculateExpireCount(expireStyle, expireValue)
+	expireTime := utils.CalculateExpireTimeFrom(params.AvailableFrom, params.ExpireValue, params.ExpireStyle)
+	expireCount := utils.CalculateExpireCount(params.ExpireStyle, params.ExpireValue)
 
 	uploadType := "anonymous"
-	if userID != nil {
+	if params.UserID != nil {
 		uploadType = "authenticated"
 	}
 
 	req := &ShareTextReq{
-		Text:         text,
-		ExpiredAt:    expireTime,
-		ExpiredCount: expireCount,
-		UserID:       userID,
-		UploadType:   uploadType,
-		OwnerIP:      ownerIP,
+		Text:          params.Text,
+		ExpiredAt:     expireTime,
+		AvailableFrom: params.AvailableFrom,
+		ExpiredCount:  expireCount,
+		Password:      params.Password,
+		UserID:        params.UserID,
+		UploadType:    uploadType,
+		OwnerIP:       params.OwnerIP,
+	}
+
+	if params.E2EE {
+		meta, err := ValidateE2EEMeta(params.E2EEMeta)
+		if err != nil {
+			return nil, err
+		}
+		req.E2EE = true
+		req.E2EEMeta = meta
 	}
 
 	resp, err := s.ShareText(ctx, req)
@@ -169,26 +236,57 @@ func (s *Service) ShareTextWithAuth(ctx context.Context, text string, expireValu
 	return resp, nil
 }
 
+// RecordFileHash 为已创建的文件分享补记服务端计算的 SHA-256（分片上传完成后异步计算），使其可用于秒传
+func (s *Service) RecordFileHash(ctx context.Context, code, fileHash string) error {
+	s.ensureRepository()
+
+	fileCode, err := s.fileCodeRepo.GetByCode(ctx, code)
+	if err != nil {
+		return errors.New("分享不存在")
+	}
+	if fileCode.E2EE || fileCode.FileHash != "" {
+		return nil
+	}
+	return s.fileCodeRepo.UpdateColumns(ctx, fileCode.ID, map[string]interface{}{
+		"file_hash":     fileHash,
+		"hash_verified": true,
+	})
+}
+
 // ShareFile 分享文件
 func (s *Service) ShareFile(ctx context.Context, req *ShareFileReq) (*ShareResp, error) {
 	s.ensureRepository()
 
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	code := s.GenerateCode()
 
 	fileCode := &model.FileCode{
-		Code:         code,
-		FilePath:     req.FilePath,
-		Size:         req.Size,
-		Text:         req.Text,
-		ExpiredAt:    req.ExpiredAt,
-		ExpiredCount: req.ExpiredCount,
-		RequireAuth:  req.RequireAuth,
-		UserID:       req.UserID,
-		UploadType:   req.UploadType,
-		OwnerIP:      req.OwnerIP,
-		FileHash:     req.FileHash,
-		IsChunked:    req.IsChunked,
-		UploadID:     req.UploadID,
+		Code:          code,
+		FilePath:      req.FilePath,
+		Size:          req.Size,
+		Prefix:        req.Prefix,
+		Suffix:        req.Suffix,
+		MimeType:      req.MimeType,
+		Text:          req.Text,
+		ExpiredAt:     req.ExpiredAt,
+		AvailableFrom: req.AvailableFrom,
+		ExpiredCount:  req.ExpiredCount,
+		RequireAuth:   req.RequireAuth,
+		PasswordHash:  passwordHash,
+		UserID:        req.UserID,
+		UploadType:    req.UploadType,
+		OwnerIP:       req.OwnerIP,
+		FileHash:      req.FileHash,
+		HashVerified:  req.HashVerified && req.FileHash != "" && !req.E2EE,
+		IsChunked:     req.IsChunked,
+		UploadID:      req.UploadID,
+		E2EE:          req.E2EE,
+		E2EEMeta:      req.E2EEMeta,
+		E2EEChunks:    req.E2EEChunks,
 	}
 
 	if err := s.fileCodeRepo.Create(ctx, fileCode); err != nil {
@@ -206,23 +304,27 @@ func (s *Service) ShareFile(ctx context.Context, req *ShareFileReq) (*ShareResp,
 	}
 
 	return &ShareResp{
-		Code:         fileCode.Code,
-		Prefix:       fileCode.Prefix,
-		Suffix:       fileCode.Suffix,
-		UUIDFileName: fileCode.UUIDFileName,
-		FilePath:     fileCode.FilePath,
-		Size:         fileCode.Size,
-		Text:         fileCode.Text,
-		ExpiredAt:    fileCode.ExpiredAt,
-		ExpiredCount: fileCode.ExpiredCount,
-		UsedCount:    fileCode.UsedCount,
-		FileHash:     fileCode.FileHash,
-		IsChunked:    fileCode.IsChunked,
-		UploadID:     fileCode.UploadID,
-		UserID:       fileCode.UserID,
-		UploadType:   fileCode.UploadType,
-		RequireAuth:  fileCode.RequireAuth,
-		OwnerIP:      fileCode.OwnerIP,
+		Code:          fileCode.Code,
+		Prefix:        fileCode.Prefix,
+		Suffix:        fileCode.Suffix,
+		UUIDFileName:  fileCode.UUIDFileName,
+		FilePath:      fileCode.FilePath,
+		Size:          fileCode.Size,
+		MimeType:      fileCode.MimeType,
+		Text:          fileCode.Text,
+		ExpiredAt:     fileCode.ExpiredAt,
+		AvailableFrom: fileCode.AvailableFrom,
+		ExpiredCount:  fileCode.ExpiredCount,
+		UsedCount:     fileCode.UsedCount,
+		FileHash:      fileCode.FileHash,
+		IsChunked:     fileCode.IsChunked,
+		UploadID:      fileCode.UploadID,
+		UserID:        fileCode.UserID,
+		UploadType:    fileCode.UploadType,
+		RequireAuth:   fileCode.RequireAuth,
+		OwnerIP:       fileCode.OwnerIP,
+		E2EE:          fileCode.E2EE,
+		Version:       fileCode.Version,
 	}, nil
 }
 
@@ -240,6 +342,11 @@ func (s *Service) GetFileByCode(ctx context.Context, code string) (*model.FileCo
 		return nil, errors.New("file has expired")
 	}
 
+	// 检查是否已到生效时间
+	if !fileCode.IsAvailable() {
+		return nil, &NotYetAvailableError{AvailableFrom: *fileCode.AvailableFrom}
+	}
+
 	return fileCode, nil
 }
 
@@ -266,6 +373,8 @@ func (s *Service) DeleteFile(ctx context.Context, fileID uint, userID *uint) err
 				// 记录错误但不影响主流程
 			}
 		}
+
+		s.deleteAllVersions(ctx, file)
 	}
 
 	return s.fileCodeRepo.Delete(ctx, fileID)
@@ -286,26 +395,20 @@ func (s *Service) DeleteFileByCode(ctx context.Context, code string, userID uint
 		return fmt.Errorf("无权限删除此分享")
 	}
 
-	// 3. 如果是文件分享，删除物理文件
-	if file.FilePath != "" && file.UUIDFileName != "" {
-		// 获取完整的文件路径
-		filePath := file.GetFilePath()
-
-		// 如果有存储服务，尝试删除物理文件
-		if s.storage != nil {
-			if err := s.storage.DeleteFile(ctx, filePath); err != nil {
-				// 记录错误但不阻止数据库删除
-				// 可以考虑添加日志记录
-			}
-		}
-	}
+	// 3. 删除历史版本（同时归还其占用的存储配额）
+	s.deleteAllVersions(ctx, file)
 
 	// 4. 删除数据库记录
 	if err := s.fileCodeRepo.Delete(ctx, file.ID); err != nil {
 		return fmt.Errorf("删除分享记录失败: %w", err)
 	}
 
-	// 5. 更新用户统计（减少存储空间）
+	// 5. 如果是文件分享，且没有其他分享（秒传）引用同一文件，删除物理文件
+	if !file.IsText() {
+		s.deleteFileIfUnreferenced(ctx, file.FilePath, file.GetFilePath())
+	}
+
+	// 6. 更新用户统计（减少存储空间）
 	if s.userService != nil {
 		if err := s.userService.UpdateUserStats(userID, "storage", -file.Size); err != nil {
 			// 记录错误但不影响主流程
@@ -315,6 +418,95 @@ func (s *Service) DeleteFileByCode(ctx context.Context, code string, userID uint
 	return nil
 }
 
+// DeleteAllByUser 删除用户的全部分享及历史版本，并通过存储驱动删除不再被引用的文件
+// 用于注销账号，不更新用户统计；返回删除的分享数和释放的字节数
+func (s *Service) DeleteAllByUser(ctx context.Context, userID uint) (int, int64, error) {
+	s.ensureRepository()
+
+	files, err := s.fileCodeRepo.GetFilesByUserID(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	// 先删除记录再删除文件，引用计数才不会把这些分享算进去
+	if err := s.fileCodeRepo.PurgeByUserID(ctx, userID); err != nil {
+		return 0, 0, err
+	}
+
+	var freed int64
+	for _, file := range files {
+		if versions, err := s.fileVersionRepo.ListByFileCodeID(ctx, file.ID); err == nil {
+			for _, v := range versions {
+				freed += v.Size
+			}
+		}
+		s.deleteAllVersions(ctx, file)
+		if !file.IsText() {
+			s.deleteFileIfUnreferenced(ctx, file.FilePath, file.GetFilePath())
+		}
+		freed += file.Size
+	}
+	return len(files), freed, nil
+}
+
+// TransferAllByUser 把用户的全部分享及历史版本转移给另一个用户，并计入对方的存储用量
+// 返回转移的分享数和字节数
+func (s *Service) TransferAllByUser(ctx context.Context, fromUserID, toUserID uint) (int, int64, error) {
+	s.ensureRepository()
+
+	files, err := s.fileCodeRepo.GetFilesByUserID(ctx, fromUserID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var moved int64
+	for _, file := range files {
+		if err := s.fileCodeRepo.UpdateColumns(ctx, file.ID, map[string]interface{}{
+			"user_id":     toUserID,
+			"upload_type": "authenticated",
+		}); err != nil {
+			return 0, 0, err
+		}
+		if err := s.fileVersionRepo.ReassignUser(ctx, file.ID, toUserID); err != nil {
+			return 0, 0, err
+		}
+		if versions, err := s.fileVersionRepo.ListByFileCodeID(ctx, file.ID); err == nil {
+			for _, v := range versions {
+				moved += v.Size
+			}
+		}
+		moved += file.Size
+	}
+
+	if s.userService != nil && moved > 0 {
+		if err := s.userService.UpdateUserStats(toUserID, "storage", moved); err != nil {
+			// 记录错误但不影响主流程
+		}
+	}
+
+	// 清理之前软删除、仍关联在原用户名下的记录
+	if err := s.fileCodeRepo.PurgeByUserID(ctx, fromUserID); err != nil {
+		return len(files), moved, err
+	}
+	return len(files), moved, nil
+}
+
+// deleteFileIfUnreferenced 当没有分享或历史版本引用 filePath 时删除存储中的文件
+// 秒传创建的分享与原分享共用同一份文件，删除其中一个不能影响其他分享
+func (s *Service) deleteFileIfUnreferenced(ctx context.Context, filePath, storagePath string) {
+	if s.storage == nil || storagePath == "" {
+		return
+	}
+	if n, err := s.fileCodeRepo.CountByFilePath(ctx, filePath); err != nil || n > 0 {
+		return
+	}
+	if n, err := s.fileVersionRepo.CountByFilePath(ctx, filePath); err != nil || n > 0 {
+		return
+	}
+	if err := s.storage.DeleteFile(ctx, storagePath); err != nil {
+		// 记录错误但不影响主流程
+	}
+}
+
 // GetFileList 获取文件列表
 func (s *Service) GetFileList(ctx context.Context, page, pageSize int, search string) ([]*model.FileCode, int64, error) {
 	s.ensureRepository()
@@ -353,35 +545,36 @@ func (s *Service) GetFileWithUsage(ctx context.Context, code string, password st
 		return nil, err
 	}
 
-	// 检查是否需要密码
-	if fileCode.RequireAuth && password == "" {
-		return nil, errors.New("需要密码")
+	if err := CheckPassword(fileCode, password); err != nil {
+		return nil, err
 	}
 
-	// TODO: 验证密码逻辑（当前仅检查非空）
-
 	return fileCode, nil
 }
 
 // modelToResp 将模型转换为响应
 func (s *Service) modelToResp(fileCode *model.FileCode) *ShareResp {
 	return &ShareResp{
-		Code:         fileCode.Code,
-		Prefix:       fileCode.Prefix,
-		Suffix:       fileCode.Suffix,
-		UUIDFileName: fileCode.UUIDFileName,
-		FilePath:     fileCode.FilePath,
-		Size:         fileCode.Size,
-		Text:         fileCode.Text,
-		ExpiredAt:    fileCode.ExpiredAt,
-		ExpiredCount: fileCode.ExpiredCount,
-		UsedCount:    fileCode.UsedCount,
-		FileHash:     fileCode.FileHash,
-		IsChunked:    fileCode.IsChunked,
-		UploadID:     fileCode.UploadID,
-		UserID:       fileCode.UserID,
-		UploadType:   fileCode.UploadType,
-		RequireAuth:  fileCode.RequireAuth,
-		OwnerIP:      fileCode.OwnerIP,
+		Code:          fileCode.Code,
+		Prefix:        fileCode.Prefix,
+		Suffix:        fileCode.Suffix,
+		UUIDFileName:  fileCode.UUIDFileName,
+		FilePath:      fileCode.FilePath,
+		Size:          fileCode.Size,
+		MimeType:      fileCode.MimeType,
+		Text:          fileCode.Text,
+		ExpiredAt:     fileCode.ExpiredAt,
+		AvailableFrom: fileCode.AvailableFrom,
+		ExpiredCount:  fileCode.ExpiredCount,
+		UsedCount:     fileCode.UsedCount,
+		FileHash:      fileCode.FileHash,
+		IsChunked:     fileCode.IsChunked,
+		UploadID:      fileCode.UploadID,
+		UserID:        fileCode.UserID,
+		UploadType:    fileCode.UploadType,
+		RequireAuth:   fileCode.RequireAuth,
+		OwnerIP:       fileCode.OwnerIP,
+		E2EE:          fileCode.E2EE,
+		Version:       fileCode.Version,
 	}
 }
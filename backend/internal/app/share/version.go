@@ -0,0 +1,182 @@
+package share
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/utils"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// defaultMaxVersions 未配置时每个分享保留的历史版本数
+const defaultMaxVersions = 5
+
+// NewVersionReq 上传新版本参数
+type NewVersionReq struct {
+	Code     string
+	UserID   uint
+	FilePath string
+	Size     int64
+	FileName string // 原始文件名
+	MimeType string
+	FileHash string // 服务端计算的 SHA-256
+}
+
+// maxVersionAttempts 并发更新同一分享时重新读取并重试的次数
+const maxVersionAttempts = 3
+
+// ErrVersionConflict 分享同时被其他上传更新，重试后仍未成功
+var ErrVersionConflict = errors.New("分享正在被其他上传更新，请稍后重试")
+
+// AddVersion 用新文件替换分享内容，旧文件保存为历史版本
+// 版本号按条件更新，并发上传时基于最新版本重试，不会产生重复的版本号
+func (s *Service) AddVersion(ctx context.Context, req *NewVersionReq) (*ShareResp, error) {
+	s.ensureRepository()
+
+	var fileCode *model.FileCode
+	for attempt := 0; ; attempt++ {
+		if attempt == maxVersionAttempts {
+			return nil, ErrVersionConflict
+		}
+
+		var err error
+		fileCode, err = s.fileCodeRepo.GetByCode(ctx, req.Code)
+		if err != nil {
+			return nil, errors.New("分享不存在")
+		}
+		if fileCode.UserID == nil || *fileCode.UserID != req.UserID {
+			return nil, errors.New("无权限更新此分享")
+		}
+		if fileCode.GetFilePath() == "" {
+			return nil, errors.New("文本分享不支持版本更新")
+		}
+		if fileCode.E2EE {
+			return nil, errors.New("端到端加密分享不支持版本更新")
+		}
+
+		storedVersion := fileCode.Version
+		currentVersion := storedVersion
+		if currentVersion < 1 {
+			currentVersion = 1
+		}
+
+		// 当前文件保存为历史版本
+		history := &model.FileVersion{
+			FileCodeID:   fileCode.ID,
+			Version:      currentVersion,
+			FilePath:     fileCode.FilePath,
+			UUIDFileName: fileCode.UUIDFileName,
+			Size:         fileCode.Size,
+			FileName:     fileCode.FileName(),
+			MimeType:     fileCode.MimeType,
+			FileHash:     fileCode.FileHash,
+			UserID:       fileCode.UserID,
+		}
+
+		// 分享指向新文件
+		fileCode.FilePath = req.FilePath
+		fileCode.UUIDFileName = ""
+		fileCode.Size = req.Size
+		fileCode.Prefix, fileCode.Suffix = utils.SplitFileName(req.FileName)
+		fileCode.MimeType = req.MimeType
+		fileCode.Text = ""
+		fileCode.FileHash = req.FileHash
+		fileCode.HashVerified = req.FileHash != ""
+		fileCode.IsChunked = false
+		fileCode.UploadID = ""
+		fileCode.Version = currentVersion + 1
+
+		replaced, err := s.fileCodeRepo.ReplaceFile(ctx, fileCode, history, storedVersion)
+		if err != nil {
+			return nil, err
+		}
+		if replaced {
+			break
+		}
+	}
+
+	if s.userService != nil {
+		if err := s.userService.UpdateUserStats(req.UserID, "storage", req.Size); err != nil {
+			// 记录错误但不影响主流程
+		}
+	}
+
+	// 清理超出保留数量的旧版本
+	s.pruneVersions(ctx, fileCode)
+
+	return s.modelToResp(fileCode), nil
+}
+
+// ListVersions 获取分享的历史版本，仅所有者可查看
+func (s *Service) ListVersions(ctx context.Context, code string, userID uint) (*model.FileCode, []*model.FileVersion, error) {
+	s.ensureRepository()
+
+	fileCode, err := s.fileCodeRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, nil, errors.New("分享不存在")
+	}
+	if fileCode.UserID == nil || *fileCode.UserID != userID {
+		return nil, nil, errors.New("无权限查看此分享")
+	}
+
+	versions, err := s.fileVersionRepo.ListByFileCodeID(ctx, fileCode.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fileCode, versions, nil
+}
+
+// GetVersion 获取分享的指定历史版本；version 为当前版本时返回 nil
+func (s *Service) GetVersion(ctx context.Context, fileCode *model.FileCode, version int) (*model.FileVersion, error) {
+	s.ensureRepository()
+
+	if version == fileCode.Version {
+		return nil, nil
+	}
+	v, err := s.fileVersionRepo.GetByVersion(ctx, fileCode.ID, version)
+	if err != nil {
+		return nil, errors.New("版本不存在")
+	}
+	return v, nil
+}
+
+// pruneVersions 删除超出保留数量的历史版本及其文件，并归还存储配额
+func (s *Service) pruneVersions(ctx context.Context, fileCode *model.FileCode) {
+	maxVersions := defaultMaxVersions
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Upload.MaxVersions > 0 {
+		maxVersions = cfg.Upload.MaxVersions
+	}
+
+	versions, err := s.fileVersionRepo.ListByFileCodeID(ctx, fileCode.ID)
+	if err != nil || len(versions) <= maxVersions {
+		return
+	}
+
+	for _, v := range versions[maxVersions:] {
+		s.deleteVersion(ctx, v)
+	}
+}
+
+// deleteAllVersions 删除分享的全部历史版本（分享被删除时调用）
+func (s *Service) deleteAllVersions(ctx context.Context, fileCode *model.FileCode) {
+	versions, err := s.fileVersionRepo.ListByFileCodeID(ctx, fileCode.ID)
+	if err != nil {
+		return
+	}
+	for _, v := range versions {
+		s.deleteVersion(ctx, v)
+	}
+}
+
+func (s *Service) deleteVersion(ctx context.Context, v *model.FileVersion) {
+	if err := s.fileVersionRepo.Delete(ctx, v.ID); err != nil {
+		return
+	}
+	s.deleteFileIfUnreferenced(ctx, v.FilePath, v.GetFilePath())
+	if s.userService != nil && v.UserID != nil {
+		if err := s.userService.UpdateUserStats(*v.UserID, "storage", -v.Size); err != nil {
+			// 记录错误但不影响主流程
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package share_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/share"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+func TestAddVersionConcurrent(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.Upload.MaxVersions = 100
+	ctx := context.Background()
+
+	owner := &model.User{Username: "alice", Email: "alice@example.com", Role: "user", Status: "active"}
+	if err := db.GetDB().Create(owner).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	fileCode := &model.FileCode{Code: "vshare", FilePath: "v1.bin", Prefix: "v1", Suffix: ".bin", Size: 1, Version: 1, UserID: &owner.ID}
+	if err := dao.NewFileCodeRepository().Create(ctx, fileCode); err != nil {
+		t.Fatalf("创建分享失败: %v", err)
+	}
+
+	// 同一分享的并发上传不能产生重复的版本号，也不能互相覆盖
+	service := share.NewService("", nil)
+	const uploads = 8
+	var (
+		start    = make(chan struct{})
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		versions = map[int]string{}
+	)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			path := fmt.Sprintf("v-%d.bin", i)
+			resp, err := service.AddVersion(ctx, &share.NewVersionReq{
+				Code: "vshare", UserID: owner.ID, FilePath: path, Size: 2, FileName: path,
+			})
+			if errors.Is(err, share.ErrVersionConflict) {
+				return
+			}
+			if err != nil {
+				t.Errorf("AddVersion: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if other, ok := versions[resp.Version]; ok {
+				t.Errorf("版本 %d 重复: %s 和 %s", resp.Version, other, path)
+			}
+			versions[resp.Version] = path
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	if len(versions) == 0 {
+		t.Fatal("没有上传成功")
+	}
+
+	latest, err := dao.NewFileCodeRepository().GetByCode(ctx, "vshare")
+	if err != nil {
+		t.Fatalf("读取分享失败: %v", err)
+	}
+	if latest.Version != 1+len(versions) || latest.FilePath != versions[latest.Version] {
+		t.Fatalf("当前版本 %d 指向 %s，成功的上传: %v", latest.Version, latest.FilePath, versions)
+	}
+
+	// 每次成功的上传都把前一个文件保存为历史版本
+	history, err := dao.NewFileVersionRepository().ListByFileCodeID(ctx, latest.ID)
+	if err != nil {
+		t.Fatalf("读取历史版本失败: %v", err)
+	}
+	if len(history) != len(versions) {
+		t.Fatalf("历史版本 %d 个，成功的上传 %d 个", len(history), len(versions))
+	}
+	for _, v := range history {
+		want := "v1.bin"
+		if v.Version > 1 {
+			want = versions[v.Version]
+		}
+		if v.FilePath != want {
+			t.Errorf("历史版本 %d 指向 %s，应为 %s", v.Version, v.FilePath, want)
+		}
+	}
+}
+
+func TestReplaceFileRejectsStaleVersion(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	repo := dao.NewFileCodeRepository()
+
+	fileCode := &model.FileCode{Code: "stale", FilePath: "v1.bin", Size: 1, Version: 2}
+	if err := repo.Create(ctx, fileCode); err != nil {
+		t.Fatalf("创建分享失败: %v", err)
+	}
+
+	// 读取分享后版本已被其他上传更新，条件更新不生效，也不保存历史版本
+	update := *fileCode
+	update.FilePath = "late.bin"
+	update.Version = 2
+	replaced, err := repo.ReplaceFile(ctx, &update, &model.FileVersion{FileCodeID: fileCode.ID, Version: 1, FilePath: "v1.bin"}, 1)
+	if err != nil || replaced {
+		t.Fatalf("过期版本: replaced=%v err=%v", replaced, err)
+	}
+
+	latest, _ := repo.GetByCode(ctx, "stale")
+	history, _ := dao.NewFileVersionRepository().ListByFileCodeID(ctx, fileCode.ID)
+	if latest.FilePath != "v1.bin" || latest.Version != 2 || len(history) != 0 {
+		t.Fatalf("过期版本修改了分享: %+v, 历史版本 %d 个", latest, len(history))
+	}
+}
@@ -0,0 +1,507 @@
+// Package sso OpenID Connect 单点登录：跳转到身份提供方、处理回调，
+// 按外部身份查找、关联或自动创建本地用户，并根据配置的声明同步角色。
+// 回调成功后签发一次性交换码，前端用它换取与密码登录相同的会话令牌
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/oidc"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProviderNotFound      = errors.New("不支持的登录方式")
+	ErrInvalidState          = errors.New("登录请求已失效，请重新登录")
+	ErrLoginFailed           = errors.New("单点登录失败，请稍后再试")
+	ErrNotProvisioned        = errors.New("该账号尚未开通，请联系管理员")
+	ErrEmailRequired         = errors.New("身份提供方未返回邮箱，无法创建账号")
+	ErrEmailInUse            = errors.New("该邮箱已被本地账号使用，请联系管理员关联账号")
+	ErrRoleDenied            = errors.New("该账号没有访问权限")
+	ErrUserDisabled          = errors.New("用户账号已被禁用")
+	ErrInvalidExchangeCode   = errors.New("登录已失效，请重新登录")
+	ErrPasswordLoginDisabled = errors.New("已关闭密码登录，请使用单点登录")
+)
+
+const (
+	// StateCookie 保存单点登录状态的 Cookie 名称
+	StateCookie = "fcb_oidc_state"
+	// StateTTL 从跳转到身份提供方到回调的最长时间
+	StateTTL = 10 * time.Minute
+	// exchangeCodeTTL 回调后前端换取登录令牌的交换码有效期
+	exchangeCodeTTL = 2 * time.Minute
+)
+
+// roleRank 角色权限高低，映射出多个角色时取最高的
+var roleRank = map[string]int{"user": 1, "admin": 2}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ProviderInfo 展示在登录页的身份提供方
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type provider struct {
+	cfg    conf.OIDCProviderConfig
+	client *oidc.Provider
+}
+
+// Service 单点登录服务
+type Service struct {
+	userRepo     *dao.UserRepository
+	identityRepo *dao.UserIdentityRepository
+	tokenRepo    *dao.UserTokenRepository
+
+	providers     map[string]*provider
+	order         []string
+	skipTwoFactor bool
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// NewService 按配置创建单点登录服务，base 为站点地址，用于生成默认的回调地址
+func NewService(cfg *conf.OIDCConfig, base string) *Service {
+	s := &Service{
+		userRepo:     dao.NewUserRepository(),
+		identityRepo: dao.NewUserIdentityRepository(),
+		tokenRepo:    dao.NewUserTokenRepository(),
+		providers:    make(map[string]*provider),
+	}
+	if cfg != nil {
+		s.load(cfg, base)
+		s.skipTwoFactor = cfg.SkipTwoFactor
+	}
+	return s
+}
+
+// GetService 获取全局单点登录服务，身份提供方在首次调用时按配置创建
+func GetService() *Service {
+	defaultOnce.Do(func() {
+		if cfg := conf.GetGlobalConfig(); cfg != nil {
+			defaultService = NewService(&cfg.OIDC, baseURL(cfg))
+		} else {
+			defaultService = NewService(nil, "")
+		}
+	})
+	return defaultService
+}
+
+// PasswordLoginDisabled 是否关闭了本地密码登录和注册
+// 只有至少配置了一个身份提供方时才生效，避免误配置后所有人都无法登录
+func PasswordLoginDisabled() bool {
+	cfg := conf.GetGlobalConfig()
+	return cfg != nil && cfg.OIDC.DisablePasswordLogin && len(GetService().order) > 0
+}
+
+// load 按配置创建身份提供方，配置不完整的提供方会被跳过
+func (s *Service) load(cfg *conf.OIDCConfig, base string) {
+	for _, pc := range cfg.Providers {
+		if !providerNamePattern.MatchString(pc.Name) || pc.Issuer == "" || pc.ClientID == "" {
+			logger.Warn("忽略配置不完整的单点登录提供方", zap.String("name", pc.Name))
+			continue
+		}
+		if _, ok := s.providers[pc.Name]; ok {
+			logger.Warn("忽略重复的单点登录提供方", zap.String("name", pc.Name))
+			continue
+		}
+		if pc.DisplayName == "" {
+			pc.DisplayName = pc.Name
+		}
+		if pc.RedirectURL == "" {
+			pc.RedirectURL = base + "/user/oidc/" + pc.Name + "/callback"
+		}
+		if pc.DefaultRole != "" && roleRank[pc.DefaultRole] == 0 {
+			logger.Warn("单点登录默认角色无效，已忽略", zap.String("name", pc.Name), zap.String("role", pc.DefaultRole))
+			pc.DefaultRole = ""
+		}
+		if pc.RoleClaim == "" && pc.DefaultRole == "" {
+			pc.DefaultRole = "user"
+		}
+
+		s.providers[pc.Name] = &provider{
+			cfg: pc,
+			client: oidc.NewProvider(oidc.Config{
+				Issuer:       pc.Issuer,
+				ClientID:     pc.ClientID,
+				ClientSecret: pc.ClientSecret,
+				RedirectURL:  pc.RedirectURL,
+				Scopes:       pc.Scopes,
+			}),
+		}
+		s.order = append(s.order, pc.Name)
+	}
+}
+
+// Providers 返回已配置的身份提供方
+func (s *Service) Providers() []ProviderInfo {
+	list := make([]ProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		p := s.providers[name]
+		list = append(list, ProviderInfo{Name: name, DisplayName: p.cfg.DisplayName})
+	}
+	return list
+}
+
+// Begin 开始单点登录，返回身份提供方的授权地址和需要写入 Cookie 的状态令牌
+// redirect 为登录完成后前端跳转的站内路径
+func (s *Service) Begin(ctx context.Context, name, redirect string) (string, string, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return "", "", ErrProviderNotFound
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.RandomString(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := p.client.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		logger.Error("获取单点登录授权地址失败", zap.String("provider", name), zap.Error(err))
+		return "", "", ErrLoginFailed
+	}
+	stateToken, err := auth.GenerateOIDCStateToken(&auth.OIDCStateClaims{
+		Provider: name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Redirect: SafeRedirect(redirect),
+	}, StateTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+// Callback 处理身份提供方的回调：校验状态、换取并校验 ID Token、找到对应的本地用户，
+// 返回一次性交换码和登录前记录的站内跳转路径
+func (s *Service) Callback(ctx context.Context, name, code, state, stateToken string) (string, string, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return "", "", ErrProviderNotFound
+	}
+	saved, err := auth.ParseOIDCStateToken(stateToken)
+	if err != nil || saved.Provider != name || state == "" ||
+		subtle.ConstantTimeCompare([]byte(saved.State), []byte(state)) != 1 {
+		return "", "", ErrInvalidState
+	}
+	if code == "" {
+		return "", "", ErrLoginFailed
+	}
+
+	token, err := p.client.Exchange(ctx, code, saved.Verifier)
+	if err != nil {
+		logger.Warn("单点登录换取令牌失败", zap.String("provider", name), zap.Error(err))
+		return "", "", ErrLoginFailed
+	}
+	claims, err := p.client.VerifyIDToken(ctx, token.IDToken, saved.Nonce)
+	if err != nil {
+		logger.Warn("单点登录 ID Token 校验失败", zap.String("provider", name), zap.Error(err))
+		return "", "", ErrLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, p, claims)
+	if err != nil {
+		return "", "", err
+	}
+	exchangeCode, err := s.issueExchangeCode(ctx, user)
+	if err != nil {
+		return "", "", err
+	}
+	return exchangeCode, saved.Redirect, nil
+}
+
+// Exchange 使用回调签发的交换码换取用户，交换码只能使用一次
+// 与密码登录相同，已开启或角色要求两步验证时返回 *twofactor.ChallengeError，凭预认证令牌完成第二步；
+// 开启 oidc.skip_two_factor 时由身份提供方负责多因素认证，不再校验本地两步验证
+func (s *Service) Exchange(ctx context.Context, code string) (*model.User, error) {
+	record, err := s.tokenRepo.GetValidByHash(ctx, model.TokenPurposeOIDCLogin, hashCode(strings.TrimSpace(code)))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidExchangeCode
+		}
+		return nil, err
+	}
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidExchangeCode
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, ErrInvalidExchangeCode
+	}
+	if user.Status != "active" {
+		return nil, ErrUserDisabled
+	}
+	if !s.skipTwoFactor {
+		if err := twofactor.GetService().Challenge(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// resolveUser 按外部身份查找本地用户；没有绑定时按配置通过已验证邮箱关联或自动创建
+func (s *Service) resolveUser(ctx context.Context, p *provider, claims oidc.Claims) (*model.User, error) {
+	subject := claims.String("sub")
+	email := strings.TrimSpace(claims.String("email"))
+	emailVerified := claims.Bool("email_verified")
+
+	role, err := p.mapRole(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *model.User
+	identity, err := s.identityRepo.GetByProviderSubject(ctx, p.cfg.Name, subject)
+	switch {
+	case err == nil:
+		user, err = s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, ErrNotProvisioned
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = s.linkOrProvision(ctx, p, claims, role)
+		if err != nil {
+			return nil, err
+		}
+		identity = &model.UserIdentity{UserID: user.ID, Provider: p.cfg.Name, Subject: subject}
+		if err := s.identityRepo.Create(ctx, identity); err != nil {
+			return nil, err
+		}
+		logger.Info("绑定单点登录身份",
+			zap.String("provider", p.cfg.Name), zap.String("subject", subject), zap.Uint("user_id", user.ID))
+	default:
+		return nil, err
+	}
+
+	if user.Status != "active" {
+		return nil, ErrUserDisabled
+	}
+
+	now := time.Now()
+	if role != "" && user.Role != role {
+		logger.Info("按单点登录声明更新用户角色",
+			zap.Uint("user_id", user.ID), zap.String("from", user.Role), zap.String("to", role))
+		user.Role = role
+	}
+	if email != "" && emailVerified && email == user.Email {
+		user.EmailVerified = true
+	}
+	user.LastLoginAt = &now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.identityRepo.UpdateLogin(ctx, identity.ID, email, now); err != nil {
+		logger.Warn("更新单点登录身份失败", zap.Uint("identity_id", identity.ID), zap.Error(err))
+	}
+	return user, nil
+}
+
+// linkOrProvision 首次登录时关联已有用户或创建新用户
+// 只有身份提供方确认过的邮箱才用于关联，否则可能被冒用他人邮箱接管本地账号
+func (s *Service) linkOrProvision(ctx context.Context, p *provider, claims oidc.Claims, role string) (*model.User, error) {
+	email := strings.TrimSpace(claims.String("email"))
+	emailVerified := claims.Bool("email_verified")
+
+	var existing *model.User
+	if email != "" {
+		user, err := s.userRepo.GetByEmail(ctx, email)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		existing = user
+	}
+	if existing != nil {
+		if p.cfg.LinkByEmail && emailVerified {
+			return existing, nil
+		}
+		if p.cfg.AutoProvision {
+			return nil, ErrEmailInUse
+		}
+		return nil, ErrNotProvisioned
+	}
+
+	if !p.cfg.AutoProvision {
+		return nil, ErrNotProvisioned
+	}
+	if email == "" {
+		return nil, ErrEmailRequired
+	}
+	if role == "" {
+		role = "user"
+	}
+
+	username, err := s.uniqueUsername(ctx, claims.String("preferred_username"), email)
+	if err != nil {
+		return nil, err
+	}
+	// 不设置密码，用户只能通过单点登录或找回密码流程登录
+	user := &model.User{
+		Username:      username,
+		Email:         email,
+		Nickname:      truncate(claims.String("name"), 50),
+		Role:          role,
+		Status:        "active",
+		EmailVerified: emailVerified,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	logger.Info("单点登录自动创建用户",
+		zap.String("provider", p.cfg.Name), zap.Uint("user_id", user.ID), zap.String("username", username))
+	return user, nil
+}
+
+// uniqueUsername 由 preferred_username 或邮箱前缀生成不重复的用户名
+func (s *Service) uniqueUsername(ctx context.Context, preferred, email string) (string, error) {
+	base := sanitizeUsername(preferred)
+	if base == "" {
+		local, _, _ := strings.Cut(email, "@")
+		base = sanitizeUsername(local)
+	}
+	if base == "" {
+		base = "user"
+	}
+	base = truncate(base, 40)
+
+	for i := 1; i <= 20; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s_%d", base, i)
+		}
+		_, err := s.userRepo.GetByUsername(ctx, candidate)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "_" + hex.EncodeToString(suffix), nil
+}
+
+// mapRole 根据 role_claim 和 role_mapping 计算本地角色，多个匹配时取权限最高的
+// 未配置 role_claim 时返回空字符串，表示不同步角色
+func (p *provider) mapRole(claims oidc.Claims) (string, error) {
+	if p.cfg.RoleClaim == "" {
+		return "", nil
+	}
+	role := ""
+	for _, value := range claims.Strings(p.cfg.RoleClaim) {
+		// 配置加载时映射的键会被转为小写
+		mapped := p.cfg.RoleMapping[strings.ToLower(value)]
+		if roleRank[mapped] > roleRank[role] {
+			role = mapped
+		}
+	}
+	if role == "" {
+		role = p.cfg.DefaultRole
+	}
+	if role == "" {
+		return "", ErrRoleDenied
+	}
+	return role, nil
+}
+
+// issueExchangeCode 签发回调后换取登录令牌的一次性交换码，数据库只保存摘要
+func (s *Service) issueExchangeCode(ctx context.Context, user *model.User) (string, error) {
+	code, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	record := &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   model.TokenPurposeOIDCLogin,
+		TokenHash: hashCode(code),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(exchangeCodeTTL),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return "", err
+	}
+	if _, err := s.tokenRepo.DeleteExpired(ctx, time.Now().Add(-time.Hour)); err != nil {
+		logger.Warn("清理过期令牌失败", zap.Error(err))
+	}
+	return code, nil
+}
+
+// SafeRedirect 只接受站内相对路径，防止登录后被跳转到外部站点
+func SafeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.ContainsAny(redirect, "\\\r\n") {
+		return ""
+	}
+	return redirect
+}
+
+// SiteURL 站点地址，单点登录回调后跳转到该地址下的前端页面
+func SiteURL() string {
+	return baseURL(conf.GetGlobalConfig())
+}
+
+func baseURL(cfg *conf.AppConfiguration) string {
+	if cfg != nil && cfg.OIDC.BaseURL != "" {
+		return strings.TrimRight(cfg.OIDC.BaseURL, "/")
+	}
+	if cfg != nil && cfg.Mail.BaseURL != "" {
+		return strings.TrimRight(cfg.Mail.BaseURL, "/")
+	}
+	return "http://localhost:12345"
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func sanitizeUsername(name string) string {
+	return strings.Trim(usernameInvalidChars.ReplaceAllString(strings.TrimSpace(name), "_"), "_.-")
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
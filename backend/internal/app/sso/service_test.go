@@ -0,0 +1,296 @@
+package sso_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/sso"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/oidc/oidctest"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+)
+
+const (
+	clientID     = "filecodebox"
+	clientSecret = "s3cret"
+	redirectURL  = "http://app.example/user/oidc/idp/callback"
+)
+
+// noRedirect 不跟随跳转，以便从授权端点的响应中取出回调参数
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func setup(t *testing.T) (*oidctest.Server, *sso.Service) {
+	t.Helper()
+	testenv.Setup(t)
+
+	idp, err := oidctest.NewServer(clientID, clientSecret)
+	if err != nil {
+		t.Fatalf("启动身份提供方失败: %v", err)
+	}
+	t.Cleanup(idp.Close)
+	idp.SetClaims(map[string]interface{}{
+		"sub":                "alice-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"staff"},
+	})
+
+	return idp, sso.NewService(oidcConfig(idp), "")
+}
+
+func oidcConfig(idp *oidctest.Server) *conf.OIDCConfig {
+	return &conf.OIDCConfig{Providers: []conf.OIDCProviderConfig{{
+		Name:          "idp",
+		Issuer:        idp.URL,
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		RedirectURL:   redirectURL,
+		AutoProvision: true,
+		RoleClaim:     "groups",
+		RoleMapping:   map[string]string{"staff": "user", "ops": "admin"},
+	}}}
+}
+
+// authorize 开始登录并访问授权端点，返回回调中的 code、state 和状态令牌
+func authorize(t *testing.T, service *sso.Service) (string, string, string) {
+	t.Helper()
+	authURL, stateToken, err := service.Begin(context.Background(), "idp", "/files")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	resp, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatalf("访问授权端点失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("授权端点返回 %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("解析回调地址失败: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state"), stateToken
+}
+
+// tamperState 重新签发状态令牌，用于模拟与授权请求不一致的 nonce 或 PKCE 校验码
+func tamperState(t *testing.T, stateToken string, modify func(*auth.OIDCStateClaims)) string {
+	t.Helper()
+	claims, err := auth.ParseOIDCStateToken(stateToken)
+	if err != nil {
+		t.Fatalf("解析状态令牌失败: %v", err)
+	}
+	modify(claims)
+	token, err := auth.GenerateOIDCStateToken(claims, sso.StateTTL)
+	if err != nil {
+		t.Fatalf("签发状态令牌失败: %v", err)
+	}
+	return token
+}
+
+func TestLoginFlow(t *testing.T) {
+	_, service := setup(t)
+	ctx := context.Background()
+
+	if providers := service.Providers(); len(providers) != 1 || providers[0].Name != "idp" {
+		t.Fatalf("身份提供方列表: %+v", providers)
+	}
+
+	authURL, _, err := service.Begin(ctx, "idp", "https://evil.example/")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	query, _ := url.Parse(authURL)
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if query.Query().Get(name) == "" {
+			t.Errorf("授权地址缺少 %s: %s", name, authURL)
+		}
+	}
+	if query.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("授权地址未使用 S256: %s", authURL)
+	}
+
+	code, state, stateToken := authorize(t, service)
+	exchangeCode, redirect, err := service.Callback(ctx, "idp", code, state, stateToken)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if redirect != "/files" {
+		t.Errorf("登录后跳转到 %q", redirect)
+	}
+
+	user, err := service.Exchange(ctx, exchangeCode)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.Role != "user" || !user.EmailVerified {
+		t.Fatalf("自动创建的用户: %+v", user)
+	}
+
+	// 交换码只能使用一次
+	if _, err := service.Exchange(ctx, exchangeCode); !errors.Is(err, sso.ErrInvalidExchangeCode) {
+		t.Fatalf("重复使用交换码: %v", err)
+	}
+	// 授权码同样只能使用一次
+	if _, _, err := service.Callback(ctx, "idp", code, state, stateToken); !errors.Is(err, sso.ErrLoginFailed) {
+		t.Fatalf("重复使用授权码: %v", err)
+	}
+}
+
+func TestRoleSync(t *testing.T) {
+	idp, service := setup(t)
+	ctx := context.Background()
+
+	login := func() (uint, string) {
+		t.Helper()
+		code, state, stateToken := authorize(t, service)
+		exchangeCode, _, err := service.Callback(ctx, "idp", code, state, stateToken)
+		if err != nil {
+			t.Fatalf("Callback: %v", err)
+		}
+		user, err := service.Exchange(ctx, exchangeCode)
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		return user.ID, user.Role
+	}
+
+	firstID, role := login()
+	if role != "user" {
+		t.Fatalf("首次登录的角色为 %q", role)
+	}
+
+	// 再次登录时角色按最新的声明同步，仍是同一个本地用户
+	idp.SetClaims(map[string]interface{}{"sub": "alice-1", "groups": []string{"staff", "ops"}})
+	id, role := login()
+	if id != firstID || role != "admin" {
+		t.Fatalf("再次登录: id=%d role=%q", id, role)
+	}
+
+	// 没有匹配的映射且未配置默认角色时拒绝登录
+	idp.SetClaims(map[string]interface{}{"sub": "alice-1", "groups": []string{"guests"}})
+	code, state, stateToken := authorize(t, service)
+	if _, _, err := service.Callback(ctx, "idp", code, state, stateToken); !errors.Is(err, sso.ErrRoleDenied) {
+		t.Fatalf("未映射的角色: %v", err)
+	}
+}
+
+func TestExchangeRequiresTwoFactor(t *testing.T) {
+	idp, service := setup(t)
+	ctx := context.Background()
+	conf.GetGlobalConfig().User.TwoFactor.RequiredRoles = []string{"admin"}
+	idp.SetClaims(map[string]interface{}{"sub": "alice-1", "email": "alice@example.com", "groups": []string{"ops"}})
+
+	exchange := func(service *sso.Service) error {
+		t.Helper()
+		code, state, stateToken := authorize(t, service)
+		exchangeCode, _, err := service.Callback(ctx, "idp", code, state, stateToken)
+		if err != nil {
+			t.Fatalf("Callback: %v", err)
+		}
+		_, err = service.Exchange(ctx, exchangeCode)
+		return err
+	}
+
+	// 角色要求两步验证时，单点登录与密码登录一样返回挑战
+	err := exchange(service)
+	var challenge *twofactor.ChallengeError
+	if !errors.As(err, &challenge) {
+		t.Fatalf("管理员单点登录未要求两步验证: %v", err)
+	}
+	if challenge.PreAuthToken == "" || challenge.Enrolled {
+		t.Fatalf("两步验证挑战: %+v", challenge)
+	}
+
+	// 显式开启 skip_two_factor 后由身份提供方负责多因素认证
+	cfg := oidcConfig(idp)
+	cfg.SkipTwoFactor = true
+	if err := exchange(sso.NewService(cfg, "")); err != nil {
+		t.Fatalf("跳过本地两步验证: %v", err)
+	}
+}
+
+func TestCallbackRejectsInvalidRequests(t *testing.T) {
+	idp, service := setup(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name    string
+		prepare func(code, state, stateToken string) (string, string, string)
+		claims  map[string]interface{}
+		want    error
+	}{
+		{
+			name: "state 不匹配",
+			prepare: func(code, state, stateToken string) (string, string, string) {
+				return code, "forged", stateToken
+			},
+			want: sso.ErrInvalidState,
+		},
+		{
+			name: "状态令牌属于其他提供方",
+			prepare: func(code, state, stateToken string) (string, string, string) {
+				return code, state, tamperState(t, stateToken, func(c *auth.OIDCStateClaims) { c.Provider = "other" })
+			},
+			want: sso.ErrInvalidState,
+		},
+		{
+			name: "PKCE 校验码不匹配",
+			prepare: func(code, state, stateToken string) (string, string, string) {
+				return code, state, tamperState(t, stateToken, func(c *auth.OIDCStateClaims) { c.Verifier = "wrong-verifier" })
+			},
+			want: sso.ErrLoginFailed,
+		},
+		{
+			name: "nonce 不匹配",
+			prepare: func(code, state, stateToken string) (string, string, string) {
+				return code, state, tamperState(t, stateToken, func(c *auth.OIDCStateClaims) { c.Nonce = "wrong-nonce" })
+			},
+			want: sso.ErrLoginFailed,
+		},
+		{
+			name:   "ID Token 的 aud 不是本应用",
+			claims: map[string]interface{}{"sub": "alice-1", "aud": "another-client"},
+			want:   sso.ErrLoginFailed,
+		},
+		{
+			name:   "ID Token 的 iss 不匹配",
+			claims: map[string]interface{}{"sub": "alice-1", "iss": "https://evil.example"},
+			want:   sso.ErrLoginFailed,
+		},
+		{
+			name:   "ID Token 已过期",
+			claims: map[string]interface{}{"sub": "alice-1", "exp": time.Now().Add(-time.Hour).Unix()},
+			want:   sso.ErrLoginFailed,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.claims != nil {
+				idp.SetClaims(tc.claims)
+			}
+			code, state, stateToken := authorize(t, service)
+			if tc.prepare != nil {
+				code, state, stateToken = tc.prepare(code, state, stateToken)
+			}
+			if _, _, err := service.Callback(ctx, "idp", code, state, stateToken); !errors.Is(err, tc.want) {
+				t.Fatalf("期望 %v，实际 %v", tc.want, err)
+			}
+		})
+	}
+
+	if _, _, err := service.Begin(ctx, "missing", ""); !errors.Is(err, sso.ErrProviderNotFound) {
+		t.Fatalf("未配置的提供方: %v", err)
+	}
+}
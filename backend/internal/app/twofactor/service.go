@@ -0,0 +1,431 @@
+// Package twofactor 两步验证（TOTP）：绑定验证器、校验验证码、恢复码，以及登录时的第二步校验。
+// 用户登录和管理员登录共用同一套流程：密码校验通过后签发短期的预认证令牌，提交验证码后才签发 JWT
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/qrcode"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/counter"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/totp"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCode      = errors.New("验证码错误")
+	ErrAlreadyEnabled   = errors.New("已开启两步验证")
+	ErrNotEnabled       = errors.New("尚未开启两步验证")
+	ErrNotSetup         = errors.New("请先生成两步验证密钥")
+	ErrRequiredByRole   = errors.New("当前角色要求开启两步验证，不能关闭")
+	ErrTooManyAttempts  = errors.New("验证码错误次数过多，请稍后再试")
+	ErrInvalidPreAuth   = errors.New("登录已失效，请重新输入密码")
+	ErrPasswordMismatch = errors.New("密码错误")
+)
+
+const (
+	// preAuthTTL 预认证令牌有效期
+	preAuthTTL = 5 * time.Minute
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// maxFailures 窗口期内允许的验证码错误次数
+	maxFailures   = 5
+	failureWindow = 15 * time.Minute
+	failKeyPrefix = "2fa:fail:"
+)
+
+// ChallengeError 密码校验通过，但还需要完成两步验证
+// Enrolled 为 false 表示角色要求两步验证而用户尚未绑定，需要先用预认证令牌完成绑定
+type ChallengeError struct {
+	PreAuthToken string
+	Enrolled     bool
+	ExpiresIn    int
+}
+
+func (e *ChallengeError) Error() string {
+	return "需要完成两步验证"
+}
+
+// SetupResult 绑定验证器所需的信息
+type SetupResult struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"`
+	QRCode string `json:"qr_code"` // Base64 编码的 PNG 图片
+}
+
+// Status 用户的两步验证状态
+type Status struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// Service 两步验证服务
+type Service struct {
+	userRepo *dao.UserRepository
+	codeRepo *dao.UserRecoveryCodeRepository
+	logRepo  *dao.AdminOperationLogRepository
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// GetService 获取全局两步验证服务
+func GetService() *Service {
+	defaultOnce.Do(func() {
+		defaultService = &Service{
+			userRepo: dao.NewUserRepository(),
+			codeRepo: dao.NewUserRecoveryCodeRepository(),
+			logRepo:  dao.NewAdminOperationLogRepository(),
+		}
+	})
+	return defaultService
+}
+
+// Required 用户角色是否被要求开启两步验证
+func Required(user *model.User) bool {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil {
+		return false
+	}
+	for _, role := range cfg.User.TwoFactor.RequiredRoles {
+		if role == user.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// Challenge 密码校验通过后调用：已开启或角色要求两步验证时返回 *ChallengeError，否则返回 nil
+func (s *Service) Challenge(user *model.User) error {
+	if !user.TOTPEnabled && !Required(user) {
+		return nil
+	}
+	token, err := auth.GeneratePreAuthToken(user.ID, preAuthTTL)
+	if err != nil {
+		return errors.New("生成令牌失败")
+	}
+	return &ChallengeError{
+		PreAuthToken: token,
+		Enrolled:     user.TOTPEnabled,
+		ExpiresIn:    int(preAuthTTL.Seconds()),
+	}
+}
+
+// CompleteLogin 登录第二步：已绑定时校验验证码或恢复码；尚未绑定时用验证码确认绑定，并返回新生成的恢复码
+func (s *Service) CompleteLogin(ctx context.Context, preAuthToken, code string) (*model.User, []string, error) {
+	user, err := s.preAuthUser(ctx, preAuthToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.TOTPEnabled {
+		return user, nil, s.Verify(ctx, user, code)
+	}
+	codes, err := s.Enable(ctx, user.ID, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 重新读取已开启两步验证的用户，调用方可能随后保存用户
+	if user, err = s.userRepo.GetByID(ctx, user.ID); err != nil {
+		return nil, nil, err
+	}
+	return user, codes, nil
+}
+
+// SetupForLogin 角色要求两步验证但尚未绑定时，凭预认证令牌生成密钥
+func (s *Service) SetupForLogin(ctx context.Context, preAuthToken string) (*SetupResult, error) {
+	user, err := s.preAuthUser(ctx, preAuthToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.Setup(ctx, user.ID)
+}
+
+// Setup 生成新的密钥和二维码，密钥在 Enable 确认前不生效
+func (s *Service) Setup(ctx context.Context, userID uint) (*SetupResult, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	url := totp.URL(issuer(), user.Username, secret)
+	qr, err := qrcode.GenerateQRCodeBase64(url, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &SetupResult{Secret: secret, URL: url, QRCode: qr}, nil
+}
+
+// Enable 使用验证器生成的验证码确认绑定，返回恢复码明文（只展示这一次）
+func (s *Service) Enable(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrNotSetup
+	}
+	if err := s.checkAttempts(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		s.recordFailure(ctx, user.ID)
+		return nil, ErrInvalidCode
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	s.clearFailures(ctx, user.ID)
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	s.audit(ctx, "user.2fa_enable", user, &user.ID, user.Username, "", err)
+	return codes, err
+}
+
+// Disable 用户自行关闭两步验证，需要当前密码和验证码（或恢复码）
+func (s *Service) Disable(ctx context.Context, userID uint, password, code, ip string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if !user.TOTPEnabled {
+		return ErrNotEnabled
+	}
+	if Required(user) {
+		return ErrRequiredByRole
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrPasswordMismatch
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+
+	err = s.clear(ctx, user)
+	s.audit(ctx, "user.2fa_disable", user, &user.ID, user.Username, ip, err)
+	return err
+}
+
+// Reset 管理员为用户重置两步验证（例如用户丢失验证器和恢复码），用户下次登录时重新绑定
+func (s *Service) Reset(ctx context.Context, userID, actorID uint, actorName, ip string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+
+	err = s.clear(ctx, user)
+	s.audit(ctx, "user.2fa_reset", user, &actorID, actorName, ip, err)
+	return err
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrNotEnabled
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	s.audit(ctx, "user.2fa_recovery_codes", user, &user.ID, user.Username, "", err)
+	return codes, err
+}
+
+// GetStatus 查询用户的两步验证状态
+func (s *Service) GetStatus(ctx context.Context, userID uint) (*Status, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	status := &Status{Enabled: user.TOTPEnabled, Required: Required(user)}
+	if user.TOTPEnabled {
+		if status.RecoveryCodesRemaining, err = s.codeRepo.CountUnused(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Verify 校验 6 位验证码或恢复码，验证码和恢复码都只能使用一次
+func (s *Service) Verify(ctx context.Context, user *model.User, code string) error {
+	if err := s.checkAttempts(ctx, user.ID); err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	var ok bool
+	if len(code) == totp.Digits {
+		if step, valid := totp.Validate(user.TOTPSecret, code, time.Now()); valid {
+			used, err := s.userRepo.UseTOTPStep(ctx, user.ID, step)
+			if err != nil {
+				return err
+			}
+			if used {
+				// 同步内存中的值，调用方随后保存用户时不会把时间步写回旧值
+				user.TOTPLastStep = step
+			}
+			ok = used
+		}
+	} else {
+		err := s.codeRepo.Use(ctx, user.ID, hashRecoveryCode(code))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ok = err == nil
+	}
+
+	if !ok {
+		s.recordFailure(ctx, user.ID)
+		return ErrInvalidCode
+	}
+	s.clearFailures(ctx, user.ID)
+	return nil
+}
+
+// preAuthUser 解析预认证令牌并重新读取用户，令牌签发后被禁用的用户不能继续登录
+func (s *Service) preAuthUser(ctx context.Context, preAuthToken string) (*model.User, error) {
+	claims, err := auth.ParsePreAuthToken(strings.TrimSpace(preAuthToken))
+	if err != nil {
+		return nil, ErrInvalidPreAuth
+	}
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil || user.Status != "active" {
+		return nil, ErrInvalidPreAuth
+	}
+	return user, nil
+}
+
+// clear 清除密钥和恢复码，关闭两步验证
+func (s *Service) clear(ctx context.Context, user *model.User) error {
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	s.clearFailures(ctx, user.ID)
+	return s.codeRepo.DeleteByUser(ctx, user.ID)
+}
+
+// replaceRecoveryCodes 生成一组新的恢复码，格式为 xxxx-xxxx-xxxx-xxxx
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))
+		code := raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	if err := s.codeRepo.Replace(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkAttempts 错误次数超过上限时拒绝校验，计数存储不可用时放行
+func (s *Service) checkAttempts(ctx context.Context, userID uint) error {
+	failures, _, err := counter.Default().Get(ctx, failKey(userID))
+	if err != nil {
+		logger.Warn("读取验证码错误次数失败", zap.Error(err))
+		return nil
+	}
+	if failures >= maxFailures {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (s *Service) recordFailure(ctx context.Context, userID uint) {
+	if _, _, err := counter.Default().IncrBy(ctx, failKey(userID), 1, failureWindow); err != nil {
+		logger.Warn("记录验证码错误次数失败", zap.Error(err))
+	}
+}
+
+func (s *Service) clearFailures(ctx context.Context, userID uint) {
+	_ = counter.Default().Reset(ctx, failKey(userID))
+}
+
+// audit 写入后台操作日志
+func (s *Service) audit(ctx context.Context, action string, user *model.User, actorID *uint, actorName, ip string, err error) {
+	entry := &model.AdminOperationLog{
+		Action:    action,
+		Target:    fmt.Sprintf("user:%d(%s)", user.ID, user.Username),
+		Success:   err == nil,
+		ActorID:   actorID,
+		ActorName: actorName,
+		IP:        ip,
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	}
+	if logErr := s.logRepo.Create(ctx, entry); logErr != nil {
+		logger.Warn("记录两步验证操作日志失败", zap.Error(logErr))
+	}
+}
+
+func failKey(userID uint) string {
+	return fmt.Sprintf("%s%d", failKeyPrefix, userID)
+}
+
+// hashRecoveryCode 忽略大小写、空格和连字符后计算摘要
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func issuer() string {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.User.TwoFactor.Issuer != "" {
+		return cfg.User.TwoFactor.Issuer
+	}
+	return "FileCodeBox"
+}
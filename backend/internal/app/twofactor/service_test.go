@@ -0,0 +1,196 @@
+package twofactor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/counter"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/totp"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// createUser 创建用户，每个测试的数据库都从 ID 1 开始，因此同时清除进程内共享的错误计数
+func createUser(t *testing.T, role string) *model.User {
+	t.Helper()
+	user := &model.User{Username: "alice", Email: "alice@example.com", Role: role, Status: "active"}
+	if err := db.GetDB().Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	reset := func() { _ = counter.Default().Reset(context.Background(), fmt.Sprintf("2fa:fail:%d", user.ID)) }
+	reset()
+	t.Cleanup(reset)
+	return user
+}
+
+// enroll 生成密钥并用当前时间步的验证码开启两步验证，返回密钥、开启时的时间步和恢复码
+func enroll(t *testing.T, userID uint) (string, int64, []string) {
+	t.Helper()
+	ctx := context.Background()
+	svc := twofactor.GetService()
+
+	setup, err := svc.Setup(ctx, userID)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(setup.Secret, step)
+	codes, err := svc.Enable(ctx, userID, code)
+	if err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	return setup.Secret, step, codes
+}
+
+func reload(t *testing.T, id uint) *model.User {
+	t.Helper()
+	var user model.User
+	if err := db.GetDB().First(&user, id).Error; err != nil {
+		t.Fatalf("读取用户失败: %v", err)
+	}
+	return &user
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := twofactor.GetService()
+	user := createUser(t, "user")
+
+	_, _, codes := enroll(t, user.ID)
+	if len(codes) != 10 {
+		t.Fatalf("生成了 %d 个恢复码", len(codes))
+	}
+
+	if err := svc.Verify(ctx, reload(t, user.ID), codes[0]); err != nil {
+		t.Fatalf("恢复码没有通过校验: %v", err)
+	}
+	if err := svc.Verify(ctx, reload(t, user.ID), codes[0]); !errors.Is(err, twofactor.ErrInvalidCode) {
+		t.Fatalf("恢复码重复使用返回 %v", err)
+	}
+	// 忽略大小写和连字符
+	normalized := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err := svc.Verify(ctx, reload(t, user.ID), normalized); err != nil {
+		t.Fatalf("去掉连字符的恢复码没有通过校验: %v", err)
+	}
+
+	status, err := svc.GetStatus(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if !status.Enabled || status.RecoveryCodesRemaining != 8 {
+		t.Fatalf("状态为 %+v", status)
+	}
+}
+
+func TestTOTPCodeReplay(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := twofactor.GetService()
+	user := createUser(t, "user")
+
+	secret, step, _ := enroll(t, user.ID)
+
+	// 开启时使用过的验证码不能再用于登录
+	used, _ := totp.Code(secret, step)
+	if err := svc.Verify(ctx, reload(t, user.ID), used); !errors.Is(err, twofactor.ErrInvalidCode) {
+		t.Fatalf("重放开启时的验证码返回 %v", err)
+	}
+
+	next, _ := totp.Code(secret, step+1)
+	if err := svc.Verify(ctx, reload(t, user.ID), next); err != nil {
+		t.Fatalf("下一个时间步的验证码没有通过校验: %v", err)
+	}
+	if err := svc.Verify(ctx, reload(t, user.ID), next); !errors.Is(err, twofactor.ErrInvalidCode) {
+		t.Fatalf("重放验证码返回 %v", err)
+	}
+	if got := reload(t, user.ID).TOTPLastStep; got != step+1 {
+		t.Fatalf("最近使用的时间步为 %d，期望 %d", got, step+1)
+	}
+}
+
+func TestCompleteLoginEnrolsRequiredRole(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.User.TwoFactor.RequiredRoles = []string{"admin"}
+	ctx := context.Background()
+	svc := twofactor.GetService()
+	user := createUser(t, "admin")
+
+	var challenge *twofactor.ChallengeError
+	if err := svc.Challenge(user); !errors.As(err, &challenge) {
+		t.Fatalf("要求两步验证的角色登录返回 %v", err)
+	}
+	if challenge.Enrolled {
+		t.Fatal("尚未绑定的用户被标记为已绑定")
+	}
+
+	if _, _, err := svc.CompleteLogin(ctx, "invalid", "000000"); !errors.Is(err, twofactor.ErrInvalidPreAuth) {
+		t.Fatalf("无效的预认证令牌返回 %v", err)
+	}
+	if _, _, err := svc.CompleteLogin(ctx, challenge.PreAuthToken, "000000"); !errors.Is(err, twofactor.ErrNotSetup) {
+		t.Fatalf("未生成密钥时返回 %v", err)
+	}
+
+	setup, err := svc.SetupForLogin(ctx, challenge.PreAuthToken)
+	if err != nil {
+		t.Fatalf("SetupForLogin: %v", err)
+	}
+	code, _ := totp.Code(setup.Secret, totp.Step(time.Now()))
+	logged, codes, err := svc.CompleteLogin(ctx, challenge.PreAuthToken, code)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if !logged.TOTPEnabled || len(codes) != 10 {
+		t.Fatalf("绑定后 enabled=%v，恢复码 %d 个", logged.TOTPEnabled, len(codes))
+	}
+
+	// 绑定后再次登录走校验流程，不再返回恢复码
+	if err := svc.Challenge(logged); !errors.As(err, &challenge) || !challenge.Enrolled {
+		t.Fatalf("绑定后登录返回 %v", err)
+	}
+	logged, again, err := svc.CompleteLogin(ctx, challenge.PreAuthToken, codes[0])
+	if err != nil || logged.ID != user.ID || again != nil {
+		t.Fatalf("恢复码登录: user=%v codes=%v err=%v", logged, again, err)
+	}
+
+	// 签发令牌后被禁用的用户不能完成登录
+	if err := db.GetDB().Model(&model.User{}).Where("id = ?", user.ID).Update("status", "disabled").Error; err != nil {
+		t.Fatalf("禁用用户失败: %v", err)
+	}
+	if _, _, err := svc.CompleteLogin(ctx, challenge.PreAuthToken, codes[1]); !errors.Is(err, twofactor.ErrInvalidPreAuth) {
+		t.Fatalf("禁用用户完成登录返回 %v", err)
+	}
+}
+
+func TestFailureLockout(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := twofactor.GetService()
+	user := createUser(t, "user")
+
+	secret, step, codes := enroll(t, user.ID)
+
+	for i := 0; i < 5; i++ {
+		if err := svc.Verify(ctx, reload(t, user.ID), "000000"); !errors.Is(err, twofactor.ErrInvalidCode) {
+			t.Fatalf("第 %d 次错误返回 %v", i+1, err)
+		}
+	}
+	// 达到上限后正确的验证码和恢复码也被拒绝，且不消耗恢复码
+	valid, _ := totp.Code(secret, step+1)
+	if err := svc.Verify(ctx, reload(t, user.ID), valid); !errors.Is(err, twofactor.ErrTooManyAttempts) {
+		t.Fatalf("锁定后提交正确验证码返回 %v", err)
+	}
+	if err := svc.Verify(ctx, reload(t, user.ID), codes[0]); !errors.Is(err, twofactor.ErrTooManyAttempts) {
+		t.Fatalf("锁定后提交恢复码返回 %v", err)
+	}
+	status, _ := svc.GetStatus(ctx, user.ID)
+	if status.RecoveryCodesRemaining != 10 {
+		t.Fatalf("锁定期间消耗了恢复码，剩余 %d 个", status.RecoveryCodesRemaining)
+	}
+}
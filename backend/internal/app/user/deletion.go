@@ -0,0 +1,362 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/share"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDeletionPending    = errors.New("账号已在等待删除")
+	ErrDeletionNotPending = errors.New("账号没有待处理的删除申请")
+	ErrDeleteLastAdmin    = errors.New("不能删除唯一的管理员账号")
+	ErrTransferTarget     = errors.New("接收分享的用户不存在或不可用")
+	ErrDeletionPassword   = errors.New("请输入当前密码确认删除")
+)
+
+// defaultDeletionGraceDays 未配置时注销账号的宽限期（天）
+const defaultDeletionGraceDays = 7
+
+// purgeBatchSize 每轮最多清除的账号数，剩余的留给下一轮
+const purgeBatchSize = 100
+
+// DeletionReq 申请删除账号的参数
+type DeletionReq struct {
+	TransferTo *uint // 分享转移给该用户，为空时随账号一起删除
+	ActorID    *uint
+	ActorName  string
+	IP         string
+}
+
+// DeletionGracePeriod 申请删除到清除数据之间的宽限期
+func DeletionGracePeriod() time.Duration {
+	days := defaultDeletionGraceDays
+	if cfg := conf.GetGlobalConfig(); cfg != nil {
+		days = cfg.User.DeletionGraceDays
+	}
+	if days < 0 {
+		days = 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// VerifyDeletion 用户自助删除账号前确认身份：有密码（本地或 LDAP）的账号必须提供密码，开启两步验证时还需要验证码
+// 只通过单点登录使用的账号没有密码，只校验两步验证
+func (s *Service) VerifyDeletion(ctx context.Context, userID uint, password, code string) error {
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+
+	if password != "" {
+		authed, err := s.Authenticate(ctx, user.Username, password, false)
+		if err != nil || authed.ID != user.ID {
+			return ErrInvalidCredentials
+		}
+	} else if user.PasswordHash != "" || s.hasLDAPIdentity(ctx, user.ID) {
+		return ErrDeletionPassword
+	}
+
+	if user.TOTPEnabled {
+		return twofactor.GetService().Verify(ctx, user, code)
+	}
+	return nil
+}
+
+func (s *Service) hasLDAPIdentity(ctx context.Context, userID uint) bool {
+	identities, err := dao.NewUserIdentityRepository().ListByUser(ctx, userID)
+	if err != nil {
+		return false
+	}
+	for _, identity := range identities {
+		if identity.Provider == ProviderLDAP {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduleDeletion 申请删除账号：账号立即停用，注销全部会话并撤销全部 API Key 和邀请码，
+// 宽限期结束后由 AccountPurger 清除数据，期间可以通过 CancelDeletion 撤销
+func (s *Service) ScheduleDeletion(ctx context.Context, userID uint, req DeletionReq) (*model.User, error) {
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+	if user.Status == model.UserStatusPendingDeletion {
+		return nil, ErrDeletionPending
+	}
+	if req.TransferTo != nil {
+		if err := s.checkTransferTarget(ctx, userID, *req.TransferTo); err != nil {
+			return nil, err
+		}
+	}
+	if user.Role == "admin" {
+		admins, err := s.repo.CountAdminUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, ErrDeleteLastAdmin
+		}
+	}
+
+	now := time.Now()
+	scheduled := now.Add(DeletionGracePeriod())
+	user.StatusBeforeDeletion = user.Status
+	user.Status = model.UserStatusPendingDeletion
+	user.DeletionRequestedAt = &now
+	user.DeletionScheduledAt = &scheduled
+	user.DeletionTransferTo = req.TransferTo
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if _, err := session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonAccountDeleted); err != nil {
+		logger.Warn("注销待删除账号的会话失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+	if _, err := s.apiKeyRepo.RevokeAllByUser(ctx, user.ID); err != nil {
+		logger.Warn("撤销待删除账号的 API Key 失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+	if err := s.invitationRepo.RevokeAllByCreator(ctx, user.ID); err != nil {
+		logger.Warn("撤销待删除账号的邀请码失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+
+	message := fmt.Sprintf("计划于 %s 清除数据，分享随账号删除", scheduled.Format(time.RFC3339))
+	if req.TransferTo != nil {
+		message = fmt.Sprintf("计划于 %s 清除数据，分享转移给用户 %d", scheduled.Format(time.RFC3339), *req.TransferTo)
+	}
+	writeAccountLog(ctx, &model.AdminOperationLog{
+		Action:    "user.delete_requested",
+		Target:    fmt.Sprintf("user:%d(%s)", user.ID, user.Username),
+		Success:   true,
+		Message:   message,
+		ActorID:   req.ActorID,
+		ActorName: req.ActorName,
+		IP:        req.IP,
+	})
+	return user, nil
+}
+
+// CancelDeletion 在宽限期内撤销删除申请，账号恢复为申请前的状态；已撤销的 API Key 不会恢复
+func (s *Service) CancelDeletion(ctx context.Context, userID uint, req DeletionReq) (*model.User, error) {
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.Status != model.UserStatusPendingDeletion {
+		return nil, ErrDeletionNotPending
+	}
+
+	user.Status = user.StatusBeforeDeletion
+	if user.Status == "" {
+		user.Status = "active"
+	}
+	user.StatusBeforeDeletion = ""
+	user.DeletionRequestedAt = nil
+	user.DeletionScheduledAt = nil
+	user.DeletionTransferTo = nil
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	writeAccountLog(ctx, &model.AdminOperationLog{
+		Action:    "user.delete_cancelled",
+		Target:    fmt.Sprintf("user:%d(%s)", user.ID, user.Username),
+		Success:   true,
+		ActorID:   req.ActorID,
+		ActorName: req.ActorName,
+		IP:        req.IP,
+	})
+	return user, nil
+}
+
+// checkTransferTarget 接收分享的用户必须存在、处于启用状态且不是被删除的用户本人
+func (s *Service) checkTransferTarget(ctx context.Context, userID, targetID uint) error {
+	if targetID == userID {
+		return ErrTransferTarget
+	}
+	target, err := s.repo.GetByID(ctx, targetID)
+	if err != nil || target.Status != "active" {
+		return ErrTransferTarget
+	}
+	return nil
+}
+
+// PurgeResult 清除一个账号的结果
+type PurgeResult struct {
+	UserID        uint  `json:"user_id"`
+	Shares        int   `json:"shares"`         // 删除或转移的分享数
+	Bytes         int64 `json:"bytes"`          // 释放或转移的字节数
+	TransferredTo *uint `json:"transferred_to"` // 分享转移给的用户，为空表示已删除
+	TransferLogs  int64 `json:"transfer_logs"`  // 匿名化的传输记录数
+}
+
+// PurgeSummary 一轮清除任务的结果
+type PurgeSummary struct {
+	Purged int `json:"purged"`
+	Failed int `json:"failed"`
+}
+
+// AccountPurger 清除宽限期已结束的账号：删除或转移分享（文件通过存储驱动删除）、匿名化传输记录，
+// 删除会话、API Key、令牌、外部身份绑定和恢复码，最后删除用户记录并写入后台操作日志
+type AccountPurger struct {
+	service  *Service
+	shares   *share.Service
+	interval time.Duration
+}
+
+// NewAccountPurger 创建清除任务，store 为分享文件所在的存储
+func NewAccountPurger(store storage.StorageInterface, interval time.Duration) *AccountPurger {
+	service := NewService()
+	shares := share.NewService("", store)
+	shares.SetUserService(service)
+	return &AccountPurger{
+		service:  service,
+		shares:   shares,
+		interval: interval,
+	}
+}
+
+// Start 在后台按间隔执行清除，ctx 取消后退出
+func (p *AccountPurger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := p.RunOnce(ctx, "scheduler"); err != nil {
+					logger.Error("清除待删除账号失败", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce 清除一批宽限期已结束的账号，每个账号单独写入后台操作日志
+func (p *AccountPurger) RunOnce(ctx context.Context, actor string) (*PurgeSummary, error) {
+	p.service.ensureRepository()
+	users, err := p.service.repo.ListDeletionDue(ctx, time.Now(), purgeBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &PurgeSummary{}
+	for _, user := range users {
+		if _, err := p.Purge(ctx, user.ID, actor); err != nil {
+			logger.Warn("清除账号失败", zap.Uint("user_id", user.ID), zap.Error(err))
+			summary.Failed++
+			continue
+		}
+		summary.Purged++
+	}
+	return summary, nil
+}
+
+// Purge 立即清除一个待删除的账号，不论宽限期是否结束
+func (p *AccountPurger) Purge(ctx context.Context, userID uint, actor string) (*PurgeResult, error) {
+	start := time.Now()
+	result, err := p.purge(ctx, userID)
+	if err != nil && result == nil {
+		return nil, err
+	}
+
+	entry := &model.AdminOperationLog{
+		Action:    "user.delete",
+		Target:    fmt.Sprintf("user:%d", userID),
+		Success:   err == nil,
+		ActorName: actor,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	switch {
+	case err != nil:
+		entry.Message = err.Error()
+	case result.TransferredTo != nil:
+		entry.Message = fmt.Sprintf("转移 %d 个分享（%d 字节）给用户 %d，匿名化 %d 条传输记录", result.Shares, result.Bytes, *result.TransferredTo, result.TransferLogs)
+	default:
+		entry.Message = fmt.Sprintf("删除 %d 个分享，释放 %d 字节，匿名化 %d 条传输记录", result.Shares, result.Bytes, result.TransferLogs)
+	}
+	writeAccountLog(ctx, entry)
+	return result, err
+}
+
+func (p *AccountPurger) purge(ctx context.Context, userID uint) (*PurgeResult, error) {
+	s := p.service
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.Status != model.UserStatusPendingDeletion {
+		return nil, ErrDeletionNotPending
+	}
+
+	result := &PurgeResult{UserID: user.ID}
+
+	// 接收方在宽限期内被停用或删除时不清除，避免把本应保留的分享删掉
+	if user.DeletionTransferTo != nil {
+		if err := s.checkTransferTarget(ctx, user.ID, *user.DeletionTransferTo); err != nil {
+			return result, err
+		}
+		result.TransferredTo = user.DeletionTransferTo
+		result.Shares, result.Bytes, err = p.shares.TransferAllByUser(ctx, user.ID, *user.DeletionTransferTo)
+	} else {
+		result.Shares, result.Bytes, err = p.shares.DeleteAllByUser(ctx, user.ID)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if result.TransferLogs, err = s.transferLogRepo.AnonymizeUser(ctx, user.ID); err != nil {
+		return result, err
+	}
+
+	if _, err := session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonAccountDeleted); err != nil {
+		return result, err
+	}
+	cleanups := []func(context.Context, uint) error{
+		dao.NewUserSessionRepository().DeleteByUser,
+		s.apiKeyRepo.DeleteByUser,
+		s.tokenRepo.DeleteByUser,
+		dao.NewUserIdentityRepository().DeleteByUser,
+		dao.NewUserRecoveryCodeRepository().DeleteByUser,
+	}
+	for _, cleanup := range cleanups {
+		if err := cleanup(ctx, user.ID); err != nil {
+			return result, err
+		}
+	}
+
+	if err := s.repo.HardDelete(ctx, user.ID); err != nil {
+		return result, err
+	}
+	logger.Info("已清除账号", zap.Uint("user_id", user.ID), zap.Int("shares", result.Shares))
+	return result, nil
+}
+
+func writeAccountLog(ctx context.Context, entry *model.AdminOperationLog) {
+	if err := dao.NewAdminOperationLogRepository().Create(ctx, entry); err != nil {
+		logger.Warn("记录账号删除日志失败", zap.Error(err))
+	}
+}
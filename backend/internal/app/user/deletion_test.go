@@ -0,0 +1,295 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"github.com/zy84338719/fileCodeBox/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+func newAccount(t *testing.T, name, role string) *model.User {
+	t.Helper()
+	account := &model.User{Username: name, Email: name + "@example.com", Role: role, Status: "active"}
+	if err := db.GetDB().Create(account).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return account
+}
+
+// deletionEnv 数据库、宽限期为 3 天的配置，以及分享文件所在的本地存储目录
+func deletionEnv(t *testing.T) (*user.Service, string) {
+	t.Helper()
+	cfg := testenv.Setup(t)
+	cfg.User.DeletionGraceDays = 3
+	return user.NewService(), t.TempDir()
+}
+
+// createShare 创建分享，filePath 不为空时同时在存储目录写入文件
+func createShare(t *testing.T, dataDir, code, filePath string, owner *model.User, size int64) *model.FileCode {
+	t.Helper()
+	share := &model.FileCode{Code: code, FilePath: filePath, Size: size, UploadType: "authenticated", UserID: &owner.ID}
+	if filePath == "" {
+		share.Text = "hello"
+	} else {
+		full := filepath.Join(dataDir, filePath)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dao.NewFileCodeRepository().Create(context.Background(), share); err != nil {
+		t.Fatalf("创建分享失败: %v", err)
+	}
+	return share
+}
+
+func fileExists(dataDir, filePath string) bool {
+	_, err := os.Stat(filepath.Join(dataDir, filePath))
+	return err == nil
+}
+
+func newPurger(dataDir string) *user.AccountPurger {
+	store := storage.NewStorageService(&storage.StorageConfig{Type: storage.StorageTypeLocal, DataPath: dataDir})
+	return user.NewAccountPurger(store, time.Hour)
+}
+
+func countLogs(t *testing.T, action string) int64 {
+	t.Helper()
+	var n int64
+	if err := db.GetDB().Model(&model.AdminOperationLog{}).Where("action = ?", action).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestScheduleAndCancelDeletion(t *testing.T) {
+	svc, _ := deletionEnv(t)
+	ctx := context.Background()
+	alice := newAccount(t, "alice", "user")
+
+	tokens, err := session.GetService().Create(ctx, alice, session.Client{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	key, err := svc.CreateAPIKey(ctx, alice.ID, &user.CreateAPIKeyReq{Name: "ci", Scopes: []string{model.APIKeyScopeShareCreate}})
+	if err != nil {
+		t.Fatalf("创建 API Key 失败: %v", err)
+	}
+
+	before := time.Now()
+	scheduled, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{ActorName: "alice"})
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if scheduled.Status != model.UserStatusPendingDeletion || scheduled.DeletionScheduledAt == nil {
+		t.Fatalf("申请后状态为 %q", scheduled.Status)
+	}
+	if due := scheduled.DeletionScheduledAt.Sub(before); due < 72*time.Hour || due > 72*time.Hour+time.Minute {
+		t.Fatalf("清除时间距现在 %v，期望 3 天", due)
+	}
+
+	if sess, err := dao.NewUserSessionRepository().GetBySessionID(ctx, tokens.SessionID); err != nil || sess.RevokeReason != session.ReasonAccountDeleted {
+		t.Fatalf("会话未被注销: %+v %v", sess, err)
+	}
+	if apiKey, err := dao.NewUserAPIKeyRepository().GetByID(ctx, key.APIKey.ID); err != nil || !apiKey.Revoked {
+		t.Fatalf("API Key 未被撤销: %+v %v", apiKey, err)
+	}
+
+	if _, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{}); !errors.Is(err, user.ErrDeletionPending) {
+		t.Fatalf("重复申请返回 %v", err)
+	}
+
+	restored, err := svc.CancelDeletion(ctx, alice.ID, user.DeletionReq{ActorName: "alice"})
+	if err != nil {
+		t.Fatalf("CancelDeletion: %v", err)
+	}
+	if restored.Status != "active" || restored.DeletionScheduledAt != nil || restored.DeletionRequestedAt != nil {
+		t.Fatalf("撤销后状态为 %+v", restored)
+	}
+	if _, err := svc.CancelDeletion(ctx, alice.ID, user.DeletionReq{}); !errors.Is(err, user.ErrDeletionNotPending) {
+		t.Fatalf("重复撤销返回 %v", err)
+	}
+	// 撤销删除后停用前的状态原样恢复
+	if err := db.GetDB().Model(alice).Update("status", "disabled").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{}); err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if restored, err = svc.CancelDeletion(ctx, alice.ID, user.DeletionReq{}); err != nil || restored.Status != "disabled" {
+		t.Fatalf("撤销后状态为 %q: %v", restored.Status, err)
+	}
+
+	if countLogs(t, "user.delete_requested") != 2 || countLogs(t, "user.delete_cancelled") != 2 {
+		t.Fatal("没有记录删除申请和撤销日志")
+	}
+}
+
+func TestScheduleDeletionGuards(t *testing.T) {
+	svc, _ := deletionEnv(t)
+	ctx := context.Background()
+	root := newAccount(t, "root", "admin")
+	alice := newAccount(t, "alice", "user")
+	disabled := newAccount(t, "carol", "user")
+	if err := db.GetDB().Model(disabled).Update("status", "disabled").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.ScheduleDeletion(ctx, root.ID, user.DeletionReq{}); !errors.Is(err, user.ErrDeleteLastAdmin) {
+		t.Fatalf("删除唯一的管理员返回 %v", err)
+	}
+
+	missing := uint(9999)
+	for name, target := range map[string]*uint{"本人": &alice.ID, "不存在": &missing, "已停用": &disabled.ID} {
+		if _, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{TransferTo: target}); !errors.Is(err, user.ErrTransferTarget) {
+			t.Errorf("转移给%s的用户返回 %v", name, err)
+		}
+	}
+	if reload(t, alice.ID).Status != "active" {
+		t.Fatal("校验失败后账号仍被停用")
+	}
+
+	// 还有其他管理员时可以删除
+	newAccount(t, "root2", "admin")
+	if _, err := svc.ScheduleDeletion(ctx, root.ID, user.DeletionReq{TransferTo: &alice.ID}); err != nil {
+		t.Fatalf("存在其他管理员时返回 %v", err)
+	}
+}
+
+func TestPurgeDeletesSharesAndAnonymizesLogs(t *testing.T) {
+	svc, dataDir := deletionEnv(t)
+	ctx := context.Background()
+	alice := newAccount(t, "alice", "user")
+	bob := newAccount(t, "bob", "user")
+
+	createShare(t, dataDir, "own", "files/own.bin", alice, 10)
+	createShare(t, dataDir, "text", "", alice, 5)
+	// 秒传产生的分享与 bob 的分享共用同一份文件
+	createShare(t, dataDir, "dup", "files/shared.bin", alice, 20)
+	createShare(t, dataDir, "bobs", "files/shared.bin", bob, 20)
+
+	logs := []*model.TransferLog{
+		{Operation: "upload", FileCode: "own", UserID: &alice.ID, Username: "alice", IP: "192.0.2.1", UserAgent: "curl"},
+		{Operation: "download", FileCode: "bobs", UserID: &bob.ID, Username: "bob", IP: "192.0.2.2"},
+	}
+	for _, entry := range logs {
+		if err := db.GetDB().Create(entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purger := newPurger(dataDir)
+	if _, err := purger.Purge(ctx, alice.ID, "admin"); !errors.Is(err, user.ErrDeletionNotPending) {
+		t.Fatalf("清除未申请删除的账号返回 %v", err)
+	}
+
+	if _, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{}); err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	// 宽限期未结束，定时任务不会清除
+	if summary, err := purger.RunOnce(ctx, "scheduler"); err != nil || summary.Purged != 0 {
+		t.Fatalf("宽限期内 RunOnce: %+v %v", summary, err)
+	}
+
+	result, err := purger.Purge(ctx, alice.ID, "admin")
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Shares != 3 || result.Bytes != 35 || result.TransferredTo != nil || result.TransferLogs != 1 {
+		t.Fatalf("清除结果: %+v", result)
+	}
+
+	if fileExists(dataDir, "files/own.bin") {
+		t.Fatal("只属于该用户的文件没有删除")
+	}
+	if !fileExists(dataDir, "files/shared.bin") {
+		t.Fatal("其他分享仍在引用的文件被删除")
+	}
+	var remaining int64
+	db.GetDB().Unscoped().Model(&model.FileCode{}).Where("user_id = ?", alice.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("仍有 %d 个分享属于已删除的用户", remaining)
+	}
+
+	var anonymized model.TransferLog
+	db.GetDB().First(&anonymized, logs[0].ID)
+	if anonymized.UserID != nil || anonymized.Username != "" || anonymized.IP != "" || anonymized.UserAgent != "" || anonymized.FileCode != "own" {
+		t.Fatalf("传输记录没有匿名化: %+v", anonymized)
+	}
+	var untouched model.TransferLog
+	db.GetDB().First(&untouched, logs[1].ID)
+	if untouched.Username != "bob" || untouched.IP != "192.0.2.2" {
+		t.Fatalf("其他用户的传输记录被修改: %+v", untouched)
+	}
+
+	if err := db.GetDB().Unscoped().First(&model.User{}, alice.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("用户记录没有删除: %v", err)
+	}
+	if countLogs(t, "user.delete") != 1 {
+		t.Fatal("没有记录清除日志")
+	}
+}
+
+func TestPurgeTransfersShares(t *testing.T) {
+	svc, dataDir := deletionEnv(t)
+	ctx := context.Background()
+	alice := newAccount(t, "alice", "user")
+	bob := newAccount(t, "bob", "user")
+	share := createShare(t, dataDir, "moved", "files/moved.bin", alice, 10)
+
+	if _, err := svc.ScheduleDeletion(ctx, alice.ID, user.DeletionReq{TransferTo: &bob.ID}); err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	purger := newPurger(dataDir)
+
+	// 接收方在宽限期内被停用时不清除
+	if err := db.GetDB().Model(bob).Update("status", "disabled").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := purger.Purge(ctx, alice.ID, "admin"); !errors.Is(err, user.ErrTransferTarget) {
+		t.Fatalf("接收方已停用时返回 %v", err)
+	}
+	if reload(t, alice.ID).Status != model.UserStatusPendingDeletion {
+		t.Fatal("清除失败后账号状态被修改")
+	}
+	if err := db.GetDB().Model(bob).Update("status", "active").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 宽限期结束后由定时任务清除
+	past := time.Now().Add(-time.Minute)
+	if err := db.GetDB().Model(alice).Update("deletion_scheduled_at", &past).Error; err != nil {
+		t.Fatal(err)
+	}
+	summary, err := purger.RunOnce(ctx, "scheduler")
+	if err != nil || summary.Purged != 1 || summary.Failed != 0 {
+		t.Fatalf("RunOnce: %+v %v", summary, err)
+	}
+
+	var moved model.FileCode
+	if err := db.GetDB().First(&moved, share.ID).Error; err != nil {
+		t.Fatalf("分享被删除: %v", err)
+	}
+	if moved.UserID == nil || *moved.UserID != bob.ID {
+		t.Fatalf("分享属于用户 %v", moved.UserID)
+	}
+	if !fileExists(dataDir, "files/moved.bin") {
+		t.Fatal("转移的分享文件被删除")
+	}
+	if got := reload(t, bob.ID).TotalStorage; got != 10 {
+		t.Fatalf("接收方存储用量为 %d", got)
+	}
+}
@@ -0,0 +1,264 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/mailer"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailNotVerified     = errors.New("邮箱尚未验证，请先完成邮箱验证")
+	ErrEmailAlreadyVerified = errors.New("邮箱已验证")
+	ErrInvalidEmailToken    = errors.New("链接无效或已过期")
+	ErrTooManyEmails        = errors.New("邮件发送过于频繁，请稍后再试")
+	ErrPasswordTooShort     = fmt.Errorf("密码长度至少%d个字符", minPasswordLength)
+)
+
+const (
+	// emailsPerHour 每个用户每种用途每小时最多发送的邮件数
+	emailsPerHour = 5
+	// minPasswordLength 重置密码时的最短长度，与初始化管理员时的要求一致
+	minPasswordLength = 6
+)
+
+// SendVerificationEmail 向当前用户的邮箱发送验证链接，之前未使用的验证链接同时作废
+func (s *Service) SendVerificationEmail(ctx context.Context, userID uint) error {
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// ResendVerificationEmail 未登录时按邮箱重新发送验证链接
+// 邮箱不存在或已验证时同样返回成功，避免泄露邮箱是否注册
+func (s *Service) ResendVerificationEmail(ctx context.Context, email string) error {
+	s.ensureRepository()
+	user, err := s.repo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+	if err := s.sendVerification(ctx, user); err != nil && !errors.Is(err, ErrTooManyEmails) {
+		return err
+	}
+	return nil
+}
+
+// VerifyEmail 使用邮件中的令牌完成邮箱验证
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	s.ensureRepository()
+	record, err := s.consumeToken(ctx, model.TokenPurposeEmailVerify, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.GetByID(ctx, record.UserID)
+	if err != nil || user.Email != record.Email {
+		// 签发后邮箱被修改，旧邮箱的验证链接不再有效
+		return ErrInvalidEmailToken
+	}
+	user.EmailVerified = true
+	return s.repo.Update(ctx, user)
+}
+
+// RequestPasswordReset 向邮箱发送重置密码链接
+// 邮箱不存在时同样返回成功，避免泄露邮箱是否注册
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	s.ensureRepository()
+	user, err := s.repo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil || user.Status != "active" {
+		return nil
+	}
+
+	token, err := s.issueToken(ctx, user, model.TokenPurposePasswordReset, resetTokenTTL())
+	if errors.Is(err, ErrTooManyEmails) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := linkURL("/#/user/reset-password", token)
+	return s.sendMail(ctx, user.Email, "重置密码", fmt.Sprintf(
+		"%s，你好：\n\n我们收到了重置密码的请求，请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件，你的密码不会被修改。\n",
+		user.Username, int(resetTokenTTL().Minutes()), link,
+	))
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码
+// 能收到邮件即证明拥有该邮箱，重置成功后同时标记邮箱已验证，并注销该用户的全部会话
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	s.ensureRepository()
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	record, err := s.consumeToken(ctx, model.TokenPurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.GetByID(ctx, record.UserID)
+	if err != nil || user.Email != record.Email {
+		return ErrInvalidEmailToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hashedPassword)
+	user.EmailVerified = true
+	if err := s.repo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// 同一用户其余未使用的重置链接一并作废
+	if err := s.tokenRepo.InvalidateByUser(ctx, user.ID, model.TokenPurposePasswordReset, ""); err != nil {
+		return err
+	}
+	_, err = session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonPasswordReset)
+	return err
+}
+
+// emailVerificationRequired 登录时是否需要已验证的邮箱，管理员不受限制，避免开启后无法登录后台
+func emailVerificationRequired(user *model.User) bool {
+	cfg := conf.GetGlobalConfig()
+	return cfg != nil && cfg.User.RequireEmailVerify && !user.EmailVerified && user.Role != "admin"
+}
+
+func (s *Service) sendVerification(ctx context.Context, user *model.User) error {
+	token, err := s.issueToken(ctx, user, model.TokenPurposeEmailVerify, verifyTokenTTL())
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.InvalidateByUser(ctx, user.ID, model.TokenPurposeEmailVerify, hashToken(token)); err != nil {
+		return err
+	}
+
+	link := linkURL("/#/user/verify-email", token)
+	return s.sendMail(ctx, user.Email, "验证你的邮箱", fmt.Sprintf(
+		"%s，你好：\n\n请在 %d 分钟内打开以下链接完成邮箱验证：\n\n%s\n\n如果你没有注册过账号，请忽略这封邮件。\n",
+		user.Username, int(verifyTokenTTL().Minutes()), link,
+	))
+}
+
+// issueToken 签发一次性令牌：明文为 随机数.签名，数据库只保存整个令牌的 SHA-256 摘要
+func (s *Service) issueToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration) (string, error) {
+	count, err := s.tokenRepo.CountRecent(ctx, user.ID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return "", err
+	}
+	if count >= emailsPerHour {
+		return "", ErrTooManyEmails
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+	token := nonce + "." + tokenSignature(purpose, nonce)
+
+	record := &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return "", err
+	}
+	// 顺带清理过期令牌，令牌表只在发送邮件时增长；多保留一小时供发送频率统计使用
+	if _, err := s.tokenRepo.DeleteExpired(ctx, time.Now().Add(-time.Hour)); err != nil {
+		logger.Warn("清理过期令牌失败", zap.Error(err))
+	}
+	return token, nil
+}
+
+// consumeToken 校验签名后查找令牌并标记为已使用，并发使用同一令牌时只有一个请求成功
+func (s *Service) consumeToken(ctx context.Context, purpose, token string) (*model.UserToken, error) {
+	nonce, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(sig), []byte(tokenSignature(purpose, nonce))) != 1 {
+		return nil, ErrInvalidEmailToken
+	}
+
+	record, err := s.tokenRepo.GetValidByHash(ctx, purpose, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidEmailToken
+		}
+		return nil, err
+	}
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidEmailToken
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *Service) sendMail(ctx context.Context, to, subject, body string) error {
+	if err := mailer.Default().Send(ctx, &mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+		logger.Error("发送邮件失败", zap.String("to", to), zap.String("subject", subject), zap.Error(err))
+		return errors.New("发送邮件失败，请稍后再试")
+	}
+	return nil
+}
+
+// tokenSignature 令牌签名绑定用途，验证链接不能用于重置密码
+func tokenSignature(purpose, nonce string) string {
+	return base64.RawURLEncoding.EncodeToString(auth.Sign(purpose + "." + nonce)[:16])
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func linkURL(path, token string) string {
+	return siteURL() + path + "?token=" + token
+}
+
+// siteURL 邮件和邀请链接使用的站点地址
+func siteURL() string {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Mail.BaseURL != "" {
+		return strings.TrimRight(cfg.Mail.BaseURL, "/")
+	}
+	return "http://localhost:12345"
+}
+
+func verifyTokenTTL() time.Duration {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Mail.VerifyTokenTTLMinutes > 0 {
+		return time.Duration(cfg.Mail.VerifyTokenTTLMinutes) * time.Minute
+	}
+	return 24 * time.Hour
+}
+
+func resetTokenTTL() time.Duration {
+	if cfg := conf.GetGlobalConfig(); cfg != nil && cfg.Mail.ResetTokenTTLMinutes > 0 {
+		return time.Duration(cfg.Mail.ResetTokenTTLMinutes) * time.Minute
+	}
+	return 30 * time.Minute
+}
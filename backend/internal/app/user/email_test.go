@@ -0,0 +1,222 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/mailer"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/mailer/mailertest"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const siteURL = "https://box.example"
+
+var tokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_.-]+)`)
+
+// newMailEnv 准备数据库、进程内 SMTP 服务器和一个邮箱未验证的用户
+func newMailEnv(t *testing.T) (*mailertest.Server, *user.Service, *model.User) {
+	t.Helper()
+	cfg := testenv.Setup(t)
+
+	server, err := mailertest.NewServer()
+	if err != nil {
+		t.Fatalf("启动 SMTP 服务器失败: %v", err)
+	}
+	t.Cleanup(server.Close)
+	cfg.Mail = conf.MailConfig{
+		Driver:  mailer.DriverSMTP,
+		Host:    server.Host,
+		Port:    server.Port,
+		From:    "noreply@box.example",
+		BaseURL: siteURL,
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	u := &model.User{Username: "alice", Email: "alice@example.com", PasswordHash: string(hash), Role: "user", Status: "active"}
+	if err := dao.NewUserRepository().Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return server, user.NewService(), u
+}
+
+// lastToken 取出最后一封邮件中的链接令牌，并校验收件人和链接地址
+func lastToken(t *testing.T, server *mailertest.Server, path string) string {
+	t.Helper()
+	msg, ok := server.Last()
+	if !ok {
+		t.Fatal("没有收到邮件")
+	}
+	if len(msg.To) != 1 || msg.To[0] != "alice@example.com" {
+		t.Fatalf("收件人: %v", msg.To)
+	}
+	if !strings.Contains(msg.Body, siteURL+path+"?token=") {
+		t.Fatalf("邮件中没有 %s 链接: %q", path, msg.Body)
+	}
+	match := tokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("邮件中没有令牌: %q", msg.Body)
+	}
+	return match[1]
+}
+
+func reload(t *testing.T, id uint) *model.User {
+	t.Helper()
+	u, err := dao.NewUserRepository().GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	server, service, u := newMailEnv(t)
+	ctx := context.Background()
+
+	// 未注册的邮箱同样返回成功，但不发送邮件
+	if err := service.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("未注册的邮箱: %v", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("向未注册的邮箱发送了 %d 封邮件", n)
+	}
+
+	if err := service.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	stale := lastToken(t, server, "/#/user/reset-password")
+	if err := service.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := lastToken(t, server, "/#/user/reset-password")
+
+	// 密码太短时不消耗令牌
+	if err := service.ResetPassword(ctx, token, "short"); !errors.Is(err, user.ErrPasswordTooShort) {
+		t.Fatalf("密码太短: %v", err)
+	}
+	if err := service.ResetPassword(ctx, token+"x", "new-password"); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("篡改的令牌: %v", err)
+	}
+	if err := service.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	updated := reload(t, u.ID)
+	if bcrypt.CompareHashAndPassword([]byte(updated.PasswordHash), []byte("new-password")) != nil {
+		t.Fatal("密码没有更新")
+	}
+	if !updated.EmailVerified {
+		t.Fatal("重置密码后邮箱应标记为已验证")
+	}
+
+	// 令牌只能使用一次，同一用户其余未使用的重置链接一并作废
+	if err := service.ResetPassword(ctx, token, "another-password"); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("重复使用令牌: %v", err)
+	}
+	if err := service.ResetPassword(ctx, stale, "another-password"); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("使用较早的重置链接: %v", err)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	server, service, u := newMailEnv(t)
+	ctx := context.Background()
+
+	if err := service.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := lastToken(t, server, "/#/user/reset-password")
+
+	if err := db.GetDB().Model(&model.UserToken{}).Where("user_id = ?", u.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ResetPassword(ctx, token, "new-password"); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("过期的令牌: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(reload(t, u.ID).PasswordHash), []byte("old-password")) != nil {
+		t.Fatal("过期的令牌修改了密码")
+	}
+}
+
+func TestEmailSendingIsThrottled(t *testing.T) {
+	server, service, _ := newMailEnv(t)
+	ctx := context.Background()
+
+	// 超出每小时的发送次数后仍返回成功，但不再发送
+	for i := 0; i < 7; i++ {
+		if err := service.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+			t.Fatalf("第 %d 次请求: %v", i+1, err)
+		}
+	}
+	if n := len(server.Messages()); n != 5 {
+		t.Fatalf("发送了 %d 封邮件，期望 5 封", n)
+	}
+}
+
+func TestVerifyEmailFlow(t *testing.T) {
+	server, service, u := newMailEnv(t)
+	ctx := context.Background()
+
+	if err := service.SendVerificationEmail(ctx, u.ID); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+	stale := lastToken(t, server, "/#/user/verify-email")
+	if err := service.ResendVerificationEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("ResendVerificationEmail: %v", err)
+	}
+	token := lastToken(t, server, "/#/user/verify-email")
+
+	// 重新发送后旧链接作废；验证链接不能用于重置密码
+	if err := service.VerifyEmail(ctx, stale); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("旧的验证链接: %v", err)
+	}
+	if err := service.ResetPassword(ctx, token, "new-password"); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("用验证链接重置密码: %v", err)
+	}
+
+	if err := service.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !reload(t, u.ID).EmailVerified {
+		t.Fatal("邮箱没有标记为已验证")
+	}
+	if err := service.VerifyEmail(ctx, token); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("重复使用验证链接: %v", err)
+	}
+	if err := service.SendVerificationEmail(ctx, u.ID); !errors.Is(err, user.ErrEmailAlreadyVerified) {
+		t.Fatalf("已验证后再次发送: %v", err)
+	}
+}
+
+func TestVerifyEmailRejectsChangedAddress(t *testing.T) {
+	server, service, u := newMailEnv(t)
+	ctx := context.Background()
+
+	if err := service.SendVerificationEmail(ctx, u.ID); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+	token := lastToken(t, server, "/#/user/verify-email")
+
+	// 签发后修改了邮箱，旧邮箱的验证链接不再有效
+	changed := reload(t, u.ID)
+	changed.Email = "alice@elsewhere.example"
+	if err := dao.NewUserRepository().Update(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.VerifyEmail(ctx, token); !errors.Is(err, user.ErrInvalidEmailToken) {
+		t.Fatalf("邮箱修改后的验证链接: %v", err)
+	}
+	if reload(t, u.ID).EmailVerified {
+		t.Fatal("修改后的邮箱被标记为已验证")
+	}
+}
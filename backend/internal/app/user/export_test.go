@@ -0,0 +1,19 @@
+package user
+
+import (
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+)
+
+// NewLDAPProvider 按配置创建 LDAP 认证方式，不经过全局单例，供外部测试包使用
+func NewLDAPProvider(cfg *conf.LDAPConfig) (AuthProvider, error) {
+	return newLDAPProvider(cfg)
+}
+
+// NewDirectorySyncFor 使用指定的 LDAP 认证方式创建同步任务
+func NewDirectorySyncFor(provider AuthProvider) *DirectorySync {
+	return &DirectorySync{
+		provider: provider.(*ldapProvider),
+		logRepo:  dao.NewAdminOperationLogRepository(),
+	}
+}
@@ -0,0 +1,252 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvitationInvalid    = errors.New("邀请码无效、已过期或已用完")
+	ErrInvitationNotAllowed = errors.New("没有邀请权限")
+	ErrInvitationQuota      = errors.New("邀请名额已用完")
+	ErrInvitationPreset     = errors.New("只有管理员可以设置邀请码的角色、配额和使用次数")
+)
+
+const (
+	maxInvitationUses        = 1000     // 单个邀请码最多可注册的次数
+	maxInvitationExpireHours = 365 * 24 // 邀请码有效期上限（小时）
+)
+
+// CreateInvitationReq 创建邀请码参数
+// 普通用户（ByAdmin 为 false）只能创建单次使用、默认角色和配额的邀请码，并受邀请名额限制
+type CreateInvitationReq struct {
+	CreatorID       uint
+	CreatorName     string
+	ByAdmin         bool
+	IP              string
+	Note            string
+	MaxUses         int        // 0 表示 1 次
+	ExpiresInHours  *int       // 与 ExpiresAt 二选一，都为空时使用 invitation_expire_hours
+	ExpiresAt       *time.Time // 绝对过期时间
+	Role            string     // 为空表示 user
+	MaxUploadSize   int64      // 0 表示使用角色/系统默认，-1 表示不限制
+	MaxStorageQuota int64
+}
+
+// CreateInvitationResp 创建结果，明文邀请码和注册链接只返回这一次
+type CreateInvitationResp struct {
+	Invitation *model.Invitation
+	Code       string
+	Link       string
+}
+
+// InvitationQuota 普通用户的邀请名额，Limit 为 -1 表示不限制
+type InvitationQuota struct {
+	Limit int   `json:"limit"`
+	Used  int64 `json:"used"`
+}
+
+// CreateInvitation 创建注册邀请码
+func (s *Service) CreateInvitation(ctx context.Context, req *CreateInvitationReq) (*CreateInvitationResp, error) {
+	s.ensureRepository()
+
+	role := strings.TrimSpace(req.Role)
+	if role == "" {
+		role = "user"
+	}
+	maxUses := req.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+
+	if !req.ByAdmin {
+		if role != "user" || maxUses != 1 || req.MaxUploadSize != 0 || req.MaxStorageQuota != 0 {
+			return nil, ErrInvitationPreset
+		}
+		quota, err := s.GetInvitationQuota(ctx, req.CreatorID)
+		if err != nil {
+			return nil, err
+		}
+		if quota.Limit == 0 {
+			return nil, ErrInvitationNotAllowed
+		}
+		if quota.Limit > 0 && quota.Used >= int64(quota.Limit) {
+			return nil, ErrInvitationQuota
+		}
+	}
+
+	if _, ok := roleRank[role]; !ok {
+		return nil, fmt.Errorf("不支持的角色: %s", role)
+	}
+	if maxUses < 1 || maxUses > maxInvitationUses {
+		return nil, fmt.Errorf("使用次数必须在 1 到 %d 之间", maxInvitationUses)
+	}
+	if req.MaxUploadSize < -1 || req.MaxStorageQuota < -1 {
+		return nil, errors.New("配额只能是 -1、0 或正数")
+	}
+	expiresAt, err := invitationExpiry(req.ExpiresInHours, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if len([]rune(note)) > 255 {
+		note = string([]rune(note)[:255])
+	}
+
+	randomPart, err := GenerateRandomKey()
+	if err != nil {
+		return nil, fmt.Errorf("生成邀请码失败: %w", err)
+	}
+	invitation := &model.Invitation{
+		CreatedBy:       req.CreatorID,
+		CreatorName:     req.CreatorName,
+		Note:            note,
+		Prefix:          randomPart[:8],
+		CodeHash:        hashToken(randomPart),
+		Role:            role,
+		MaxUploadSize:   req.MaxUploadSize,
+		MaxStorageQuota: req.MaxStorageQuota,
+		MaxUses:         maxUses,
+		ExpiresAt:       expiresAt,
+	}
+	if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, fmt.Errorf("保存邀请码失败: %w", err)
+	}
+
+	writeInvitationLog(ctx, "invitation.create", invitation, req.CreatorID, req.CreatorName, req.IP,
+		fmt.Sprintf("角色 %s，可使用 %d 次", invitation.Role, invitation.MaxUses))
+	return &CreateInvitationResp{
+		Invitation: invitation,
+		Code:       randomPart,
+		Link:       InvitationLink(randomPart),
+	}, nil
+}
+
+// ListInvitations 分页列出邀请码
+func (s *Service) ListInvitations(ctx context.Context, query model.InvitationQuery) ([]*model.Invitation, int64, error) {
+	s.ensureRepository()
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+	return s.invitationRepo.List(ctx, query)
+}
+
+// RevokeInvitation 撤销邀请码，ownerID 不为空时只能撤销自己创建的邀请码
+func (s *Service) RevokeInvitation(ctx context.Context, id uint, ownerID *uint, actorID uint, actorName, ip string) error {
+	s.ensureRepository()
+	if err := s.invitationRepo.Revoke(ctx, id, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("邀请码不存在或已撤销")
+		}
+		return err
+	}
+	writeInvitationLog(ctx, "invitation.revoke", &model.Invitation{Model: gorm.Model{ID: id}}, actorID, actorName, ip, "")
+	return nil
+}
+
+// GetInvitationQuota 返回普通用户的邀请名额：用户所属角色的 invite_quota，为 0 时使用全局 user.invite_quota
+func (s *Service) GetInvitationQuota(ctx context.Context, userID uint) (*InvitationQuota, error) {
+	s.ensureRepository()
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	quota := &InvitationQuota{}
+	if cfg := conf.GetGlobalConfig(); cfg != nil {
+		quota.Limit = cfg.User.RoleLimits[user.Role].InviteQuota
+		if quota.Limit == 0 {
+			quota.Limit = cfg.User.InviteQuota
+		}
+	}
+	if quota.Limit < 0 {
+		quota.Limit = -1
+	}
+	if quota.Used, err = s.invitationRepo.CountIssuedByCreator(ctx, userID); err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// resolveInvitation 校验注册时提交的邀请码，返回可用的邀请码记录
+func (s *Service) resolveInvitation(ctx context.Context, code string) (*model.Invitation, error) {
+	invitation, err := s.invitationRepo.GetByHash(ctx, hashToken(strings.TrimSpace(code)))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	if invitation.Status(time.Now()) != model.InvitationStatusActive {
+		return nil, ErrInvitationInvalid
+	}
+	return invitation, nil
+}
+
+// InvitationLink 邀请码对应的注册链接
+func InvitationLink(code string) string {
+	return siteURL() + "/#/user/register?invite=" + url.QueryEscape(code)
+}
+
+func invitationExpiry(inHours *int, at *time.Time) (*time.Time, error) {
+	switch {
+	case at != nil:
+		if !at.After(time.Now()) {
+			return nil, errors.New("过期时间必须晚于当前时间")
+		}
+		if at.After(time.Now().Add(maxInvitationExpireHours * time.Hour)) {
+			return nil, fmt.Errorf("有效期不能超过 %d 天", maxInvitationExpireHours/24)
+		}
+		t := at.UTC()
+		return &t, nil
+	case inHours != nil:
+		if *inHours < 1 || *inHours > maxInvitationExpireHours {
+			return nil, fmt.Errorf("有效期必须在 1 到 %d 小时之间", maxInvitationExpireHours)
+		}
+		t := time.Now().UTC().Add(time.Duration(*inHours) * time.Hour)
+		return &t, nil
+	}
+
+	hours := 0
+	if cfg := conf.GetGlobalConfig(); cfg != nil {
+		hours = cfg.User.InvitationExpireHours
+	}
+	if hours <= 0 {
+		return nil, nil
+	}
+	t := time.Now().UTC().Add(time.Duration(hours) * time.Hour)
+	return &t, nil
+}
+
+func writeInvitationLog(ctx context.Context, action string, invitation *model.Invitation, actorID uint, actorName, ip, message string) {
+	entry := &model.AdminOperationLog{
+		Action:    action,
+		Target:    fmt.Sprintf("invitation:%d", invitation.ID),
+		Success:   true,
+		Message:   message,
+		ActorID:   &actorID,
+		ActorName: actorName,
+		IP:        ip,
+	}
+	if invitation.Prefix != "" {
+		entry.Target = fmt.Sprintf("invitation:%d(%s)", invitation.ID, invitation.Prefix)
+	}
+	if err := dao.NewAdminOperationLogRepository().Create(ctx, entry); err != nil {
+		logger.Warn("记录邀请码日志失败", zap.Error(err))
+	}
+}
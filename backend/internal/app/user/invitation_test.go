@@ -0,0 +1,223 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+func intPtr(v int) *int { return &v }
+
+func register(svc *user.Service, name, code string) (*model.UserResp, error) {
+	return svc.Create(context.Background(), &user.CreateUserReq{
+		Username:   name,
+		Email:      name + "@example.com",
+		Password:   "secret-password",
+		InviteCode: code,
+	})
+}
+
+func TestCreateInvitationLimits(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.User.InviteQuota = 5
+	ctx := context.Background()
+	svc := user.NewService()
+	admin := newAccount(t, "root", "admin")
+	alice := newAccount(t, "alice", "user")
+
+	// 普通用户只能创建单次使用、默认角色和配额的邀请码
+	for name, req := range map[string]user.CreateInvitationReq{
+		"角色":   {Role: "admin"},
+		"使用次数": {MaxUses: 2},
+		"上传限制": {MaxUploadSize: 1024},
+		"存储配额": {MaxStorageQuota: -1},
+	} {
+		req.CreatorID = alice.ID
+		if _, err := svc.CreateInvitation(ctx, &req); !errors.Is(err, user.ErrInvitationPreset) {
+			t.Errorf("普通用户设置%s返回 %v", name, err)
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	tooLate := time.Now().Add(400 * 24 * time.Hour)
+	for name, req := range map[string]user.CreateInvitationReq{
+		"未知角色":     {Role: "owner"},
+		"使用次数过多":   {MaxUses: 1001},
+		"使用次数为负":   {MaxUses: -1},
+		"配额无效":     {MaxStorageQuota: -2},
+		"有效期为 0":   {ExpiresInHours: intPtr(0)},
+		"有效期过长":    {ExpiresInHours: intPtr(366 * 24)},
+		"过期时间已过":   {ExpiresAt: &past},
+		"过期时间超出上限": {ExpiresAt: &tooLate},
+	} {
+		req.CreatorID = admin.ID
+		req.ByAdmin = true
+		if _, err := svc.CreateInvitation(ctx, &req); err == nil {
+			t.Errorf("%s: 没有返回错误", name)
+		}
+	}
+
+	resp, err := svc.CreateInvitation(ctx, &user.CreateInvitationReq{
+		CreatorID: admin.ID, ByAdmin: true, Role: "admin", MaxUses: 3, Note: strings.Repeat("备", 300),
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	if resp.Invitation.Role != "admin" || resp.Invitation.MaxUses != 3 || len([]rune(resp.Invitation.Note)) != 255 {
+		t.Fatalf("邀请码: %+v", resp.Invitation)
+	}
+	if !strings.HasPrefix(resp.Code, resp.Invitation.Prefix) || !strings.Contains(resp.Link, "invite=") {
+		t.Fatalf("邀请码明文 %q 与前缀 %q 不符，链接 %q", resp.Code, resp.Invitation.Prefix, resp.Link)
+	}
+}
+
+func TestInvitationUserQuota(t *testing.T) {
+	cfg := testenv.Setup(t)
+	cfg.User.InviteQuota = 2
+	cfg.User.RoleLimits = map[string]conf.RoleLimit{"admin": {InviteQuota: -1}}
+	ctx := context.Background()
+	svc := user.NewService()
+	alice := newAccount(t, "alice", "user")
+
+	create := func() (*user.CreateInvitationResp, error) {
+		return svc.CreateInvitation(ctx, &user.CreateInvitationReq{CreatorID: alice.ID, CreatorName: "alice"})
+	}
+	first, err := create()
+	if err != nil {
+		t.Fatalf("第 1 个邀请码: %v", err)
+	}
+	second, err := create()
+	if err != nil {
+		t.Fatalf("第 2 个邀请码: %v", err)
+	}
+	if _, err := create(); !errors.Is(err, user.ErrInvitationQuota) {
+		t.Fatalf("超出名额返回 %v", err)
+	}
+
+	// 撤销未使用的邀请码会归还名额，已被使用过的邀请码撤销后仍占用名额
+	if _, err := register(svc, "bob", second.Code); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+	if err := svc.RevokeInvitation(ctx, second.Invitation.ID, &alice.ID, alice.ID, "alice", ""); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+	if _, err := create(); !errors.Is(err, user.ErrInvitationQuota) {
+		t.Fatalf("撤销已使用的邀请码后返回 %v", err)
+	}
+	if err := svc.RevokeInvitation(ctx, first.Invitation.ID, &alice.ID, alice.ID, "alice", ""); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+	if _, err := create(); err != nil {
+		t.Fatalf("撤销未使用的邀请码后返回 %v", err)
+	}
+
+	quota, err := svc.GetInvitationQuota(ctx, alice.ID)
+	if err != nil || quota.Limit != 2 || quota.Used != 2 {
+		t.Fatalf("邀请名额: %+v %v", quota, err)
+	}
+
+	// 角色配置覆盖全局名额：-1 表示不限制，全局为 0 时普通用户不能邀请
+	root := newAccount(t, "root", "admin")
+	if quota, err := svc.GetInvitationQuota(ctx, root.ID); err != nil || quota.Limit != -1 {
+		t.Fatalf("管理员的邀请名额: %+v %v", quota, err)
+	}
+	cfg.User.InviteQuota = 0
+	if _, err := create(); !errors.Is(err, user.ErrInvitationNotAllowed) {
+		t.Fatalf("没有邀请权限时返回 %v", err)
+	}
+}
+
+func TestRedeemInvitation(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := user.NewService()
+	admin := newAccount(t, "root", "admin")
+
+	resp, err := svc.CreateInvitation(ctx, &user.CreateInvitationReq{
+		CreatorID: admin.ID, ByAdmin: true, Role: "admin", MaxUses: 2, MaxUploadSize: -1, MaxStorageQuota: 4096,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	for _, name := range []string{"bob", "carol"} {
+		created, err := register(svc, name, " "+resp.Code+" ")
+		if err != nil {
+			t.Fatalf("%s 注册失败: %v", name, err)
+		}
+		stored := reload(t, created.ID)
+		if stored.Role != "admin" || stored.MaxUploadSize != -1 || stored.MaxStorageQuota != 4096 {
+			t.Fatalf("%s 没有使用邀请码预设: %+v", name, stored)
+		}
+		if stored.InvitationID == nil || *stored.InvitationID != resp.Invitation.ID {
+			t.Fatalf("%s 没有记录邀请码", name)
+		}
+	}
+
+	// 使用次数用完后注册失败，且不会创建用户
+	if _, err := register(svc, "dave", resp.Code); !errors.Is(err, user.ErrInvitationInvalid) {
+		t.Fatalf("邀请码用完后返回 %v", err)
+	}
+	var count int64
+	db.GetDB().Model(&model.User{}).Where("username = ?", "dave").Count(&count)
+	if count != 0 {
+		t.Fatal("邀请码用完后仍创建了用户")
+	}
+	var invitation model.Invitation
+	db.GetDB().First(&invitation, resp.Invitation.ID)
+	if invitation.UsedCount != 2 || invitation.Status(time.Now()) != model.InvitationStatusExhausted {
+		t.Fatalf("邀请码状态: used=%d status=%s", invitation.UsedCount, invitation.Status(time.Now()))
+	}
+
+	if _, err := register(svc, "erin", "not-a-code"); !errors.Is(err, user.ErrInvitationInvalid) {
+		t.Fatalf("无效的邀请码返回 %v", err)
+	}
+}
+
+func TestExpiredAndRevokedInvitation(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	svc := user.NewService()
+	admin := newAccount(t, "root", "admin")
+	other := newAccount(t, "alice", "user")
+
+	expiring, err := svc.CreateInvitation(ctx, &user.CreateInvitationReq{CreatorID: admin.ID, ByAdmin: true, ExpiresInHours: intPtr(1)})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	if err := db.GetDB().Model(expiring.Invitation).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := register(svc, "bob", expiring.Code); !errors.Is(err, user.ErrInvitationInvalid) {
+		t.Fatalf("过期的邀请码返回 %v", err)
+	}
+
+	revoked, err := svc.CreateInvitation(ctx, &user.CreateInvitationReq{CreatorID: admin.ID, ByAdmin: true})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	// 普通用户只能撤销自己创建的邀请码
+	if err := svc.RevokeInvitation(ctx, revoked.Invitation.ID, &other.ID, other.ID, "alice", ""); err == nil {
+		t.Fatal("撤销他人的邀请码没有返回错误")
+	}
+	if err := svc.RevokeInvitation(ctx, revoked.Invitation.ID, nil, admin.ID, "root", "192.0.2.1"); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+	if err := svc.RevokeInvitation(ctx, revoked.Invitation.ID, nil, admin.ID, "root", ""); err == nil {
+		t.Fatal("重复撤销没有返回错误")
+	}
+	if _, err := register(svc, "carol", revoked.Code); !errors.Is(err, user.ErrInvitationInvalid) {
+		t.Fatalf("已撤销的邀请码返回 %v", err)
+	}
+	if countLogs(t, "invitation.revoke") != 1 {
+		t.Fatal("没有记录撤销日志")
+	}
+}
@@ -0,0 +1,407 @@
+package user
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/directory"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDirectoryNotProvisioned = errors.New("该账号尚未开通，请联系管理员")
+	ErrDirectoryConflict       = errors.New("用户名或邮箱已被本地账号使用，请联系管理员")
+	ErrDirectoryRoleDenied     = errors.New("该账号没有访问权限")
+	ErrDirectoryEmailRequired  = errors.New("目录中缺少邮箱，无法创建账号")
+	ErrDirectoryDisabled       = errors.New("用户账号已被禁用")
+)
+
+// roleRank 角色权限高低，匹配多个组时取最高的
+var roleRank = map[string]int{"user": 1, "admin": 2}
+
+// ldapProvider 通过 LDAP 绑定校验密码，目录用户通过 UserIdentity（provider 为 ldap，subject 为小写用户名）对应到本地用户
+type ldapProvider struct {
+	client       *directory.Client
+	cfg          conf.LDAPConfig
+	repo         *dao.UserRepository
+	identityRepo *dao.UserIdentityRepository
+}
+
+var (
+	ldapProviderInstance *ldapProvider
+	ldapProviderErr      error
+	ldapProviderOnce     sync.Once
+)
+
+// ldapAuthProvider 按配置创建 LDAP 认证方式，只创建一次，登录和同步任务共用
+func ldapAuthProvider() (*ldapProvider, error) {
+	ldapProviderOnce.Do(func() {
+		cfg := conf.GetGlobalConfig()
+		if cfg == nil {
+			ldapProviderErr = errors.New("配置未加载")
+			return
+		}
+		ldapProviderInstance, ldapProviderErr = newLDAPProvider(&cfg.LDAP)
+	})
+	return ldapProviderInstance, ldapProviderErr
+}
+
+func newLDAPProvider(cfg *conf.LDAPConfig) (*ldapProvider, error) {
+	var roots *x509.CertPool
+	if cfg.CACertFile != "" {
+		data, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 LDAP CA 证书失败: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, errors.New("LDAP CA 证书中没有有效的 PEM 证书")
+		}
+	}
+	if cfg.DefaultRole != "" && roleRank[cfg.DefaultRole] == 0 {
+		return nil, fmt.Errorf("LDAP default_role 无效: %s", cfg.DefaultRole)
+	}
+
+	client, err := directory.New(directory.Config{
+		URL:                  cfg.URL,
+		StartTLS:             cfg.StartTLS,
+		InsecureSkipVerify:   cfg.InsecureSkipVerify,
+		RootCAs:              roots,
+		Timeout:              time.Duration(cfg.TimeoutSeconds) * time.Second,
+		BindDN:               cfg.BindDN,
+		BindPassword:         cfg.BindPassword,
+		BaseDN:               cfg.BaseDN,
+		UserFilter:           cfg.UserFilter,
+		UsernameAttribute:    cfg.UsernameAttribute,
+		EmailAttribute:       cfg.EmailAttribute,
+		DisplayNameAttribute: cfg.DisplayNameAttribute,
+		GroupAttribute:       cfg.GroupAttribute,
+		GroupBaseDN:          cfg.GroupBaseDN,
+		GroupFilter:          cfg.GroupFilter,
+		DisabledFilter:       cfg.DisabledFilter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ldapProvider{
+		client:       client,
+		cfg:          *cfg,
+		repo:         dao.NewUserRepository(),
+		identityRepo: dao.NewUserIdentityRepository(),
+	}, nil
+}
+
+func (p *ldapProvider) Name() string {
+	return ProviderLDAP
+}
+
+func (p *ldapProvider) Authenticate(ctx context.Context, login, password string, byEmail bool) (*model.User, error) {
+	entry, err := p.client.Authenticate(login, password, byEmail)
+	if errors.Is(err, directory.ErrInvalidCredentials) || errors.Is(err, directory.ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errProviderUnavailable, err)
+	}
+	if entry.Username == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if entry.Disabled {
+		return nil, ErrDirectoryDisabled
+	}
+
+	role, err := p.mapRole(entry.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return p.resolveUser(ctx, entry, role)
+}
+
+// mapRole 按 role_mapping 把所属的组映射为本地角色，多个匹配时取权限最高的
+// 默认只按组的完整 DN 匹配；开启 role_mapping_by_name 后也按第一个 RDN 的值（例如 CN）匹配，
+// 这时目录中任意位置的同名组都会得到同样的角色
+// 未配置 role_mapping 时返回空字符串，表示不同步角色
+func (p *ldapProvider) mapRole(groups []string) (string, error) {
+	if len(p.cfg.RoleMapping) == 0 {
+		return "", nil
+	}
+	role := ""
+	for _, group := range groups {
+		// 配置加载时映射的键会被转为小写
+		keys := []string{strings.ToLower(group)}
+		if p.cfg.RoleMappingByName {
+			keys = append(keys, strings.ToLower(directory.GroupName(group)))
+		}
+		for _, key := range keys {
+			if mapped := p.cfg.RoleMapping[key]; roleRank[mapped] > roleRank[role] {
+				role = mapped
+			}
+		}
+	}
+	if role == "" {
+		role = p.cfg.DefaultRole
+	}
+	if role == "" {
+		return "", ErrDirectoryRoleDenied
+	}
+	return role, nil
+}
+
+// resolveUser 找到目录用户对应的本地用户；首次登录时按配置关联同名本地用户或自动创建，
+// 之后每次登录同步角色，并恢复被同步任务停用、目录中已重新启用的账号
+func (p *ldapProvider) resolveUser(ctx context.Context, entry *directory.Entry, role string) (*model.User, error) {
+	subject := strings.ToLower(entry.Username)
+	identity, err := p.identityRepo.GetByProviderSubject(ctx, ProviderLDAP, subject)
+	var user *model.User
+	switch {
+	case err == nil:
+		user, err = p.repo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, ErrDirectoryNotProvisioned
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = p.linkOrProvision(ctx, entry, role)
+		if err != nil {
+			return nil, err
+		}
+		identity = &model.UserIdentity{UserID: user.ID, Provider: ProviderLDAP, Subject: subject}
+		if err := p.identityRepo.Create(ctx, identity); err != nil {
+			return nil, err
+		}
+		logger.Info("绑定 LDAP 账号", zap.String("username", entry.Username), zap.Uint("user_id", user.ID))
+	default:
+		return nil, err
+	}
+
+	if identity.Disabled {
+		if user.Status == "inactive" {
+			user.Status = "active"
+		}
+		if err := p.identityRepo.SetDisabled(ctx, identity.ID, false); err != nil {
+			return nil, err
+		}
+	}
+	if role != "" && user.Role != role {
+		logger.Info("按 LDAP 组更新用户角色",
+			zap.Uint("user_id", user.ID), zap.String("from", user.Role), zap.String("to", role))
+		user.Role = role
+	}
+	if err := p.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := p.identityRepo.UpdateLogin(ctx, identity.ID, entry.Email, time.Now()); err != nil {
+		logger.Warn("更新 LDAP 绑定失败", zap.Uint("identity_id", identity.ID), zap.Error(err))
+	}
+	return user, nil
+}
+
+// linkOrProvision 首次登录时关联用户名相同的本地用户（需开启 link_existing），或自动创建本地用户
+func (p *ldapProvider) linkOrProvision(ctx context.Context, entry *directory.Entry, role string) (*model.User, error) {
+	existing, err := p.repo.GetByUsername(ctx, entry.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		if p.cfg.LinkExisting {
+			return existing, nil
+		}
+		return nil, ErrDirectoryConflict
+	}
+
+	if !p.cfg.AutoProvision {
+		return nil, ErrDirectoryNotProvisioned
+	}
+	if entry.Email == "" {
+		return nil, ErrDirectoryEmailRequired
+	}
+	if other, err := p.repo.GetByEmail(ctx, entry.Email); err == nil && other != nil {
+		return nil, ErrDirectoryConflict
+	}
+	if role == "" {
+		role = "user"
+	}
+
+	// 不设置本地密码，密码始终由目录校验
+	user := &model.User{
+		Username:      entry.Username,
+		Email:         entry.Email,
+		Nickname:      entry.DisplayName,
+		Role:          role,
+		Status:        "active",
+		EmailVerified: true,
+	}
+	if len([]rune(user.Nickname)) > 50 {
+		user.Nickname = string([]rune(user.Nickname)[:50])
+	}
+	if err := p.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	logger.Info("LDAP 自动创建用户", zap.String("username", user.Username), zap.Uint("user_id", user.ID))
+	return user, nil
+}
+
+// DirectorySyncResult 一次目录同步的结果
+type DirectorySyncResult struct {
+	Checked  int `json:"checked"`  // 检查的绑定数
+	Disabled int `json:"disabled"` // 因目录中禁用或删除而停用的用户数
+	Enabled  int `json:"enabled"`  // 目录中重新启用后恢复的用户数
+}
+
+// DirectorySync 定期把目录中的账号状态同步到本地用户：目录中禁用或删除的账号停用本地用户并注销全部会话，
+// 目录中恢复后重新启用。只恢复由同步任务停用的用户，管理员手动禁用的用户不受影响
+type DirectorySync struct {
+	provider *ldapProvider
+	logRepo  *dao.AdminOperationLogRepository
+	interval time.Duration
+}
+
+// NewDirectorySync 创建目录同步任务，LDAP 配置无效时返回错误
+func NewDirectorySync(interval time.Duration) (*DirectorySync, error) {
+	provider, err := ldapAuthProvider()
+	if err != nil {
+		return nil, err
+	}
+	return &DirectorySync{
+		provider: provider,
+		logRepo:  dao.NewAdminOperationLogRepository(),
+		interval: interval,
+	}, nil
+}
+
+// Start 在后台按间隔执行同步，ctx 取消后退出
+func (d *DirectorySync) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := d.RunOnce(ctx, "scheduler"); err != nil {
+					logger.Error("同步 LDAP 账号状态失败", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce 执行一次同步，并在有用户状态变化或出错时写入后台操作日志
+func (d *DirectorySync) RunOnce(ctx context.Context, actor string) (*DirectorySyncResult, error) {
+	start := time.Now()
+	result, err := d.sync(ctx)
+	if err == nil && result.Disabled == 0 && result.Enabled == 0 {
+		return result, nil
+	}
+
+	entry := &model.AdminOperationLog{
+		Action:    "user.ldap_sync",
+		Target:    d.provider.cfg.URL,
+		Success:   err == nil,
+		ActorName: actor,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	} else {
+		entry.Message = fmt.Sprintf("检查 %d 个账号，停用 %d 个，恢复 %d 个", result.Checked, result.Disabled, result.Enabled)
+	}
+	if logErr := d.logRepo.Create(ctx, entry); logErr != nil {
+		logger.Warn("记录 LDAP 同步日志失败", zap.Error(logErr))
+	}
+	return result, err
+}
+
+func (d *DirectorySync) sync(ctx context.Context) (*DirectorySyncResult, error) {
+	entries, err := d.provider.client.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	// 目录返回空结果多半是配置或权限问题，此时停用全部用户的代价太大
+	if len(entries) == 0 {
+		return nil, errors.New("目录中没有找到任何用户，已跳过同步")
+	}
+	directoryUsers := make(map[string]directory.Entry, len(entries))
+	for _, e := range entries {
+		directoryUsers[strings.ToLower(e.Username)] = e
+	}
+
+	identities, err := d.provider.identityRepo.ListByProvider(ctx, ProviderLDAP)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DirectorySyncResult{}
+	for i := range identities {
+		identity := &identities[i]
+		result.Checked++
+		e, found := directoryUsers[identity.Subject]
+		active := found && !e.Disabled
+
+		switch {
+		case !active && !identity.Disabled:
+			changed, err := d.setStatus(ctx, identity, "active", "inactive")
+			if err != nil {
+				return result, err
+			}
+			if changed {
+				result.Disabled++
+			}
+		case active && identity.Disabled:
+			changed, err := d.setStatus(ctx, identity, "inactive", "active")
+			if err != nil {
+				return result, err
+			}
+			if changed {
+				result.Enabled++
+			}
+		}
+	}
+	return result, nil
+}
+
+// setStatus 用户当前状态为 from 时改为 to，并记录绑定的停用标记；停用时注销该用户的全部会话
+func (d *DirectorySync) setStatus(ctx context.Context, identity *model.UserIdentity, from, to string) (bool, error) {
+	user, err := d.provider.repo.GetByID(ctx, identity.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	disabling := to != "active"
+	if user.Status != from {
+		// 状态已被管理员修改：停用时不再标记，恢复时只清除标记
+		if !disabling {
+			return false, d.provider.identityRepo.SetDisabled(ctx, identity.ID, false)
+		}
+		return false, nil
+	}
+
+	user.Status = to
+	if err := d.provider.repo.Update(ctx, user); err != nil {
+		return false, err
+	}
+	if err := d.provider.identityRepo.SetDisabled(ctx, identity.ID, disabling); err != nil {
+		return false, err
+	}
+	if disabling {
+		if _, err := session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonUserDisabled); err != nil {
+			logger.Warn("注销停用用户的会话失败", zap.Uint("user_id", user.ID), zap.Error(err))
+		}
+	}
+	logger.Info("按 LDAP 同步用户状态", zap.Uint("user_id", user.ID), zap.String("status", to))
+	return true, nil
+}
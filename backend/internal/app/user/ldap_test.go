@@ -0,0 +1,224 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/directory/directorytest"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+)
+
+const (
+	serviceDN   = "cn=svc,dc=example,dc=com"
+	aliceDN     = "uid=alice,ou=people,dc=example,dc=com"
+	adminsDN    = "cn=admins,ou=groups,dc=example,dc=com"
+	staffDN     = "cn=staff,ou=groups,dc=example,dc=com"
+	lookalikeDN = "cn=admins,ou=projects,dc=example,dc=com"
+)
+
+func newDirectory(t *testing.T) *directorytest.Server {
+	t.Helper()
+	testenv.Setup(t)
+
+	server, err := directorytest.NewServer()
+	if err != nil {
+		t.Fatalf("启动 LDAP 服务器失败: %v", err)
+	}
+	t.Cleanup(server.Close)
+	server.Add(directorytest.Entry{DN: serviceDN, Password: "svc-pass"})
+	server.Add(directorytest.Entry{
+		DN:       aliceDN,
+		Password: "alice-pass",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"alice"},
+			"mail":        {"alice@example.com"},
+			"cn":          {"Alice"},
+			"memberOf":    {staffDN},
+		},
+	})
+	return server
+}
+
+func ldapConfig(server *directorytest.Server) *conf.LDAPConfig {
+	return &conf.LDAPConfig{
+		URL:            server.URL,
+		BindDN:         serviceDN,
+		BindPassword:   "svc-pass",
+		BaseDN:         "ou=people,dc=example,dc=com",
+		GroupAttribute: "memberOf",
+		DisabledFilter: "(accountStatus=disabled)",
+		AutoProvision:  true,
+		RoleMapping:    map[string]string{adminsDN: "admin", staffDN: "user"},
+	}
+}
+
+func newProvider(t *testing.T, cfg *conf.LDAPConfig) user.AuthProvider {
+	t.Helper()
+	provider, err := user.NewLDAPProvider(cfg)
+	if err != nil {
+		t.Fatalf("创建 LDAP 认证方式失败: %v", err)
+	}
+	return provider
+}
+
+func TestLDAPBind(t *testing.T) {
+	server := newDirectory(t)
+	provider := newProvider(t, ldapConfig(server))
+	ctx := context.Background()
+
+	u, err := provider.Authenticate(ctx, "alice", "alice-pass", false)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if u.Username != "alice" || u.Email != "alice@example.com" || u.Role != "user" || u.PasswordHash != "" {
+		t.Fatalf("自动创建的用户: %+v", u)
+	}
+
+	// 按邮箱登录对应同一个本地用户
+	byEmail, err := provider.Authenticate(ctx, "alice@example.com", "alice-pass", true)
+	if err != nil || byEmail.ID != u.ID {
+		t.Fatalf("按邮箱登录: %v", err)
+	}
+
+	for _, tc := range []struct{ login, password string }{
+		{"alice", "wrong"},
+		{"alice", ""},
+		{"bob", "alice-pass"},
+	} {
+		if _, err := provider.Authenticate(ctx, tc.login, tc.password, false); !errors.Is(err, user.ErrInvalidCredentials) {
+			t.Errorf("%s/%q: 期望 ErrInvalidCredentials，实际 %v", tc.login, tc.password, err)
+		}
+	}
+
+	// 服务账号密码错误时认证方式不可用，不能被当作用户密码错误
+	cfg := ldapConfig(server)
+	cfg.BindPassword = "wrong"
+	if _, err := newProvider(t, cfg).Authenticate(ctx, "alice", "alice-pass", false); err == nil || errors.Is(err, user.ErrInvalidCredentials) {
+		t.Fatalf("服务账号绑定失败: %v", err)
+	}
+}
+
+func TestLDAPRoleMapping(t *testing.T) {
+	server := newDirectory(t)
+	ctx := context.Background()
+
+	login := func(cfg *conf.LDAPConfig) (string, error) {
+		t.Helper()
+		u, err := newProvider(t, cfg).Authenticate(ctx, "alice", "alice-pass", false)
+		if err != nil {
+			return "", err
+		}
+		return u.Role, nil
+	}
+
+	// 多个匹配时取权限最高的，每次登录同步
+	server.SetAttribute(aliceDN, "memberOf", staffDN, adminsDN)
+	if role, err := login(ldapConfig(server)); err != nil || role != "admin" {
+		t.Fatalf("所属组包含 admins: role=%q err=%v", role, err)
+	}
+
+	// 默认只按完整 DN 匹配，其他位置的同名组不会得到管理员角色
+	server.SetAttribute(aliceDN, "memberOf", staffDN, lookalikeDN)
+	if role, err := login(ldapConfig(server)); err != nil || role != "user" {
+		t.Fatalf("同名组: role=%q err=%v", role, err)
+	}
+
+	// 未开启按组名匹配时，写成 CN 的映射不生效
+	byName := ldapConfig(server)
+	byName.RoleMapping = map[string]string{"admins": "admin", "staff": "user"}
+	if _, err := login(byName); !errors.Is(err, user.ErrDirectoryRoleDenied) {
+		t.Fatalf("未开启按组名匹配: %v", err)
+	}
+
+	// 显式开启后，映射的键可以写 CN，其他位置的同名组也会匹配
+	byName.RoleMappingByName = true
+	if role, err := login(byName); err != nil || role != "admin" {
+		t.Fatalf("按组名匹配: role=%q err=%v", role, err)
+	}
+
+	// 没有匹配且未配置默认角色时拒绝登录，配置了默认角色时使用默认角色
+	server.SetAttribute(aliceDN, "memberOf", "cn=guests,ou=groups,dc=example,dc=com")
+	if _, err := login(ldapConfig(server)); !errors.Is(err, user.ErrDirectoryRoleDenied) {
+		t.Fatalf("没有匹配的组: %v", err)
+	}
+	withDefault := ldapConfig(server)
+	withDefault.DefaultRole = "user"
+	if role, err := login(withDefault); err != nil || role != "user" {
+		t.Fatalf("默认角色: role=%q err=%v", role, err)
+	}
+}
+
+func TestDirectorySync(t *testing.T) {
+	server := newDirectory(t)
+	provider := newProvider(t, ldapConfig(server))
+	sync := user.NewDirectorySyncFor(provider)
+	ctx := context.Background()
+	users := dao.NewUserRepository()
+
+	u, err := provider.Authenticate(ctx, "alice", "alice-pass", false)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	status := func() string {
+		t.Helper()
+		current, err := users.GetByID(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.Status
+	}
+
+	result, err := sync.RunOnce(ctx, "test")
+	if err != nil || result.Checked != 1 || result.Disabled != 0 || result.Enabled != 0 {
+		t.Fatalf("没有变化时同步: %+v %v", result, err)
+	}
+
+	// 目录中禁用后停用本地用户，登录被拒绝
+	server.SetAttribute(aliceDN, "accountStatus", "disabled")
+	if result, err := sync.RunOnce(ctx, "test"); err != nil || result.Disabled != 1 {
+		t.Fatalf("禁用后同步: %+v %v", result, err)
+	}
+	if got := status(); got != "inactive" {
+		t.Fatalf("禁用后状态为 %q", got)
+	}
+	if _, err := provider.Authenticate(ctx, "alice", "alice-pass", false); !errors.Is(err, user.ErrDirectoryDisabled) {
+		t.Fatalf("禁用后登录: %v", err)
+	}
+
+	// 目录中恢复后重新启用
+	server.SetAttribute(aliceDN, "accountStatus")
+	if result, err := sync.RunOnce(ctx, "test"); err != nil || result.Enabled != 1 {
+		t.Fatalf("恢复后同步: %+v %v", result, err)
+	}
+	if got := status(); got != "active" {
+		t.Fatalf("恢复后状态为 %q", got)
+	}
+
+	// 管理员手动禁用的用户不会被同步任务恢复
+	current, _ := users.GetByID(ctx, u.ID)
+	current.Status = "disabled"
+	if err := users.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	server.Add(directorytest.Entry{DN: "uid=bob,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+		"objectClass": {"person"}, "uid": {"bob"},
+	}})
+	server.Delete(aliceDN)
+	if result, err := sync.RunOnce(ctx, "test"); err != nil || result.Disabled != 0 {
+		t.Fatalf("删除手动禁用的用户后同步: %+v %v", result, err)
+	}
+	server.Add(directorytest.Entry{DN: aliceDN, Password: "alice-pass", Attributes: map[string][]string{
+		"objectClass": {"person"}, "uid": {"alice"}, "mail": {"alice@example.com"},
+	}})
+	if result, err := sync.RunOnce(ctx, "test"); err != nil || result.Enabled != 0 {
+		t.Fatalf("恢复后同步: %+v %v", result, err)
+	}
+	if got := status(); got != "disabled" {
+		t.Fatalf("手动禁用的用户状态变为 %q", got)
+	}
+}
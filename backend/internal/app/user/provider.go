@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 认证方式名称，对应 user.auth_providers 中的取值
+const (
+	ProviderLocal = "local"
+	ProviderLDAP  = "ldap"
+)
+
+var (
+	// ErrInvalidCredentials 用户不存在或密码错误，Authenticate 会继续尝试下一个认证方式
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// errProviderUnavailable 认证方式暂时不可用（例如目录服务器无法连接），记录日志后继续尝试下一个
+	errProviderUnavailable = errors.New("认证服务暂时不可用")
+)
+
+// AuthProvider 密码认证方式，Login 按 user.auth_providers 的顺序依次尝试
+type AuthProvider interface {
+	Name() string
+	// Authenticate 校验登录名（byEmail 为 true 时是邮箱）和密码，成功时返回对应的本地用户
+	// 用户不存在或密码错误返回 ErrInvalidCredentials；其他错误表示认证方式已确认身份但拒绝登录
+	Authenticate(ctx context.Context, login, password string, byEmail bool) (*model.User, error)
+}
+
+// localProvider 使用本地数据库中的 bcrypt 密码认证
+type localProvider struct {
+	repo *dao.UserRepository
+}
+
+func (p *localProvider) Name() string {
+	return ProviderLocal
+}
+
+func (p *localProvider) Authenticate(ctx context.Context, login, password string, byEmail bool) (*model.User, error) {
+	lookup := p.repo.GetByUsername
+	if byEmail {
+		lookup = p.repo.GetByEmail
+	}
+	user, err := lookup(ctx, login)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	// 单点登录或目录创建的用户没有本地密码，bcrypt 校验必然失败
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+var (
+	authProviderList []AuthProvider
+	authProviderOnce sync.Once
+)
+
+// authProviders 按配置创建认证方式，配置无效的认证方式会被跳过，全部无效时回退到本地密码
+func authProviders() []AuthProvider {
+	authProviderOnce.Do(func() {
+		names := []string{ProviderLocal}
+		cfg := conf.GetGlobalConfig()
+		if cfg != nil && len(cfg.User.AuthProviders) > 0 {
+			names = cfg.User.AuthProviders
+		}
+		for _, name := range names {
+			switch name {
+			case ProviderLocal:
+				authProviderList = append(authProviderList, &localProvider{repo: dao.NewUserRepository()})
+			case ProviderLDAP:
+				p, err := ldapAuthProvider()
+				if err != nil {
+					logger.Error("LDAP 认证配置无效，已跳过", zap.Error(err))
+					continue
+				}
+				authProviderList = append(authProviderList, p)
+			default:
+				logger.Warn("忽略未知的认证方式", zap.String("provider", name))
+			}
+		}
+		if len(authProviderList) == 0 {
+			authProviderList = []AuthProvider{&localProvider{repo: dao.NewUserRepository()}}
+		}
+	})
+	return authProviderList
+}
+
+// Authenticate 按配置的顺序依次尝试各认证方式校验登录名和密码
+// 某个认证方式不可用时记录日志并继续尝试下一个；全部失败时返回 ErrInvalidCredentials
+func (s *Service) Authenticate(ctx context.Context, login, password string, byEmail bool) (*model.User, error) {
+	for _, p := range authProviders() {
+		user, err := p.Authenticate(ctx, login, password, byEmail)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			continue
+		case errors.Is(err, errProviderUnavailable):
+			logger.Warn("认证方式不可用", zap.String("provider", p.Name()), zap.Error(err))
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -7,22 +7,32 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
+	"slices"
 	"strings"
 	"time"
 
 	usermodel "github.com/zy84338719/fileCodeBox/backend/gen/http/model/user"
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/session"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/sso"
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/twofactor"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// ErrOldPasswordMismatch 修改密码时旧密码校验失败
+var ErrOldPasswordMismatch = errors.New("旧密码错误")
+
 type CreateUserReq struct {
-	Username string
-	Email    string
-	Password string
-	Nickname string
+	Username   string
+	Email      string
+	Password   string
+	Nickname   string
+	InviteCode string // 邀请码，不为空时使用邀请码预设的角色和配额
 }
 
 type UpdateUserReq struct {
@@ -33,15 +43,23 @@ type UpdateUserReq struct {
 }
 
 type Service struct {
-	repo       *dao.UserRepository
-	apiKeyRepo *dao.UserAPIKeyRepository
+	repo            *dao.UserRepository
+	apiKeyRepo      *dao.UserAPIKeyRepository
+	transferLogRepo *dao.TransferLogRepository
+	chunkRepo       *dao.ChunkRepository
+	tokenRepo       *dao.UserTokenRepository
+	invitationRepo  *dao.InvitationRepository
 }
 
 func NewService() *Service {
 	// 延迟初始化 repository，确保数据库已经准备好
 	return &Service{
-		repo:       nil, // 延迟初始化
-		apiKeyRepo: nil, // 延迟初始化
+		repo:            nil, // 延迟初始化
+		apiKeyRepo:      nil, // 延迟初始化
+		transferLogRepo: nil, // 延迟初始化
+		chunkRepo:       nil, // 延迟初始化
+		tokenRepo:       nil, // 延迟初始化
+		invitationRepo:  nil, // 延迟初始化
 	}
 }
 
@@ -53,6 +71,18 @@ func (s *Service) ensureRepository() {
 	if s.apiKeyRepo == nil {
 		s.apiKeyRepo = dao.NewUserAPIKeyRepository()
 	}
+	if s.transferLogRepo == nil {
+		s.transferLogRepo = dao.NewTransferLogRepository()
+	}
+	if s.chunkRepo == nil {
+		s.chunkRepo = dao.NewChunkRepository()
+	}
+	if s.tokenRepo == nil {
+		s.tokenRepo = dao.NewUserTokenRepository()
+	}
+	if s.invitationRepo == nil {
+		s.invitationRepo = dao.NewInvitationRepository()
+	}
 }
 
 func (s *Service) Create(ctx context.Context, req *CreateUserReq) (*model.UserResp, error) {
@@ -89,7 +119,25 @@ func (s *Service) Create(ctx context.Context, req *CreateUserReq) (*model.UserRe
 		Role:         "user",
 	}
 
-	if err := s.repo.Create(ctx, user); err != nil {
+	if req.InviteCode == "" {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		return user.ToResp(), nil
+	}
+
+	// 凭邀请码注册：使用预设的角色和配额，占用邀请码与创建用户在同一事务中完成
+	invitation, err := s.resolveInvitation(ctx, req.InviteCode)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = invitation.Role
+	user.MaxUploadSize = invitation.MaxUploadSize
+	user.MaxStorageQuota = invitation.MaxStorageQuota
+	if err := s.invitationRepo.Redeem(ctx, invitation.ID, user); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationInvalid
+		}
 		return nil, err
 	}
 
@@ -134,6 +182,11 @@ func (s *Service) Update(ctx context.Context, id uint, req *UpdateUserReq) (*mod
 	if err := s.repo.Update(ctx, user); err != nil {
 		return nil, err
 	}
+	if user.Status != "active" {
+		if _, err := session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonUserDisabled); err != nil {
+			return nil, err
+		}
+	}
 
 	return user.ToResp(), nil
 }
@@ -167,66 +220,86 @@ func (s *Service) List(ctx context.Context, page, pageSize int) ([]*model.UserRe
 }
 
 // Login 用户登录
-func (s *Service) Login(ctx context.Context, username, password string) (*model.UserResp, string, error) {
+func (s *Service) Login(ctx context.Context, username, password string, client session.Client) (*model.UserResp, *session.Tokens, error) {
 	s.ensureRepository()
-	user, err := s.repo.GetByUsername(ctx, username)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, "", errors.New("用户名或密码错误")
-		}
-		return nil, "", err
+	if sso.PasswordLoginDisabled() {
+		return nil, nil, sso.ErrPasswordLoginDisabled
 	}
-
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, "", errors.New("用户名或密码错误")
+	user, err := s.Authenticate(ctx, username, password, false)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// 检查用户状态
 	if user.Status != "active" {
-		return nil, "", errors.New("用户账号已被禁用")
+		return nil, nil, errors.New("用户账号已被禁用")
+	}
+	if emailVerificationRequired(user) {
+		return nil, nil, ErrEmailNotVerified
+	}
+	if err := twofactor.GetService().Challenge(user); err != nil {
+		return nil, nil, err
 	}
 
-	// 生成 JWT Token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
+	tokens, err := session.GetService().Create(ctx, user, client)
 	if err != nil {
-		return nil, "", errors.New("生成令牌失败")
+		return nil, nil, err
 	}
 
-	return user.ToResp(), token, nil
+	return user.ToResp(), tokens, nil
 }
 
 // LoginByEmail 通过邮箱登录
-func (s *Service) LoginByEmail(ctx context.Context, email, password string) (*model.UserResp, string, error) {
+func (s *Service) LoginByEmail(ctx context.Context, email, password string, client session.Client) (*model.UserResp, *session.Tokens, error) {
 	s.ensureRepository()
-	user, err := s.repo.GetByEmail(ctx, email)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, "", errors.New("邮箱或密码错误")
-		}
-		return nil, "", err
+	if sso.PasswordLoginDisabled() {
+		return nil, nil, sso.ErrPasswordLoginDisabled
 	}
-
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, "", errors.New("邮箱或密码错误")
+	user, err := s.Authenticate(ctx, email, password, true)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, nil, errors.New("邮箱或密码错误")
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// 检查用户状态
 	if user.Status != "active" {
-		return nil, "", errors.New("用户账号已被禁用")
+		return nil, nil, errors.New("用户账号已被禁用")
+	}
+	if emailVerificationRequired(user) {
+		return nil, nil, ErrEmailNotVerified
+	}
+	if err := twofactor.GetService().Challenge(user); err != nil {
+		return nil, nil, err
 	}
 
-	// 生成 JWT Token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
+	tokens, err := session.GetService().Create(ctx, user, client)
 	if err != nil {
-		return nil, "", errors.New("生成令牌失败")
+		return nil, nil, err
 	}
 
-	return user.ToResp(), token, nil
+	return user.ToResp(), tokens, nil
 }
 
-// ChangePassword 修改密码
+// CompleteTwoFactorLogin 登录第二步：提交预认证令牌和验证码（或恢复码）换取登录令牌
+// 角色要求两步验证而用户尚未绑定时，本次提交同时完成绑定，并返回新生成的恢复码
+func (s *Service) CompleteTwoFactorLogin(ctx context.Context, preAuthToken, code string, client session.Client) (*model.UserResp, *session.Tokens, []string, error) {
+	s.ensureRepository()
+	user, recoveryCodes, err := twofactor.GetService().CompleteLogin(ctx, preAuthToken, code)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	tokens, err := session.GetService().Create(ctx, user, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return user.ToResp(), tokens, recoveryCodes, nil
+}
+
+// ChangePassword 修改密码，成功后注销该用户的全部会话
 func (s *Service) ChangePassword(ctx context.Context, userID uint, oldPassword, newPassword string) error {
 	s.ensureRepository()
 	user, err := s.repo.GetByID(ctx, userID)
@@ -236,7 +309,10 @@ func (s *Service) ChangePassword(ctx context.Context, userID uint, oldPassword,
 
 	// 验证旧密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)); err != nil {
-		return errors.New("旧密码错误")
+		return ErrOldPasswordMismatch
+	}
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
 	}
 
 	// 生成新密码哈希
@@ -246,7 +322,11 @@ func (s *Service) ChangePassword(ctx context.Context, userID uint, oldPassword,
 	}
 
 	user.PasswordHash = string(hashedPassword)
-	return s.repo.Update(ctx, user)
+	if err := s.repo.Update(ctx, user); err != nil {
+		return err
+	}
+	_, err = session.GetService().RevokeAll(ctx, user.ID, "", session.ReasonPasswordChanged)
+	return err
 }
 
 // UpdateUserStats 更新用户统计信息
@@ -278,11 +358,26 @@ func (s *Service) GetStats(ctx context.Context, userID uint) (*model.UserStats,
 		return nil, err
 	}
 
+	// 下载次数以传输日志为准，只回写这一列，避免读取统计时覆盖并发修改的其他字段
+	totalDownloads := user.TotalDownloads
+	if count, err := s.transferLogRepo.CountDownloadsByOwner(ctx, userID); err == nil {
+		totalDownloads = int(count)
+		if totalDownloads != user.TotalDownloads {
+			if err := s.repo.SetTotalDownloads(ctx, userID, totalDownloads); err != nil {
+				logger.Warn("同步下载次数失败", zap.Uint("user_id", userID), zap.Error(err))
+			}
+		}
+	}
+
+	// 未完成的分片上传会话在被回收前同样占用配额
+	pendingStorage, _ := s.chunkRepo.SumOpenSessionSize(ctx, userID, "")
+
 	return &model.UserStats{
 		UserID:         user.ID,
 		TotalUploads:   user.TotalUploads,
-		TotalDownloads: user.TotalDownloads,
+		TotalDownloads: totalDownloads,
 		TotalStorage:   user.TotalStorage,
+		PendingStorage: pendingStorage,
 		FileCount:      0, // TODO: 从 FileCode 表统计
 	}, nil
 }
@@ -290,15 +385,20 @@ func (s *Service) GetStats(ctx context.Context, userID uint) (*model.UserStats,
 // ==================== API Key 相关常量和类型 ====================
 
 const (
-	apiKeyPrefix   = "fcb_sk_"
-	maxUserAPIKeys = 5 // 每个用户最多保留的有效密钥数量
+	maxUserAPIKeys         = 5     // 每个用户最多保留的有效密钥数量
+	maxAPIKeyAllowedIPs    = 20    // 单个密钥来源地址白名单的最大条目数
+	maxAPIKeyRatePerMinute = 60000 // 单个密钥每分钟请求上限的最大值
 )
 
 // CreateAPIKeyReq 创建 API Key 请求
+// Scopes 至少包含一个权限范围；AllowedIPs 为 IP 或 CIDR，为空表示不限制；RateLimitPerMinute 为 0 表示不单独限流
 type CreateAPIKeyReq struct {
-	Name          string
-	ExpiresAt     *time.Time
-	ExpiresInDays *int64
+	Name               string
+	ExpiresAt          *time.Time
+	ExpiresInDays      *int64
+	Scopes             []string
+	AllowedIPs         []string
+	RateLimitPerMinute int
 }
 
 // CreateAPIKeyResp 创建 API Key 响应
@@ -309,13 +409,36 @@ type CreateAPIKeyResp struct {
 
 // APIKeyData API Key 数据
 type APIKeyData struct {
-	ID         uint
-	Name       string
-	Prefix     string
-	LastUsedAt *time.Time
-	ExpiresAt  *time.Time
-	CreatedAt  *time.Time
-	Revoked    bool
+	ID                 uint
+	Name               string
+	Prefix             string
+	Scopes             []string
+	AllowedIPs         []string
+	RateLimitPerMinute int
+	UsageCount         int64
+	LastUsedAt         *time.Time
+	LastUsedIP         string
+	ExpiresAt          *time.Time
+	CreatedAt          *time.Time
+	Revoked            bool
+}
+
+// newAPIKeyData 转换为对外展示的密钥信息，不包含密钥本身
+func newAPIKeyData(key *model.UserAPIKey) *APIKeyData {
+	return &APIKeyData{
+		ID:                 key.ID,
+		Name:               key.Name,
+		Prefix:             key.Prefix,
+		Scopes:             key.ScopeList(),
+		AllowedIPs:         key.AllowedIPList(),
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		UsageCount:         key.UsageCount,
+		LastUsedAt:         key.LastUsedAt,
+		LastUsedIP:         key.LastUsedIP,
+		ExpiresAt:          key.ExpiresAt,
+		CreatedAt:          &key.CreatedAt,
+		Revoked:            key.Revoked,
+	}
 }
 
 // ==================== API Key 方法 ====================
@@ -359,21 +482,34 @@ func (s *Service) CreateAPIKey(ctx context.Context, userID uint, req *CreateAPIK
 	// 处理过期时间
 	var expiresAt *time.Time
 	if req.ExpiresAt != nil {
-		if req.ExpiresAt.After(time.Now().Add(-1 * time.Minute)) {
-			t := req.ExpiresAt.UTC()
-			expiresAt = &t
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("过期时间必须晚于当前时间")
 		}
+		t := req.ExpiresAt.UTC()
+		expiresAt = &t
 	} else if req.ExpiresInDays != nil && *req.ExpiresInDays > 0 {
 		t := time.Now().UTC().Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
 		expiresAt = &t
 	}
 
+	scopes, err := s.normalizeAPIKeyScopes(ctx, userID, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	allowedIPs, err := normalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if req.RateLimitPerMinute < 0 || req.RateLimitPerMinute > maxAPIKeyRatePerMinute {
+		return nil, fmt.Errorf("每分钟请求上限必须在 0 到 %d 之间", maxAPIKeyRatePerMinute)
+	}
+
 	// 生成随机密钥
 	randomPart, err := GenerateRandomKey()
 	if err != nil {
 		return nil, fmt.Errorf("生成随机密钥失败: %w", err)
 	}
-	plainKey := apiKeyPrefix + randomPart
+	plainKey := model.APIKeyPrefix + randomPart
 	keyHash := HashAPIKey(plainKey)
 	keyPrefix := GetKeyPrefix(plainKey)
 
@@ -388,12 +524,15 @@ func (s *Service) CreateAPIKey(ctx context.Context, userID uint, req *CreateAPIK
 
 	// 创建记录
 	record := &model.UserAPIKey{
-		UserID:    userID,
-		Name:      name,
-		Prefix:    keyPrefix,
-		KeyHash:   keyHash,
-		ExpiresAt: expiresAt,
-		Revoked:   false,
+		UserID:             userID,
+		Name:               name,
+		Prefix:             keyPrefix,
+		KeyHash:            keyHash,
+		Scopes:             strings.Join(scopes, ","),
+		AllowedIPs:         strings.Join(allowedIPs, ","),
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		ExpiresAt:          expiresAt,
+		Revoked:            false,
 	}
 
 	if err := s.apiKeyRepo.Create(ctx, record); err != nil {
@@ -401,19 +540,70 @@ func (s *Service) CreateAPIKey(ctx context.Context, userID uint, req *CreateAPIK
 	}
 
 	return &CreateAPIKeyResp{
-		Key: plainKey,
-		APIKey: &APIKeyData{
-			ID:         record.ID,
-			Name:       record.Name,
-			Prefix:     record.Prefix,
-			LastUsedAt: record.LastUsedAt,
-			ExpiresAt:  record.ExpiresAt,
-			CreatedAt:  &record.CreatedAt,
-			Revoked:    record.Revoked,
-		},
+		Key:    plainKey,
+		APIKey: newAPIKeyData(record),
 	}, nil
 }
 
+// normalizeAPIKeyScopes 校验并去重权限范围，admin:* 只有管理员可以授予
+func (s *Service) normalizeAPIKeyScopes(ctx context.Context, userID uint, requested []string) ([]string, error) {
+	var scopes []string
+	for _, scope := range requested {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || slices.Contains(scopes, scope) {
+			continue
+		}
+		if !slices.Contains(model.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("未知的权限范围: %s", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("请至少选择一个权限范围: %s", strings.Join(model.APIKeyScopes, ", "))
+	}
+
+	if slices.Contains(scopes, model.APIKeyScopeAdmin) {
+		user, err := s.repo.GetByID(ctx, userID)
+		if err != nil {
+			return nil, errors.New("用户不存在")
+		}
+		if user.Role != "admin" {
+			return nil, errors.New("只有管理员可以授予 admin:* 权限范围")
+		}
+	}
+	return scopes, nil
+}
+
+// normalizeAllowedIPs 校验来源地址白名单，单个 IP 和 CIDR 均按网段格式保存
+func normalizeAllowedIPs(entries []string) ([]string, error) {
+	var result []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var network string
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			network = ipNet.String()
+		} else if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			network = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		} else {
+			return nil, fmt.Errorf("无效的 IP 或网段: %s", entry)
+		}
+		if !slices.Contains(result, network) {
+			result = append(result, network)
+		}
+	}
+	if len(result) > maxAPIKeyAllowedIPs {
+		return nil, fmt.Errorf("来源地址白名单最多 %d 条", maxAPIKeyAllowedIPs)
+	}
+	return result, nil
+}
+
 // ListAPIKeys 获取用户的全部 API Key 列表（包含已撤销）
 func (s *Service) ListAPIKeys(ctx context.Context, userID uint) ([]*APIKeyData, error) {
 	s.ensureRepository()
@@ -425,15 +615,7 @@ func (s *Service) ListAPIKeys(ctx context.Context, userID uint) ([]*APIKeyData,
 
 	result := make([]*APIKeyData, len(keys))
 	for i, key := range keys {
-		result[i] = &APIKeyData{
-			ID:         key.ID,
-			Name:       key.Name,
-			Prefix:     key.Prefix,
-			LastUsedAt: key.LastUsedAt,
-			ExpiresAt:  key.ExpiresAt,
-			CreatedAt:  &key.CreatedAt,
-			Revoked:    key.Revoked,
-		}
+		result[i] = newAPIKeyData(key)
 	}
 
 	return result, nil
@@ -456,7 +638,19 @@ func (s *Service) DeleteAPIKey(ctx context.Context, userID, id uint) error {
 // ==================== 用户文件列表方法 ====================
 
 // GetUserFiles 获取用户文件列表（支持分页）
-func (s *Service) GetUserFiles(ctx context.Context, userID uint, page, pageSize int) (*usermodel.UserFileList, error) {
+// UserFileItem 用户文件列表项，在 IDL 定义的基础上补充 MIME 类型
+type UserFileItem struct {
+	*usermodel.UserFileItem
+	MimeType string `json:"mime_type"`
+}
+
+// UserFileList 用户文件列表
+type UserFileList struct {
+	Files      []*UserFileItem               `json:"files"`
+	Pagination *usermodel.UserFilePagination `json:"pagination"`
+}
+
+func (s *Service) GetUserFiles(ctx context.Context, userID uint, page, pageSize int) (*UserFileList, error) {
 	fileCodeRepo := dao.NewFileCodeRepository()
 
 	// 获取文件列表
@@ -466,30 +660,23 @@ func (s *Service) GetUserFiles(ctx context.Context, userID uint, page, pageSize
 	}
 
 	// 转换为响应格式
-	fileItems := make([]*usermodel.UserFileItem, len(files))
+	fileItems := make([]*UserFileItem, len(files))
 	for i, file := range files {
-		// 提取文件名（从 UUIDFileName 或 FilePath 中获取）
-		fileName := file.UUIDFileName
-		if fileName == "" && file.FilePath != "" {
-			// 从路径中提取文件名
-			parts := strings.Split(file.FilePath, "/")
-			if len(parts) > 0 {
-				fileName = parts[len(parts)-1]
-			}
-		}
-
-		fileItems[i] = &usermodel.UserFileItem{
-			Id:           uint32(file.ID),
-			Code:         file.Code,
-			Prefix:       file.Prefix,
-			Suffix:       file.Suffix,
-			FileName:     fileName,
-			FilePath:     file.FilePath,
-			Size:         file.Size,
-			ExpiredCount: int32(file.ExpiredCount),
-			UsedCount:    int32(file.UsedCount),
-			CreatedAt:    file.CreatedAt.Format("2006-01-02 15:04:05"),
-			UpdatedAt:    file.UpdatedAt.Format("2006-01-02 15:04:05"),
+		fileItems[i] = &UserFileItem{
+			UserFileItem: &usermodel.UserFileItem{
+				Id:           uint32(file.ID),
+				Code:         file.Code,
+				Prefix:       file.Prefix,
+				Suffix:       file.Suffix,
+				FileName:     file.FileName(),
+				FilePath:     file.FilePath,
+				Size:         file.Size,
+				ExpiredCount: int32(file.ExpiredCount),
+				UsedCount:    int32(file.UsedCount),
+				CreatedAt:    file.CreatedAt.Format("2006-01-02 15:04:05"),
+				UpdatedAt:    file.UpdatedAt.Format("2006-01-02 15:04:05"),
+			},
+			MimeType: file.MimeType,
 		}
 
 		// 格式化过期时间
@@ -504,7 +691,7 @@ func (s *Service) GetUserFiles(ctx context.Context, userID uint, page, pageSize
 		totalPages = 1
 	}
 
-	return &usermodel.UserFileList{
+	return &UserFileList{
 		Files: fileItems,
 		Pagination: &usermodel.UserFilePagination{
 			Page:       int32(page),
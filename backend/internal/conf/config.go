@@ -16,6 +16,11 @@ type AppConfiguration struct {
 	Upload   UploadConfig   `mapstructure:"upload"`
 	Download DownloadConfig `mapstructure:"download"`
 	Storage  StorageConfig  `mapstructure:"storage"`
+
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
+	LDAP      LDAPConfig      `mapstructure:"ldap"`
 }
 
 // SetGlobalConfig 设置全局配置
@@ -35,6 +40,8 @@ type ServerConfig struct {
 	Mode         string `mapstructure:"mode"` // debug, release, test
 	ReadTimeout  int    `mapstructure:"read_timeout"`
 	WriteTimeout int    `mapstructure:"write_timeout"`
+	// TrustedProxies 受信任的反向代理（IP 或 CIDR），只有来自这些地址的请求才采用 X-Forwarded-For / X-Real-IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig 数据库配置
@@ -85,9 +92,47 @@ type UserConfig struct {
 	RequireEmailVerify    bool   `mapstructure:"require_email_verify"`
 	UserUploadSize        int64  `mapstructure:"user_upload_size"`
 	UserStorageQuota      int64  `mapstructure:"user_storage_quota"`
-	SessionExpiryHours    int    `mapstructure:"session_expiry_hours"`
-	MaxSessionsPerUser    int    `mapstructure:"max_sessions_per_user"`
+	SessionExpiryHours    int    `mapstructure:"session_expiry_hours"`  // 刷新令牌闲置多久后失效
+	MaxSessionsPerUser    int    `mapstructure:"max_sessions_per_user"` // 超出后自动注销最早登录的会话
+	AccessTokenMinutes    int    `mapstructure:"access_token_minutes"`  // 访问令牌有效期
 	JWTSecret             string `mapstructure:"jwt_secret"`
+
+	JWTKeys       []JWTKeyConfig `mapstructure:"jwt_keys"`        // 访问令牌签名密钥集合，为空时使用 jwt_secret
+	JWTCurrentKey string         `mapstructure:"jwt_current_key"` // 签发新令牌使用的密钥 ID，为空时使用第一个
+
+	RoleLimits map[string]RoleLimit `mapstructure:"role_limits"` // 按角色覆盖默认上传限制
+	TwoFactor  TwoFactorConfig      `mapstructure:"two_factor"`
+
+	AuthProviders []string `mapstructure:"auth_providers"` // 密码登录依次尝试的认证方式：local、ldap
+
+	InviteQuota           int `mapstructure:"invite_quota"`            // 普通用户可以创建的邀请码数量，0 表示不能邀请，-1 表示不限制
+	InvitationExpireHours int `mapstructure:"invitation_expire_hours"` // 未指定有效期时邀请码的有效期（小时）
+
+	DeletionGraceDays    int `mapstructure:"deletion_grace_days"`    // 申请删除账号到清除数据的宽限期（天）
+	DeletionPurgeMinutes int `mapstructure:"deletion_purge_minutes"` // 清除到期账号的执行间隔（分钟），0 表示不清除
+}
+
+// JWTKeyConfig 访问令牌签名密钥
+// 轮换时添加新密钥并设为 jwt_current_key，旧密钥保留到其签发的访问令牌全部过期后再删除
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`               // 写入令牌头部的 kid
+	Algorithm      string `mapstructure:"algorithm"`        // HS256（默认）、EdDSA 或 RS256
+	Secret         string `mapstructure:"secret"`           // HS256 密钥
+	PrivateKeyFile string `mapstructure:"private_key_file"` // EdDSA/RS256 私钥（PEM）
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // 只有公钥的密钥只用于验证
+}
+
+// TwoFactorConfig 两步验证配置
+type TwoFactorConfig struct {
+	Issuer        string   `mapstructure:"issuer"`         // 验证器应用中显示的发行方名称
+	RequiredRoles []string `mapstructure:"required_roles"` // 必须开启两步验证的角色，未绑定的用户登录时需要先完成绑定
+}
+
+// RoleLimit 角色默认上传限制：0 表示沿用全局配置，-1 表示不限制
+type RoleLimit struct {
+	UploadSize   int64 `mapstructure:"upload_size"`
+	StorageQuota int64 `mapstructure:"storage_quota"`
+	InviteQuota  int   `mapstructure:"invite_quota"`
 }
 
 // UploadConfig 上传配置
@@ -96,8 +141,25 @@ type UploadConfig struct {
 	UploadSize     int64 `mapstructure:"upload_size"`
 	EnableChunk    bool  `mapstructure:"enable_chunk"`
 	ChunkSize      int64 `mapstructure:"chunk_size"`
-	MaxSaveSeconds int   `mapstructure:"max_save_seconds"`
+	MaxSaveSeconds int   `mapstructure:"max_save_seconds"` // 匿名分享最长有效期（秒），0 表示不限制
 	RequireLogin   bool  `mapstructure:"require_login"`
+	MaxVersions    int   `mapstructure:"max_versions"` // 每个分享保留的历史版本数
+
+	MaxSessionsPerUser int `mapstructure:"max_sessions_per_user"` // 每个登录用户同时未完成的分片上传数
+	MaxSessionsPerIP   int `mapstructure:"max_sessions_per_ip"`   // 每个 IP 同时未完成的匿名分片上传数
+	SessionTTLHours    int `mapstructure:"session_ttl_hours"`     // 分片上传会话闲置多久后被回收
+	SessionGCMinutes   int `mapstructure:"session_gc_minutes"`    // 回收任务的执行间隔
+
+	Anonymous AnonymousUploadConfig `mapstructure:"anonymous"` // 匿名上传限制
+}
+
+// AnonymousUploadConfig 匿名上传限制，按客户端 IP 在固定窗口内统计，0 表示不限制
+// 匿名分享的最长有效期由 UploadConfig.MaxSaveSeconds 控制
+type AnonymousUploadConfig struct {
+	AllowFile     bool  `mapstructure:"allow_file"`     // 是否允许匿名上传文件，关闭后仍可匿名分享文本
+	WindowSeconds int   `mapstructure:"window_seconds"` // 统计窗口长度
+	MaxUploads    int   `mapstructure:"max_uploads"`    // 每个 IP 窗口内最多上传次数（文件和文本）
+	MaxBytes      int64 `mapstructure:"max_bytes"`      // 每个 IP 窗口内最多上传字节数
 }
 
 // DownloadConfig 下载配置
@@ -106,6 +168,106 @@ type DownloadConfig struct {
 	MaxConcurrentDownloads   int  `mapstructure:"max_concurrent_downloads"`
 	DownloadTimeout          int  `mapstructure:"download_timeout"`
 	RequireLogin             bool `mapstructure:"require_login"`
+
+	Guard LookupGuardConfig `mapstructure:"guard"` // 分享码查找的暴力破解防护
+}
+
+// LookupGuardConfig 分享码查找防护：窗口内查找失败（分享码不存在或密码错误）次数过多时封禁，
+// 同一对象再次被封禁时封禁时长翻倍
+type LookupGuardConfig struct {
+	Enabled           bool `mapstructure:"enabled"`
+	WindowSeconds     int  `mapstructure:"window_seconds"`      // 失败次数的统计窗口
+	MaxFailures       int  `mapstructure:"max_failures"`        // 每个 IP 窗口内允许的失败次数，0 表示不按 IP 封禁
+	PrefixLength      int  `mapstructure:"prefix_length"`       // 按分享码前几位统计，0 表示不按前缀统计
+	MaxPrefixFailures int  `mapstructure:"max_prefix_failures"` // 每个 IP 对同一前缀窗口内允许的失败次数，封禁后只拒绝该前缀下不存在的分享码
+	// 所有 IP 对同一前缀窗口内合计允许的失败次数，0 表示不限制；封禁时长固定为 block_seconds
+	MaxGlobalPrefixFailures int `mapstructure:"max_global_prefix_failures"`
+	BlockSeconds            int `mapstructure:"block_seconds"`     // 首次封禁时长
+	MaxBlockSeconds         int `mapstructure:"max_block_seconds"` // 封禁时长上限
+}
+
+// MailConfig 邮件配置
+type MailConfig struct {
+	Driver   string `mapstructure:"driver"` // smtp 或 log（写入文件，用于开发和测试）
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	TLS      bool   `mapstructure:"tls"` // 使用隐式 TLS（465 端口默认开启），否则在服务器支持时使用 STARTTLS
+	Dir      string `mapstructure:"dir"` // log 驱动写入邮件的目录
+
+	BaseURL               string `mapstructure:"base_url"`                 // 邮件中链接指向的站点地址
+	VerifyTokenTTLMinutes int    `mapstructure:"verify_token_ttl_minutes"` // 邮箱验证链接有效期
+	ResetTokenTTLMinutes  int    `mapstructure:"reset_token_ttl_minutes"`  // 重置密码链接有效期
+}
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	DisablePasswordLogin bool                 `mapstructure:"disable_password_login"` // 关闭本地密码登录和注册，只允许单点登录
+	SkipTwoFactor        bool                 `mapstructure:"skip_two_factor"`        // 单点登录不再校验本地两步验证，只应在身份提供方强制多因素认证时开启
+	BaseURL              string               `mapstructure:"base_url"`               // 站点地址，用于生成回调地址，为空时使用 mail.base_url
+	Providers            []OIDCProviderConfig `mapstructure:"providers"`
+}
+
+// OIDCProviderConfig 单个身份提供方
+type OIDCProviderConfig struct {
+	Name         string   `mapstructure:"name"`         // 出现在登录和回调地址中的标识
+	DisplayName  string   `mapstructure:"display_name"` // 登录按钮上显示的名称
+	Issuer       string   `mapstructure:"issuer"`       // 发现文档地址为 {issuer}/.well-known/openid-configuration
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"` // 为空时按公共客户端处理，只依赖 PKCE
+	Scopes       []string `mapstructure:"scopes"`        // 默认 openid profile email
+	RedirectURL  string   `mapstructure:"redirect_url"`  // 默认 {base_url}/user/oidc/{name}/callback
+
+	AutoProvision bool              `mapstructure:"auto_provision"` // 首次登录时自动创建本地用户
+	LinkByEmail   bool              `mapstructure:"link_by_email"`  // 按已验证的邮箱关联已有本地用户
+	RoleClaim     string            `mapstructure:"role_claim"`     // 用于映射角色的声明，例如 groups
+	RoleMapping   map[string]string `mapstructure:"role_mapping"`   // 声明值到本地角色（admin、user）的映射
+	DefaultRole   string            `mapstructure:"default_role"`   // 没有匹配的映射时使用的角色，为空时拒绝登录
+}
+
+// LDAPConfig LDAP / Active Directory 认证配置，需要在 user.auth_providers 中加入 ldap 才会使用
+type LDAPConfig struct {
+	URL                string `mapstructure:"url"`       // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool   `mapstructure:"start_tls"` // ldap:// 连接建立后升级为 TLS
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	CACertFile         string `mapstructure:"ca_cert_file"` // 校验服务器证书的 CA（PEM），为空时使用系统证书
+	TimeoutSeconds     int    `mapstructure:"timeout_seconds"`
+
+	BindDN       string `mapstructure:"bind_dn"` // 搜索用户使用的服务账号，为空时匿名搜索
+	BindPassword string `mapstructure:"bind_password"`
+
+	BaseDN               string `mapstructure:"base_dn"`
+	UserFilter           string `mapstructure:"user_filter"`        // 用户条目的过滤条件
+	UsernameAttribute    string `mapstructure:"username_attribute"` // 登录名对应的属性
+	EmailAttribute       string `mapstructure:"email_attribute"`
+	DisplayNameAttribute string `mapstructure:"display_name_attribute"`
+	GroupAttribute       string `mapstructure:"group_attribute"` // 用户条目中列出所属组的属性
+	GroupBaseDN          string `mapstructure:"group_base_dn"`   // 配置后在该节点下按 group_filter 搜索组
+	GroupFilter          string `mapstructure:"group_filter"`    // 支持 {dn} 和 {username} 占位符
+	DisabledFilter       string `mapstructure:"disabled_filter"` // 匹配已禁用账号的过滤条件
+
+	AutoProvision       bool              `mapstructure:"auto_provision"`        // 首次登录时自动创建本地用户
+	LinkExisting        bool              `mapstructure:"link_existing"`         // 关联用户名相同的已有本地用户
+	RoleMapping         map[string]string `mapstructure:"role_mapping"`          // 组的完整 DN 到本地角色的映射
+	RoleMappingByName   bool              `mapstructure:"role_mapping_by_name"`  // role_mapping 的键也可以是组名（第一个 RDN 的值，例如 CN）
+	DefaultRole         string            `mapstructure:"default_role"`          // 配置了 role_mapping 但没有匹配时使用的角色，为空时拒绝登录
+	SyncIntervalMinutes int               `mapstructure:"sync_interval_minutes"` // 同步目录中禁用状态的间隔，0 表示不同步
+}
+
+// RateLimitConfig 接口限流配置，按路由组声明策略
+// 已连接 Redis 时各实例共享限额，否则每个实例单独计数
+type RateLimitConfig struct {
+	Enabled  bool                       `mapstructure:"enabled"`
+	Policies map[string]RateLimitPolicy `mapstructure:"policies"` // 键为路由组：upload、download、login、admin
+}
+
+// RateLimitPolicy 单个路由组的限流策略
+type RateLimitPolicy struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"` // 持续速率，0 表示不限流
+	Burst             int     `mapstructure:"burst"`               // 允许的突发请求数
+	Key               string  `mapstructure:"key"`                 // ip 或 user（未登录时按 IP）
 }
 
 // StorageConfig 存储配置
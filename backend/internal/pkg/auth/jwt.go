@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"errors"
 	"time"
 
@@ -10,39 +13,51 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("token has expired")
-	jwtSecret       = []byte("FileCodeBox2025SecretKey") // 应该从配置文件读取
+	ErrRevokedToken = errors.New("token has been revoked")
+	jwtSecret       = []byte("FileCodeBox2025SecretKey") // 启动时由 SetJWTSecret 替换为配置中的 user.jwt_secret
 )
 
 // Claims JWT claims
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成 JWT token
-func GenerateToken(userID uint, username, role string) (string, error) {
+// SessionChecker 校验访问令牌所属的会话是否仍然有效，由会话服务在启动时注册
+type SessionChecker func(ctx context.Context, claims *Claims) error
+
+var sessionChecker SessionChecker
+
+// SetSessionChecker 注册会话校验函数
+func SetSessionChecker(fn SessionChecker) {
+	sessionChecker = fn
+}
+
+// GenerateToken 为指定会话生成短期访问令牌
+func GenerateToken(userID uint, username, role, sessionID string, ttl time.Duration) (string, error) {
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour * 7)), // 7天过期
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "FileCodeBox",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signWithCurrentKey(claims)
 }
 
-// ParseToken 解析 JWT token
+// ParseToken 解析 JWT token，只校验签名和有效期
+// 按头部的 kid 选择验证密钥，轮换后旧密钥签发的令牌在过期前仍然有效
 func ParseToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	ks := activeKeys()
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verifyingKey(ks), jwt.WithValidMethods(ks.methods))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -58,23 +73,121 @@ func ParseToken(tokenString string) (*Claims, error) {
 	return nil, ErrInvalidToken
 }
 
-// RefreshToken 刷新 token
-func RefreshToken(tokenString string) (string, error) {
+// ValidateToken 解析访问令牌并确认其所属会话未被撤销，认证中间件应使用它而不是 ParseToken
+func ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
 	claims, err := ParseToken(tokenString)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if sessionChecker != nil {
+		if err := sessionChecker(ctx, claims); err != nil {
+			return nil, ErrRevokedToken
+		}
 	}
+	return claims, nil
+}
 
-	// 生成新的 token
-	return GenerateToken(claims.UserID, claims.Username, claims.Role)
+// PreAuthClaims 密码校验通过、两步验证尚未完成时签发的临时令牌
+// 使用独立的派生密钥签名，ParseToken 不会接受它，只能用于提交验证码
+type PreAuthClaims struct {
+	UserID uint `json:"user_id"`
+	jwt.RegisteredClaims
 }
 
-// GenerateAdminToken 生成管理员 token (24小时过期)
-func GenerateAdminToken(userID uint, username string) (string, error) {
-	return GenerateToken(userID, username, "admin")
+const preAuthAudience = "pre-auth"
+
+// GeneratePreAuthToken 生成两步验证用的临时令牌
+func GeneratePreAuthToken(userID uint, ttl time.Duration) (string, error) {
+	claims := &PreAuthClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "FileCodeBox",
+			Audience:  jwt.ClaimStrings{preAuthAudience},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(Sign(preAuthAudience))
+}
+
+// ParsePreAuthToken 解析两步验证用的临时令牌
+func ParsePreAuthToken(tokenString string) (*PreAuthClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &PreAuthClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return Sign(preAuthAudience), nil
+	}, jwt.WithAudience(preAuthAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims, ok := token.Claims.(*PreAuthClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// OIDCStateClaims 单点登录跳转到身份提供方前保存在 Cookie 中的状态
+// 回调时校验 state 防止 CSRF，nonce 和 PKCE 校验码分别用于校验 ID Token 和换取令牌
+type OIDCStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect,omitempty"`
+	jwt.RegisteredClaims
+}
+
+const oidcStateAudience = "oidc-state"
+
+// GenerateOIDCStateToken 生成单点登录状态令牌
+func GenerateOIDCStateToken(state *OIDCStateClaims, ttl time.Duration) (string, error) {
+	claims := *state
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "FileCodeBox",
+		Audience:  jwt.ClaimStrings{oidcStateAudience},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	return token.SignedString(Sign(oidcStateAudience))
+}
+
+// ParseOIDCStateToken 解析单点登录状态令牌
+func ParseOIDCStateToken(tokenString string) (*OIDCStateClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &OIDCStateClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return Sign(oidcStateAudience), nil
+	}, jwt.WithAudience(oidcStateAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims, ok := token.Claims.(*OIDCStateClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
 }
 
 // SetJWTSecret 设置 JWT secret（从配置文件）
+// 未配置密钥集合时它同时是访问令牌的 HS256 签名密钥；邮件链接、两步验证预认证令牌和单点登录状态始终使用它派生的密钥签名
 func SetJWTSecret(secret string) {
 	jwtSecret = []byte(secret)
 }
+
+// Sign 使用 JWT 密钥对 data 计算 HMAC-SHA256，用于邮件链接等一次性令牌的签名
+func Sign(data string) []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
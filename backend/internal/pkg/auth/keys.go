@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultKeyID 未配置密钥集合时，由 jwt_secret 生成的 HS256 密钥使用的 kid
+const DefaultKeyID = "default"
+
+// KeySpec 一个签名密钥的配置
+// Algorithm 为 HS256（默认）、EdDSA 或 RS256；HS256 使用 Secret，非对称算法使用 PEM 格式的密钥，
+// 只提供公钥的密钥只用于验证，适合轮换后保留旧密钥
+type KeySpec struct {
+	ID            string
+	Algorithm     string
+	Secret        string
+	PrivateKeyPEM []byte
+	PublicKeyPEM  []byte
+}
+
+// key 解析后的签名密钥，signKey 为 nil 表示只用于验证
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// keySet 签名密钥集合：新令牌使用 current 签名，集合中的其他密钥仍可验证旧令牌
+type keySet struct {
+	current *key
+	keys    map[string]*key
+	methods []string
+}
+
+// configuredKeys 通过 SetKeys 配置的密钥集合，为 nil 时使用 jwt_secret 生成的默认密钥
+var configuredKeys *keySet
+
+// SetKeys 配置签名密钥集合，currentID 为空时使用第一个密钥签发新令牌
+func SetKeys(currentID string, specs []KeySpec) error {
+	if len(specs) == 0 {
+		configuredKeys = nil
+		return nil
+	}
+
+	ks := &keySet{keys: make(map[string]*key, len(specs))}
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		k, err := newKey(spec)
+		if err != nil {
+			return err
+		}
+		if ks.keys[k.id] != nil {
+			return fmt.Errorf("JWT 密钥 ID 重复: %s", k.id)
+		}
+		ks.keys[k.id] = k
+		if !seen[k.method.Alg()] {
+			seen[k.method.Alg()] = true
+			ks.methods = append(ks.methods, k.method.Alg())
+		}
+	}
+
+	if currentID == "" {
+		currentID = specs[0].ID
+	}
+	ks.current = ks.keys[currentID]
+	if ks.current == nil {
+		return fmt.Errorf("当前 JWT 密钥 %q 不在密钥列表中", currentID)
+	}
+	if ks.current.signKey == nil {
+		return fmt.Errorf("当前 JWT 密钥 %q 缺少私钥，无法签发令牌", currentID)
+	}
+
+	configuredKeys = ks
+	return nil
+}
+
+// activeKeys 返回当前生效的密钥集合
+func activeKeys() *keySet {
+	if ks := configuredKeys; ks != nil {
+		return ks
+	}
+	k := &key{id: DefaultKeyID, method: jwt.SigningMethodHS256, signKey: jwtSecret, verifyKey: jwtSecret}
+	return &keySet{current: k, keys: map[string]*key{k.id: k}, methods: []string{k.method.Alg()}}
+}
+
+// newKey 解析一个密钥配置
+func newKey(spec KeySpec) (*key, error) {
+	if spec.ID == "" {
+		return nil, errors.New("JWT 密钥缺少 id")
+	}
+	k := &key{id: spec.ID}
+	var err error
+	switch strings.ToUpper(spec.Algorithm) {
+	case "", "HS256":
+		if spec.Secret == "" {
+			return nil, fmt.Errorf("JWT 密钥 %s 缺少 secret", spec.ID)
+		}
+		k.method = jwt.SigningMethodHS256
+		k.signKey = []byte(spec.Secret)
+		k.verifyKey = k.signKey
+	case "EDDSA", "ED25519":
+		k.method = jwt.SigningMethodEdDSA
+		if len(spec.PrivateKeyPEM) > 0 {
+			var priv interface{}
+			if priv, err = jwt.ParseEdPrivateKeyFromPEM(spec.PrivateKeyPEM); err != nil {
+				return nil, fmt.Errorf("解析 JWT 密钥 %s 的私钥失败: %w", spec.ID, err)
+			}
+			k.signKey = priv
+			k.verifyKey = priv.(ed25519.PrivateKey).Public()
+		} else if len(spec.PublicKeyPEM) > 0 {
+			if k.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(spec.PublicKeyPEM); err != nil {
+				return nil, fmt.Errorf("解析 JWT 密钥 %s 的公钥失败: %w", spec.ID, err)
+			}
+		} else {
+			return nil, fmt.Errorf("JWT 密钥 %s 缺少私钥或公钥", spec.ID)
+		}
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		if len(spec.PrivateKeyPEM) > 0 {
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(spec.PrivateKeyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("解析 JWT 密钥 %s 的私钥失败: %w", spec.ID, err)
+			}
+			k.signKey = priv
+			k.verifyKey = &priv.PublicKey
+		} else if len(spec.PublicKeyPEM) > 0 {
+			if k.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(spec.PublicKeyPEM); err != nil {
+				return nil, fmt.Errorf("解析 JWT 密钥 %s 的公钥失败: %w", spec.ID, err)
+			}
+		} else {
+			return nil, fmt.Errorf("JWT 密钥 %s 缺少私钥或公钥", spec.ID)
+		}
+	default:
+		return nil, fmt.Errorf("JWT 密钥 %s 使用了不支持的算法 %s", spec.ID, spec.Algorithm)
+	}
+	return k, nil
+}
+
+// signWithCurrentKey 使用当前密钥签名，并在头部写入 kid
+func signWithCurrentKey(claims jwt.Claims) (string, error) {
+	k := activeKeys().current
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.signKey)
+}
+
+// verifyingKey 根据令牌头部的 kid 选择验证密钥，没有 kid 时使用当前密钥
+func verifyingKey(ks *keySet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		k := ks.current
+		if kid, ok := token.Header["kid"].(string); ok {
+			if k = ks.keys[kid]; k == nil {
+				return nil, ErrInvalidToken
+			}
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return k.verifyKey, nil
+	}
+}
+
+// PublicJWKs 以 JWK 格式返回非对称密钥的公钥（RFC 7517），供其他服务验证本服务签发的令牌
+// HS256 密钥是共享密钥，不会出现在结果中
+func PublicJWKs() []map[string]string {
+	ks := activeKeys()
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		k := ks.keys[id]
+		switch pub := k.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"kid": k.id,
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"kid": k.id,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	return jwks
+}
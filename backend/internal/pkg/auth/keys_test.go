@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// resetKeys 测试结束后恢复为 jwt_secret 生成的默认密钥
+func resetKeys(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { configuredKeys = nil })
+}
+
+func edKeyPEM(t *testing.T) (ed25519.PublicKey, []byte, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, encodePrivate(t, priv), encodePublic(t, pub)
+}
+
+func rsaKeyPEM(t *testing.T) (*rsa.PublicKey, []byte, []byte) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &priv.PublicKey, encodePrivate(t, priv), encodePublic(t, &priv.PublicKey)
+}
+
+func encodePrivate(t *testing.T, priv interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func encodePublic(t *testing.T, pub interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func mustToken(t *testing.T, userID uint) string {
+	t.Helper()
+	token, err := GenerateToken(userID, "alice", "user", "sid", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestSetKeysValidation(t *testing.T) {
+	resetKeys(t)
+	_, _, edPub := edKeyPEM(t)
+
+	cases := map[string]struct {
+		current string
+		specs   []KeySpec
+	}{
+		"缺少 id":     {"", []KeySpec{{Secret: testSecret}}},
+		"缺少 secret": {"", []KeySpec{{ID: "a"}}},
+		"不支持的算法":    {"", []KeySpec{{ID: "a", Algorithm: "ES256", Secret: testSecret}}},
+		"缺少非对称密钥":   {"", []KeySpec{{ID: "a", Algorithm: "EdDSA"}}},
+		"无效的 PEM":   {"", []KeySpec{{ID: "a", Algorithm: "RS256", PrivateKeyPEM: []byte("bad")}}},
+		"id 重复":     {"", []KeySpec{{ID: "a", Secret: testSecret}, {ID: "a", Secret: testSecret}}},
+		"当前密钥不存在":   {"b", []KeySpec{{ID: "a", Secret: testSecret}}},
+		"当前密钥只有公钥":  {"", []KeySpec{{ID: "a", Algorithm: "EdDSA", PublicKeyPEM: edPub}}},
+	}
+	for name, c := range cases {
+		if err := SetKeys(c.current, c.specs); err == nil {
+			t.Errorf("%s: 没有返回错误", name)
+		}
+		if configuredKeys != nil {
+			t.Fatalf("%s: 配置失败后密钥集合被替换", name)
+		}
+	}
+
+	// 当前密钥为空时使用第一个密钥
+	if err := SetKeys("", []KeySpec{{ID: "a", Secret: testSecret}, {ID: "b", Secret: testSecret + "b"}}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+	if kid := tokenKid(t, mustToken(t, 1)); kid != "a" {
+		t.Fatalf("签名使用了 %q", kid)
+	}
+
+	// 传入空列表恢复默认密钥
+	if err := SetKeys("", nil); err != nil || configuredKeys != nil {
+		t.Fatalf("清空密钥集合: %v", err)
+	}
+	if kid := tokenKid(t, mustToken(t, 1)); kid != DefaultKeyID {
+		t.Fatalf("默认密钥的 kid 为 %q", kid)
+	}
+}
+
+func TestRotationVerifiesByKid(t *testing.T) {
+	resetKeys(t)
+	_, edPriv, edPub := edKeyPEM(t)
+
+	if err := SetKeys("old", []KeySpec{{ID: "old", Secret: testSecret}}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+	oldToken := mustToken(t, 1)
+
+	// 轮换到 EdDSA 新密钥，旧密钥保留用于验证
+	if err := SetKeys("new", []KeySpec{
+		{ID: "new", Algorithm: "EdDSA", PrivateKeyPEM: edPriv},
+		{ID: "old", Secret: testSecret},
+	}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+	newToken := mustToken(t, 2)
+	if kid := tokenKid(t, newToken); kid != "new" {
+		t.Fatalf("新令牌的 kid 为 %q", kid)
+	}
+	for token, userID := range map[string]uint{oldToken: 1, newToken: 2} {
+		claims, err := ParseToken(token)
+		if err != nil || claims.UserID != userID {
+			t.Fatalf("轮换后验证用户 %d 的令牌: claims=%v err=%v", userID, claims, err)
+		}
+	}
+
+	// 再次轮换：new 只保留公钥，old 删除
+	if err := SetKeys("next", []KeySpec{
+		{ID: "next", Secret: testSecret + "next"},
+		{ID: "new", Algorithm: "EdDSA", PublicKeyPEM: edPub},
+	}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+	if _, err := ParseToken(newToken); err != nil {
+		t.Fatalf("只有公钥的密钥无法验证: %v", err)
+	}
+	if _, err := ParseToken(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("已删除密钥签发的令牌返回 %v", err)
+	}
+}
+
+func TestRejectUnknownKidAndAlgorithmMismatch(t *testing.T) {
+	resetKeys(t)
+	edPubKey, edPriv, edPubPEM := edKeyPEM(t)
+	if err := SetKeys("hs", []KeySpec{
+		{ID: "hs", Secret: testSecret},
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyPEM: edPriv},
+	}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+
+	claims := &Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	cases := map[string]string{
+		"未知的 kid": sign(jwt.SigningMethodHS256, "missing", []byte(testSecret)),
+		// 用 EdDSA 公钥作为 HMAC 密钥伪造令牌，kid 指向 EdDSA 密钥
+		"kid 与算法不符（公钥）":  sign(jwt.SigningMethodHS256, "ed", []byte(edPubKey)),
+		"kid 与算法不符（PEM）": sign(jwt.SigningMethodHS256, "ed", edPubPEM),
+		// kid 指向 HS256 密钥，实际使用 HS512
+		"kid 与算法不符（HS512）": sign(jwt.SigningMethodHS512, "hs", []byte(testSecret)),
+	}
+	for name, token := range cases {
+		if _, err := ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: 返回 %v", name, err)
+		}
+	}
+
+	// 没有 kid 的令牌使用当前密钥验证
+	if _, err := ParseToken(sign(jwt.SigningMethodHS256, "", []byte(testSecret))); err != nil {
+		t.Fatalf("没有 kid 的令牌: %v", err)
+	}
+}
+
+func TestPublicJWKs(t *testing.T) {
+	resetKeys(t)
+	edPub, edPriv, _ := edKeyPEM(t)
+	rsaPub, _, rsaPubPEM := rsaKeyPEM(t)
+	if err := SetKeys("ed", []KeySpec{
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyPEM: edPriv},
+		{ID: "rsa", Algorithm: "RS256", PublicKeyPEM: rsaPubPEM},
+		{ID: "hs", Secret: testSecret},
+	}); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+
+	jwks := PublicJWKs()
+	if len(jwks) != 2 {
+		t.Fatalf("返回了 %d 个公钥: %v", len(jwks), jwks)
+	}
+
+	ed, rs := jwks[0], jwks[1]
+	if ed["kid"] != "ed" || ed["kty"] != "OKP" || ed["crv"] != "Ed25519" || ed["alg"] != "EdDSA" || ed["use"] != "sig" {
+		t.Fatalf("Ed25519 公钥: %v", ed)
+	}
+	if ed["x"] != base64.RawURLEncoding.EncodeToString(edPub) {
+		t.Fatalf("Ed25519 公钥的 x 不一致")
+	}
+
+	if rs["kid"] != "rsa" || rs["kty"] != "RSA" || rs["alg"] != "RS256" {
+		t.Fatalf("RSA 公钥: %v", rs)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(rs["n"])
+	e, _ := base64.RawURLEncoding.DecodeString(rs["e"])
+	if new(big.Int).SetBytes(n).Cmp(rsaPub.N) != 0 || int(new(big.Int).SetBytes(e).Int64()) != rsaPub.E {
+		t.Fatalf("RSA 公钥的 n 或 e 不一致")
+	}
+
+	// 只使用 jwt_secret 时没有可公开的密钥
+	configuredKeys = nil
+	if jwks := PublicJWKs(); len(jwks) != 0 {
+		t.Fatalf("默认 HS256 密钥出现在 JWKS 中: %v", jwks)
+	}
+}
@@ -0,0 +1,261 @@
+// Package counter 提供固定窗口计数器：已连接 Redis 时计数保存在 Redis 中，多实例共享；否则保存在进程内存中
+package counter
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/redis"
+)
+
+// keyPrefix Redis 中计数器键的前缀
+const keyPrefix = "fcb:counter:"
+
+// Store 固定窗口计数器存储
+type Store interface {
+	// IncrBy 将 key 的计数增加 n（可为负数），返回增加后的值和窗口剩余时间
+	// key 不存在或已过期时开启一个长度为 window 的新窗口
+	IncrBy(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error)
+	// DecrBy 退回 key 的计数 n，最多减到 0，不改变窗口剩余时间
+	// key 不存在或已过期时不做任何操作，退回不会开启新窗口
+	DecrBy(ctx context.Context, key string, n int64) error
+	// Get 返回 key 当前的计数和窗口剩余时间，不存在时返回 0
+	Get(ctx context.Context, key string) (int64, time.Duration, error)
+	// Set 将 key 的计数设为 value，并在 ttl 后过期
+	Set(ctx context.Context, key string, value int64, ttl time.Duration) error
+	// Reset 删除 key 的计数
+	Reset(ctx context.Context, key string) error
+	// List 返回以 prefix 开头、尚未过期的计数
+	List(ctx context.Context, prefix string) ([]Entry, error)
+}
+
+// Entry 一个计数器的当前状态
+type Entry struct {
+	Key   string        // 不含存储前缀的键
+	Value int64         // 当前计数
+	TTL   time.Duration // 窗口剩余时间
+}
+
+var (
+	defaultMemory = newMemoryStore()
+	defaultRedis  = &redisStore{}
+)
+
+// Default 返回当前可用的计数器存储：Redis 已初始化时使用 Redis，否则使用内存
+func Default() Store {
+	if redis.GetClient() != nil {
+		return defaultRedis
+	}
+	return defaultMemory
+}
+
+// redisStore 基于 Redis 的计数器
+type redisStore struct{}
+
+// incrScript 增加计数，新建的键在同一脚本内设置过期时间，返回 {计数, 剩余毫秒}
+var incrScript = goredis.NewScript(`
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  ttl = tonumber(ARGV[2])
+end
+return {value, ttl}
+`)
+
+// decrScript 仅在键存在时退回计数，最多减到 0，保留原有的过期时间
+var decrScript = goredis.NewScript(`
+local value = tonumber(redis.call('GET', KEYS[1]))
+if not value then
+  return 0
+end
+local n = tonumber(ARGV[1])
+if n > value then
+  n = value
+end
+redis.call('DECRBY', KEYS[1], n)
+return 1
+`)
+
+func (s *redisStore) IncrBy(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error) {
+	// 过期时间至少 1 毫秒，否则 PEXPIRE 会立即删除键
+	ms := window.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	values, err := incrScript.Run(ctx, redis.GetClient(), []string{keyPrefix + key}, n, ms).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return values[0], time.Duration(values[1]) * time.Millisecond, nil
+}
+
+func (s *redisStore) DecrBy(ctx context.Context, key string, n int64) error {
+	return decrScript.Run(ctx, redis.GetClient(), []string{keyPrefix + key}, n).Err()
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	client := redis.GetClient()
+	key = keyPrefix + key
+
+	pipe := client.Pipeline()
+	get := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && get.Err() != goredis.Nil {
+		return 0, 0, err
+	}
+	if get.Err() == goredis.Nil {
+		return 0, 0, nil
+	}
+	value, err := get.Int64()
+	if err != nil {
+		return 0, 0, err
+	}
+	return value, ttl.Val(), nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	return redis.GetClient().Set(ctx, keyPrefix+key, value, ttl).Err()
+}
+
+func (s *redisStore) Reset(ctx context.Context, key string) error {
+	return redis.Del(ctx, keyPrefix+key)
+}
+
+func (s *redisStore) List(ctx context.Context, prefix string) ([]Entry, error) {
+	client := redis.GetClient()
+
+	var keys []string
+	iter := client.Scan(ctx, 0, keyPrefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := client.Pipeline()
+	gets := make([]*goredis.StringCmd, len(keys))
+	ttls := make([]*goredis.DurationCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != goredis.Nil {
+		return nil, err
+	}
+
+	// 扫描与读取之间过期的键直接跳过
+	entries := make([]Entry, 0, len(keys))
+	for i, key := range keys {
+		value, err := gets[i].Int64()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Key: key[len(keyPrefix):], Value: value, TTL: ttls[i].Val()})
+	}
+	return entries, nil
+}
+
+// memoryStore 进程内计数器，过期的键在访问时或定期清理时删除
+type memoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]*memoryEntry), lastSweep: time.Now()}
+}
+
+func (s *memoryStore) IncrBy(ctx context.Context, key string, n int64, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.value += n
+	return entry.value, entry.expiresAt.Sub(now), nil
+}
+
+func (s *memoryStore) DecrBy(ctx context.Context, key string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil
+	}
+	entry.value -= min(n, entry.value)
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return 0, 0, nil
+	}
+	return entry.value, entry.expiresAt.Sub(now), nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &memoryEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context, prefix string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var entries []Entry
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) && now.Before(entry.expiresAt) {
+			entries = append(entries, Entry{Key: key, Value: entry.value, TTL: entry.expiresAt.Sub(now)})
+		}
+	}
+	return entries, nil
+}
+
+// sweep 每分钟最多清理一次过期的键，调用方需持有锁
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package counter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreWindow(t *testing.T) {
+	s := newMemoryStore()
+	ctx := context.Background()
+
+	value, ttl, err := s.IncrBy(ctx, "k", 2, time.Minute)
+	if err != nil || value != 2 || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("IncrBy: value=%d ttl=%v err=%v", value, ttl, err)
+	}
+	// 同一窗口内继续累加，不延长窗口
+	value, next, _ := s.IncrBy(ctx, "k", 3, time.Hour)
+	if value != 5 || next > ttl {
+		t.Fatalf("窗口内累加: value=%d ttl=%v", value, next)
+	}
+
+	// 退回最多减到 0
+	_ = s.DecrBy(ctx, "k", 2)
+	if value, _, _ := s.Get(ctx, "k"); value != 3 {
+		t.Fatalf("退回后计数为 %d", value)
+	}
+	_ = s.DecrBy(ctx, "k", 10)
+	if value, _, _ := s.Get(ctx, "k"); value != 0 {
+		t.Fatalf("退回超过计数后为 %d", value)
+	}
+}
+
+func TestMemoryStoreDecrDoesNotCreate(t *testing.T) {
+	s := newMemoryStore()
+	ctx := context.Background()
+
+	// 不存在的键
+	_ = s.DecrBy(ctx, "missing", 1)
+	if _, ok := s.entries["missing"]; ok {
+		t.Fatal("退回创建了新键")
+	}
+
+	// 已过期的键：退回不开启新窗口，之后的计数从 0 开始
+	_, _, _ = s.IncrBy(ctx, "expired", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_ = s.DecrBy(ctx, "expired", 1)
+	if value, _, _ := s.IncrBy(ctx, "expired", 1, time.Minute); value != 1 {
+		t.Fatalf("过期后退回再计数为 %d", value)
+	}
+}
@@ -0,0 +1,299 @@
+// Package directory LDAP / Active Directory 客户端：用服务账号搜索用户条目，再以用户身份绑定校验密码，
+// 支持 ldaps:// 和 StartTLS，并读取用户所属的组和禁用状态
+package directory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrUserNotFound       = errors.New("目录中不存在该用户")
+)
+
+// pageSize 同步时分页搜索的每页条数
+const pageSize = 500
+
+// Config 目录服务连接和搜索配置
+type Config struct {
+	URL                string // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool   // ldap:// 连接建立后升级为 TLS
+	InsecureSkipVerify bool
+	RootCAs            *x509.CertPool // 为空时使用系统证书
+	Timeout            time.Duration
+
+	BindDN       string // 搜索用户使用的服务账号，为空时匿名搜索
+	BindPassword string
+
+	BaseDN               string
+	UserFilter           string // 用户条目的过滤条件，例如 (objectClass=person)
+	UsernameAttribute    string // 例如 uid 或 sAMAccountName
+	EmailAttribute       string
+	DisplayNameAttribute string
+	GroupAttribute       string // 用户条目中列出所属组的属性，例如 memberOf
+	GroupBaseDN          string // 配置后在该节点下按 GroupFilter 搜索组
+	GroupFilter          string // {dn} 和 {username} 会被替换为转义后的用户 DN 和用户名，例如 (member={dn})
+	DisabledFilter       string // 匹配已禁用账号的过滤条件，例如 AD 的 (userAccountControl:1.2.840.113556.1.4.803:=2)
+}
+
+// Entry 目录中的用户
+type Entry struct {
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string // 组的 DN
+	Disabled    bool
+}
+
+// Client 目录服务客户端，每次操作建立新连接，不持有长连接
+type Client struct {
+	cfg Config
+	tls *tls.Config
+}
+
+// New 校验配置并创建客户端
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("LDAP 地址无效: %q", cfg.URL)
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("缺少 LDAP base_dn")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(objectClass=person)"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.DisplayNameAttribute == "" {
+		cfg.DisplayNameAttribute = "cn"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if _, err := ldap.CompileFilter(cfg.UserFilter); err != nil {
+		return nil, fmt.Errorf("LDAP user_filter 无效: %w", err)
+	}
+	if cfg.DisabledFilter != "" {
+		if _, err := ldap.CompileFilter(cfg.DisabledFilter); err != nil {
+			return nil, fmt.Errorf("LDAP disabled_filter 无效: %w", err)
+		}
+	}
+
+	host := u.Hostname()
+	return &Client{
+		cfg: cfg,
+		tls: &tls.Config{
+			ServerName:         host,
+			RootCAs:            cfg.RootCAs,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		},
+	}, nil
+}
+
+// Authenticate 按用户名（byEmail 为 true 时按邮箱）搜索用户，再以该用户的 DN 和密码绑定
+func (c *Client) Authenticate(login, password string, byEmail bool) (*Entry, error) {
+	// 空密码的简单绑定在多数服务器上被视为匿名绑定并返回成功，必须拒绝
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attr := c.cfg.UsernameAttribute
+	if byEmail {
+		attr = c.cfg.EmailAttribute
+	}
+	entry, err := c.findUser(conn, attr, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP 绑定失败: %w", err)
+	}
+	return entry, nil
+}
+
+// Lookup 按用户名查找用户，不校验密码
+func (c *Client) Lookup(username string) (*Entry, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return c.findUser(conn, c.cfg.UsernameAttribute, username)
+}
+
+// ListUsers 分页列出全部用户及其禁用状态，用于同步
+func (c *Client) ListUsers() ([]Entry, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.SearchWithPaging(c.searchRequest(c.cfg.BaseDN, ldap.ScopeWholeSubtree, c.cfg.UserFilter, 0), pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 搜索用户失败: %w", err)
+	}
+
+	disabled := map[string]bool{}
+	if c.cfg.DisabledFilter != "" {
+		filter := "(&" + c.cfg.UserFilter + c.cfg.DisabledFilter + ")"
+		dres, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+			c.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter, []string{"dn"}, nil,
+		), pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP 搜索禁用用户失败: %w", err)
+		}
+		for _, e := range dres.Entries {
+			disabled[strings.ToLower(e.DN)] = true
+		}
+	}
+
+	entries := make([]Entry, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		entry := c.toEntry(e)
+		if entry.Username == "" {
+			continue
+		}
+		entry.Disabled = disabled[strings.ToLower(e.DN)]
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// connect 建立连接，按配置升级 TLS，并以服务账号绑定
+func (c *Client) connect() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+	conn, err := ldap.DialURL(c.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(c.tls))
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 服务器失败: %w", err)
+	}
+	conn.SetTimeout(c.cfg.Timeout)
+
+	if c.cfg.StartTLS && strings.HasPrefix(c.cfg.URL, "ldap://") {
+		if err := conn.StartTLS(c.tls); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS 失败: %w", err)
+		}
+	}
+
+	if c.cfg.BindDN != "" {
+		err = conn.Bind(c.cfg.BindDN, c.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+	}
+	return conn, nil
+}
+
+// findUser 搜索唯一匹配的用户条目，并补充组和禁用状态
+func (c *Client) findUser(conn *ldap.Conn, attr, value string) (*Entry, error) {
+	filter := fmt.Sprintf("(&%s(%s=%s))", c.cfg.UserFilter, attr, ldap.EscapeFilter(value))
+	res, err := conn.Search(c.searchRequest(c.cfg.BaseDN, ldap.ScopeWholeSubtree, filter, 2))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("LDAP 搜索用户失败: %w", err)
+	}
+	// 匹配多个条目时无法确定是哪个用户，按不存在处理
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+
+	entry := c.toEntry(res.Entries[0])
+	if c.cfg.GroupBaseDN != "" && c.cfg.GroupFilter != "" {
+		groups, err := c.searchGroups(conn, entry)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	if c.cfg.DisabledFilter != "" {
+		dres, err := conn.Search(ldap.NewSearchRequest(
+			entry.DN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+			c.cfg.DisabledFilter, []string{"dn"}, nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("LDAP 查询禁用状态失败: %w", err)
+		}
+		entry.Disabled = len(dres.Entries) > 0
+	}
+	return entry, nil
+}
+
+// searchGroups 在 GroupBaseDN 下搜索包含该用户的组
+func (c *Client) searchGroups(conn *ldap.Conn, entry *Entry) ([]string, error) {
+	filter := strings.NewReplacer(
+		"{dn}", ldap.EscapeFilter(entry.DN),
+		"{username}", ldap.EscapeFilter(entry.Username),
+	).Replace(c.cfg.GroupFilter)
+	res, err := conn.Search(ldap.NewSearchRequest(
+		c.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 搜索组失败: %w", err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+func (c *Client) searchRequest(base string, scope int, filter string, sizeLimit int) *ldap.SearchRequest {
+	attrs := []string{c.cfg.UsernameAttribute, c.cfg.EmailAttribute, c.cfg.DisplayNameAttribute}
+	if c.cfg.GroupAttribute != "" {
+		attrs = append(attrs, c.cfg.GroupAttribute)
+	}
+	return ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, sizeLimit, int(c.cfg.Timeout.Seconds()), false, filter, attrs, nil)
+}
+
+func (c *Client) toEntry(e *ldap.Entry) *Entry {
+	entry := &Entry{
+		DN:          e.DN,
+		Username:    e.GetEqualFoldAttributeValue(c.cfg.UsernameAttribute),
+		Email:       e.GetEqualFoldAttributeValue(c.cfg.EmailAttribute),
+		DisplayName: e.GetEqualFoldAttributeValue(c.cfg.DisplayNameAttribute),
+	}
+	if c.cfg.GroupAttribute != "" {
+		entry.Groups = e.GetEqualFoldAttributeValues(c.cfg.GroupAttribute)
+	}
+	return entry
+}
+
+// GroupName 返回组 DN 第一个 RDN 的值，例如 cn=admins,ou=groups,dc=example,dc=com 返回 admins
+func GroupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
@@ -0,0 +1,440 @@
+// Package directorytest 提供进程内的 LDAP 服务器，用于在测试中代替真实的目录服务。
+// 只实现认证和同步用到的操作：简单绑定、搜索（and/or/not/等值/存在/子串过滤）和 StartTLS，
+// 条目保存在内存中，属性值按大小写不敏感匹配
+package directorytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP 协议操作和结果码
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchEntry       = 4
+	opSearchDone        = 5
+	opAbandonRequest    = 16
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+	resultSuccess       = 0
+	resultProtocolError = 2
+	resultNoSuchObject  = 32
+	resultInvalidCreds  = 49
+	resultUnwilling     = 53
+	startTLSOID         = "1.3.6.1.4.1.1466.20037"
+)
+
+// Entry 目录条目，Password 非空时可以用该条目的 DN 绑定
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server 内存中的 LDAP 服务器
+type Server struct {
+	URL      string         // ldap:// 或 ldaps:// 地址
+	RootCAs  *x509.CertPool // 信任服务器证书的证书池，用于 StartTLS 和 ldaps
+	ln       net.Listener
+	tlsCfg   *tls.Config
+	mu       sync.RWMutex
+	entries  map[string]*Entry
+	conns    sync.WaitGroup
+	shutdown chan struct{}
+}
+
+// NewServer 在 127.0.0.1 的随机端口启动明文 LDAP 服务器，支持 StartTLS
+func NewServer() (*Server, error) {
+	return newServer(false)
+}
+
+// NewTLSServer 启动 ldaps:// 服务器
+func NewTLSServer() (*Server, error) {
+	return newServer(true)
+}
+
+func newServer(useTLS bool) (*Server, error) {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		RootCAs:  pool,
+		tlsCfg:   &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		entries:  make(map[string]*Entry),
+		shutdown: make(chan struct{}),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	scheme := "ldap"
+	if useTLS {
+		ln = tls.NewListener(ln, s.tlsCfg)
+		scheme = "ldaps"
+	}
+	s.ln = ln
+	s.URL = fmt.Sprintf("%s://%s", scheme, ln.Addr().String())
+	go s.serve()
+	return s, nil
+}
+
+// Close 停止监听并等待已有连接结束
+func (s *Server) Close() {
+	close(s.shutdown)
+	s.ln.Close()
+	s.conns.Wait()
+}
+
+// Add 添加或替换条目
+func (s *Server) Add(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := make(map[string][]string, len(entry.Attributes))
+	for name, values := range entry.Attributes {
+		attrs[name] = append([]string(nil), values...)
+	}
+	entry.Attributes = attrs
+	s.entries[normalizeDN(entry.DN)] = &entry
+}
+
+// SetAttribute 修改条目的属性，values 为空时删除该属性
+func (s *Server) SetAttribute(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[normalizeDN(dn)]; ok {
+		for existing := range e.Attributes {
+			if strings.EqualFold(existing, name) {
+				delete(e.Attributes, existing)
+			}
+		}
+		if len(values) > 0 {
+			e.Attributes[name] = values
+		}
+	}
+}
+
+// Delete 删除条目
+func (s *Server) Delete(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, normalizeDN(dn))
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdown:
+				return
+			default:
+				continue
+			}
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle 依次处理一个连接上的请求；StartTLS 成功后在同一连接上继续以 TLS 读写
+func (s *Server) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	go func() {
+		<-s.shutdown
+		conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		if op.ClassType != ber.ClassApplication {
+			return
+		}
+
+		switch op.Tag {
+		case opBindRequest:
+			code := s.bind(op)
+			s.write(conn, msgID, result(opBindResponse, code, ""))
+		case opSearchRequest:
+			entries, code := s.search(op)
+			for _, e := range entries {
+				s.write(conn, msgID, e)
+			}
+			s.write(conn, msgID, result(opSearchDone, code, ""))
+		case opExtendedRequest:
+			if len(op.Children) == 0 || op.Children[0].Data.String() != startTLSOID {
+				s.write(conn, msgID, result(opExtendedResponse, resultProtocolError, "unsupported extended operation"))
+				continue
+			}
+			if _, ok := conn.(*tls.Conn); ok {
+				s.write(conn, msgID, result(opExtendedResponse, resultUnwilling, "TLS already established"))
+				continue
+			}
+			s.write(conn, msgID, result(opExtendedResponse, resultSuccess, ""))
+			tlsConn := tls.Server(conn, s.tlsCfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+		case opUnbindRequest:
+			return
+		case opAbandonRequest:
+		default:
+			s.write(conn, msgID, result(opExtendedResponse, resultProtocolError, "unsupported operation"))
+		}
+	}
+}
+
+// bind 简单绑定：空 DN 和空密码为匿名绑定，否则必须与条目的密码一致
+func (s *Server) bind(op *ber.Packet) int64 {
+	if len(op.Children) < 3 {
+		return resultProtocolError
+	}
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+	if dn == "" && password == "" {
+		return resultSuccess
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[normalizeDN(dn)]
+	if !ok || e.Password == "" || e.Password != password {
+		return resultInvalidCreds
+	}
+	return resultSuccess
+}
+
+func (s *Server) search(op *ber.Packet) ([]*ber.Packet, int64) {
+	if len(op.Children) < 8 {
+		return nil, resultProtocolError
+	}
+	base := normalizeDN(op.Children[0].Data.String())
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var wanted []string
+	for _, attr := range op.Children[7].Children {
+		wanted = append(wanted, strings.ToLower(attr.Data.String()))
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.entries[base]; !ok && scope == 0 {
+		return nil, resultNoSuchObject
+	}
+
+	var out []*ber.Packet
+	for key, e := range s.entries {
+		if !inScope(key, base, scope) || !matches(e, filter) {
+			continue
+		}
+		out = append(out, entryPacket(e, wanted))
+	}
+	return out, resultSuccess
+}
+
+func (s *Server) write(conn net.Conn, msgID int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	packet.AppendChild(op)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func result(tag ber.Tag, code int64, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"))
+	return p
+}
+
+// entryPacket 编码搜索结果条目，不返回 userPassword
+func entryPacket(e *Entry, wanted []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchEntry, nil, "SearchResultEntry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, "userPassword") || !wantAttribute(wanted, strings.ToLower(name)) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func wantAttribute(wanted []string, name string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == "*" || w == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matches 按 RFC 4511 的过滤器编码求值，不支持的过滤类型视为不匹配
+func matches(e *Entry, f *ber.Packet) bool {
+	switch f.Tag {
+	case 0: // and
+		for _, child := range f.Children {
+			if !matches(e, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range f.Children {
+			if matches(e, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(f.Children) == 1 && !matches(e, f.Children[0])
+	case 3: // equalityMatch
+		if len(f.Children) != 2 {
+			return false
+		}
+		value := f.Children[1].Data.String()
+		for _, v := range e.values(f.Children[0].Data.String()) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case 4: // substrings
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range e.values(f.Children[0].Data.String()) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		name := f.Data.String()
+		return strings.EqualFold(name, "objectClass") || len(e.values(name)) > 0
+	}
+	return false
+}
+
+// values 按大小写不敏感的属性名读取属性值
+func (e *Entry) values(name string) []string {
+	for existing, values := range e.Attributes {
+		if strings.EqualFold(existing, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case 0: // initial
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case 1: // any
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case 2: // final
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// inScope 判断条目是否在搜索范围内：0 仅 base，1 base 的直接子条目，2 整个子树
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case 0:
+		return dn == base
+	case 1:
+		_, parent, ok := strings.Cut(dn, ",")
+		return ok && parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, ",")
+}
+
+// selfSignedCert 为 127.0.0.1 和 localhost 生成自签名证书
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "directorytest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
@@ -0,0 +1,323 @@
+package e2ee
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client E2EE 分享参考客户端
+// 所有加解密都在本地完成，发往服务端的只有密文、nonce/tag 和加密后的元数据
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token 可选的 Bearer 令牌，用于以登录用户身份上传
+	Token string
+}
+
+// NewClient 创建参考客户端
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ShareOptions 分享参数
+type ShareOptions struct {
+	ExpireValue int
+	ExpireStyle string
+}
+
+// Meta 与服务端 e2ee_meta 对应的结构
+type Meta struct {
+	Alg       string `json:"alg"`
+	ChunkSize int64  `json:"chunk_size"`
+	Name      string `json:"name"`
+	NameNonce string `json:"name_nonce"`
+}
+
+// ChunkInfo 与服务端 e2ee_chunks 对应的结构
+type ChunkInfo struct {
+	Index int    `json:"index"`
+	Size  int64  `json:"size"`
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+// Result 分享结果；Link 中的 fragment 携带密钥，只能交给接收方
+type Result struct {
+	Code string
+	Key  []byte
+	Link string
+}
+
+// ShareText 加密并分享一段文本
+func (c *Client) ShareText(ctx context.Context, text string, opts ShareOptions) (*Result, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := SealString(key, text)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(Meta{Alg: Algorithm})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text":         sealed,
+		"expire_value": opts.ExpireValue,
+		"expire_style": opts.ExpireStyle,
+		"e2ee":         true,
+		"e2ee_meta":    string(meta),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Code string `json:"code"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/share/text/", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return c.result(resp.Data.Code, key), nil
+}
+
+// UploadFile 按分片加密并通过分片上传接口分享文件
+func (c *Client) UploadFile(ctx context.Context, name string, r io.Reader, size int64, chunkSize int, opts ShareOptions) (*Result, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	sealedName, err := SealString(key, name)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(Meta{Alg: Algorithm, ChunkSize: int64(chunkSize), Name: sealedName})
+	if err != nil {
+		return nil, err
+	}
+
+	totalChunks := int((size + int64(chunkSize) - 1) / int64(chunkSize))
+	if totalChunks == 0 {
+		totalChunks = 1
+	}
+
+	// GCM 密文与明文等长，因此声明的大小即明文大小
+	initBody, err := json.Marshal(map[string]interface{}{
+		"file_name":    "encrypted.bin",
+		"file_size":    size,
+		"chunk_size":   chunkSize,
+		"total_chunks": totalChunks,
+		"e2ee":         true,
+		"e2ee_meta":    string(meta),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var initResp struct {
+		Data struct {
+			UploadID    string `json:"upload_id"`
+			UploadToken string `json:"upload_token"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/chunk/upload/init/", "application/json", bytes.NewReader(initBody), &initResp); err != nil {
+		return nil, err
+	}
+	uploadID := initResp.Data.UploadID
+	// 匿名上传需要携带初始化时签发的上传令牌
+	uploadToken := initResp.Data.UploadToken
+
+	buf := make([]byte, chunkSize)
+	for i := 0; i < totalChunks; i++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		sealed, err := SealChunk(key, i, buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if err := c.uploadChunk(ctx, uploadID, uploadToken, i, sealed); err != nil {
+			return nil, err
+		}
+	}
+
+	completeBody, err := json.Marshal(map[string]interface{}{
+		"expire_value": opts.ExpireValue,
+		"expire_style": opts.ExpireStyle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var completeResp struct {
+		Data struct {
+			ShareCode string `json:"share_code"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/chunk/upload/complete/"+uploadID+"?upload_token="+url.QueryEscape(uploadToken), "application/json", bytes.NewReader(completeBody), &completeResp); err != nil {
+		return nil, err
+	}
+	return c.result(completeResp.Data.ShareCode, key), nil
+}
+
+// Fetch 下载并解密分享内容，返回明文名称（文本分享为空）与内容
+func (c *Client) Fetch(ctx context.Context, code string, key []byte) (string, []byte, error) {
+	var detail struct {
+		Data struct {
+			E2EE   bool        `json:"e2ee"`
+			Meta   Meta        `json:"e2ee_meta"`
+			Chunks []ChunkInfo `json:"e2ee_chunks"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/share/select/?code="+url.QueryEscape(code), "", nil, &detail); err != nil {
+		return "", nil, err
+	}
+	if !detail.Data.E2EE {
+		return "", nil, errors.New("e2ee: share is not end-to-end encrypted")
+	}
+
+	raw, err := c.download(ctx, code)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 文本分享：整个响应体就是 SealString 的输出
+	if len(detail.Data.Chunks) == 0 {
+		text, err := OpenString(key, string(raw))
+		if err != nil {
+			return "", nil, err
+		}
+		return "", []byte(text), nil
+	}
+
+	name := ""
+	if detail.Data.Meta.Name != "" {
+		if name, err = OpenString(key, detail.Data.Meta.Name); err != nil {
+			return "", nil, err
+		}
+	}
+
+	plaintext := make([]byte, 0, len(raw))
+	var offset int64
+	for _, ch := range detail.Data.Chunks {
+		if offset+ch.Size > int64(len(raw)) {
+			return "", nil, ErrInvalidCiphertext
+		}
+		nonce, err1 := base64.StdEncoding.DecodeString(ch.Nonce)
+		tag, err2 := base64.StdEncoding.DecodeString(ch.Tag)
+		if err1 != nil || err2 != nil {
+			return "", nil, ErrInvalidCiphertext
+		}
+		part, err := OpenChunk(key, ch.Index, &SealedChunk{
+			Ciphertext: raw[offset : offset+ch.Size],
+			Nonce:      nonce,
+			Tag:        tag,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		plaintext = append(plaintext, part...)
+		offset += ch.Size
+	}
+	return name, plaintext, nil
+}
+
+func (c *Client) uploadChunk(ctx context.Context, uploadID, uploadToken string, index int, sealed *SealedChunk) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("chunk", fmt.Sprintf("chunk_%d", index))
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(sealed.Ciphertext); err != nil {
+		return err
+	}
+	_ = writer.WriteField("nonce", base64.StdEncoding.EncodeToString(sealed.Nonce))
+	_ = writer.WriteField("tag", base64.StdEncoding.EncodeToString(sealed.Tag))
+	_ = writer.WriteField("upload_token", uploadToken)
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/chunk/upload/chunk/%s/%d", uploadID, index)
+	return c.do(ctx, http.MethodPost, path, writer.FormDataContentType(), body, nil)
+}
+
+func (c *Client) download(ctx context.Context, code string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/share/download?code="+url.QueryEscape(code), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("e2ee: download failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.authorize(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("e2ee: %s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+func (c *Client) result(code string, key []byte) *Result {
+	return &Result{
+		Code: code,
+		Key:  key,
+		Link: fmt.Sprintf("%s/share/%s#k=%s", c.BaseURL, code, EncodeKey(key)),
+	}
+}
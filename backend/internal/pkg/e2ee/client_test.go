@@ -0,0 +1,157 @@
+package e2ee_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/e2ee"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+// storagePath 处理器保存分享文件的根目录（相对于工作目录）
+const storagePath = "data/uploads"
+
+var plaintext = bytes.Repeat([]byte("top secret plaintext, never for the server. "), 300)
+
+func newClient(t *testing.T) *e2ee.Client {
+	t.Helper()
+	testenv.Setup(t)
+	return e2ee.NewClient(testenv.StartServer(t))
+}
+
+func loadShare(t *testing.T, code string) *model.FileCode {
+	t.Helper()
+	var fileCode model.FileCode
+	if err := db.GetDB().Where("code = ?", code).First(&fileCode).Error; err != nil {
+		t.Fatalf("读取分享 %s 失败: %v", code, err)
+	}
+	return &fileCode
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+	text := string(plaintext)
+
+	result, err := client.ShareText(ctx, text, e2ee.ShareOptions{ExpireValue: 1, ExpireStyle: "day"})
+	if err != nil {
+		t.Fatalf("ShareText: %v", err)
+	}
+
+	stored := loadShare(t, result.Code)
+	if !stored.E2EE {
+		t.Fatal("分享未标记为 E2EE")
+	}
+	if strings.Contains(stored.Text, "top secret") {
+		t.Fatal("服务端保存了明文文本")
+	}
+
+	_, got, err := client.Fetch(ctx, result.Code, result.Key)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(got) != text {
+		t.Fatal("解密后的文本与原文不一致")
+	}
+
+	// 错误的密钥无法解密
+	otherKey, _ := e2ee.GenerateKey()
+	if _, _, err := client.Fetch(ctx, result.Code, otherKey); err == nil {
+		t.Fatal("使用错误的密钥解密成功")
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	// 分片大小不整除明文长度，覆盖最后一个短分片
+	result, err := client.UploadFile(ctx, "report.txt", bytes.NewReader(plaintext), int64(len(plaintext)), 4096, e2ee.ShareOptions{ExpireValue: 1, ExpireStyle: "day"})
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	stored := loadShare(t, result.Code)
+	if stored.FileHash != "" || stored.HashVerified {
+		t.Fatalf("E2EE 文件记录了可用于秒传的摘要: %q", stored.FileHash)
+	}
+	if stored.FileName() != "" || strings.Contains(stored.Suffix, "txt") {
+		t.Fatalf("服务端保存了明文文件名: %q%q", stored.Prefix, stored.Suffix)
+	}
+
+	data, err := os.ReadFile(filepath.Join(storagePath, stored.GetFilePath()))
+	if err != nil {
+		t.Fatalf("读取存储的文件失败: %v", err)
+	}
+	if len(data) != len(plaintext) {
+		t.Fatalf("存储的密文长度 %d，期望 %d", len(data), len(plaintext))
+	}
+	if bytes.Contains(data, []byte("top secret")) {
+		t.Fatal("存储的文件包含明文")
+	}
+
+	name, got, err := client.Fetch(ctx, result.Code, result.Key)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if name != "report.txt" {
+		t.Fatalf("解密后的文件名为 %q", name)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatal("解密后的内容与原文不一致")
+	}
+}
+
+// 直接上传的 E2EE 文件同样不能参与去重和秒传
+func TestShareFileSkipsCiphertextHash(t *testing.T) {
+	testenv.Setup(t)
+	baseURL := testenv.StartServer(t)
+
+	key, _ := e2ee.GenerateKey()
+	sealed, err := e2ee.SealChunk(key, 0, plaintext)
+	if err != nil {
+		t.Fatalf("SealChunk: %v", err)
+	}
+	meta, _ := json.Marshal(e2ee.Meta{Alg: e2ee.Algorithm})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("e2ee", "true")
+	_ = writer.WriteField("e2ee_meta", string(meta))
+	part, _ := writer.CreateFormFile("file", "ciphertext.bin")
+	_, _ = part.Write(sealed.Ciphertext)
+	_ = writer.Close()
+
+	resp, err := http.Post(baseURL+"/share/file/", writer.FormDataContentType(), body)
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("上传返回 %d: %s", resp.StatusCode, raw)
+	}
+	var out struct {
+		Data struct {
+			Code string `json:"code"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+
+	stored := loadShare(t, out.Data.Code)
+	if !stored.E2EE || stored.FileHash != "" || stored.HashVerified {
+		t.Fatalf("E2EE 文件记录了摘要: e2ee=%v hash=%q verified=%v", stored.E2EE, stored.FileHash, stored.HashVerified)
+	}
+}
@@ -0,0 +1,152 @@
+// Package e2ee 端到端加密分享的参考实现
+//
+// 加密全部在客户端完成：密钥只出现在分享链接的 URL fragment（#k=...）中，
+// 浏览器不会把 fragment 发送给服务端，因此服务端只会接触到密文和不透明的元数据。
+package e2ee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Algorithm 当前使用的加密算法标识，写入 e2ee_meta.alg
+	Algorithm = "AES-256-GCM"
+	// KeySize 密钥长度（字节）
+	KeySize = 32
+	// DefaultChunkSize 默认明文分片大小
+	DefaultChunkSize = 1 << 20
+
+	nonceSize = 12
+	tagSize   = 16
+)
+
+var (
+	ErrInvalidKey        = errors.New("e2ee: invalid key")
+	ErrInvalidCiphertext = errors.New("e2ee: invalid ciphertext")
+)
+
+// GenerateKey 生成随机内容密钥
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey 将密钥编码为可放入 URL fragment 的字符串
+func EncodeKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// DecodeKey 解析 URL fragment 中的密钥
+func DecodeKey(s string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// SealedChunk 单个加密分片：密文与 nonce/tag 分开保存，便于服务端按偏移拼接密文
+type SealedChunk struct {
+	Ciphertext []byte
+	Nonce      []byte
+	Tag        []byte
+}
+
+// SealChunk 加密一个明文分片
+// 分片索引作为附加认证数据，防止密文分片被重排
+func SealChunk(key []byte, index int, plaintext []byte) (*SealedChunk, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nil, nonce, plaintext, chunkAAD(index))
+	split := len(sealed) - tagSize
+	return &SealedChunk{
+		Ciphertext: sealed[:split],
+		Nonce:      nonce,
+		Tag:        sealed[split:],
+	}, nil
+}
+
+// OpenChunk 解密一个分片
+func OpenChunk(key []byte, index int, chunk *SealedChunk) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunk.Nonce) != nonceSize || len(chunk.Tag) != tagSize {
+		return nil, ErrInvalidCiphertext
+	}
+
+	sealed := make([]byte, 0, len(chunk.Ciphertext)+tagSize)
+	sealed = append(sealed, chunk.Ciphertext...)
+	sealed = append(sealed, chunk.Tag...)
+
+	plaintext, err := aead.Open(nil, chunk.Nonce, sealed, chunkAAD(index))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// SealString 加密短文本（文件名、文本分享），输出 base64(nonce|ciphertext|tag)
+func SealString(key []byte, plaintext string) (string, error) {
+	chunk, err := SealChunk(key, -1, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 0, nonceSize+len(chunk.Ciphertext)+tagSize)
+	buf = append(buf, chunk.Nonce...)
+	buf = append(buf, chunk.Ciphertext...)
+	buf = append(buf, chunk.Tag...)
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// OpenString 解密 SealString 的输出
+func OpenString(key []byte, sealed string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(buf) < nonceSize+tagSize {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := OpenChunk(key, -1, &SealedChunk{
+		Nonce:      buf[:nonceSize],
+		Ciphertext: buf[nonceSize : len(buf)-tagSize],
+		Tag:        buf[len(buf)-tagSize:],
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("e2ee: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkAAD(index int) []byte {
+	aad := make([]byte, 8)
+	binary.BigEndian.PutUint64(aad, uint64(int64(index)))
+	return aad
+}
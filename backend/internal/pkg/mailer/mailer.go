@@ -0,0 +1,193 @@
+// Package mailer 发送系统邮件。生产环境使用 SMTP，开发和测试环境可以把邮件写入文件并打印到日志
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// 邮件驱动
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New 按配置创建邮件发送器，未配置驱动时使用 log 驱动
+func New(cfg *conf.MailConfig) Mailer {
+	if cfg != nil && cfg.Driver == DriverSMTP {
+		return &SMTPMailer{cfg: *cfg}
+	}
+
+	m := &LogMailer{Dir: "./data/mail", From: "noreply@localhost"}
+	if cfg != nil && cfg.Dir != "" {
+		m.Dir = cfg.Dir
+	}
+	if cfg != nil && cfg.From != "" {
+		m.From = cfg.From
+	}
+	return m
+}
+
+// Default 按全局配置创建邮件发送器
+func Default() Mailer {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil {
+		return New(nil)
+	}
+	return New(&cfg.Mail)
+}
+
+// SMTPMailer 通过 SMTP 发送邮件
+// 端口 465 或开启 tls 时使用隐式 TLS，否则在服务器支持时使用 STARTTLS
+type SMTPMailer struct {
+	cfg conf.MailConfig
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS || m.cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: m.cfg.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接邮件服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接邮件服务器失败: %w", err)
+	}
+	defer client.Close()
+
+	if _, isTLS := conn.(*tls.Conn); !isTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+				return fmt.Errorf("STARTTLS 失败: %w", err)
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("邮件服务器认证失败: %w", err)
+		}
+	}
+
+	from := m.cfg.From
+	if from == "" {
+		from = m.cfg.Username
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(compose(from, msg)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// LogMailer 把邮件写入 Dir 目录下的 .eml 文件并打印到日志，用于开发和测试
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitize(msg.To))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, compose(m.From, msg), 0o600); err != nil {
+		return err
+	}
+	logger.Info("邮件已写入文件",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("file", path),
+	)
+	return nil
+}
+
+// validate 拒绝包含换行的收件人和主题，防止邮件头注入
+func validate(msg *Message) error {
+	if msg.To == "" || strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("无效的收件人或主题")
+	}
+	return nil
+}
+
+// compose 生成 RFC 5322 格式的邮件内容
+func compose(from string, msg *Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,73 @@
+package mailer_test
+
+import (
+	"context"
+	"mime"
+	"strings"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/mailer"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/mailer/mailertest"
+)
+
+func newSMTP(t *testing.T) (*mailertest.Server, *conf.MailConfig) {
+	t.Helper()
+	server, err := mailertest.NewServer()
+	if err != nil {
+		t.Fatalf("启动 SMTP 服务器失败: %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server, &conf.MailConfig{Driver: mailer.DriverSMTP, Host: server.Host, Port: server.Port, From: "noreply@example.com"}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server, cfg := newSMTP(t)
+	cfg.Username = "mailer"
+	cfg.Password = "secret"
+
+	err := mailer.New(cfg).Send(context.Background(), &mailer.Message{
+		To:      "alice@example.com",
+		Subject: "验证你的邮箱",
+		Body:    "第一行\n第二行\n.以点开头的行\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg, ok := server.Last()
+	if !ok {
+		t.Fatal("SMTP 服务器没有收到邮件")
+	}
+	if msg.Username != "mailer" || msg.From != "noreply@example.com" || len(msg.To) != 1 || msg.To[0] != "alice@example.com" {
+		t.Fatalf("信封: %+v", msg)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "验证你的邮箱" {
+		t.Fatalf("主题 %q: %v", subject, err)
+	}
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "text/plain; charset=utf-8") {
+		t.Fatalf("Content-Type: %q", msg.Header.Get("Content-Type"))
+	}
+	if msg.Body != "第一行\n第二行\n.以点开头的行\n" {
+		t.Fatalf("正文: %q", msg.Body)
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	server, cfg := newSMTP(t)
+	m := mailer.New(cfg)
+
+	for _, msg := range []*mailer.Message{
+		{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "hi", Body: "x"},
+		{To: "alice@example.com", Subject: "hi\r\nBcc: eve@example.com", Body: "x"},
+		{To: "", Subject: "hi", Body: "x"},
+	} {
+		if err := m.Send(context.Background(), msg); err == nil {
+			t.Errorf("接受了无效的邮件: %q %q", msg.To, msg.Subject)
+		}
+	}
+	if got := len(server.Messages()); got != 0 {
+		t.Fatalf("无效的邮件被发送了 %d 封", got)
+	}
+}
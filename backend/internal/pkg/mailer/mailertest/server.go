@@ -0,0 +1,183 @@
+// Package mailertest 提供进程内的 SMTP 服务器，用于在测试中接收系统邮件。
+// 只实现发送一封邮件需要的命令（EHLO、AUTH PLAIN、MAIL、RCPT、DATA、RSET、NOOP、QUIT），
+// 不支持 STARTTLS，收到的邮件保存在内存中
+package mailertest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message 收到的一封邮件
+type Message struct {
+	Username string   // AUTH PLAIN 提交的用户名，未认证时为空
+	From     string   // MAIL FROM 的地址
+	To       []string // RCPT TO 的地址
+	Header   mail.Header
+	Body     string // 已去掉 CRLF 中的 CR
+}
+
+// Server 内存中的 SMTP 服务器
+type Server struct {
+	Host string
+	Port int
+
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []Message
+	conns    sync.WaitGroup
+}
+
+// NewServer 在 127.0.0.1 的随机端口启动 SMTP 服务器，调用方负责 Close
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: addr.Port, ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+// Close 停止监听并等待已有连接结束
+func (s *Server) Close() {
+	s.ln.Close()
+	s.conns.Wait()
+}
+
+// Messages 返回已收到的邮件
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last 返回最后收到的一封邮件，没有邮件时返回 false
+func (s *Server) Last() (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		return Message{}, false
+	}
+	return s.messages[len(s.messages)-1], true
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+// handle 处理一个连接上的会话，每个 DATA 结束时保存一封邮件
+func (s *Server) handle(conn *textproto.Conn) {
+	reply := func(code int, text string) bool {
+		return conn.PrintfLine("%d %s", code, text) == nil
+	}
+	if !reply(220, "mailertest ESMTP") {
+		return
+	}
+
+	var current Message
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if conn.PrintfLine("250-mailertest") != nil || conn.PrintfLine("250-AUTH PLAIN") != nil || !reply(250, "8BITMIME") {
+				return
+			}
+		case "HELO", "NOOP":
+			reply(250, "OK")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			username, ok := decodePlain(initial)
+			if !strings.EqualFold(mechanism, "PLAIN") || !ok {
+				reply(535, "authentication failed")
+				continue
+			}
+			current.Username = username
+			reply(235, "authenticated")
+		case "MAIL":
+			current.From = address(arg)
+			current.To = nil
+			reply(250, "OK")
+		case "RCPT":
+			current.To = append(current.To, address(arg))
+			reply(250, "OK")
+		case "DATA":
+			if current.From == "" || len(current.To) == 0 {
+				reply(503, "need MAIL and RCPT first")
+				continue
+			}
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := io.ReadAll(conn.DotReader())
+			if err != nil {
+				return
+			}
+			msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+			if err != nil {
+				reply(554, "invalid message")
+				continue
+			}
+			body, _ := io.ReadAll(msg.Body)
+			current.Header = msg.Header
+			current.Body = strings.ReplaceAll(string(body), "\r\n", "\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = Message{Username: current.Username}
+			reply(250, "queued as "+strconv.Itoa(len(s.Messages())))
+		case "RSET":
+			current = Message{Username: current.Username}
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, fmt.Sprintf("command %s not implemented", verb))
+		}
+	}
+}
+
+// address 从 "FROM:<a@b>" 或 "TO:<a@b>" 中取出地址
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// decodePlain 解析 AUTH PLAIN 的初始响应（authzid\0authcid\0passwd），返回用户名
+func decodePlain(initial string) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(string(raw), "\x00")
+	if len(parts) != 3 || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -0,0 +1,364 @@
+// Package oidc 实现 OpenID Connect 授权码流程的客户端部分：发现文档、PKCE、用授权码换取令牌，
+// 以及基于身份提供方 JWKS 的 ID Token 校验
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery      = errors.New("获取身份提供方配置失败")
+	ErrExchange       = errors.New("授权码换取令牌失败")
+	ErrInvalidIDToken = errors.New("ID Token 无效")
+)
+
+const (
+	// metadataTTL 发现文档的缓存时间
+	metadataTTL = time.Hour
+	// jwksRefreshInterval 遇到未知 kid 时重新获取 JWKS 的最小间隔，防止被恶意令牌触发频繁请求
+	jwksRefreshInterval = 10 * time.Second
+	// maxResponseSize 身份提供方响应的最大字节数
+	maxResponseSize = 1 << 20
+	// clockSkew 校验 exp/iat 时容忍的时钟偏差
+	clockSkew = time.Minute
+)
+
+// signingMethods ID Token 允许的签名算法，不接受 none 和 HS*
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Config 一个身份提供方的客户端配置
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // 为空时按公共客户端处理，只依赖 PKCE
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Token 令牌端点的响应
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Claims ID Token 中的声明
+type Claims map[string]interface{}
+
+// String 读取字符串声明，不存在或类型不符时返回空字符串
+func (c Claims) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+// Bool 读取布尔声明，兼容部分身份提供方返回的 "true" 字符串
+func (c Claims) Bool(name string) bool {
+	switch v := c[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Strings 读取字符串数组声明，单个字符串视为只有一个元素的数组
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// metadata 发现文档（/.well-known/openid-configuration）中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider 一个 OpenID Connect 身份提供方，发现文档和 JWKS 按需获取并缓存
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	meta      *metadata
+	metaAt    time.Time
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+	keysFetch time.Time
+}
+
+// NewProvider 创建身份提供方客户端，不会立即发起网络请求
+func NewProvider(cfg Config) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL 生成授权地址，使用 S256 PKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange 用授权码和 PKCE 校验码换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token Token
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: 响应中缺少 id_token", ErrExchange)
+	}
+	return &token, nil
+}
+
+// VerifyIDToken 校验 ID Token 的签名、签发方、受众、有效期和 nonce，返回其中的声明
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	result := Claims(claims)
+	// 存在多个受众时 azp 必须是本客户端
+	if aud, _ := claims.GetAudience(); len(aud) > 1 && result.String("azp") != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp 不匹配", ErrInvalidIDToken)
+	}
+	if result.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce 不匹配", ErrInvalidIDToken)
+	}
+	if result.String("sub") == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrInvalidIDToken)
+	}
+	return result, nil
+}
+
+// metadata 获取发现文档，缓存 metadataTTL
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	if p.meta != nil && time.Since(p.metaAt) < metadataTTL {
+		meta := p.meta
+		p.mu.Unlock()
+		return meta, nil
+	}
+	p.mu.Unlock()
+
+	issuer := strings.TrimRight(p.cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	if err := p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	// 发现文档中的 issuer 必须与配置一致，防止被替换为其他提供方
+	if strings.TrimRight(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer 不匹配（%s）", ErrDiscovery, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: 缺少必要的端点", ErrDiscovery)
+	}
+
+	p.mu.Lock()
+	p.meta = &meta
+	p.metaAt = time.Now()
+	p.mu.Unlock()
+	return &meta, nil
+}
+
+// publicKey 按 kid 查找签名公钥；找不到时重新获取 JWKS，以便跟上身份提供方的密钥轮换
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.lookupKey(kid)
+	refresh := !ok && time.Since(p.keysFetch) >= jwksRefreshInterval
+	if refresh {
+		p.keysFetch = time.Now()
+	}
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !refresh {
+		return nil, errors.New("未知的签名密钥")
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	key, ok = p.lookupKey(kid)
+	p.mu.Unlock()
+	if !ok {
+		return nil, errors.New("未知的签名密钥")
+	}
+	return key, nil
+}
+
+// lookupKey 在已缓存的 JWKS 中查找公钥，令牌没有 kid 时只在 JWKS 仅有一个密钥时使用它
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeys 获取并解析 JWKS，跳过不用于签名或不支持的密钥
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jsonWebKeySet
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("获取 JWKS 失败: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i := range set.Keys {
+		jwk := &set.Keys[i]
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// do 发送请求并解析 JSON 响应，非 2xx 状态视为错误
+func (p *Provider) do(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// RandomString 生成 n 字节随机数的 URL 安全 Base64 编码，用于 state、nonce 和 PKCE 校验码
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CodeChallenge 计算 PKCE 校验码对应的 S256 挑战值
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+// Package testenv 为集成测试准备隔离的运行环境：临时工作目录、默认配置、SQLite 数据库，
+// 以及注册了全部路由的 HTTP 服务。处理器中的存储路径是相对路径，因此每个测试都切换到自己的临时目录
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/zy84338719/fileCodeBox/backend/cmd/server/bootstrap"
+	"github.com/zy84338719/fileCodeBox/backend/gen/http/router"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	httpmw "github.com/zy84338719/fileCodeBox/backend/internal/transport/http/middleware"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Setup 切换到临时工作目录，加载默认配置（关闭接口限流）并初始化日志和数据库
+// 返回的配置即全局配置，测试可以直接修改
+func Setup(t testing.TB) *conf.AppConfiguration {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	cfg, err := bootstrap.InitConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("加载默认配置失败: %v", err)
+	}
+	cfg.Database = conf.DatabaseConfig{Driver: "sqlite", DBName: filepath.Join(dir, "test.db")}
+	cfg.RateLimit.Enabled = false
+	conf.SetGlobalConfig(cfg)
+
+	if err := logger.Init(&logger.Config{Level: "error"}); err != nil {
+		t.Fatalf("初始化日志失败: %v", err)
+	}
+	auth.SetJWTSecret(cfg.User.JWTSecret)
+
+	database, err := bootstrap.InitDatabase(&cfg.Database)
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	// 迁移完成后不再逐条打印 SQL
+	db.SetDatabaseInstance(database.Session(&gorm.Session{Logger: gormlogger.Default.LogMode(gormlogger.Silent)}))
+	t.Cleanup(func() { _ = db.Close() })
+	return cfg
+}
+
+// StartServer 在本机随机端口启动注册了全部路由的服务，返回形如 http://127.0.0.1:port 的地址
+// 需要先调用 Setup
+func StartServer(t testing.TB) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("分配端口失败: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	h := server.New(
+		server.WithHostPorts(addr),
+		server.WithStreamBody(true),
+		server.WithExitWaitTime(0),
+	)
+	clientIP, err := httpmw.NewClientIPFunc(conf.GetGlobalConfig().Server.TrustedProxies)
+	if err != nil {
+		t.Fatalf("解析受信任代理失败: %v", err)
+	}
+	h.SetClientIPFunc(clientIP)
+	router.GeneratedRegister(h)
+	go h.Spin()
+	t.Cleanup(func() {
+		// 关闭保持的客户端连接，否则 Shutdown 会等到超时
+		http.DefaultClient.CloseIdleConnections()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = h.Shutdown(ctx)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err == nil {
+			_ = conn.Close()
+			return fmt.Sprintf("http://%s", addr)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("服务未能在 %s 上启动: %v", addr, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 的 SHA1 密钥 "12345678901234567890" 的 Base32 编码
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeRFC6238Vectors 附录 B 的验证码为 8 位，6 位验证码取其后 6 位
+func TestCodeRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, v := range vectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if got != v.code {
+			t.Errorf("Code(%d) = %s，期望 %s", v.unix, got, v.code)
+		}
+	}
+
+	// 密钥大小写和首尾空白不影响结果
+	if got, _ := Code(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", Step(time.Unix(59, 0))); got != "287082" {
+		t.Errorf("小写密钥的验证码为 %s", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("无效的密钥没有返回错误")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset := int64(-Skew); offset <= Skew; offset++ {
+		code, _ := Code(rfcSecret, current+offset)
+		step, ok := Validate(rfcSecret, code, now)
+		if !ok || step != current+offset {
+			t.Errorf("偏差 %d 步: step=%d ok=%v", offset, step, ok)
+		}
+	}
+	for _, offset := range []int64{-Skew - 1, Skew + 1} {
+		code, _ := Code(rfcSecret, current+offset)
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("偏差 %d 步的验证码通过了校验", offset)
+		}
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := Validate(rfcSecret, " 287 082 ", now); !ok {
+		t.Error("带空格的验证码没有通过校验")
+	}
+	for _, code := range []string{"", "28708", "2870820", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("%q 通过了校验", code)
+		}
+	}
+}
+
+// TestValidateReturnsStepForReplay 同一个验证码在有效期内每次都返回相同的时间步，
+// 调用方据此拒绝重放（见 twofactor.Service.Verify）
+func TestValidateReturnsStepForReplay(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Step(issued))
+
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("验证码没有通过校验")
+	}
+	second, ok := Validate(rfcSecret, code, issued.Add(Period*time.Second))
+	if !ok || second != first {
+		t.Fatalf("下一个时间步重复提交: step=%d ok=%v，期望 %d", second, ok, first)
+	}
+	if _, ok := Validate(rfcSecret, code, issued.Add(2*Period*time.Second)); ok {
+		t.Fatal("超出偏差范围后验证码仍然有效")
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -35,6 +36,11 @@ func ParseExpireParams(expireValueStr, expireStyle, requireAuthStr string) (*Exp
 
 // CalculateExpireTime 计算过期时间
 func CalculateExpireTime(expireValue int, expireStyle string) *time.Time {
+	return CalculateExpireTimeFrom(nil, expireValue, expireStyle)
+}
+
+// CalculateExpireTimeFrom 从生效时间开始计算过期时间，availableFrom 为 nil 时从当前时间开始
+func CalculateExpireTimeFrom(availableFrom *time.Time, expireValue int, expireStyle string) *time.Time {
 	if expireStyle == "forever" {
 		return nil
 	}
@@ -66,10 +72,35 @@ func CalculateExpireTime(expireValue int, expireStyle string) *time.Time {
 		duration = time.Duration(expireValue) * 24 * time.Hour
 	}
 
-	expireTime := time.Now().Add(duration)
+	start := time.Now()
+	if availableFrom != nil && availableFrom.After(start) {
+		start = *availableFrom
+	}
+	expireTime := start.Add(duration)
 	return &expireTime
 }
 
+// ParseAvailableFrom 解析分享生效时间，支持 RFC 3339 和 Unix 秒级时间戳
+// 为空或早于当前时间时返回 nil，表示立即生效
+func ParseAvailableFrom(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	var t time.Time
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t = time.Unix(ts, 0)
+	} else if t, err = time.Parse(time.RFC3339, value); err != nil {
+		return nil, errors.New("available_from 格式错误，应为 RFC 3339 时间或 Unix 时间戳")
+	}
+
+	if !t.After(time.Now()) {
+		return nil, nil
+	}
+	return &t, nil
+}
+
 // CalculateExpireCount 计算过期次数（-1 表示无限制）
 func CalculateExpireCount(expireStyle string, expireValue int) int {
 	if expireStyle == "count" {
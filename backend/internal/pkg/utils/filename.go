@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// maxFileNameLength 原始文件名最大长度（字节），与数据库字段长度保持一致
+const maxFileNameLength = 255
+
+// inlineSafeMimeTypes 允许浏览器内联展示的 MIME 类型
+// 不包含 text/html、image/svg+xml 等可能执行脚本的类型
+var inlineSafeMimeTypes = map[string]bool{
+	"text/plain":      true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wav":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/ogg":       true,
+}
+
+// SanitizeFileName 清理客户端提交的文件名：去掉路径和控制字符并限制长度
+func SanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+
+	// 超长时保留扩展名，按字符截断前缀
+	if len(name) > maxFileNameLength {
+		ext := path.Ext(name)
+		if len(ext) > 32 {
+			ext = ""
+		}
+		runes := []rune(strings.TrimSuffix(name, ext))
+		for len(string(runes))+len(ext) > maxFileNameLength {
+			runes = runes[:len(runes)-1]
+		}
+		name = string(runes) + ext
+	}
+	return name
+}
+
+// SplitFileName 将文件名拆分为前缀和扩展名（含点）
+func SplitFileName(name string) (prefix, suffix string) {
+	suffix = path.Ext(name)
+	return strings.TrimSuffix(name, suffix), suffix
+}
+
+// DetectMimeType 根据文件头嗅探 MIME 类型，嗅探结果过于笼统时参考扩展名
+func DetectMimeType(fileName string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	base, _, _ := mime.ParseMediaType(sniffed)
+
+	if base == "application/octet-stream" || base == "text/plain" || base == "application/zip" {
+		if byExt := mime.TypeByExtension(strings.ToLower(path.Ext(fileName))); byExt != "" {
+			extBase, _, _ := mime.ParseMediaType(byExt)
+			// 只在嗅探结果与扩展名兼容时采用扩展名类型，避免伪装成文本的二进制被当作其他类型
+			if base != "text/plain" || strings.HasPrefix(extBase, "text/") || strings.HasSuffix(extBase, "+xml") || strings.HasSuffix(extBase, "json") {
+				return byExt
+			}
+		}
+	}
+	return sniffed
+}
+
+// IsInlineSafeMime 判断该 MIME 类型是否允许浏览器内联展示
+func IsInlineSafeMime(mimeType string) bool {
+	base, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return inlineSafeMimeTypes[base]
+}
+
+// ContentDisposition 生成符合 RFC 6266 的 Content-Disposition 头
+// filename 为 ASCII 兜底名，filename* 使用 UTF-8 百分号编码保留原始文件名
+func ContentDisposition(disposition, fileName string) string {
+	if fileName == "" {
+		return disposition
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r < 0x20 || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, fileName)
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, encodeRFC5987(fileName))
+}
+
+// encodeRFC5987 按 RFC 5987 的 attr-char 规则进行百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0F])
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRange Range 头无法满足
+var ErrInvalidRange = errors.New("无效的 Range 请求")
+
+// ByteRange 单个字节区间 [Start, Start+Length)
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ParseRange 解析 HTTP Range 头（仅支持单个区间）
+// 返回 nil 表示应返回完整内容；多区间请求同样回退为完整内容
+func ParseRange(header string, size int64) (*ByteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, ErrInvalidRange
+	}
+	spec := strings.TrimSpace(header[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, ErrInvalidRange
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	// bytes=-N：最后 N 个字节
+	if startStr == "" {
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		if n == 0 {
+			return nil, ErrInvalidRange
+		}
+		return &ByteRange{Start: size - n, Length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, ErrInvalidRange
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, ErrInvalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return &ByteRange{Start: start, Length: end - start + 1}, nil
+}
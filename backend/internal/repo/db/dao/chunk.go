@@ -61,7 +61,7 @@ func (r *ChunkRepository) UpdateUploadProgress(ctx context.Context, uploadID str
 }
 
 func (r *ChunkRepository) UpdateChunkCompleted(ctx context.Context, uploadID string, chunkIndex int, chunkHash string) error {
-	return r.db().WithContext(ctx).Where("upload_id = ? AND chunk_index = ?", uploadID, chunkIndex).
+	return r.db().WithContext(ctx).Model(&model.UploadChunk{}).Where("upload_id = ? AND chunk_index = ?", uploadID, chunkIndex).
 		Updates(map[string]interface{}{
 			"completed":  true,
 			"chunk_hash": chunkHash,
@@ -77,6 +77,102 @@ func (r *ChunkRepository) CountCompletedChunks(ctx context.Context, uploadID str
 	return count, err
 }
 
+// CountOpenSessions 统计 since 之后创建、尚未完成的上传会话数
+// userID 不为空时按用户统计，否则按 IP 统计匿名会话
+func (r *ChunkRepository) CountOpenSessions(ctx context.Context, userID *uint, ownerIP string, since time.Time) (int64, error) {
+	query := r.db().WithContext(ctx).Model(&model.UploadChunk{}).
+		Where("chunk_index = -1 AND status <> 'completed' AND created_at > ?", since)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("user_id IS NULL AND owner_ip = ?", ownerIP)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// GetIdleSessions 获取 idleBefore 之后没有任何活动的未完成上传会话（控制记录）
+func (r *ChunkRepository) GetIdleSessions(ctx context.Context, idleBefore time.Time, limit int) ([]*model.UploadChunk, error) {
+	active := r.db().Model(&model.UploadChunk{}).Select("upload_id").Where("updated_at >= ?", idleBefore)
+
+	var sessions []*model.UploadChunk
+	err := r.db().WithContext(ctx).
+		Where("chunk_index = -1 AND status <> 'completed' AND updated_at < ?", idleBefore).
+		Where("upload_id NOT IN (?)", active).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// SumOpenSessionSize 统计用户未完成上传会话声明的文件总大小（回收前计入配额）
+// excludeUploadID 不为空时不统计该会话
+func (r *ChunkRepository) SumOpenSessionSize(ctx context.Context, userID uint, excludeUploadID string) (int64, error) {
+	query := r.db().WithContext(ctx).Model(&model.UploadChunk{}).
+		Select("COALESCE(SUM(file_size), 0)").
+		Where("chunk_index = -1 AND status <> 'completed' AND user_id = ?", userID)
+	if excludeUploadID != "" {
+		query = query.Where("upload_id <> ?", excludeUploadID)
+	}
+
+	var total int64
+	err := query.Scan(&total).Error
+	return total, err
+}
+
+// RecordChunkFailure 记录分片上传失败：累加重试次数并保存错误信息，返回累计重试次数
+// 已完成的分片只记录错误，不改变其状态
+func (r *ChunkRepository) RecordChunkFailure(ctx context.Context, uploadID string, chunkIndex int, lastError string) (int, error) {
+	chunk := model.UploadChunk{UploadID: uploadID, ChunkIndex: chunkIndex}
+	err := r.db().WithContext(ctx).
+		Where("upload_id = ? AND chunk_index = ?", uploadID, chunkIndex).
+		Attrs(model.UploadChunk{Status: "failed"}).
+		FirstOrCreate(&chunk).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.db().WithContext(ctx).Model(&chunk).Updates(map[string]interface{}{
+		"retry_count": gorm.Expr("retry_count + 1"),
+		"last_error":  lastError,
+		"status":      gorm.Expr("CASE WHEN completed THEN status ELSE 'failed' END"),
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+	return chunk.RetryCount + 1, nil
+}
+
+// MarkUploadFailed 标记整个上传失败（如合并后校验不通过）
+func (r *ChunkRepository) MarkUploadFailed(ctx context.Context, uploadID string, lastError string) error {
+	return r.db().WithContext(ctx).Model(&model.UploadChunk{}).
+		Where("upload_id = ? AND chunk_index = -1", uploadID).
+		Updates(map[string]interface{}{
+			"status":      "failed",
+			"last_error":  lastError,
+			"retry_count": gorm.Expr("retry_count + 1"),
+		}).Error
+}
+
+// SumCompletedChunkSize 统计已完成分片的总字节数（即 tus 的 Upload-Offset）
+func (r *ChunkRepository) SumCompletedChunkSize(ctx context.Context, uploadID string) (int64, error) {
+	var total int64
+	err := r.db().WithContext(ctx).Model(&model.UploadChunk{}).
+		Where("upload_id = ? AND chunk_index >= 0 AND completed = true", uploadID).
+		Select("COALESCE(SUM(chunk_size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// UpdateTotalChunks 更新控制记录中的分片总数（tus 上传的分片数随写入增长）
+func (r *ChunkRepository) UpdateTotalChunks(ctx context.Context, uploadID string, totalChunks int) error {
+	return r.db().WithContext(ctx).Model(&model.UploadChunk{}).
+		Where("upload_id = ? AND chunk_index = -1", uploadID).
+		Update("total_chunks", totalChunks).Error
+}
+
 func (r *ChunkRepository) DeleteByUploadID(ctx context.Context, uploadID string) error {
 	return r.db().WithContext(ctx).Where("upload_id = ?", uploadID).Delete(&model.UploadChunk{}).Error
 }
@@ -136,8 +232,18 @@ func (r *ChunkRepository) GetUploadedChunkIndexes(ctx context.Context, uploadID
 	return uploadedChunks, err
 }
 
+func (r *ChunkRepository) GetCompletedChunks(ctx context.Context, uploadID string) ([]*model.UploadChunk, error) {
+	var chunks []*model.UploadChunk
+	err := r.db().WithContext(ctx).
+		Where("upload_id = ? AND completed = true AND chunk_index >= 0", uploadID).
+		Order("chunk_index ASC").
+		Find(&chunks).Error
+	return chunks, err
+}
+
 func (r *ChunkRepository) FirstOrCreateChunk(ctx context.Context, chunk *model.UploadChunk) error {
+	// Assign 传入副本：查询到已有记录时会写回 chunk，不能让它覆盖待更新的字段
 	return r.db().WithContext(ctx).Where("upload_id = ? AND chunk_index = ?", chunk.UploadID, chunk.ChunkIndex).
-		Assign(chunk).
+		Assign(*chunk).
 		FirstOrCreate(chunk).Error
 }
@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+type FileVersionRepository struct {
+}
+
+func NewFileVersionRepository() *FileVersionRepository {
+	return &FileVersionRepository{}
+}
+
+func (r *FileVersionRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+func (r *FileVersionRepository) Create(ctx context.Context, version *model.FileVersion) error {
+	return r.db().WithContext(ctx).Create(version).Error
+}
+
+// ListByFileCodeID 获取分享的全部历史版本（新版本在前）
+func (r *FileVersionRepository) ListByFileCodeID(ctx context.Context, fileCodeID uint) ([]*model.FileVersion, error) {
+	var versions []*model.FileVersion
+	err := r.db().WithContext(ctx).
+		Where("file_code_id = ?", fileCodeID).
+		Order("version DESC").
+		Find(&versions).Error
+	return versions, err
+}
+
+func (r *FileVersionRepository) GetByVersion(ctx context.Context, fileCodeID uint, version int) (*model.FileVersion, error) {
+	var v model.FileVersion
+	err := r.db().WithContext(ctx).
+		Where("file_code_id = ? AND version = ?", fileCodeID, version).
+		First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// CountByFilePath 统计引用同一存储文件的历史版本数量
+func (r *FileVersionRepository) CountByFilePath(ctx context.Context, filePath string) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.FileVersion{}).Where("file_path = ?", filePath).Count(&count).Error
+	return count, err
+}
+
+// Delete 物理删除历史版本记录（对应的文件已被清理）
+func (r *FileVersionRepository) Delete(ctx context.Context, id uint) error {
+	return r.db().WithContext(ctx).Unscoped().Delete(&model.FileVersion{}, id).Error
+}
+
+func (r *FileVersionRepository) DeleteByFileCodeID(ctx context.Context, fileCodeID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("file_code_id = ?", fileCodeID).Delete(&model.FileVersion{}).Error
+}
+
+// ReassignUser 把分享的全部历史版本转移给另一个用户
+func (r *FileVersionRepository) ReassignUser(ctx context.Context, fileCodeID, userID uint) error {
+	return r.db().WithContext(ctx).Model(&model.FileVersion{}).
+		Where("file_code_id = ?", fileCodeID).
+		Update("user_id", userID).Error
+}
@@ -42,9 +42,14 @@ func (r *FileCodeRepository) GetByCode(ctx context.Context, code string) (*model
 	return &fileCode, nil
 }
 
+// GetByHashAndSize 查找哈希和大小都匹配、且哈希经过服务端校验的文件分享（用于秒传）
+// 端到端加密分享和文本分享不参与去重
 func (r *FileCodeRepository) GetByHashAndSize(ctx context.Context, fileHash string, size int64) (*model.FileCode, error) {
 	var fileCode model.FileCode
-	err := r.db().WithContext(ctx).Where("file_hash = ? AND size = ? AND deleted_at IS NULL", fileHash, size).First(&fileCode).Error
+	err := r.db().WithContext(ctx).
+		Where("file_hash = ? AND size = ? AND hash_verified = ? AND e2ee = ? AND file_path <> ''", fileHash, size, true, false).
+		Order("id DESC").
+		First(&fileCode).Error
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +64,43 @@ func (r *FileCodeRepository) UpdateColumns(ctx context.Context, id uint, updates
 	return r.db().WithContext(ctx).Model(&model.FileCode{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// ReplaceFile 在一个事务中把分享切换到新文件并保存旧文件的历史版本
+// 仅当分享的版本号仍为 fromVersion 时才更新，已被其他请求更新时返回 false 且不做任何修改
+func (r *FileCodeRepository) ReplaceFile(ctx context.Context, fileCode *model.FileCode, history *model.FileVersion, fromVersion int) (bool, error) {
+	replaced := false
+	err := r.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.FileCode{}).
+			Where("id = ? AND version = ?", fileCode.ID, fromVersion).
+			Updates(map[string]interface{}{
+				"file_path":      fileCode.FilePath,
+				"uuid_file_name": fileCode.UUIDFileName,
+				"size":           fileCode.Size,
+				"prefix":         fileCode.Prefix,
+				"suffix":         fileCode.Suffix,
+				"mime_type":      fileCode.MimeType,
+				"text":           fileCode.Text,
+				"file_hash":      fileCode.FileHash,
+				"hash_verified":  fileCode.HashVerified,
+				"is_chunked":     fileCode.IsChunked,
+				"upload_id":      fileCode.UploadID,
+				"version":        fileCode.Version,
+				"updated_at":     time.Now(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		if err := tx.Create(history).Error; err != nil {
+			return err
+		}
+		replaced = true
+		return nil
+	})
+	return replaced, err
+}
+
 func (r *FileCodeRepository) Delete(ctx context.Context, id uint) error {
 	return r.db().WithContext(ctx).Delete(&model.FileCode{}, id).Error
 }
@@ -67,6 +109,23 @@ func (r *FileCodeRepository) DeleteByFileCode(ctx context.Context, fileCode *mod
 	return r.db().WithContext(ctx).Delete(fileCode).Error
 }
 
+// GetByUploadID 根据分片上传 ID 查找对应的分享
+func (r *FileCodeRepository) GetByUploadID(ctx context.Context, uploadID string) (*model.FileCode, error) {
+	var fileCode model.FileCode
+	err := r.db().WithContext(ctx).Where("upload_id = ?", uploadID).First(&fileCode).Error
+	if err != nil {
+		return nil, err
+	}
+	return &fileCode, nil
+}
+
+// CountByFilePath 统计引用同一存储文件的分享数量（秒传的分享共用一份文件）
+func (r *FileCodeRepository) CountByFilePath(ctx context.Context, filePath string) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.FileCode{}).Where("file_path = ?", filePath).Count(&count).Error
+	return count, err
+}
+
 func (r *FileCodeRepository) Count(ctx context.Context) (int64, error) {
 	var count int64
 	err := r.db().WithContext(ctx).Model(&model.FileCode{}).Count(&count).Error
@@ -216,6 +275,11 @@ func (r *FileCodeRepository) DeleteByUserID(ctx context.Context, userID uint) er
 	return r.db().WithContext(ctx).Where("user_id = ?", userID).Delete(&model.FileCode{}).Error
 }
 
+// PurgeByUserID 彻底删除用户的全部分享记录，包括之前软删除的记录
+func (r *FileCodeRepository) PurgeByUserID(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&model.FileCode{}).Error
+}
+
 func (r *FileCodeRepository) CountTodayUploads(ctx context.Context) (int64, error) {
 	var count int64
 	today := time.Now().Format("2006-01-02")
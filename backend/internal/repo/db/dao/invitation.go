@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+// InvitationRepository 注册邀请码数据访问
+type InvitationRepository struct {
+}
+
+func NewInvitationRepository() *InvitationRepository {
+	return &InvitationRepository{}
+}
+
+func (r *InvitationRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+// Create 创建邀请码
+func (r *InvitationRepository) Create(ctx context.Context, invitation *model.Invitation) error {
+	return r.db().WithContext(ctx).Create(invitation).Error
+}
+
+// GetByHash 根据摘要查找邀请码
+func (r *InvitationRepository) GetByHash(ctx context.Context, hash string) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := r.db().WithContext(ctx).Where("code_hash = ?", hash).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// List 分页列出邀请码，最新创建的在前
+func (r *InvitationRepository) List(ctx context.Context, query model.InvitationQuery) ([]*model.Invitation, int64, error) {
+	var invitations []*model.Invitation
+	var total int64
+
+	q := r.db().WithContext(ctx).Model(&model.Invitation{})
+	if query.CreatedBy != nil {
+		q = q.Where("created_by = ?", *query.CreatedBy)
+	}
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (query.Page - 1) * query.PageSize
+	err := q.Order("id DESC").Offset(offset).Limit(query.PageSize).Find(&invitations).Error
+	return invitations, total, err
+}
+
+// Revoke 撤销邀请码，createdBy 不为空时只能撤销自己创建的邀请码
+// 邀请码不存在或已撤销时返回 gorm.ErrRecordNotFound
+func (r *InvitationRepository) Revoke(ctx context.Context, id uint, createdBy *uint) error {
+	now := time.Now()
+	q := r.db().WithContext(ctx).Model(&model.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL", id)
+	if createdBy != nil {
+		q = q.Where("created_by = ?", *createdBy)
+	}
+	res := q.Updates(map[string]interface{}{"revoked_at": &now, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeAllByCreator 撤销用户创建的全部邀请码
+func (r *InvitationRepository) RevokeAllByCreator(ctx context.Context, userID uint) error {
+	now := time.Now()
+	return r.db().WithContext(ctx).Model(&model.Invitation{}).
+		Where("created_by = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": &now, "updated_at": now}).Error
+}
+
+// CountIssuedByCreator 统计用户占用邀请名额的邀请码：未撤销的以及已经有人使用过的
+func (r *InvitationRepository) CountIssuedByCreator(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.Invitation{}).
+		Where("created_by = ? AND (revoked_at IS NULL OR used_count > 0)", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// Redeem 在同一事务中占用一次邀请码并创建用户
+// 邀请码已撤销、过期或用完时返回 gorm.ErrRecordNotFound，此时不会创建用户
+func (r *InvitationRepository) Redeem(ctx context.Context, id uint, user *model.User) error {
+	return r.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&model.Invitation{}).
+			Where("id = ? AND revoked_at IS NULL AND used_count < max_uses", id).
+			Where("expires_at IS NULL OR expires_at > ?", now).
+			Updates(map[string]interface{}{
+				"used_count": gorm.Expr("used_count + 1"),
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		user.InvitationID = &id
+		return tx.Create(user).Error
+	})
+}
@@ -2,6 +2,8 @@ package dao
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
@@ -68,3 +70,114 @@ func (r *TransferLogRepository) List(ctx context.Context, query model.TransferLo
 
 	return logs, total, nil
 }
+
+// downloadOperations 计入下载次数的操作类型
+var downloadOperations = []string{model.TransferOpDownload, model.TransferOpText}
+
+// StatsByFileCodeID 统计单个分享的访问情况，since 之后的记录按天聚合
+func (r *TransferLogRepository) StatsByFileCodeID(ctx context.Context, fileCodeID uint, since time.Time) (*model.ShareAccessStats, error) {
+	stats := &model.ShareAccessStats{Daily: []model.DailyAccessCount{}}
+	base := func() *gorm.DB {
+		return r.db().WithContext(ctx).Model(&model.TransferLog{}).Where("file_code_id = ?", fileCodeID)
+	}
+
+	var byOperation []struct {
+		Operation string
+		Count     int64
+		Bytes     int64
+	}
+	if err := base().
+		Select("operation, COUNT(*) AS count, COALESCE(SUM(bytes_sent), 0) AS bytes").
+		Group("operation").
+		Scan(&byOperation).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range byOperation {
+		stats.TotalEvents += row.Count
+		stats.BytesSent += row.Bytes
+		switch row.Operation {
+		case model.TransferOpDownload:
+			stats.Downloads = row.Count
+		case model.TransferOpRange:
+			stats.RangeRequests = row.Count
+		case model.TransferOpText:
+			stats.TextViews = row.Count
+		case model.TransferOpPreview:
+			stats.PreviewViews = row.Count
+		}
+	}
+
+	if err := base().Where("success = ?", false).Count(&stats.Failed).Error; err != nil {
+		return nil, err
+	}
+
+	// 独立下载者：登录用户按用户ID，匿名用户按IP
+	var downloaders []struct {
+		UserID *uint
+		IP     string
+	}
+	if err := base().
+		Distinct("user_id", "ip").
+		Where("operation IN ? AND success = ?", downloadOperations, true).
+		Scan(&downloaders).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(downloaders))
+	for _, d := range downloaders {
+		key := "ip:" + d.IP
+		if d.UserID != nil {
+			key = fmt.Sprintf("user:%d", *d.UserID)
+		}
+		seen[key] = struct{}{}
+	}
+	stats.UniqueDownloaders = int64(len(seen))
+
+	// 按天聚合在内存中完成，避免不同数据库日期函数的差异
+	var recent []struct {
+		CreatedAt time.Time
+		BytesSent int64
+	}
+	if err := base().
+		Select("created_at, bytes_sent").
+		Where("created_at >= ?", since).
+		Order("created_at ASC").
+		Scan(&recent).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range recent {
+		day := row.CreatedAt.Local().Format("2006-01-02")
+		n := len(stats.Daily)
+		if n == 0 || stats.Daily[n-1].Date != day {
+			stats.Daily = append(stats.Daily, model.DailyAccessCount{Date: day})
+			n++
+		}
+		stats.Daily[n-1].Events++
+		stats.Daily[n-1].BytesSent += row.BytesSent
+	}
+
+	return stats, nil
+}
+
+// CountDownloadsByOwner 统计某用户所有分享被成功下载（含文本读取）的次数
+func (r *TransferLogRepository) CountDownloadsByOwner(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.TransferLog{}).
+		Joins("JOIN file_codes ON file_codes.id = transfer_logs.file_code_id").
+		Where("file_codes.user_id = ?", userID).
+		Where("transfer_logs.operation IN ? AND transfer_logs.success = ?", downloadOperations, true).
+		Count(&count).Error
+	return count, err
+}
+
+// AnonymizeUser 匿名化用户的传输记录：清空用户、IP 和 UA，保留操作统计
+func (r *TransferLogRepository) AnonymizeUser(ctx context.Context, userID uint) (int64, error) {
+	res := r.db().WithContext(ctx).Model(&model.TransferLog{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"user_id":    nil,
+			"username":   "",
+			"ip":         "",
+			"user_agent": "",
+		})
+	return res.RowsAffected, res.Error
+}
@@ -2,6 +2,7 @@ package dao
 
 import (
 	"context"
+	"time"
 
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
@@ -88,3 +89,33 @@ func (r *UserRepository) CountAdminUsers(ctx context.Context) (int64, error) {
 	err := r.db().WithContext(ctx).Model(&model.User{}).Where("role = ?", "admin").Count(&count).Error
 	return count, err
 }
+
+// HardDelete 彻底删除用户记录，释放用户名和邮箱
+func (r *UserRepository) HardDelete(ctx context.Context, id uint) error {
+	return r.db().WithContext(ctx).Unscoped().Delete(&model.User{}, id).Error
+}
+
+// ListDeletionDue 返回宽限期已结束、等待清除数据的账号
+func (r *UserRepository) ListDeletionDue(ctx context.Context, before time.Time, limit int) ([]*model.User, error) {
+	var users []*model.User
+	err := r.db().WithContext(ctx).
+		Where("status = ? AND deletion_scheduled_at <= ?", model.UserStatusPendingDeletion, before).
+		Order("deletion_scheduled_at ASC").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// UseTOTPStep 记录已使用的 TOTP 时间步，step 不大于已记录的时间步时返回 false，保证同一验证码只能使用一次
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	res := r.db().WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+// SetTotalDownloads 只更新下载次数，不修改其他字段和更新时间
+func (r *UserRepository) SetTotalDownloads(ctx context.Context, id uint, total int) error {
+	return r.db().WithContext(ctx).Model(&model.User{}).Where("id = ?", id).
+		UpdateColumn("total_downloads", total).Error
+}
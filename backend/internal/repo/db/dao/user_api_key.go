@@ -2,6 +2,7 @@ package dao
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
@@ -48,15 +49,33 @@ func (r *UserAPIKeyRepository) GetActiveByHash(ctx context.Context, hash string)
 	return &key, nil
 }
 
-// TouchLastUsed 更新最后使用时间
-func (r *UserAPIKeyRepository) TouchLastUsed(ctx context.Context, id uint) error {
+// RecordUsage 累加使用次数并更新最后使用时间和来源地址
+func (r *UserAPIKeyRepository) RecordUsage(ctx context.Context, id uint, ip string) error {
 	now := time.Now()
 	return r.db().WithContext(ctx).Model(&model.UserAPIKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + 1"),
 		"last_used_at": &now,
+		"last_used_ip": ip,
 		"updated_at":   now,
 	}).Error
 }
 
+// GrantLegacyScopes 为引入权限范围之前创建、Scopes 为空的密钥补上普通用户的全部范围。
+// 管理员的旧密钥同样不会获得 admin:*，需要时由管理员显式重新创建。返回更新的密钥数量，已设置范围的密钥不受影响
+func (r *UserAPIKeyRepository) GrantLegacyScopes(ctx context.Context) (int64, error) {
+	var userScopes []string
+	for _, scope := range model.APIKeyScopes {
+		if scope != model.APIKeyScopeAdmin {
+			userScopes = append(userScopes, scope)
+		}
+	}
+
+	res := r.db().WithContext(ctx).Model(&model.UserAPIKey{}).
+		Where("scopes = '' OR scopes IS NULL").
+		Update("scopes", strings.Join(userScopes, ","))
+	return res.RowsAffected, res.Error
+}
+
 // RevokeByID 撤销密钥
 func (r *UserAPIKeyRepository) RevokeByID(ctx context.Context, userID, id uint) error {
 	now := time.Now()
@@ -76,6 +95,24 @@ func (r *UserAPIKeyRepository) RevokeByID(ctx context.Context, userID, id uint)
 	return nil
 }
 
+// RevokeAllByUser 撤销用户全部有效密钥，返回撤销的数量
+func (r *UserAPIKeyRepository) RevokeAllByUser(ctx context.Context, userID uint) (int64, error) {
+	now := time.Now()
+	res := r.db().WithContext(ctx).Model(&model.UserAPIKey{}).
+		Where("user_id = ? AND revoked = ?", userID, false).
+		Updates(map[string]interface{}{
+			"revoked":    true,
+			"revoked_at": &now,
+			"updated_at": now,
+		})
+	return res.RowsAffected, res.Error
+}
+
+// DeleteByUser 删除用户的全部密钥
+func (r *UserAPIKeyRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&model.UserAPIKey{}).Error
+}
+
 // CountActiveByUser 统计用户有效密钥数量
 func (r *UserAPIKeyRepository) CountActiveByUser(ctx context.Context, userID uint) (int64, error) {
 	var count int64
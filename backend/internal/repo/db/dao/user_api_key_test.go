@@ -0,0 +1,64 @@
+package dao_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+func TestGrantLegacyScopes(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	repo := dao.NewUserAPIKeyRepository()
+
+	admin := &model.User{Username: "root", Email: "root@example.com", Role: "admin", Status: "active"}
+	user := &model.User{Username: "bob", Email: "bob@example.com", Role: "user", Status: "active"}
+	for _, u := range []*model.User{admin, user} {
+		if err := db.GetDB().Create(u).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+
+	keys := []*model.UserAPIKey{
+		{UserID: admin.ID, KeyHash: "legacy-admin"},
+		{UserID: user.ID, KeyHash: "legacy-user"},
+		{UserID: user.ID, KeyHash: "scoped", Scopes: model.APIKeyScopeShareCreate},
+	}
+	for _, key := range keys {
+		if err := repo.Create(ctx, key); err != nil {
+			t.Fatalf("创建密钥失败: %v", err)
+		}
+	}
+
+	granted, err := repo.GrantLegacyScopes(ctx)
+	if err != nil {
+		t.Fatalf("GrantLegacyScopes: %v", err)
+	}
+	if granted != 2 {
+		t.Fatalf("更新了 %d 个密钥", granted)
+	}
+
+	want := map[string]string{
+		"legacy-admin": "share:create,share:read,share:delete,files:list",
+		"legacy-user":  "share:create,share:read,share:delete,files:list",
+		"scoped":       "share:create",
+	}
+	for _, key := range keys {
+		got, err := repo.GetByID(ctx, key.ID)
+		if err != nil {
+			t.Fatalf("读取密钥失败: %v", err)
+		}
+		if got.Scopes != want[key.KeyHash] {
+			t.Errorf("%s 的权限范围为 %q", key.KeyHash, got.Scopes)
+		}
+	}
+
+	// 再次执行不会改动已有范围的密钥
+	if granted, err := repo.GrantLegacyScopes(ctx); err != nil || granted != 0 {
+		t.Fatalf("重复迁移: granted=%d err=%v", granted, err)
+	}
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepository struct {
+}
+
+func NewUserIdentityRepository() *UserIdentityRepository {
+	return &UserIdentityRepository{}
+}
+
+func (r *UserIdentityRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+// Create 创建外部身份绑定
+func (r *UserIdentityRepository) Create(ctx context.Context, identity *model.UserIdentity) error {
+	return r.db().WithContext(ctx).Create(identity).Error
+}
+
+// GetByProviderSubject 根据身份提供方和 sub 获取绑定
+func (r *UserIdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db().WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// UpdateLogin 记录最近一次登录时间和邮箱
+func (r *UserIdentityRepository) UpdateLogin(ctx context.Context, id uint, email string, at time.Time) error {
+	return r.db().WithContext(ctx).Model(&model.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": at}).Error
+}
+
+// ListByUser 获取用户绑定的全部外部身份
+func (r *UserIdentityRepository) ListByUser(ctx context.Context, userID uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := r.db().WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&identities).Error
+	return identities, err
+}
+
+// ListByProvider 获取某个身份提供方的全部绑定
+func (r *UserIdentityRepository) ListByProvider(ctx context.Context, provider string) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := r.db().WithContext(ctx).Where("provider = ?", provider).Order("id ASC").Find(&identities).Error
+	return identities, err
+}
+
+// SetDisabled 记录绑定是否因目录中禁用而停用了本地用户
+func (r *UserIdentityRepository) SetDisabled(ctx context.Context, id uint, disabled bool) error {
+	return r.db().WithContext(ctx).Model(&model.UserIdentity{}).Where("id = ?", id).Update("disabled", disabled).Error
+}
+
+// DeleteByUser 删除用户的全部外部身份绑定
+func (r *UserIdentityRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Where("user_id = ?", userID).Delete(&model.UserIdentity{}).Error
+}
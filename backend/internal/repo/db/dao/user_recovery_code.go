@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+type UserRecoveryCodeRepository struct {
+}
+
+func NewUserRecoveryCodeRepository() *UserRecoveryCodeRepository {
+	return &UserRecoveryCodeRepository{}
+}
+
+func (r *UserRecoveryCodeRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+// Replace 删除用户已有的恢复码并保存新的一组
+func (r *UserRecoveryCodeRepository) Replace(ctx context.Context, userID uint, hashes []string) error {
+	return r.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.UserRecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			codes = append(codes, model.UserRecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Use 将一个未使用的恢复码标记为已使用，恢复码不存在或已使用时返回 gorm.ErrRecordNotFound
+func (r *UserRecoveryCodeRepository) Use(ctx context.Context, userID uint, hash string) error {
+	now := time.Now()
+	res := r.db().WithContext(ctx).Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Updates(map[string]interface{}{"used_at": &now, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountUnused 统计用户剩余可用的恢复码
+func (r *UserRecoveryCodeRepository) CountUnused(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteByUser 删除用户的全部恢复码
+func (r *UserRecoveryCodeRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error
+}
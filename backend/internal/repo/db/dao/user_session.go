@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+type UserSessionRepository struct {
+}
+
+func NewUserSessionRepository() *UserSessionRepository {
+	return &UserSessionRepository{}
+}
+
+func (r *UserSessionRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+// Create 创建会话
+func (r *UserSessionRepository) Create(ctx context.Context, session *model.UserSession) error {
+	return r.db().WithContext(ctx).Create(session).Error
+}
+
+// GetBySessionID 根据会话ID获取会话（包括已撤销的）
+func (r *UserSessionRepository) GetBySessionID(ctx context.Context, sessionID string) (*model.UserSession, error) {
+	var session model.UserSession
+	err := r.db().WithContext(ctx).Where("session_id = ?", sessionID).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActive 获取用户未撤销且未过期的会话，按创建时间升序
+func (r *UserSessionRepository) ListActive(ctx context.Context, userID uint, now time.Time) ([]model.UserSession, error) {
+	var sessions []model.UserSession
+	err := r.db().WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("created_at ASC, id ASC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Rotate 用新的刷新令牌摘要替换旧摘要，仅当会话未撤销且摘要仍为 oldHash 时生效
+// 返回 false 表示旧令牌已被使用过或会话已撤销
+func (r *UserSessionRepository) Rotate(ctx context.Context, id uint, oldHash, newHash string, expiresAt time.Time, ip, userAgent string) (bool, error) {
+	now := time.Now()
+	res := r.db().WithContext(ctx).Model(&model.UserSession{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_hash": newHash,
+			"expires_at":   expiresAt,
+			"last_used_at": now,
+			"ip":           ip,
+			"user_agent":   userAgent,
+			"updated_at":   now,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// Revoke 撤销指定会话，已撤销的会话保持原有原因不变
+func (r *UserSessionRepository) Revoke(ctx context.Context, sessionIDs []string, reason string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return r.db().WithContext(ctx).Model(&model.UserSession{}).
+		Where("session_id IN ? AND revoked_at IS NULL", sessionIDs).
+		Updates(map[string]interface{}{"revoked_at": &now, "revoke_reason": reason, "updated_at": now}).Error
+}
+
+// DeleteByUser 删除用户的全部会话记录
+func (r *UserSessionRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&model.UserSession{}).Error
+}
+
+// DeleteStale 删除在 before 之前已过期或已撤销的会话
+func (r *UserSessionRepository) DeleteStale(ctx context.Context, before time.Time) error {
+	return r.db().WithContext(ctx).Unscoped().
+		Where("expires_at < ? OR revoked_at < ?", before, before).
+		Delete(&model.UserSession{}).Error
+}
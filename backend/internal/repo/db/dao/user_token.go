@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository struct {
+}
+
+func NewUserTokenRepository() *UserTokenRepository {
+	return &UserTokenRepository{}
+}
+
+func (r *UserTokenRepository) db() *gorm.DB {
+	return db.GetDB()
+}
+
+// Create 保存新签发的令牌
+func (r *UserTokenRepository) Create(ctx context.Context, token *model.UserToken) error {
+	return r.db().WithContext(ctx).Create(token).Error
+}
+
+// GetValidByHash 根据摘要获取未使用且未过期的令牌
+func (r *UserTokenRepository) GetValidByHash(ctx context.Context, purpose, hash string) (*model.UserToken, error) {
+	var token model.UserToken
+	err := r.db().WithContext(ctx).
+		Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, time.Now()).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed 将令牌标记为已使用，令牌已被使用时返回 gorm.ErrRecordNotFound，保证只能使用一次
+func (r *UserTokenRepository) MarkUsed(ctx context.Context, id uint) error {
+	now := time.Now()
+	res := r.db().WithContext(ctx).Model(&model.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Updates(map[string]interface{}{"used_at": &now, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// InvalidateByUser 作废用户某种用途下所有未使用的令牌，exceptHash 不为空时保留该令牌
+func (r *UserTokenRepository) InvalidateByUser(ctx context.Context, userID uint, purpose, exceptHash string) error {
+	now := time.Now()
+	query := r.db().WithContext(ctx).Model(&model.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose)
+	if exceptHash != "" {
+		query = query.Where("token_hash <> ?", exceptHash)
+	}
+	return query.Updates(map[string]interface{}{"used_at": &now, "updated_at": now}).Error
+}
+
+// CountRecent 统计用户某种用途下 since 之后签发的令牌数，用于限制邮件发送频率
+func (r *UserTokenRepository) CountRecent(ctx context.Context, userID uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db().WithContext(ctx).Model(&model.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, since).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteByUser 删除用户的全部令牌
+func (r *UserTokenRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db().WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&model.UserToken{}).Error
+}
+
+// DeleteExpired 删除 before 之前过期的令牌
+func (r *UserTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res := r.db().WithContext(ctx).Unscoped().Where("expires_at < ?", before).Delete(&model.UserToken{})
+	return res.RowsAffected, res.Error
+}
@@ -92,5 +92,11 @@ func autoMigrate() error {
 		&model.TransferLog{},
 		&model.AdminOperationLog{},
 		&model.UserAPIKey{},
+		&model.UserToken{},
+		&model.UserRecoveryCode{},
+		&model.UserSession{},
+		&model.UserIdentity{},
+		&model.Invitation{},
+		&model.FileVersion{},
 	)
 }
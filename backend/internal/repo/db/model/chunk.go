@@ -17,11 +17,26 @@ type UploadChunk struct {
 	FileSize    int64  `json:"file_size"`
 	ChunkSize   int    `json:"chunk_size"`
 	FileName    string `gorm:"size:255" json:"file_name"`
+	FileHash    string `gorm:"size:64" json:"file_hash"` // 控制记录：客户端声明的整个文件 SHA-256，合并后校验
 
 	Completed  bool   `gorm:"default:false" json:"completed"`
 	RetryCount int    `gorm:"default:0" json:"retry_count"`            // 重试次数
 	LastError  string `gorm:"type:text" json:"last_error"`             // 最后错误信息
 	Status     string `gorm:"size:20;default:'pending'" json:"status"` // pending, uploading, completed, failed
+
+	// 端到端加密上传：控制记录保存 E2EE 标记和元数据，分片记录保存各自的 nonce/tag
+	E2EE     bool   `gorm:"column:e2ee;default:false" json:"e2ee"`
+	E2EEMeta string `gorm:"column:e2ee_meta;type:text" json:"-"`
+	Nonce    string `gorm:"size:64" json:"nonce"`
+	AuthTag  string `gorm:"size:64" json:"auth_tag"`
+
+	// UploadMeta tus 上传的 Upload-Metadata 原文，仅保存在控制记录中
+	UploadMeta string `gorm:"type:text" json:"-"`
+
+	// 上传会话归属（仅控制记录）：登录用户绑定 UserID，匿名上传绑定服务端签发的上传令牌
+	UserID          *uint  `gorm:"index" json:"user_id"`
+	OwnerIP         string `gorm:"size:45;index" json:"owner_ip"`
+	UploadTokenHash string `gorm:"size:64" json:"-"` // 上传令牌的 SHA-256，不保存明文
 }
 
 // ChunkQuery 分片查询条件
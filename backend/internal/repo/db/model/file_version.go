@@ -0,0 +1,24 @@
+package model
+
+import "gorm.io/gorm"
+
+// FileVersion 分享的历史版本
+// FileCode 始终指向最新版本；每次替换文件时，旧版本的存储信息会被保存为一条历史记录
+type FileVersion struct {
+	gorm.Model
+	FileCodeID   uint   `gorm:"index;uniqueIndex:idx_file_version" json:"file_code_id"`
+	Version      int    `gorm:"uniqueIndex:idx_file_version" json:"version"`
+	FilePath     string `gorm:"size:255" json:"file_path"`
+	UUIDFileName string `gorm:"size:255" json:"uuid_file_name"`
+	Size         int64  `gorm:"default:0" json:"size"`
+	FileName     string `gorm:"size:255" json:"file_name"` // 原始文件名
+	MimeType     string `gorm:"size:127" json:"mime_type"`
+	FileHash     string `gorm:"size:64" json:"file_hash"`
+	UserID       *uint  `gorm:"index" json:"user_id"`
+}
+
+// GetFilePath 获取版本文件路径
+func (v *FileVersion) GetFilePath() string {
+	f := FileCode{FilePath: v.FilePath, UUIDFileName: v.UUIDFileName}
+	return f.GetFilePath()
+}
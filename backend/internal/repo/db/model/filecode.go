@@ -11,26 +11,42 @@ import (
 // FileCode 文件代码模型
 type FileCode struct {
 	gorm.Model
-	Code         string     `gorm:"uniqueIndex;size:255" json:"code"`
-	Prefix       string     `gorm:"size:255" json:"prefix"`
-	Suffix       string     `gorm:"size:255" json:"suffix"`
-	UUIDFileName string     `gorm:"size:255" json:"uuid_file_name"`
-	FilePath     string     `gorm:"size:255" json:"file_path"`
-	Size         int64      `gorm:"default:0" json:"size"`
-	Text         string     `gorm:"type:text" json:"text"`
-	ExpiredAt    *time.Time `json:"expired_at"`
-	ExpiredCount int        `gorm:"default:0" json:"expired_count"`
-	UsedCount    int        `gorm:"default:0" json:"used_count"`
-
-	FileHash  string `gorm:"size:64" json:"file_hash"`
-	IsChunked bool   `gorm:"default:false" json:"is_chunked"`
-	UploadID  string `gorm:"size:36" json:"upload_id"`
+	Code          string     `gorm:"uniqueIndex;size:255" json:"code"`
+	Prefix        string     `gorm:"size:255" json:"prefix"`
+	Suffix        string     `gorm:"size:255" json:"suffix"`
+	UUIDFileName  string     `gorm:"size:255" json:"uuid_file_name"`
+	FilePath      string     `gorm:"size:255" json:"file_path"`
+	Size          int64      `gorm:"default:0" json:"size"`
+	MimeType      string     `gorm:"size:127" json:"mime_type"` // 上传时嗅探的 MIME 类型
+	Text          string     `gorm:"type:text" json:"text"`
+	ExpiredAt     *time.Time `json:"expired_at"`
+	AvailableFrom *time.Time `gorm:"index" json:"available_from"` // 生效时间，为空表示立即生效
+	ExpiredCount  int        `gorm:"default:0" json:"expired_count"`
+	UsedCount     int        `gorm:"default:0" json:"used_count"`
+
+	FileHash     string `gorm:"size:64;index" json:"file_hash"`
+	HashVerified bool   `gorm:"default:false" json:"-"` // FileHash 是否为服务端计算的 SHA-256，只有校验过的文件可用于秒传
+	IsChunked    bool   `gorm:"default:false" json:"is_chunked"`
+	UploadID     string `gorm:"size:36" json:"upload_id"`
+	Version      int    `gorm:"default:1" json:"version"` // 当前版本号，历史版本见 FileVersion
 
 	// 新增：用户认证相关字段
 	UserID      *uint  `gorm:"index" json:"user_id"`                           // 上传用户ID，为null表示匿名上传
 	UploadType  string `gorm:"size:20;default:'anonymous'" json:"upload_type"` // anonymous, authenticated
 	RequireAuth bool   `gorm:"default:false" json:"require_auth"`              // 是否需要登录才能下载
 	OwnerIP     string `gorm:"size:45" json:"owner_ip"`                        // 上传者IP地址
+
+	PasswordHash string `gorm:"size:255" json:"-"` // 分享密码的 bcrypt 摘要，为空表示未设置密码
+
+	// 端到端加密（E2EE）：服务端只保存密文，以下元数据由客户端生成且不透明
+	E2EE       bool   `gorm:"column:e2ee;default:false" json:"e2ee"` // 是否为端到端加密分享
+	E2EEMeta   string `gorm:"column:e2ee_meta;type:text" json:"-"`   // 加密文件名、算法、分片大小等（JSON）
+	E2EEChunks string `gorm:"column:e2ee_chunks;type:text" json:"-"` // 各分片的 nonce/tag（JSON），用于流式解密
+}
+
+// IsAvailable 检查是否已到生效时间
+func (f *FileCode) IsAvailable() bool {
+	return f.AvailableFrom == nil || !time.Now().Before(*f.AvailableFrom)
 }
 
 // IsExpired 检查是否过期
@@ -72,6 +88,34 @@ func (f *FileCode) GetFilePath() string {
 	return ""
 }
 
+// IsText 是否为文本分享
+func (f *FileCode) IsText() bool {
+	return f.GetFilePath() == ""
+}
+
+// HasPassword 访问分享是否需要提交密码
+func (f *FileCode) HasPassword() bool {
+	return f.PasswordHash != "" || f.RequireAuth
+}
+
+// FileName 获取原始文件名（Prefix + Suffix）
+// 兼容旧数据：早期文件分享把原始文件名保存在 Text 字段中
+func (f *FileCode) FileName() string {
+	if f.IsText() || f.E2EE {
+		return ""
+	}
+	if name := f.Prefix + f.Suffix; name != "" {
+		return name
+	}
+	if f.Text != "" {
+		return f.Text
+	}
+	if f.UUIDFileName != "" {
+		return f.UUIDFileName
+	}
+	return filepath.Base(f.FilePath)
+}
+
 // FileCodeQuery 文件代码查询条件
 type FileCodeQuery struct {
 	gorm.Model
@@ -90,11 +134,12 @@ type FileCodeQuery struct {
 // FileCodeUpdate 文件代码更新数据
 type FileCodeUpdate struct {
 	gorm.Model
-	ExpiredAt    *time.Time `json:"expired_at"`
-	ExpiredCount *int       `json:"expired_count"`
-	UsedCount    *int       `json:"used_count"`
-	RequireAuth  *bool      `json:"require_auth"`
-	OwnerIP      *string    `json:"owner_ip"`
+	ExpiredAt     *time.Time `json:"expired_at"`
+	AvailableFrom *time.Time `gorm:"index" json:"available_from"` // 生效时间，为空表示立即生效
+	ExpiredCount  *int       `json:"expired_count"`
+	UsedCount     *int       `json:"used_count"`
+	RequireAuth   *bool      `json:"require_auth"`
+	OwnerIP       *string    `json:"owner_ip"`
 }
 
 // FileCodeStats 文件统计查询结果
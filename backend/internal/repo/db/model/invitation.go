@@ -0,0 +1,98 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 邀请码状态
+const (
+	InvitationStatusActive    = "active"
+	InvitationStatusExpired   = "expired"
+	InvitationStatusExhausted = "exhausted"
+	InvitationStatusRevoked   = "revoked"
+)
+
+// Invitation 注册邀请码，关闭开放注册时凭邀请码注册
+// 明文邀请码只在创建时返回，数据库仅保存 SHA-256 摘要，Prefix 便于在列表中辨认
+// MaxUses 为可注册的次数，UsedCount 达到 MaxUses 后失效；ExpiresAt 为空表示长期有效
+// Role、MaxUploadSize、MaxStorageQuota 写入注册用户，配额为 0 表示使用角色/系统默认，-1 表示不限制
+type Invitation struct {
+	gorm.Model
+	CreatedBy       uint       `gorm:"index" json:"created_by"`
+	CreatorName     string     `gorm:"size:50" json:"creator_name"`
+	Note            string     `gorm:"size:255" json:"note"`
+	Prefix          string     `gorm:"size:16" json:"prefix"`
+	CodeHash        string     `gorm:"size:64;uniqueIndex" json:"-"`
+	Role            string     `gorm:"size:20;default:'user'" json:"role"`
+	MaxUploadSize   int64      `gorm:"default:0" json:"max_upload_size"`
+	MaxStorageQuota int64      `gorm:"default:0" json:"max_storage_quota"`
+	MaxUses         int        `gorm:"default:1" json:"max_uses"`
+	UsedCount       int        `gorm:"default:0" json:"used_count"`
+	ExpiresAt       *time.Time `gorm:"index" json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+}
+
+// TableName 指定表名
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// Status 邀请码当前状态
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case i.ExpiresAt != nil && !now.Before(*i.ExpiresAt):
+		return InvitationStatusExpired
+	case i.UsedCount >= i.MaxUses:
+		return InvitationStatusExhausted
+	default:
+		return InvitationStatusActive
+	}
+}
+
+// InvitationResp 邀请码列表项，不包含明文邀请码
+type InvitationResp struct {
+	ID              uint       `json:"id"`
+	Prefix          string     `json:"prefix"`
+	Note            string     `json:"note"`
+	Role            string     `json:"role"`
+	MaxUploadSize   int64      `json:"max_upload_size"`
+	MaxStorageQuota int64      `json:"max_storage_quota"`
+	MaxUses         int        `json:"max_uses"`
+	UsedCount       int        `json:"used_count"`
+	Status          string     `json:"status"`
+	CreatedBy       uint       `json:"created_by"`
+	CreatorName     string     `json:"creator_name"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func (i *Invitation) ToResp() *InvitationResp {
+	return &InvitationResp{
+		ID:              i.ID,
+		Prefix:          i.Prefix,
+		Note:            i.Note,
+		Role:            i.Role,
+		MaxUploadSize:   i.MaxUploadSize,
+		MaxStorageQuota: i.MaxStorageQuota,
+		MaxUses:         i.MaxUses,
+		UsedCount:       i.UsedCount,
+		Status:          i.Status(time.Now()),
+		CreatedBy:       i.CreatedBy,
+		CreatorName:     i.CreatorName,
+		ExpiresAt:       i.ExpiresAt,
+		RevokedAt:       i.RevokedAt,
+		CreatedAt:       i.CreatedAt,
+	}
+}
+
+// InvitationQuery 邀请码查询条件，CreatedBy 为空时查询全部
+type InvitationQuery struct {
+	CreatedBy *uint
+	Page      int
+	PageSize  int
+}
@@ -2,11 +2,21 @@ package model
 
 import "gorm.io/gorm"
 
+// 传输日志操作类型
+const (
+	TransferOpUpload   = "upload"   // 上传
+	TransferOpDownload = "download" // 完整下载
+	TransferOpRange    = "range"    // 断点续传（Range 请求）
+	TransferOpText     = "text"     // 文本读取
+	TransferOpPreview  = "preview"  // 预览查看
+)
+
 // TransferLog 记录上传/下载操作日志
-// 当系统要求登录上传/下载时，用于追踪用户行为
-// Operation: upload 或 download
+// 每次文本读取、下载、断点续传和预览查看都会写入一条记录，用于分享访问统计
+// Operation: upload / download / range / text / preview
 // DurationMs: 针对下载记录耗时，上传默认为0
-// Username保留冗余信息，便于查询，即使用户被删除仍保留原始名字
+// BytesSent: 实际发送给客户端的字节数
+// Username保留冗余信息，便于查询；用户账号被删除时其记录会被匿名化（清空用户、IP 和 UA）
 type TransferLog struct {
 	gorm.Model
 	Operation  string `gorm:"size:20;index" json:"operation"`
@@ -17,7 +27,10 @@ type TransferLog struct {
 	UserID     *uint  `gorm:"index" json:"user_id"`
 	Username   string `gorm:"size:100" json:"username"`
 	IP         string `gorm:"size:45" json:"ip"`
+	UserAgent  string `gorm:"size:512" json:"user_agent"`
+	BytesSent  int64  `json:"bytes_sent"`
 	DurationMs int64  `json:"duration_ms"`
+	Success    bool   `json:"success"`
 }
 
 // TransferLogQuery 查询条件
@@ -28,3 +41,24 @@ type TransferLogQuery struct {
 	Page      int    `json:"page"`
 	PageSize  int    `json:"page_size"`
 }
+
+// ShareAccessStats 单个分享的访问统计
+type ShareAccessStats struct {
+	Code              string             `json:"code"`
+	TotalEvents       int64              `json:"total_events"`
+	Downloads         int64              `json:"downloads"`
+	RangeRequests     int64              `json:"range_requests"`
+	TextViews         int64              `json:"text_views"`
+	PreviewViews      int64              `json:"preview_views"`
+	Failed            int64              `json:"failed"`
+	BytesSent         int64              `json:"bytes_sent"`
+	UniqueDownloaders int64              `json:"unique_downloaders"`
+	Daily             []DailyAccessCount `json:"daily"`
+}
+
+// DailyAccessCount 按天聚合的访问次数
+type DailyAccessCount struct {
+	Date      string `json:"date"`
+	Events    int64  `json:"events"`
+	BytesSent int64  `json:"bytes_sent"`
+}
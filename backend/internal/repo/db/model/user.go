@@ -6,6 +6,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// UserStatusPendingDeletion 账号已申请删除，宽限期内停用，到期后清除全部数据
+const UserStatusPendingDeletion = "pending_deletion"
+
 type User struct {
 	gorm.Model
 	Username      string     `gorm:"uniqueIndex;size:50" json:"username"`
@@ -14,58 +17,75 @@ type User struct {
 	Nickname      string     `gorm:"size:50" json:"nickname"`                // 用户昵称
 	Avatar        string     `gorm:"size:255" json:"avatar"`                 // 头像URL
 	Role          string     `gorm:"size:20;default:'user'" json:"role"`     // admin, user
-	Status        string     `gorm:"size:20;default:'active'" json:"status"` // active, inactive, banned
+	Status        string     `gorm:"size:20;default:'active'" json:"status"` // active, inactive, banned, pending_deletion
 	EmailVerified bool       `gorm:"default:false" json:"email_verified"`    // 邮箱是否验证
 	LastLoginAt   *time.Time `json:"last_login_at"`                          // 最后登录时间
 	LastLoginIP   string     `gorm:"size:45" json:"last_login_ip"`           // 最后登录IP
 
+	// 两步验证（TOTP）
+	TOTPSecret   string `gorm:"size:64" json:"-"`                  // Base32 密钥，开启前为待确认的密钥
+	TOTPEnabled  bool   `gorm:"default:false" json:"totp_enabled"` // 是否已开启两步验证
+	TOTPLastStep int64  `gorm:"default:0" json:"-"`                // 最近一次使用的时间步，防止验证码重放
+
+	// 账号删除：宽限期结束后清除数据，期间可以撤销
+	DeletionRequestedAt  *time.Time `json:"deletion_requested_at"`              // 申请删除的时间
+	DeletionScheduledAt  *time.Time `gorm:"index" json:"deletion_scheduled_at"` // 清除数据的时间
+	DeletionTransferTo   *uint      `json:"-"`                                  // 分享转移给该用户，为空时删除分享
+	StatusBeforeDeletion string     `gorm:"size:20" json:"-"`                   // 撤销删除时恢复的状态
+
+	InvitationID *uint `gorm:"index" json:"-"` // 注册时使用的邀请码
+
 	// 用户上传统计
 	TotalUploads    int   `gorm:"default:0" json:"total_uploads"`     // 总上传次数
 	TotalDownloads  int   `gorm:"default:0" json:"total_downloads"`   // 总下载次数
 	TotalStorage    int64 `gorm:"default:0" json:"total_storage"`     // 总存储大小(字节)
-	MaxUploadSize   int64 `gorm:"default:0" json:"max_upload_size"`   // 最大单次上传大小(字节)，0表示使用系统默认
-	MaxStorageQuota int64 `gorm:"default:0" json:"max_storage_quota"` // 最大存储配额(字节)，0表示无限制
+	MaxUploadSize   int64 `gorm:"default:0" json:"max_upload_size"`   // 最大单次上传大小(字节)，0表示使用角色/系统默认，-1表示不限制
+	MaxStorageQuota int64 `gorm:"default:0" json:"max_storage_quota"` // 最大存储配额(字节)，0表示使用角色/系统默认，-1表示不限制
 }
 
 type UserResp struct {
-	ID              uint       `json:"id"`
-	Username        string     `json:"username"`
-	Email           string     `json:"email"`
-	Nickname        string     `json:"nickname"`
-	Avatar          string     `json:"avatar"`
-	Role            string     `json:"role"`
-	Status          string     `json:"status"`
-	EmailVerified   bool       `json:"email_verified"`
-	LastLoginAt     *time.Time `json:"last_login_at"`
-	LastLoginIP     string     `json:"last_login_ip"`
-	TotalUploads    int        `json:"total_uploads"`
-	TotalDownloads  int        `json:"total_downloads"`
-	TotalStorage    int64      `json:"total_storage"`
-	MaxUploadSize   int64      `json:"max_upload_size"`
-	MaxStorageQuota int64      `json:"max_storage_quota"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+	ID                  uint       `json:"id"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	Nickname            string     `json:"nickname"`
+	Avatar              string     `json:"avatar"`
+	Role                string     `json:"role"`
+	Status              string     `json:"status"`
+	EmailVerified       bool       `json:"email_verified"`
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	LastLoginAt         *time.Time `json:"last_login_at"`
+	LastLoginIP         string     `json:"last_login_ip"`
+	TotalUploads        int        `json:"total_uploads"`
+	TotalDownloads      int        `json:"total_downloads"`
+	TotalStorage        int64      `json:"total_storage"`
+	MaxUploadSize       int64      `json:"max_upload_size"`
+	MaxStorageQuota     int64      `json:"max_storage_quota"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 func (u *User) ToResp() *UserResp {
 	return &UserResp{
-		ID:              u.Model.ID,
-		Username:        u.Username,
-		Email:           u.Email,
-		Nickname:        u.Nickname,
-		Avatar:          u.Avatar,
-		Role:            u.Role,
-		Status:          u.Status,
-		EmailVerified:   u.EmailVerified,
-		LastLoginAt:     u.LastLoginAt,
-		LastLoginIP:     u.LastLoginIP,
-		TotalUploads:    u.TotalUploads,
-		TotalDownloads:  u.TotalDownloads,
-		TotalStorage:    u.TotalStorage,
-		MaxUploadSize:   u.MaxUploadSize,
-		MaxStorageQuota: u.MaxStorageQuota,
-		CreatedAt:       u.Model.CreatedAt,
-		UpdatedAt:       u.Model.UpdatedAt,
+		ID:                  u.Model.ID,
+		Username:            u.Username,
+		Email:               u.Email,
+		Nickname:            u.Nickname,
+		Avatar:              u.Avatar,
+		Role:                u.Role,
+		Status:              u.Status,
+		EmailVerified:       u.EmailVerified,
+		TOTPEnabled:         u.TOTPEnabled,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+		LastLoginAt:         u.LastLoginAt,
+		LastLoginIP:         u.LastLoginIP,
+		TotalUploads:        u.TotalUploads,
+		TotalDownloads:      u.TotalDownloads,
+		TotalStorage:        u.TotalStorage,
+		MaxUploadSize:       u.MaxUploadSize,
+		MaxStorageQuota:     u.MaxStorageQuota,
+		CreatedAt:           u.Model.CreatedAt,
+		UpdatedAt:           u.Model.UpdatedAt,
 	}
 }
 
@@ -87,5 +107,6 @@ type UserStats struct {
 	TotalUploads   int   `json:"total_uploads"`
 	TotalDownloads int   `json:"total_downloads"`
 	TotalStorage   int64 `json:"total_storage"`
+	PendingStorage int64 `json:"pending_storage"` // 未完成分片上传占用的空间
 	FileCount      int   `json:"file_count"`
 }
@@ -1,31 +1,112 @@
 package model
 
 import (
+	"net"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// APIKeyPrefix API Key 明文的固定前缀
+const APIKeyPrefix = "fcb_sk_"
+
+// API Key 的权限范围，密钥只能访问授予了对应范围的接口
+const (
+	APIKeyScopeShareCreate = "share:create" // 上传文件、分享文本
+	APIKeyScopeShareRead   = "share:read"   // 查看分享统计和版本
+	APIKeyScopeShareDelete = "share:delete" // 删除分享
+	APIKeyScopeFilesList   = "files:list"   // 列出自己的文件
+	APIKeyScopeAdmin       = "admin:*"      // 管理后台接口，仅管理员可以授予
+)
+
+// APIKeyScopes 全部可用的权限范围
+var APIKeyScopes = []string{
+	APIKeyScopeShareCreate,
+	APIKeyScopeShareRead,
+	APIKeyScopeShareDelete,
+	APIKeyScopeFilesList,
+	APIKeyScopeAdmin,
+}
+
 // UserAPIKey 表示用户生成的 API Key 元信息，真实密钥仅在创建时返回
 // KeyHash 存储经过 SHA-256 处理后的摘要，Prefix 便于调试时区分不同密钥
 // Revoked 标记密钥是否已被撤销
 // ExpiresAt 可选过期时间，为空表示长期有效
 // LastUsedAt 记录最近一次使用时间
 // Name 为用户自定义的标识，方便区分多把密钥
+// Scopes、AllowedIPs 以逗号分隔保存；AllowedIPs 为空表示不限制来源
+// RateLimitPerMinute 为该密钥每分钟的请求上限，0 表示只受全局限流约束
 
 type UserAPIKey struct {
 	gorm.Model
-	UserID     uint   `gorm:"index"`
-	Name       string `gorm:"size:100"`
-	Prefix     string `gorm:"size:16"`
-	KeyHash    string `gorm:"size:64;uniqueIndex"`
-	LastUsedAt *time.Time
-	ExpiresAt  *time.Time
-	RevokedAt  *time.Time
-	Revoked    bool `gorm:"default:false"`
+	UserID             uint   `gorm:"index"`
+	Name               string `gorm:"size:100"`
+	Prefix             string `gorm:"size:16"`
+	KeyHash            string `gorm:"size:64;uniqueIndex"`
+	Scopes             string `gorm:"size:255"`
+	AllowedIPs         string `gorm:"size:1024"`
+	RateLimitPerMinute int    `gorm:"default:0"`
+	UsageCount         int64  `gorm:"default:0"`
+	LastUsedAt         *time.Time
+	LastUsedIP         string `gorm:"size:64"`
+	ExpiresAt          *time.Time
+	RevokedAt          *time.Time
+	Revoked            bool `gorm:"default:false"`
 }
 
 // TableName 指定表名
 func (UserAPIKey) TableName() string {
 	return "user_api_keys"
 }
+
+// ScopeList 返回密钥的权限范围
+func (k *UserAPIKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+// HasScope 判断密钥是否授予了指定的权限范围
+func (k *UserAPIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedIPList 返回来源地址白名单（IP 或 CIDR）
+func (k *UserAPIKey) AllowedIPList() []string {
+	return splitList(k.AllowedIPs)
+}
+
+// IPAllowed 判断来源地址是否在白名单中，白名单为空时允许任意地址
+func (k *UserAPIKey) IPAllowed(ip string) bool {
+	allowed := k.AllowedIPList()
+	if len(allowed) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+			return true
+		}
+		if other := net.ParseIP(entry); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
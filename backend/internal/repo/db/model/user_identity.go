@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 本地用户与外部身份提供方账号的绑定关系
+// 同一提供方的 Subject 只能绑定一个本地用户，一个本地用户可以绑定多个提供方
+type UserIdentity struct {
+	gorm.Model
+	UserID      uint   `gorm:"index"`
+	Provider    string `gorm:"size:64;uniqueIndex:idx_identity_provider_subject"`
+	Subject     string `gorm:"size:255;uniqueIndex:idx_identity_provider_subject"` // ID Token 中的 sub，LDAP 为小写的用户名
+	Email       string `gorm:"size:100"`                                           // 最近一次登录时身份提供方返回的邮箱
+	LastLoginAt *time.Time
+	Disabled    bool `gorm:"default:false"` // 目录同步因账号在目录中被禁用而停用了本地用户，恢复后由同步任务重新启用
+}
+
+// TableName 指定表名
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
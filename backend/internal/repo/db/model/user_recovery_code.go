@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserRecoveryCode 两步验证恢复码，丢失验证器时代替验证码登录
+// 明文只在生成时展示一次，数据库仅保存 SHA-256 摘要；UsedAt 不为空表示已使用
+type UserRecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"size:64;index"`
+	UsedAt   *time.Time
+}
+
+// TableName 指定表名
+func (UserRecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSession 用户登录会话，每次登录创建一条记录
+// 访问令牌携带 SessionID，刷新令牌只保存 SHA-256 摘要并在每次刷新时轮换；
+// RevokedAt 不为空表示会话已被撤销，对应的访问令牌和刷新令牌立即失效
+type UserSession struct {
+	gorm.Model
+	UserID       uint   `gorm:"index"`
+	SessionID    string `gorm:"size:64;uniqueIndex"`
+	RefreshHash  string `gorm:"size:64"`
+	UserAgent    string `gorm:"size:255"`
+	IP           string `gorm:"size:45"`
+	LastUsedAt   time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+	RevokedAt    *time.Time
+	RevokeReason string `gorm:"size:32"`
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// Active 会话是否仍然有效
+func (s *UserSession) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
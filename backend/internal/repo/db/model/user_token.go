@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 一次性令牌的用途
+const (
+	TokenPurposeEmailVerify   = "email_verify"
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeOIDCLogin     = "oidc_login" // 单点登录回调后前端换取登录令牌用的一次性代码
+)
+
+// UserToken 一次性令牌（邮箱验证、重置密码、单点登录交换码）
+// 明文令牌只交给用户（邮件或回调地址），数据库仅保存 SHA-256 摘要；UsedAt 不为空表示已使用或已作废
+type UserToken struct {
+	gorm.Model
+	UserID    uint      `gorm:"index"`
+	Purpose   string    `gorm:"size:32;index"`
+	TokenHash string    `gorm:"size:64;uniqueIndex"`
+	Email     string    `gorm:"size:100"` // 签发时的邮箱，邮箱变更后旧的验证令牌失效
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+}
+
+// TableName 指定表名
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
@@ -23,6 +23,9 @@ func Init(cfg *conf.RedisConfig) error {
 	defer cancel()
 
 	if err := Client.Ping(ctx).Err(); err != nil {
+		// 连接失败时不保留客户端，调用方据此回退到内存实现
+		Client.Close()
+		Client = nil
 		return fmt.Errorf("failed to connect redis: %w", err)
 	}
 
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -43,8 +45,12 @@ type StorageInterface interface {
 	FileExists(ctx context.Context, filePath string) bool
 
 	// 分片操作
-	SaveChunk(ctx context.Context, uploadID string, chunkIndex int, data []byte) error
-	MergeChunks(ctx context.Context, uploadID string, totalChunks int, savePath string) error
+	// 分片到达时直接写入目标位置，完成时只做收尾，不再整体重写文件。
+	// 对象存储应映射为原生分片上传：InitChunks 对应创建分片上传，SaveChunk 对应上传分片
+	// （part number 为 chunkIndex+1），FinalizeChunks 对应完成上传，CleanChunks 对应中止上传。
+	InitChunks(ctx context.Context, uploadID string, totalSize int64) error
+	SaveChunk(ctx context.Context, uploadID string, chunkIndex int, offset int64, data []byte) error
+	FinalizeChunks(ctx context.Context, uploadID string, savePath string) error
 	CleanChunks(ctx context.Context, uploadID string) error
 
 	// 工具方法
@@ -109,8 +115,9 @@ func (s *StorageService) SaveFile(ctx context.Context, file *multipart.FileHeade
 	}
 	defer dst.Close()
 
-	// 复制文件内容
-	written, err := io.Copy(dst, src)
+	// 复制文件内容，同时计算 SHA-256 供秒传去重使用
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hasher), src)
 	if err != nil {
 		return nil, fmt.Errorf("保存文件失败: %w", err)
 	}
@@ -120,6 +127,7 @@ func (s *StorageService) SaveFile(ctx context.Context, file *multipart.FileHeade
 		Message:   "文件保存成功",
 		FilePath:  savePath,
 		FileSize:  written,
+		FileHash:  hex.EncodeToString(hasher.Sum(nil)),
 		Timestamp: startTime,
 	}, nil
 }
@@ -148,53 +156,73 @@ func (s *StorageService) FileExists(ctx context.Context, filePath string) bool {
 	return !os.IsNotExist(err)
 }
 
-// SaveChunk 保存分片
-func (s *StorageService) SaveChunk(ctx context.Context, uploadID string, chunkIndex int, data []byte) error {
-	chunkPath := filepath.Join(s.config.DataPath, "chunks", uploadID, fmt.Sprintf("chunk_%d", chunkIndex))
+// partFilePath 上传中的目标文件路径，分片按偏移直接写入该文件
+func (s *StorageService) partFilePath(uploadID string) string {
+	return filepath.Join(s.config.DataPath, "chunks", uploadID, "data.part")
+}
 
-	// 确保目录存在
-	dir := filepath.Dir(chunkPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// InitChunks 预分配上传中的目标文件
+func (s *StorageService) InitChunks(ctx context.Context, uploadID string, totalSize int64) error {
+	partPath := s.partFilePath(uploadID)
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
 		return err
 	}
 
-	return os.WriteFile(chunkPath, data, 0644)
-}
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-// MergeChunks 合并分片
-func (s *StorageService) MergeChunks(ctx context.Context, uploadID string, totalChunks int, savePath string) error {
-	fullPath := filepath.Join(s.config.DataPath, savePath)
+	// Truncate 在大多数文件系统上生成稀疏文件，不会真正写入 totalSize 字节
+	return f.Truncate(totalSize)
+}
 
-	// 确保目录存在
-	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// SaveChunk 将分片写入目标文件的 offset 处，分片可以乱序、并发到达
+func (s *StorageService) SaveChunk(ctx context.Context, uploadID string, chunkIndex int, offset int64, data []byte) error {
+	partPath := s.partFilePath(uploadID)
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
 		return err
 	}
 
-	// 创建目标文件
-	dst, err := os.Create(fullPath)
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
+	if _, err := f.WriteAt(data, offset); err != nil {
+		f.Close()
+		return fmt.Errorf("写入分片 %d 失败: %w", chunkIndex, err)
+	}
+	return f.Close()
+}
 
-	// 按顺序合并所有分片
-	for i := 0; i < totalChunks; i++ {
-		chunkPath := filepath.Join(s.config.DataPath, "chunks", uploadID, fmt.Sprintf("chunk_%d", i))
-		chunkData, err := os.ReadFile(chunkPath)
-		if err != nil {
-			return fmt.Errorf("读取分片 %d 失败: %w", i, err)
-		}
+// FinalizeChunks 将写满的目标文件落盘并移动到 savePath
+func (s *StorageService) FinalizeChunks(ctx context.Context, uploadID string, savePath string) error {
+	partPath := s.partFilePath(uploadID)
+	fullPath := filepath.Join(s.config.DataPath, savePath)
 
-		if _, err := dst.Write(chunkData); err != nil {
-			return fmt.Errorf("写入分片 %d 失败: %w", i, err)
-		}
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
 	}
 
-	// 清理临时分片
-	go s.CleanChunks(context.Background(), uploadID)
+	f, err := os.OpenFile(partPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("上传文件不存在: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
 
-	return nil
+	// 同一存储根目录下的 rename 不拷贝数据
+	if err := os.Rename(partPath, fullPath); err != nil {
+		return err
+	}
+	return s.CleanChunks(ctx, uploadID)
 }
 
 // CleanChunks 清理分片
@@ -4,23 +4,39 @@ import (
 	"context"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 )
 
-// AdminAuth 管理员 JWT 认证中间件
-// 验证 JWT token 并确保用户具有管理员角色
+// AdminAuth 管理员认证中间件
+// 接受管理员的登录令牌，或管理员创建的授予了 admin:* 范围的 API Key；用户降级后其 API Key 随之失去管理权限
 func AdminAuth() app.HandlerFunc {
 	return func(ctx context.Context, c *app.RequestContext) {
-		tokenString := extractBearerToken(c)
-		if tokenString == "" {
+		token, apiKey := extractCredentials(c)
+		switch {
+		case token != "":
+			if err := parseAndSetClaims(ctx, c, token); err != nil {
+				respondUnauthorized(c, "Invalid or expired token")
+				return
+			}
+		case apiKey != "":
+			key, user, failure := authenticateAPIKey(ctx, c, apiKey)
+			if failure != nil {
+				failure.respond(c)
+				return
+			}
+			if user.Role != UserRoleAdmin {
+				respondForbidden(c, "Admin access required")
+				return
+			}
+			if !checkScopes(c, key, []string{model.APIKeyScopeAdmin}) {
+				return
+			}
+			setAPIKeyIdentity(ctx, c, key, user)
+		default:
 			respondUnauthorized(c, "Authorization header is required")
 			return
 		}
 
-		if err := parseAndSetClaims(c, tokenString); err != nil {
-			respondUnauthorized(c, "Invalid or expired token")
-			return
-		}
-
 		// 检查管理员权限
 		if !IsAdmin(c) {
 			respondForbidden(c, "Admin access required")
@@ -51,7 +67,7 @@ func AdminOrSystemAdmin() app.HandlerFunc {
 	return AdminAuth()
 }
 
-// AdminOnly 仅允许管理员访问（不检查 JWT，从上下文获取角色）
+// AdminOnly 仅允许管理员访问（不做认证，从上下文获取角色）
 // 用于在已认证的基础上二次验证管理员权限
 func AdminOnly() app.HandlerFunc {
 	return func(ctx context.Context, c *app.RequestContext) {
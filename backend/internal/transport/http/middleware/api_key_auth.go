@@ -4,8 +4,11 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/dao"
@@ -19,6 +22,8 @@ const (
 	APIKeyQueryParamName = "api_key"
 	// APIKeyAuthHeaderPrefix Authorization 头中 API Key 的前缀
 	APIKeyAuthHeaderPrefix = "ApiKey"
+	// APIKeyPrefix API Key 明文的固定前缀，Authorization: Bearer 后跟该前缀时按 API Key 处理
+	APIKeyPrefix = model.APIKeyPrefix
 )
 
 var (
@@ -41,146 +46,111 @@ func GetAPIKeyRepository() *dao.UserAPIKeyRepository {
 	return apiKeyRepository
 }
 
-// APIKeyAuth API Key 认证中间件
-// 从 Header 或 Query 参数获取 API Key，验证后将用户信息注入上下文
-func APIKeyAuth() app.HandlerFunc {
-	return func(ctx context.Context, c *app.RequestContext) {
-		apiKey := extractAPIKey(c)
-		if apiKey == "" {
-			respondUnauthorized(c, "API Key is required")
-			return
-		}
-
-		repo := GetAPIKeyRepository()
-		if repo == nil {
-			respondUnauthorized(c, "API Key service not initialized")
-			return
-		}
-
-		// 计算 hash 并验证
-		hash := computeAPIKeyHash(apiKey)
-		key, err := repo.GetActiveByHash(ctx, hash)
-		if err != nil {
-			respondUnauthorized(c, "Invalid or expired API Key")
-			return
-		}
-
-		// 获取用户信息以设置角色
-		user, err := getUserByID(ctx, key.UserID)
-		if err != nil {
-			respondUnauthorized(c, "User not found")
-			return
-		}
-
-		// 更新最后使用时间
-		_ = repo.TouchLastUsed(ctx, key.ID)
-
-		// 将用户信息存入上下文
-		c.Set(ContextKeyUserID, user.ID)
-		c.Set(ContextKeyUsername, user.Username)
-		c.Set(ContextKeyUserRole, user.Role)
-		c.Set(ContextKeyAPIKeyID, key.ID)
-		c.Set(ContextKeyAuthType, "api_key")
+// apiKeyFailure API Key 校验失败时的响应
+type apiKeyFailure struct {
+	status     int
+	message    string
+	retryAfter time.Duration
+}
 
-		c.Next(ctx)
+func (f *apiKeyFailure) respond(c *app.RequestContext) {
+	switch f.status {
+	case http.StatusForbidden:
+		respondForbidden(c, f.message)
+	case http.StatusTooManyRequests:
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(f.retryAfter)))
+		c.Abort()
+		c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+			"code":    http.StatusTooManyRequests,
+			"message": f.message,
+		})
+	default:
+		respondUnauthorized(c, f.message)
 	}
 }
 
-// OptionalAPIKeyAuth 可选 API Key 认证中间件
-// 不强制要求 API Key，但如果提供了有效的 key 则解析用户信息
-func OptionalAPIKeyAuth() app.HandlerFunc {
-	return func(ctx context.Context, c *app.RequestContext) {
-		apiKey := extractAPIKey(c)
-		if apiKey == "" {
-			// 没有提供 API Key，继续执行（匿名用户）
-			c.Next(ctx)
-			return
-		}
-
-		repo := GetAPIKeyRepository()
-		if repo == nil {
-			c.Next(ctx)
-			return
-		}
-
-		// 尝试验证 API Key
-		hash := computeAPIKeyHash(apiKey)
-		key, err := repo.GetActiveByHash(ctx, hash)
-		if err != nil {
-			// API Key 无效，继续执行（匿名用户）
-			c.Next(ctx)
-			return
-		}
-
-		// 获取用户信息
-		user, err := getUserByID(ctx, key.UserID)
-		if err != nil {
-			c.Next(ctx)
-			return
-		}
-
-		// 更新最后使用时间
-		_ = repo.TouchLastUsed(ctx, key.ID)
+// authenticateAPIKey 校验密钥本身（未撤销、未过期）、来源地址白名单、所属用户状态和该密钥的限流
+func authenticateAPIKey(ctx context.Context, c *app.RequestContext, apiKey string) (*model.UserAPIKey, *model.User, *apiKeyFailure) {
+	repo := GetAPIKeyRepository()
+	if repo == nil {
+		return nil, nil, &apiKeyFailure{status: http.StatusUnauthorized, message: "API Key service not initialized"}
+	}
 
-		// 将用户信息存入上下文
-		c.Set(ContextKeyUserID, user.ID)
-		c.Set(ContextKeyUsername, user.Username)
-		c.Set(ContextKeyUserRole, user.Role)
-		c.Set(ContextKeyAPIKeyID, key.ID)
-		c.Set(ContextKeyAuthType, "api_key")
+	// 计算 hash 并验证
+	hash := computeAPIKeyHash(apiKey)
+	key, err := repo.GetActiveByHash(ctx, hash)
+	if err != nil {
+		return nil, nil, &apiKeyFailure{status: http.StatusUnauthorized, message: "Invalid or expired API Key"}
+	}
 
-		c.Next(ctx)
+	if !key.IPAllowed(c.ClientIP()) {
+		return nil, nil, &apiKeyFailure{status: http.StatusForbidden, message: "API Key is not allowed from this IP address"}
 	}
-}
 
-// APIKeyAuthWithAdmin API Key 认证 + 管理员权限检查
-func APIKeyAuthWithAdmin() app.HandlerFunc {
-	return func(ctx context.Context, c *app.RequestContext) {
-		apiKey := extractAPIKey(c)
-		if apiKey == "" {
-			respondUnauthorized(c, "API Key is required")
-			return
-		}
+	// 获取用户信息以设置角色
+	user, err := getUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, &apiKeyFailure{status: http.StatusUnauthorized, message: "User not found"}
+	}
+	if user.Status != "active" {
+		return nil, nil, &apiKeyFailure{status: http.StatusForbidden, message: "User account is disabled"}
+	}
 
-		repo := GetAPIKeyRepository()
-		if repo == nil {
-			respondUnauthorized(c, "API Key service not initialized")
-			return
+	if limiter := apiKeyLimiter(key); limiter != nil {
+		if result := limiter.Take(ctx, c); !result.Allowed {
+			return nil, nil, &apiKeyFailure{
+				status:     http.StatusTooManyRequests,
+				message:    "API Key rate limit exceeded, please try again later",
+				retryAfter: result.RetryAfter,
+			}
 		}
+	}
 
-		// 计算 hash 并验证
-		hash := computeAPIKeyHash(apiKey)
-		key, err := repo.GetActiveByHash(ctx, hash)
-		if err != nil {
-			respondUnauthorized(c, "Invalid or expired API Key")
-			return
-		}
+	return key, user, nil
+}
 
-		// 获取用户信息
-		user, err := getUserByID(ctx, key.UserID)
-		if err != nil {
-			respondUnauthorized(c, "User not found")
-			return
-		}
+// apiKeyLimiter 按密钥计数的限流器，每分钟 RateLimitPerMinute 次，允许一分钟的额度一次用完
+// 密钥未设置限额时返回 nil
+func apiKeyLimiter(key *model.UserAPIKey) *RateLimiter {
+	if key.RateLimitPerMinute <= 0 {
+		return nil
+	}
+	id := "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	limiter, err := NewRateLimiter(&RateLimiterConfig{
+		Name:              "api_key",
+		RequestsPerSecond: float64(key.RateLimitPerMinute) / 60,
+		BurstSize:         key.RateLimitPerMinute,
+		KeyGenerator: func(ctx context.Context, c *app.RequestContext) string {
+			return id
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	return limiter
+}
 
-		// 检查管理员权限
-		if user.Role != UserRoleAdmin {
-			respondForbidden(c, "Admin access required")
-			return
+// missingScope 返回密钥缺少的第一个权限范围，全部满足时返回空字符串
+func missingScope(key *model.UserAPIKey, scopes []string) string {
+	for _, scope := range scopes {
+		if !key.HasScope(scope) {
+			return scope
 		}
-
-		// 更新最后使用时间
-		_ = repo.TouchLastUsed(ctx, key.ID)
-
-		// 将用户信息存入上下文
-		c.Set(ContextKeyUserID, user.ID)
-		c.Set(ContextKeyUsername, user.Username)
-		c.Set(ContextKeyUserRole, user.Role)
-		c.Set(ContextKeyAPIKeyID, key.ID)
-		c.Set(ContextKeyAuthType, "api_key")
-
-		c.Next(ctx)
 	}
+	return ""
+}
+
+// setAPIKeyIdentity 记录密钥的使用情况，并将用户信息存入上下文
+func setAPIKeyIdentity(ctx context.Context, c *app.RequestContext, key *model.UserAPIKey, user *model.User) {
+	// 更新使用次数和最后使用时间
+	_ = GetAPIKeyRepository().RecordUsage(ctx, key.ID, c.ClientIP())
+
+	c.Set(ContextKeyUserID, user.ID)
+	c.Set(ContextKeyUsername, user.Username)
+	c.Set(ContextKeyUserRole, user.Role)
+	c.Set(ContextKeyAPIKeyID, key.ID)
+	c.Set(ContextKeyAPIKeyScopes, key.ScopeList())
+	c.Set(ContextKeyAuthType, AuthTypeAPIKey)
 }
 
 // extractAPIKey 从请求中提取 API Key
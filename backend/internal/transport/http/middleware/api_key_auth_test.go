@@ -0,0 +1,58 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/zy84338719/fileCodeBox/backend/internal/app/user"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/testenv"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
+)
+
+func TestAPIKeyAllowListUsesTrustedClientIP(t *testing.T) {
+	cfg := testenv.Setup(t)
+	ctx := context.Background()
+
+	owner := &model.User{Username: "ci", Email: "ci@example.com", Role: "user", Status: "active"}
+	if err := db.GetDB().Create(owner).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	created, err := user.NewService().CreateAPIKey(ctx, owner.ID, &user.CreateAPIKeyReq{
+		Name:       "ci",
+		Scopes:     []string{model.APIKeyScopeFilesList},
+		AllowedIPs: []string{"198.51.100.7"},
+	})
+	if err != nil {
+		t.Fatalf("创建 API Key 失败: %v", err)
+	}
+
+	get := func(base, forwardedFor string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+"/user/files", nil)
+		req.Header.Set("X-API-Key", created.Key)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// 直连地址不是受信任代理时，伪造 X-Forwarded-For 不能通过白名单
+	if status := get(testenv.StartServer(t), "198.51.100.7"); status != http.StatusForbidden {
+		t.Fatalf("伪造来源地址返回 %d", status)
+	}
+
+	// 经过受信任代理转发时按转发的客户端地址校验
+	cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+	base := testenv.StartServer(t)
+	if status := get(base, "198.51.100.7"); status != http.StatusOK {
+		t.Fatalf("白名单内的地址返回 %d", status)
+	}
+	if status := get(base, "203.0.113.9"); status != http.StatusForbidden {
+		t.Fatalf("白名单外的地址返回 %d", status)
+	}
+}
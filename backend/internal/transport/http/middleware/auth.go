@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/auth"
-	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/errors"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/db/model"
 )
 
 const (
@@ -15,15 +17,105 @@ const (
 	ContextKeyUsername = "username"
 	// ContextKeyUserRole 用户角色上下文键
 	ContextKeyUserRole = "role"
+	// ContextKeySessionID 会话ID上下文键
+	ContextKeySessionID = "session_id"
 	// ContextKeyAPIKeyID API Key ID上下文键
 	ContextKeyAPIKeyID = "api_key_id"
+	// ContextKeyAPIKeyScopes API Key 权限范围上下文键
+	ContextKeyAPIKeyScopes = "api_key_scopes"
 	// ContextKeyAuthType 认证类型上下文键 (jwt/api_key)
 	ContextKeyAuthType = "auth_type"
 )
 
+// 认证方式，写入上下文的 ContextKeyAuthType
+const (
+	AuthTypeJWT    = "jwt"
+	AuthTypeAPIKey = "api_key"
+)
+
+// UserAuth 认证中间件，依次识别登录令牌（Bearer JWT）和 API Key（Bearer fcb_sk_…、ApiKey 授权头、X-API-Key 头或 api_key 查询参数），
+// 并将用户 ID、用户名、角色、认证方式以及会话 ID 或密钥 ID 写入上下文
+// API Key 必须授予 scopes 中的全部权限范围；scopes 为空的接口只接受登录令牌
+func UserAuth(scopes ...string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		token, apiKey := extractCredentials(c)
+		switch {
+		case token != "":
+			if err := parseAndSetClaims(ctx, c, token); err != nil {
+				respondUnauthorized(c, "Invalid or expired token")
+				return
+			}
+		case apiKey != "":
+			if !authorizeAPIKey(ctx, c, apiKey, scopes) {
+				return
+			}
+		default:
+			respondUnauthorized(c, "Authorization header is required")
+			return
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// OptionalUserAuth 可选认证中间件，不强制要求登录
+// 令牌或 API Key 无效时按匿名用户处理；API Key 有效但来源地址、限流或权限范围不满足时直接拒绝，
+// 避免调用方误以为请求以自己的身份执行
+func OptionalUserAuth(scopes ...string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		token, apiKey := extractCredentials(c)
+		switch {
+		case token != "":
+			// 解析失败时继续执行（匿名用户）
+			_ = parseAndSetClaims(ctx, c, token)
+		case apiKey != "":
+			key, user, failure := authenticateAPIKey(ctx, c, apiKey)
+			if failure != nil && failure.status != http.StatusUnauthorized {
+				failure.respond(c)
+				return
+			}
+			if failure == nil {
+				if !checkScopes(c, key, scopes) {
+					return
+				}
+				setAPIKeyIdentity(ctx, c, key, user)
+			}
+		}
+
+		c.Next(ctx)
+	}
+}
+
+// authorizeAPIKey 校验 API Key 及其权限范围，成功时写入上下文，失败时已写入响应
+func authorizeAPIKey(ctx context.Context, c *app.RequestContext, apiKey string, scopes []string) bool {
+	key, user, failure := authenticateAPIKey(ctx, c, apiKey)
+	if failure != nil {
+		failure.respond(c)
+		return false
+	}
+	if !checkScopes(c, key, scopes) {
+		return false
+	}
+	setAPIKeyIdentity(ctx, c, key, user)
+	return true
+}
+
+// checkScopes 检查 API Key 是否授予了接口要求的权限范围，不满足时返回 403
+func checkScopes(c *app.RequestContext, key *model.UserAPIKey, scopes []string) bool {
+	if len(scopes) == 0 {
+		respondForbidden(c, "API Key is not allowed for this endpoint")
+		return false
+	}
+	if missing := missingScope(key, scopes); missing != "" {
+		respondForbidden(c, "API Key is missing required scope: "+missing)
+		return false
+	}
+	return true
+}
+
 // parseAndSetClaims 解析JWT并将用户信息存入上下文
-func parseAndSetClaims(c *app.RequestContext, tokenString string) error {
-	claims, err := auth.ParseToken(tokenString)
+func parseAndSetClaims(ctx context.Context, c *app.RequestContext, tokenString string) error {
+	claims, err := auth.ValidateToken(ctx, tokenString)
 	if err != nil {
 		return err
 	}
@@ -31,44 +123,39 @@ func parseAndSetClaims(c *app.RequestContext, tokenString string) error {
 	c.Set(ContextKeyUserID, claims.UserID)
 	c.Set(ContextKeyUsername, claims.Username)
 	c.Set(ContextKeyUserRole, claims.Role)
-	c.Set(ContextKeyAuthType, "jwt")
+	c.Set(ContextKeySessionID, claims.SessionID)
+	c.Set(ContextKeyAuthType, AuthTypeJWT)
 
 	return nil
 }
 
-// extractBearerToken 从Authorization头提取Bearer token
-func extractBearerToken(c *app.RequestContext) string {
-	authHeader := string(c.GetHeader("Authorization"))
-	if authHeader == "" {
-		return ""
-	}
-	parts := splitToken(authHeader)
-	if len(parts) == 2 && parts[0] == "Bearer" {
-		return parts[1]
+// extractCredentials 从请求中提取登录令牌或 API Key，二者只返回一个
+// Bearer 后跟 fcb_sk_ 前缀的值按 API Key 处理，其余 Bearer 值按 JWT 处理
+func extractCredentials(c *app.RequestContext) (token, apiKey string) {
+	scheme, value, _ := strings.Cut(strings.TrimSpace(string(c.GetHeader("Authorization"))), " ")
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(scheme, "Bearer") && value != "" {
+		if strings.HasPrefix(value, APIKeyPrefix) {
+			return "", value
+		}
+		return value, ""
 	}
-	return ""
+	return "", extractAPIKey(c)
 }
 
-// splitToken 分割token字符串
-func splitToken(authHeader string) []string {
-	result := make([]string, 0, 2)
-	current := make([]rune, 0, len(authHeader))
-
-	for _, ch := range authHeader {
-		if ch == ' ' {
-			if len(current) > 0 {
-				result = append(result, string(current))
-				current = current[:0]
-			}
-		} else {
-			current = append(current, ch)
-		}
+// SkipPaths 对指定路径跳过 handler，用于同一路由组中不需要认证的接口（如登录）
+func SkipPaths(handler app.HandlerFunc, paths ...string) app.HandlerFunc {
+	skip := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		skip[path] = true
 	}
-	if len(current) > 0 {
-		result = append(result, string(current))
+	return func(ctx context.Context, c *app.RequestContext) {
+		if skip[string(c.URI().Path())] {
+			c.Next(ctx)
+			return
+		}
+		handler(ctx, c)
 	}
-
-	return result
 }
 
 // GetUserID 从上下文获取用户ID
@@ -111,6 +198,22 @@ func GetAPIKeyID(c *app.RequestContext) uint {
 	return 0
 }
 
+// HasScope 检查当前请求是否具备指定的权限范围
+// JWT 登录的用户拥有其角色的全部权限，API Key 只拥有创建时授予的范围
+func HasScope(c *app.RequestContext, scope string) bool {
+	if GetAuthType(c) != AuthTypeAPIKey {
+		return true
+	}
+	scopes, _ := c.Get(ContextKeyAPIKeyScopes)
+	list, _ := scopes.([]string)
+	for _, s := range list {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAuthType 从上下文获取认证类型
 func GetAuthType(c *app.RequestContext) string {
 	if authType, exists := c.Get(ContextKeyAuthType); exists {
@@ -135,7 +238,7 @@ func IsAdmin(c *app.RequestContext) bool {
 func respondUnauthorized(c *app.RequestContext, message string) {
 	c.Abort()
 	c.JSON(http.StatusUnauthorized, map[string]interface{}{
-		"code":    errors.CodeUnauthorized,
+		"code":    http.StatusUnauthorized,
 		"message": message,
 	})
 }
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// NewClientIPFunc 按受信任代理列表解析客户端地址，供 engine.SetClientIPFunc 使用
+// 只有直连地址属于受信任代理时才采用 X-Forwarded-For / X-Real-IP，并跳过链路中受信任的代理；
+// 列表为空时始终使用直连地址。Hertz 默认信任任意来源的转发头，客户端可以伪造地址绕过按 IP 的限制
+func NewClientIPFunc(trustedProxies []string) (app.ClientIP, error) {
+	cidrs := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			cidrs = append(cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		cidrs = append(cidrs, network)
+	}
+
+	return app.ClientIPWithOption(app.ClientIPOptions{
+		RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		TrustedCIDRs:    cidrs,
+	}), nil
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/mock"
+)
+
+// peerConn 指定直连地址的连接
+type peerConn struct {
+	*mock.Conn
+	addr net.Addr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr { return c.addr }
+
+func requestFrom(peer string, headers map[string]string) *app.RequestContext {
+	c := app.NewContext(0)
+	c.SetConn(&peerConn{Conn: mock.NewConn(""), addr: &net.TCPAddr{IP: net.ParseIP(peer), Port: 40000}})
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	return c
+}
+
+func TestClientIPIgnoresHeadersFromUntrustedPeers(t *testing.T) {
+	clientIP, err := NewClientIPFunc(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未配置受信任代理时，伪造的转发头不能改变客户端地址
+	c := requestFrom("203.0.113.5", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"})
+	if ip := clientIP(c); ip != "203.0.113.5" {
+		t.Fatalf("客户端地址为 %s", ip)
+	}
+}
+
+func TestClientIPThroughTrustedProxies(t *testing.T) {
+	clientIP, err := NewClientIPFunc([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"受信任代理转发", "10.1.2.3", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"单个 IP 的代理", "192.0.2.1", map[string]string{"X-Real-IP": "198.51.100.8"}, "198.51.100.8"},
+		// 客户端自带的 X-Forwarded-For 排在最前，只取最后一个不受信任的地址
+		{"跳过链路中的代理", "10.1.2.3", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.9, 10.0.0.9"}, "198.51.100.9"},
+		{"不受信任的直连地址", "203.0.113.5", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "203.0.113.5"},
+		{"代理未转发地址", "10.1.2.3", nil, "10.1.2.3"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if ip := clientIP(requestFrom(tc.peer, tc.headers)); ip != tc.want {
+				t.Fatalf("客户端地址为 %s，应为 %s", ip, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewClientIPFuncRejectsInvalidProxies(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := NewClientIPFunc([]string{entry}); err == nil {
+			t.Errorf("%q 未返回错误", entry)
+		}
+	}
+}
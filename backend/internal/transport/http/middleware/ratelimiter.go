@@ -2,105 +2,125 @@ package middleware
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zy84338719/fileCodeBox/backend/internal/conf"
+	"github.com/zy84338719/fileCodeBox/backend/internal/pkg/logger"
+	"github.com/zy84338719/fileCodeBox/backend/internal/repo/redis"
+	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
 // RateLimiterConfig 限流器配置
 type RateLimiterConfig struct {
+	// Name 策略名称，作为限流键的命名空间，不同策略的计数互不影响
+	Name string
 	// RequestsPerSecond 每秒允许的请求数
 	RequestsPerSecond float64
 	// BurstSize 突发流量大小
 	BurstSize int
 	// KeyGenerator 用于生成限流键的函数
 	KeyGenerator func(ctx context.Context, c *app.RequestContext) string
-	// Expiration 限流记录的过期时间
-	Expiration time.Duration
 }
 
-// RateLimiter 限流器
-type RateLimiter struct {
-	limiterMap sync.Map // map[string]*rateLimiterEntry
-	config     *RateLimiterConfig
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // 桶容量（突发流量大小）
+	Remaining  int           // 本次请求后剩余的可用请求数
+	Reset      time.Duration // 桶完全恢复所需的时间
+	RetryAfter time.Duration // 被拒绝时，距离下一个请求可被放行的时间
 }
 
-type rateLimiterEntry struct {
-	limiter    *rate.Limiter
-	lastAccess time.Time
+// RateLimiter 基于 GCRA 的限流器
+// 已连接 Redis 时状态保存在 Redis 中，多实例共享同一份限额；否则保存在进程内存中
+type RateLimiter struct {
+	config   *RateLimiterConfig
+	interval time.Duration // 每个请求占用的时间（1 / RequestsPerSecond）
 }
 
-// NewRateLimiter 创建新的限流器
-func NewRateLimiter(config *RateLimiterConfig) *RateLimiter {
+// NewRateLimiter 创建新的限流器，RequestsPerSecond 必须是有限的正数
+func NewRateLimiter(config *RateLimiterConfig) (*RateLimiter, error) {
 	if config == nil {
 		config = &RateLimiterConfig{
 			RequestsPerSecond: 10,
 			BurstSize:         20,
 			KeyGenerator:      IPKeyGenerator,
-			Expiration:        time.Hour,
 		}
 	}
+	if !(config.RequestsPerSecond > 0) || math.IsInf(config.RequestsPerSecond, 1) {
+		return nil, fmt.Errorf("限流器 %q 的 RequestsPerSecond 必须是有限的正数: %v", config.Name, config.RequestsPerSecond)
+	}
 
 	// 设置默认的键生成器
 	if config.KeyGenerator == nil {
 		config.KeyGenerator = IPKeyGenerator
 	}
-
-	// 设置默认的过期时间
-	if config.Expiration == 0 {
-		config.Expiration = time.Hour
+	if config.BurstSize <= 0 {
+		config.BurstSize = 1
+	}
+	// 未命名的限流器各自独立计数
+	if config.Name == "" {
+		config.Name = "limiter-" + strconv.FormatInt(unnamedLimiters.Add(1), 10)
 	}
 
 	return &RateLimiter{
-		config: config,
-	}
+		config:   config,
+		interval: time.Duration(float64(time.Second) / config.RequestsPerSecond),
+	}, nil
 }
 
-// Allow 检查是否允许请求
-func (rl *RateLimiter) Allow(ctx context.Context, c *app.RequestContext) bool {
-	key := rl.config.KeyGenerator(ctx, c)
-	limiter, exists := rl.limiterMap.Load(key)
-
-	if !exists {
-		// 创建新的限流器
-		newLimiter := &rateLimiterEntry{
-			limiter:    rate.NewLimiter(rate.Limit(rl.config.RequestsPerSecond), rl.config.BurstSize),
-			lastAccess: time.Now(),
+// Take 为当前请求消耗一个配额
+// Redis 出错时回退到内存限流，避免 Redis 故障导致所有请求被拒绝
+func (rl *RateLimiter) Take(ctx context.Context, c *app.RequestContext) RateLimitResult {
+	key := "fcb:ratelimit:" + rl.config.Name + ":" + rl.config.KeyGenerator(ctx, c)
+	burst := rl.config.BurstSize
+
+	if client := redis.GetClient(); client != nil {
+		result, err := takeRedis(ctx, client, key, rl.interval, burst)
+		if err == nil {
+			return result
 		}
-		rl.limiterMap.Store(key, newLimiter)
-		limiter = newLimiter
+		logger.Warn("Redis 限流失败，回退到内存限流", zap.String("key", key), zap.Error(err))
 	}
+	return defaultMemoryLimiter.take(key, rl.interval, burst)
+}
 
-	entry := limiter.(*rateLimiterEntry)
-	entry.lastAccess = time.Now()
-
-	return entry.limiter.Allow()
+// Allow 检查是否允许请求
+func (rl *RateLimiter) Allow(ctx context.Context, c *app.RequestContext) bool {
+	return rl.Take(ctx, c).Allowed
 }
 
-// Cleanup 清理过期的限流记录
+// Cleanup 立即清理内存中已恢复满额的限流记录，平时在访问时每分钟清理一次
 func (rl *RateLimiter) Cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	go func() {
-		for range ticker.C {
-			now := time.Now()
-			rl.limiterMap.Range(func(key, value interface{}) bool {
-				entry := value.(*rateLimiterEntry)
-				if now.Sub(entry.lastAccess) > rl.config.Expiration {
-					rl.limiterMap.Delete(key)
-				}
-				return true
-			})
-		}
-	}()
+	defaultMemoryLimiter.mu.Lock()
+	defer defaultMemoryLimiter.mu.Unlock()
+	defaultMemoryLimiter.sweep(time.Now())
 }
 
-// Middleware 返回限流中间件
+// Middleware 返回限流中间件，响应中带有 RateLimit-* 头，被拒绝时带有 Retry-After
 func (rl *RateLimiter) Middleware() app.HandlerFunc {
+	window := int(math.Ceil(float64(rl.config.BurstSize) * rl.interval.Seconds()))
+	policy := strconv.Itoa(rl.config.BurstSize) + ";w=" + strconv.Itoa(window)
+
 	return func(ctx context.Context, c *app.RequestContext) {
-		if !rl.Allow(ctx, c) {
+		result := rl.Take(ctx, c)
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
 			c.Abort()
 			c.JSON(http.StatusTooManyRequests, map[string]interface{}{
 				"code":    http.StatusTooManyRequests,
@@ -113,6 +133,94 @@ func (rl *RateLimiter) Middleware() app.HandlerFunc {
 	}
 }
 
+// gcraScript 在 Redis 中执行 GCRA，使用 Redis 服务器时间，避免各实例时钟不一致
+// 保存的值为理论到达时间（TAT，微秒），返回 {是否放行, 剩余次数, 重试等待微秒, 恢复满额微秒}
+var gcraScript = goredis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+  tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - interval * burst
+if now < allow_at then
+  return {0, 0, allow_at - now, tat - now}
+end
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((now - allow_at) / interval), 0, new_tat - now}
+`)
+
+func takeRedis(ctx context.Context, client *goredis.Client, key string, interval time.Duration, burst int) (RateLimitResult, error) {
+	values, err := gcraScript.Run(ctx, client, []string{key}, interval.Microseconds(), burst).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      burst,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		Reset:      time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+// memoryLimiter 进程内的 GCRA 状态，所有策略共享，键中带有策略名称
+type memoryLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+var (
+	defaultMemoryLimiter = &memoryLimiter{tats: make(map[string]time.Time), lastSweep: time.Now()}
+	unnamedLimiters      atomic.Int64
+)
+
+func (m *memoryLimiter) take(key string, interval time.Duration, burst int) RateLimitResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= time.Minute {
+		m.sweep(now)
+	}
+
+	tat := m.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-interval * time.Duration(burst))
+	if now.Before(allowAt) {
+		return RateLimitResult{Limit: burst, RetryAfter: allowAt.Sub(now), Reset: tat.Sub(now)}
+	}
+
+	m.tats[key] = newTat
+	return RateLimitResult{
+		Allowed:   true,
+		Limit:     burst,
+		Remaining: int(now.Sub(allowAt) / interval),
+		Reset:     newTat.Sub(now),
+	}
+}
+
+// sweep 删除已恢复满额的记录，调用方需持有锁
+func (m *memoryLimiter) sweep(now time.Time) {
+	m.lastSweep = now
+	for key, tat := range m.tats {
+		if !tat.After(now) {
+			delete(m.tats, key)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
 // IPKeyGenerator 基于 IP 地址生成限流键
 func IPKeyGenerator(ctx context.Context, c *app.RequestContext) string {
 	return c.ClientIP()
@@ -122,7 +230,7 @@ func IPKeyGenerator(ctx context.Context, c *app.RequestContext) string {
 // 如果用户未认证，则使用 IP
 func UserKeyGenerator(ctx context.Context, c *app.RequestContext) string {
 	if userID := GetUserID(c); userID > 0 {
-		return "user:" + string(rune(userID))
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
 	}
 	return "ip:" + c.ClientIP()
 }
@@ -133,7 +241,35 @@ func PathKeyGenerator(ctx context.Context, c *app.RequestContext) string {
 	return c.ClientIP() + ":" + path
 }
 
-// GlobalRateLimit 全局限流中间件（基于 IP）
+// RouteRateLimit 按配置文件中 rate_limit.policies.<group> 的策略限流
+// 未启用限流或未配置该路由组时不做限制；按用户限流时需挂载在认证中间件之后
+func RouteRateLimit(group string) app.HandlerFunc {
+	cfg := conf.GetGlobalConfig()
+	if cfg == nil || !cfg.RateLimit.Enabled {
+		return passThrough
+	}
+	policy, ok := cfg.RateLimit.Policies[group]
+	if !ok || policy.RequestsPerSecond <= 0 {
+		return passThrough
+	}
+
+	keyGenerator := IPKeyGenerator
+	if policy.Key == "user" {
+		keyGenerator = UserKeyGenerator
+	}
+	return ConfigurableRateLimit(&RateLimiterConfig{
+		Name:              group,
+		RequestsPerSecond: policy.RequestsPerSecond,
+		BurstSize:         policy.Burst,
+		KeyGenerator:      keyGenerator,
+	})
+}
+
+func passThrough(ctx context.Context, c *app.RequestContext) {
+	c.Next(ctx)
+}
+
+// GlobalRateLimit 全局限流中间件（所有请求共享一个令牌桶，仅限当前实例）
 func GlobalRateLimit(requestsPerSecond float64, burstSize int) app.HandlerFunc {
 	limiter := rate.NewLimiter(rate.Limit(requestsPerSecond), burstSize)
 
@@ -151,70 +287,61 @@ func GlobalRateLimit(requestsPerSecond float64, burstSize int) app.HandlerFunc {
 	}
 }
 
-// PerIPRateLimit 基于 IP 的限流中间件
-func PerIPRateLimit(requestsPerSecond float64, burstSize int) app.HandlerFunc {
-	config := &RateLimiterConfig{
+// PerIPRateLimit 基于 IP 的限流中间件，name 为策略名称，不同名称的计数互不影响
+func PerIPRateLimit(name string, requestsPerSecond float64, burstSize int) app.HandlerFunc {
+	return ConfigurableRateLimit(&RateLimiterConfig{
+		Name:              name,
 		RequestsPerSecond: requestsPerSecond,
 		BurstSize:         burstSize,
 		KeyGenerator:      IPKeyGenerator,
-		Expiration:        time.Hour,
-	}
-	limiter := NewRateLimiter(config)
-	limiter.Cleanup()
-
-	return limiter.Middleware()
+	})
 }
 
-// PerUserRateLimit 基于用户的限流中间件
-func PerUserRateLimit(requestsPerSecond float64, burstSize int) app.HandlerFunc {
-	config := &RateLimiterConfig{
+// PerUserRateLimit 基于用户的限流中间件，name 为策略名称，不同名称的计数互不影响
+func PerUserRateLimit(name string, requestsPerSecond float64, burstSize int) app.HandlerFunc {
+	return ConfigurableRateLimit(&RateLimiterConfig{
+		Name:              name,
 		RequestsPerSecond: requestsPerSecond,
 		BurstSize:         burstSize,
 		KeyGenerator:      UserKeyGenerator,
-		Expiration:        time.Hour,
-	}
-	limiter := NewRateLimiter(config)
-	limiter.Cleanup()
-
-	return limiter.Middleware()
+	})
 }
 
-// PerPathRateLimit 基于路径的限流中间件
-func PerPathRateLimit(requestsPerSecond float64, burstSize int) app.HandlerFunc {
-	config := &RateLimiterConfig{
+// PerPathRateLimit 基于路径的限流中间件，name 为策略名称，不同名称的计数互不影响
+func PerPathRateLimit(name string, requestsPerSecond float64, burstSize int) app.HandlerFunc {
+	return ConfigurableRateLimit(&RateLimiterConfig{
+		Name:              name,
 		RequestsPerSecond: requestsPerSecond,
 		BurstSize:         burstSize,
 		KeyGenerator:      PathKeyGenerator,
-		Expiration:        time.Hour,
-	}
-	limiter := NewRateLimiter(config)
-	limiter.Cleanup()
-
-	return limiter.Middleware()
+	})
 }
 
 // ConfigurableRateLimit 可配置的限流中间件
+// 配置无效时记录错误日志并不做限制，与配置文件中速率为 0 表示不限流的约定一致
 func ConfigurableRateLimit(config *RateLimiterConfig) app.HandlerFunc {
-	limiter := NewRateLimiter(config)
-	limiter.Cleanup()
-
+	limiter, err := NewRateLimiter(config)
+	if err != nil {
+		logger.Error("限流配置无效，已跳过限流", zap.Error(err))
+		return passThrough
+	}
 	return limiter.Middleware()
 }
 
 // DefaultRateLimit 默认的限流中间件
 // 每个 IP 每秒最多 10 个请求，突发 20 个
 func DefaultRateLimit() app.HandlerFunc {
-	return PerIPRateLimit(10, 20)
+	return PerIPRateLimit("default", 10, 20)
 }
 
 // StrictRateLimit 严格的限流中间件
 // 每个 IP 每秒最多 5 个请求，突发 10 个
 func StrictRateLimit() app.HandlerFunc {
-	return PerIPRateLimit(5, 10)
+	return PerIPRateLimit("strict", 5, 10)
 }
 
 // LooseRateLimit 宽松的限流中间件
 // 每个 IP 每秒最多 100 个请求，突发 200 个
 func LooseRateLimit() app.HandlerFunc {
-	return PerIPRateLimit(100, 200)
+	return PerIPRateLimit("loose", 100, 200)
 }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+func TestNewRateLimiterRejectsInvalidRate(t *testing.T) {
+	for _, rps := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := NewRateLimiter(&RateLimiterConfig{RequestsPerSecond: rps}); err == nil {
+			t.Errorf("RequestsPerSecond=%v 未返回错误", rps)
+		}
+	}
+	if _, err := NewRateLimiter(&RateLimiterConfig{RequestsPerSecond: 0.5}); err != nil {
+		t.Fatalf("有效配置返回错误: %v", err)
+	}
+}
+
+func TestRateLimitNamesAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	c := app.NewContext(0)
+	c.Request.Header.Set("X-Real-IP", "192.0.2.1")
+
+	first, _ := NewRateLimiter(&RateLimiterConfig{Name: "test-a", RequestsPerSecond: 0.01, BurstSize: 1})
+	second, _ := NewRateLimiter(&RateLimiterConfig{Name: "test-b", RequestsPerSecond: 0.01, BurstSize: 1})
+
+	if !first.Allow(ctx, c) {
+		t.Fatal("第一个请求被拒绝")
+	}
+	if first.Allow(ctx, c) {
+		t.Fatal("超出突发额度的请求被放行")
+	}
+	// 不同名称的策略不共享计数
+	if !second.Allow(ctx, c) {
+		t.Fatal("另一策略的请求被拒绝")
+	}
+}
@@ -1,24 +1,26 @@
 import { request } from '@/utils/request'
 import type { ApiResponse, PaginatedResponse } from '@/types/common'
+import type { TwoFactorChallenge, LoginTokens } from '@/types/user'
 
 export const adminApi = {
-  // 管理员登录
+  // 管理员登录，开启两步验证时返回预认证令牌
   login: (data: { username: string; password: string }) => {
-    return request<ApiResponse<{
-      token: string
-      user: {
-        id: number
-        username: string
-        nickname: string
-        role: string
-      }
-    }>>({
+    return request<ApiResponse<LoginTokens | TwoFactorChallenge>>({
       url: '/admin/login',
       method: 'POST',
       data,
     })
   },
 
+  // 管理员登录第二步：提交两步验证码或恢复码
+  loginTwoFactor: (data: { pre_auth_token: string; code: string }) => {
+    return request<ApiResponse<LoginTokens & { recovery_codes?: string[] }>>({
+      url: '/admin/login/2fa',
+      method: 'POST',
+      data,
+    })
+  },
+
   // 获取系统统计
   getStats: () => {
     return request<ApiResponse<{
@@ -149,6 +151,14 @@ export const adminApi = {
     })
   },
 
+  // 重置用户的两步验证
+  resetUserTwoFactor: (id: number) => {
+    return request<ApiResponse<void>>({
+      url: `/admin/users/${id}/2fa`,
+      method: 'DELETE',
+    })
+  },
+
   // 批量更新用户状态（后端未实现，待后端实现后启用）
   batchUpdateUserStatus: (ids: number[], status: number) => {
     return request<ApiResponse<{ updated_count: number }>>({
@@ -280,6 +290,29 @@ export const adminApi = {
     })
   },
 
+  // 获取分享码查找防护的封禁列表
+  getLookupBlocks: () => {
+    return request<ApiResponse<Array<{
+      scope: 'ip' | 'prefix' | 'prefix_global'
+      subject: string
+      level: number
+      retry_after: number
+      expires_at: string
+    }>>>({
+      url: '/admin/maintenance/blocks',
+      method: 'GET'
+    })
+  },
+
+  // 解除封禁
+  clearLookupBlock: (scope: string, subject: string) => {
+    return request<ApiResponse<void>>({
+      url: '/admin/maintenance/blocks',
+      method: 'DELETE',
+      params: { scope, subject }
+    })
+  },
+
   // 清理孤立文件（后端未实现，待后端实现后启用）
   cleanOrphanFiles: () => {
     return request<ApiResponse<{ deleted_count: number }>>({
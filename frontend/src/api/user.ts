@@ -1,6 +1,6 @@
-import { request } from '@/utils/request'
+import { request, apiURL } from '@/utils/request'
 import type { ApiResponse } from '@/types/common'
-import type { UserInfo, UserStats } from '@/types/user'
+import type { UserInfo, UserStats, TwoFactorChallenge, TwoFactorSetup, TwoFactorStatus, LoginTokens, SessionInfo, OIDCProviders } from '@/types/user'
 
 export const userApi = {
   // 用户注册
@@ -9,6 +9,7 @@ export const userApi = {
     email: string
     password: string
     nickname?: string
+    invite_code?: string
   }) => {
     return request<ApiResponse<UserInfo>>({
       url: '/user/register',
@@ -17,15 +18,132 @@ export const userApi = {
     })
   },
 
-  // 用户登录
+  // 用户登录，开启两步验证时返回预认证令牌
   login: (data: { username: string; password: string }) => {
-    return request<ApiResponse<{ token: string; user: UserInfo }>>({
+    return request<ApiResponse<(LoginTokens & { user: UserInfo }) | TwoFactorChallenge>>({
       url: '/user/login',
       method: 'POST',
       data,
     })
   },
 
+  // 登录第二步：提交两步验证码或恢复码
+  loginTwoFactor: (data: { pre_auth_token: string; code: string }) => {
+    return request<ApiResponse<LoginTokens & { user: UserInfo; role?: string; recovery_codes?: string[] }>>({
+      url: '/user/login/2fa',
+      method: 'POST',
+      data,
+    })
+  },
+
+  // 获取单点登录方式，以及是否允许密码登录
+  getOIDCProviders: () => {
+    return request<ApiResponse<OIDCProviders>>({
+      url: '/user/oidc/providers',
+      method: 'GET',
+    })
+  },
+
+  // 单点登录入口地址，浏览器直接跳转，登录完成后回到 redirect
+  oidcLoginURL: (provider: string, redirect?: string) => {
+    const query = redirect ? `?redirect=${encodeURIComponent(redirect)}` : ''
+    return apiURL(`/user/oidc/${encodeURIComponent(provider)}/login${query}`)
+  },
+
+  // 使用单点登录回调得到的一次性代码换取登录令牌
+  oidcExchange: (code: string) => {
+    return request<ApiResponse<(LoginTokens & { user: UserInfo; role: string }) | TwoFactorChallenge>>({
+      url: '/user/oidc/exchange',
+      method: 'POST',
+      data: { code },
+    })
+  },
+
+  // 退出登录，注销当前会话
+  logout: () => {
+    return request<ApiResponse<void>>({
+      url: '/user/logout',
+      method: 'POST',
+    })
+  },
+
+  // 获取已登录的设备会话
+  getSessions: () => {
+    return request<ApiResponse<SessionInfo[]>>({
+      url: '/user/sessions',
+      method: 'GET',
+    })
+  },
+
+  // 注销指定会话
+  revokeSession: (id: string) => {
+    return request<ApiResponse<void>>({
+      url: `/user/sessions/${id}`,
+      method: 'DELETE',
+    })
+  },
+
+  // 注销全部会话，keepCurrent 为 true 时保留当前会话
+  revokeAllSessions: (keepCurrent = true) => {
+    return request<ApiResponse<{ revoked: number }>>({
+      url: '/user/sessions',
+      method: 'DELETE',
+      params: { keep_current: keepCurrent },
+    })
+  },
+
+  // 登录时绑定验证器（角色要求两步验证但尚未绑定）
+  loginTwoFactorSetup: (preAuthToken: string) => {
+    return request<ApiResponse<TwoFactorSetup>>({
+      url: '/user/login/2fa/setup',
+      method: 'POST',
+      data: { pre_auth_token: preAuthToken },
+    })
+  },
+
+  // 获取两步验证状态
+  getTwoFactorStatus: () => {
+    return request<ApiResponse<TwoFactorStatus>>({
+      url: '/user/2fa',
+      method: 'GET',
+    })
+  },
+
+  // 生成两步验证密钥和二维码
+  setupTwoFactor: () => {
+    return request<ApiResponse<TwoFactorSetup>>({
+      url: '/user/2fa/setup',
+      method: 'POST',
+    })
+  },
+
+  // 确认绑定，返回恢复码
+  enableTwoFactor: (code: string) => {
+    return request<ApiResponse<{ recovery_codes: string[] }>>({
+      url: '/user/2fa/enable',
+      method: 'POST',
+      data: { code },
+    })
+  },
+
+  // 关闭两步验证
+  disableTwoFactor: (data: { password: string; code: string }) => {
+    return request<ApiResponse<void>>({
+      url: '/user/2fa/disable',
+      method: 'POST',
+      data,
+    })
+  },
+
+  // 重新生成恢复码
+  regenerateRecoveryCodes: (code: string) => {
+    return request<ApiResponse<{ recovery_codes: string[] }>>({
+      url: '/user/2fa/recovery-codes',
+      method: 'POST',
+      data: { code },
+    })
+  },
+
   // 获取用户信息
   getUserInfo: () => {
     return request<ApiResponse<UserInfo>>({
@@ -61,6 +179,42 @@ export const userApi = {
     })
   },
 
+  // 发送邮箱验证邮件，未登录时需要提供邮箱
+  sendVerification: (data: { email?: string } = {}) => {
+    return request<ApiResponse<void>>({
+      url: '/user/email/verify/send',
+      method: 'POST',
+      data,
+    })
+  },
+
+  // 使用邮件中的令牌验证邮箱
+  verifyEmail: (token: string) => {
+    return request<ApiResponse<void>>({
+      url: '/user/email/verify',
+      method: 'POST',
+      data: { token },
+    })
+  },
+
+  // 发送重置密码邮件
+  forgotPassword: (email: string) => {
+    return request<ApiResponse<void>>({
+      url: '/user/password/forgot',
+      method: 'POST',
+      data: { email },
+    })
+  },
+
+  // 使用邮件中的令牌重置密码
+  resetPassword: (data: { token: string; new_password: string }) => {
+    return request<ApiResponse<void>>({
+      url: '/user/password/reset',
+      method: 'POST',
+      data,
+    })
+  },
+
   // 获取用户统计
   getUserStats: () => {
     return request<ApiResponse<UserStats>>({
@@ -26,6 +26,24 @@ const routes: RouteRecordRaw[] = [
     component: () => import('@/views/user/Register.vue'),
     meta: { title: '注册' },
   },
+  {
+    path: '/user/verify-email',
+    name: 'VerifyEmail',
+    component: () => import('@/views/user/VerifyEmail.vue'),
+    meta: { title: '验证邮箱' },
+  },
+  {
+    path: '/user/reset-password',
+    name: 'ResetPassword',
+    component: () => import('@/views/user/ResetPassword.vue'),
+    meta: { title: '重置密码' },
+  },
+  {
+    path: '/user/oidc-callback',
+    name: 'OidcCallback',
+    component: () => import('@/views/user/OidcCallback.vue'),
+    meta: { title: '单点登录' },
+  },
   {
     path: '/user/dashboard',
     name: 'UserDashboard',
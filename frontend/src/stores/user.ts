@@ -1,7 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { userApi } from '@/api/user'
-import type { UserInfo } from '@/types/user'
+import type { UserInfo, TwoFactorChallenge, LoginTokens } from '@/types/user'
 
 export const useUserStore = defineStore('user', () => {
   const token = ref<string>(localStorage.getItem('token') || '')
@@ -10,21 +10,82 @@ export const useUserStore = defineStore('user', () => {
   const isLoggedIn = computed(() => !!token.value)
   const isAdmin = computed(() => userInfo.value?.role === 'admin')
 
-  const login = async (username: string, password: string) => {
+  // 保存登录令牌，访问令牌过期后请求拦截器使用 refresh_token 自动续期
+  const setTokens = (data: LoginTokens) => {
+    token.value = data.token
+    localStorage.setItem('token', data.token)
+    localStorage.setItem('refresh_token', data.refresh_token)
+  }
+
+  const setSession = (data: LoginTokens & { user: UserInfo }) => {
+    setTokens(data)
+    userInfo.value = data.user
+  }
+
+  // 登录成功返回 null；需要两步验证时返回预认证信息，再调用 loginTwoFactor
+  const login = async (username: string, password: string): Promise<TwoFactorChallenge | null> => {
     const res = await userApi.login({ username, password })
     if (res.code === 200) {
-      token.value = res.data.token
-      userInfo.value = res.data.user
-      localStorage.setItem('token', res.data.token)
-      return true
+      if ('two_factor_required' in res.data) {
+        return res.data
+      }
+      setSession(res.data)
+      return null
+    }
+    throw new Error(res.message)
+  }
+
+  // 记录角色，管理员可直接进入管理后台
+  const rememberRole = (role?: string) => {
+    if (role === 'admin') {
+      localStorage.setItem('userRole', 'admin')
+    } else {
+      localStorage.removeItem('userRole')
+    }
+  }
+
+  // 登录第二步，登录时完成绑定会返回恢复码；单点登录时同时记录角色
+  const loginTwoFactor = async (preAuthToken: string, code: string, sso = false) => {
+    const res = await userApi.loginTwoFactor({ pre_auth_token: preAuthToken, code })
+    if (res.code === 200) {
+      if (sso) {
+        setSession({ ...res.data, user: { ...res.data.user, role: res.data.role } })
+        rememberRole(res.data.role)
+      } else {
+        setSession(res.data)
+      }
+      return res.data.recovery_codes
     }
     throw new Error(res.message)
   }
 
-  const logout = () => {
+  // 单点登录：用回调得到的一次性代码换取令牌；角色要求两步验证时返回预认证信息，再调用 loginTwoFactor
+  const loginWithSSO = async (code: string): Promise<TwoFactorChallenge | null> => {
+    const res = await userApi.oidcExchange(code)
+    if (res.code === 200) {
+      if ('two_factor_required' in res.data) {
+        return res.data
+      }
+      setSession({ ...res.data, user: { ...res.data.user, role: res.data.role } })
+      rememberRole(res.data.role)
+      return null
+    }
+    throw new Error(res.message)
+  }
+
+  // 退出登录：通知服务端注销当前会话，失败时也清除本地状态
+  const logout = async () => {
+    if (token.value) {
+      try {
+        await userApi.logout()
+      } catch {
+        // 会话可能已失效，忽略
+      }
+    }
     token.value = ''
     userInfo.value = null
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
   }
 
   const fetchUserInfo = async () => {
@@ -45,6 +106,9 @@ export const useUserStore = defineStore('user', () => {
     isLoggedIn,
     isAdmin,
     login,
+    loginTwoFactor,
+    loginWithSSO,
+    setTokens,
     logout,
     fetchUserInfo,
   }
@@ -18,6 +18,56 @@ export interface UserStats {
   file_count: number
 }
 
+// 密码校验通过后需要两步验证时登录接口返回的数据
+export interface TwoFactorChallenge {
+  two_factor_required: true
+  two_factor_enrolled: boolean
+  pre_auth_token: string
+  expires_in: number
+}
+
+export interface TwoFactorSetup {
+  secret: string
+  otpauth_url: string
+  qr_code: string
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean
+  required: boolean
+  recovery_codes_remaining: number
+}
+
+// 登录或刷新后签发的令牌，访问令牌过期后用 refresh_token 续期
+export interface LoginTokens {
+  token: string
+  token_type: string
+  expires_in: number
+  refresh_token: string
+}
+
+// 已登录的设备会话
+export interface SessionInfo {
+  id: string
+  ip: string
+  user_agent: string
+  created_at: string
+  last_used_at: string
+  expires_at: string
+  current: boolean
+}
+
+// 单点登录身份提供方
+export interface OIDCProvider {
+  name: string
+  display_name: string
+}
+
+export interface OIDCProviders {
+  providers: OIDCProvider[]
+  password_login_enabled: boolean
+}
+
 export interface LoginForm {
   username: string
   password: string
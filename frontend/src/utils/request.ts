@@ -1,5 +1,5 @@
 import axios from 'axios'
-import type { AxiosInstance, AxiosRequestConfig } from 'axios'
+import type { AxiosInstance, AxiosRequestConfig, InternalAxiosRequestConfig } from 'axios'
 import { ElMessage } from 'element-plus'
 
 const instance: AxiosInstance = axios.create({
@@ -7,6 +7,35 @@ const instance: AxiosInstance = axios.create({
   timeout: 30000,
 })
 
+// 这些接口返回 401 表示凭据错误，不尝试刷新令牌
+const noRefreshUrls = ['/user/login', '/admin/login', '/user/token/refresh', '/user/oidc/exchange']
+
+// 同一时间只发起一次刷新，并发的 401 请求共用结果
+let refreshing: Promise<string> | null = null
+
+// 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refresh_token')
+    refreshing = (refreshToken
+      ? instance.post('/user/token/refresh', { refresh_token: refreshToken }).then((res: any) => {
+          localStorage.setItem('token', res.data.token)
+          localStorage.setItem('refresh_token', res.data.refresh_token)
+          return res.data.token as string
+        })
+      : Promise.reject(new Error('no refresh token'))
+    ).finally(() => {
+      refreshing = null
+    })
+  }
+  return refreshing
+}
+
+const clearSession = () => {
+  localStorage.removeItem('token')
+  localStorage.removeItem('refresh_token')
+}
+
 // 请求拦截器
 instance.interceptors.request.use(
   (config) => {
@@ -26,16 +55,35 @@ instance.interceptors.response.use(
   (response) => {
     return response.data
   },
-  (error) => {
+  async (error) => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+    if (
+      error.response?.status === 401 &&
+      config &&
+      !config._retried &&
+      !noRefreshUrls.includes(config.url || '') &&
+      localStorage.getItem('refresh_token')
+    ) {
+      config._retried = true
+      try {
+        const token = await refreshAccessToken()
+        config.headers.Authorization = `Bearer ${token}`
+        return instance.request(config)
+      } catch {
+        // 刷新请求本身的错误已由拦截器处理（清除登录状态并跳转登录页）
+        return Promise.reject(error)
+      }
+    }
+
     if (error.response) {
       switch (error.response.status) {
         case 401:
           ElMessage.error('未授权，请重新登录')
-          localStorage.removeItem('token')
+          clearSession()
           window.location.href = '/user/login'
           break
         case 403:
-          ElMessage.error('拒绝访问')
+          ElMessage.error(error.response.data?.message || '拒绝访问')
           break
         case 404:
           ElMessage.error('请求资源不存在')
@@ -57,4 +105,9 @@ export const request = <T = any>(config: AxiosRequestConfig): Promise<T> => {
   return instance.request<any, T>(config)
 }
 
+// 后端接口的完整地址，用于需要浏览器直接跳转的接口（如单点登录）
+export const apiURL = (path: string): string => {
+  return (instance.defaults.baseURL || '') + path
+}
+
 export default instance